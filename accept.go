@@ -0,0 +1,129 @@
+package minimux
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WithAccept limits a handler to requests whose Accept header accepts one of a set of media types, such as
+// "text/html" or "application/json", so that browsers and API clients requesting the same path can be given
+// different representations by different routes. Where several routes for the same pattern use WithAccept,
+// a route only handles a request if none of the others offers a media type the request prefers, by its q-values,
+// with ties going to the first route. Requests without an Accept header accept anything. Requests it does not
+// accept continue on to the next matching route, which can be NotAcceptable to answer them with 406 Not Acceptable.
+func (r *Route) WithAccept(mediaTypes ...string) *Route {
+	r.Accept = append(r.Accept, mediaTypes...)
+	return r
+}
+
+// NotAcceptable is a handler that returns a 406 status and does nothing else, such as for a route after those
+// using WithAccept, for requests which accept none of their media types
+var NotAcceptable Handler = HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	w.WriteHeader(http.StatusNotAcceptable)
+	return nil
+})
+
+// mediaRange is one of the media ranges of an Accept header, such as "text/*;q=0.5"
+type mediaRange struct {
+	typ, subtype string
+	quality      float64
+}
+
+// parseAccept parses the media ranges of the Accept headers of a request, skipping any which are invalid
+func parseAccept(header http.Header) []mediaRange {
+	var ranges []mediaRange
+	for _, accept := range header.Values("Accept") {
+		for _, field := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(field)
+			if err != nil {
+				continue
+			}
+			typ, subtype, ok := strings.Cut(mediaType, "/")
+			if !ok || (typ == "*" && subtype != "*") {
+				continue
+			}
+			quality := 1.0
+			if q, ok := params["q"]; ok {
+				if quality, err = strconv.ParseFloat(q, 64); err != nil || quality < 0 || quality > 1 {
+					continue
+				}
+			}
+			ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, quality: quality})
+		}
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality of a media type given by the most specific of the media ranges matching it,
+// or 0 if none do
+func acceptQuality(ranges []mediaRange, mediaType string) float64 {
+	typ, subtype, _ := strings.Cut(strings.ToLower(mediaType), "/")
+	quality, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := 0
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*":
+		default:
+			continue
+		}
+		if s > specificity {
+			quality, specificity = r.quality, s
+		}
+	}
+	return quality
+}
+
+// accepts returns true if a request accepts one of the Accept media types of this route
+// at least as much as any media type of the routes for the same pattern
+func (r *Route) accepts(req *http.Request) bool {
+	if len(req.Header.Values("Accept")) == 0 {
+		return true
+	}
+	ranges := parseAccept(req.Header)
+	best := 0.0
+	for _, mediaType := range r.Accept {
+		best = max(best, acceptQuality(ranges, mediaType))
+	}
+	if best == 0 {
+		return false
+	}
+	for _, mediaType := range r.acceptRivals {
+		if acceptQuality(ranges, mediaType) > best {
+			return false
+		}
+	}
+	return true
+}
+
+// linkAcceptRivals records, for each route with the same pattern as any route using WithAccept,
+// the media types offered by the others, so that they can negotiate which one handles a request
+func linkAcceptRivals(routes []Route) {
+	offered := map[string][]int{}
+	for ix := range routes {
+		if routes[ix].Matcher == nil && len(routes[ix].Accept) != 0 {
+			pattern := routes[ix].Pattern.String()
+			offered[pattern] = append(offered[pattern], ix)
+		}
+	}
+	if len(offered) == 0 {
+		return
+	}
+	for ix := range routes {
+		r := &routes[ix]
+		if r.Matcher != nil {
+			continue
+		}
+		for _, other := range offered[r.Pattern.String()] {
+			if other != ix {
+				r.acceptRivals = append(r.acceptRivals, routes[other].Accept...)
+			}
+		}
+	}
+}
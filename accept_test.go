@@ -0,0 +1,46 @@
+package minimux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Routes with Accept media types", func() {
+	mux := &minimux.Mux{
+		MatchCacheSize: 10,
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/users").WithAccept("text/html").IsHandledBy(minimux.NewStaticString("html", "text/html")),
+			minimux.LiteralPath("/users").WithAccept("application/json", "application/problem+json").IsHandledBy(minimux.NewStaticString("json", "application/json")),
+			minimux.LiteralPath("/users").IsHandledBy(minimux.NotAcceptable),
+		},
+	}
+
+	DescribeTable("should choose the representation the client prefers",
+		func(accept []string, expectedStatus int, expectedBody string) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			for _, value := range accept {
+				req.Header.Add("Accept", value)
+			}
+			resp := serve(mux, req)
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+			Expect(resp.Header().Values("Vary")).To(ContainElement("Accept"))
+		},
+		Entry("no Accept header", nil, http.StatusOK, "html"),
+		Entry("browser", []string{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}, http.StatusOK, "html"),
+		Entry("API client", []string{"application/json"}, http.StatusOK, "json"),
+		Entry("second media type", []string{"application/problem+json"}, http.StatusOK, "json"),
+		Entry("lower quality first", []string{"text/html;q=0.5, application/json"}, http.StatusOK, "json"),
+		Entry("by type wildcard", []string{"application/*"}, http.StatusOK, "json"),
+		Entry("more specific range wins", []string{"*/*;q=0.9, text/html;q=0.1"}, http.StatusOK, "json"),
+		Entry("tie goes to the first route", []string{"*/*"}, http.StatusOK, "html"),
+		Entry("several headers", []string{"text/plain", "application/json;q=0.5"}, http.StatusOK, "json"),
+		Entry("explicitly refused", []string{"text/html;q=0, application/json;q=0"}, http.StatusNotAcceptable, ""),
+		Entry("nothing offered", []string{"image/png"}, http.StatusNotAcceptable, ""),
+	)
+})
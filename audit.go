@@ -0,0 +1,68 @@
+package minimux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// AuthDecision is the outcome of authenticating or authorizing a request
+type AuthDecision struct {
+	// Authenticator is what made the decision, e.g. IdentityMethodOIDC
+	Authenticator string
+	// Identity is who made the request, or nil if they could not be identified
+	Identity *Identity
+	// Request is the request which was allowed or denied
+	Request *http.Request
+	// Route is the route which made the decision, such as with WithClientCert or WithPolicy,
+	// or nil if it was made by a handler, which may be shared by several routes
+	Route *Route
+	// Allowed is true if the request was allowed to continue
+	Allowed bool
+	// Reason is why the request was allowed or denied
+	Reason string
+}
+
+// An AuthAuditor records authentication and authorization decisions
+type AuthAuditor func(ctx context.Context, decision AuthDecision)
+
+// AuthAuditors returns an AuthAuditor which calls each of a set of auditors in order
+func AuthAuditors(auditors ...AuthAuditor) AuthAuditor {
+	return func(ctx context.Context, decision AuthDecision) {
+		for _, auditor := range auditors {
+			auditor(ctx, decision)
+		}
+	}
+}
+
+// LogAuthDecisions returns an AuthAuditor that logs the authenticator, decision, identity, method, url,
+// and reason of each decision, with the URL redacted by DefaultRedactor
+func LogAuthDecisions(w io.Writer) AuthAuditor {
+	return func(ctx context.Context, decision AuthDecision) {
+		verdict := "deny"
+		if decision.Allowed {
+			verdict = "allow"
+		}
+		fmt.Fprintf(w, "%s %s %s %s %s %s\n", decision.Authenticator, verdict, decision.Identity, decision.Request.Method, DefaultRedactor.URL(decision.Request.URL), decision.Reason)
+	}
+}
+
+type authAuditorKey struct{}
+
+// AuditAuthDecisions returns a PreProcessor which has every authentication and authorization decision
+// made while handling a request, by the built-in authenticators and any others which call AuditAuthDecision,
+// recorded by an AuthAuditor
+func AuditAuthDecisions(auditor AuthAuditor) PreProcessor {
+	return func(ctx context.Context, req *http.Request) (context.Context, func()) {
+		return context.WithValue(ctx, authAuditorKey{}, auditor), nil
+	}
+}
+
+// AuditAuthDecision records an authentication or authorization decision with the AuthAuditor
+// of the context, if any. Authenticators should call this for every request they allow or deny.
+func AuditAuthDecision(ctx context.Context, decision AuthDecision) {
+	if auditor, ok := ctx.Value(authAuditorKey{}).(AuthAuditor); ok {
+		auditor(ctx, decision)
+	}
+}
@@ -0,0 +1,58 @@
+package minimux_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AuditAuthDecisions", func() {
+	It("should record the decisions of every authenticator", func() {
+		var decisions []minimux.AuthDecision
+		var log bytes.Buffer
+		mux := &minimux.Mux{
+			PreProcess: minimux.AuditAuthDecisions(minimux.AuthAuditors(
+				func(ctx context.Context, decision minimux.AuthDecision) {
+					decisions = append(decisions, decision)
+				},
+				minimux.LogAuthDecisions(&log),
+			)),
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/admin").Named("admin").WithClientCert(func(cert *x509.Certificate) bool { return cert.Subject.CommonName == "admin" }).IsHandledBy(minimux.NewStaticString("admin", "text/plain")),
+				minimux.LiteralPath("/hook").IsHandledBy((&minimux.WebhookSignatures{Scheme: minimux.GitHubWebhooks}).Require(minimux.NotFound)),
+			},
+		}
+		for _, commonName := range []string{"admin", "guest"} {
+			req := httptest.NewRequest(http.MethodGet, "https://localhost/admin", nil)
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}}}
+			serve(mux, req)
+		}
+		serve(mux, httptest.NewRequest(http.MethodPost, "https://localhost/hook", nil))
+
+		Expect(decisions).To(HaveLen(3))
+		Expect(decisions[0].Allowed).To(BeTrue())
+		Expect(decisions[0].Identity.Name).To(Equal("admin"))
+		Expect(decisions[1].Allowed).To(BeFalse())
+		Expect(decisions[1].Identity.Name).To(Equal("guest"))
+		Expect(decisions[0].Route.Name).To(Equal("admin"))
+		Expect(decisions[1].Route.Name).To(Equal("admin"))
+		Expect(decisions[2].Authenticator).To(Equal(minimux.IdentityMethodWebhookSignature))
+		Expect(decisions[2].Allowed).To(BeFalse())
+		Expect(decisions[2].Identity).To(BeNil())
+		Expect(decisions[2].Route).To(BeNil())
+		Expect(log.String()).To(Equal(
+			"client-cert allow admin (client-cert) GET https://localhost/admin client certificate accepted\n" +
+				"client-cert deny guest (client-cert) GET https://localhost/admin client certificate not accepted\n" +
+				"webhook-signature deny <anonymous> POST https://localhost/hook missing webhook signature\n",
+		))
+	})
+})
@@ -0,0 +1,179 @@
+package minimux
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// BindError is the reason one value of a request could not be bound to a field by Bind
+type BindError struct {
+	// Source is where the value came from, one of "path", "query", "form", or "body"
+	Source string
+	// Name is the name of the value in its source, such as the path variable or query parameter, or empty for the body
+	Name string
+	// Err is why the value could not be bound
+	Err error
+}
+
+// Error implements error
+func (e *BindError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Source, e.Name, e.Err)
+}
+
+// Unwrap returns the reason the value could not be bound
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// Bind populates the fields of the struct pointed to by dst from every part of a request, by their tags:
+// `path:"id"` from a route variable, `query:"page"` from a query parameter, `form:"email"` from the parsed form,
+// and, if the request has a body with a Content-Type a Codec decodes, any fields it would decode, such as those
+// tagged `json:"name"` or `xml:"name"`. The Codecs of the Mux are used if the request has its context.
+// Values are bound in that order, from last to first, so that route variables take precedence.
+// Fields may be strings, bools, integers, floats, implementations of encoding.TextUnmarshaler, or slices of those,
+// which are bound to every value of a query parameter or form field, and fields of embedded structs are bound too.
+// If any value cannot be bound, the others still are, and the error wraps ErrBadRequest and a BindError for each.
+// Otherwise, the struct is checked by its Validate method, if it is a Validator, and the ValidateInput of the Mux,
+// if the request has its context, such as by calling req.WithContext(ctx) in a Handler, and any error wraps
+// ErrUnprocessableEntity, and lists the FieldErrors it wraps in its message.
+func Bind(req *http.Request, pathVars map[string]string, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind: destination must be a non-nil pointer to a struct, not %T", dst)
+	}
+	var errs []error
+	if req.Header.Get("Content-Type") != "" {
+		if c, ok := requestCodec(req, codecsFromContext(req.Context())); ok && codecSupports(c, dst) {
+			if err := decodeBody(c, req, dst); err != nil {
+				errs = append(errs, &BindError{Source: "body", Err: err})
+			}
+		}
+	}
+	if hasTag(v.Elem().Type(), "form") {
+		if err := req.ParseForm(); err != nil {
+			errs = append(errs, &BindError{Source: "form", Err: err})
+		}
+	}
+	query := req.URL.Query()
+	sources := []struct {
+		tag    string
+		values func(name string) ([]string, bool)
+	}{
+		{tag: "form", values: func(name string) ([]string, bool) { values, ok := req.PostForm[name]; return values, ok }},
+		{tag: "query", values: func(name string) ([]string, bool) { values, ok := query[name]; return values, ok }},
+		{tag: "path", values: func(name string) ([]string, bool) { value, ok := pathVars[name]; return []string{value}, ok }},
+	}
+	for _, source := range sources {
+		errs = append(errs, bindValues(v.Elem(), source.tag, source.values)...)
+	}
+	if len(errs) != 0 {
+		return ErrBadRequest.WithInternal(errors.Join(errs...))
+	}
+	return validateInput(req.Context(), dst)
+}
+
+// hasTag returns true if any field of a struct type, or of the structs it embeds, has a tag
+func hasTag(t reflect.Type, tag string) bool {
+	for ix := 0; ix < t.NumField(); ix++ {
+		field := t.Field(ix)
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return true
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && hasTag(field.Type, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// bindValues binds the fields of a struct with a tag to the values from a source, by the names in their tags
+func bindValues(v reflect.Value, tag string, values func(name string) ([]string, bool)) (errs []error) {
+	t := v.Type()
+	for ix := 0; ix < t.NumField(); ix++ {
+		field := t.Field(ix)
+		name, ok := field.Tag.Lookup(tag)
+		if !ok {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				errs = append(errs, bindValues(v.Field(ix), tag, values)...)
+			}
+			continue
+		}
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		found, ok := values(name)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(ix), found); err != nil {
+			errs = append(errs, &BindError{Source: tag, Name: name, Err: err})
+		}
+	}
+	return errs
+}
+
+// textUnmarshalerType is the type of encoding.TextUnmarshaler
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// setField sets a field to a list of values, all of them if it is a slice, or the first otherwise
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && !reflect.PointerTo(field.Type()).Implements(textUnmarshalerType) {
+		elems := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for ix, value := range values {
+			if err := setValue(elems.Index(ix), value); err != nil {
+				return err
+			}
+		}
+		field.Set(elems)
+		return nil
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return setValue(field, values[0])
+}
+
+// setValue parses a value into a field according to its type
+func setValue(field reflect.Value, value string) error {
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package minimux_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type bindPage struct {
+	Page int    `query:"page"`
+	Sort string `query:"sort"`
+}
+
+type bindTarget struct {
+	bindPage
+	ID     int64      `path:"id" json:"-"`
+	Name   string     `json:"name"`
+	Tags   []string   `query:"tag"`
+	Email  string     `form:"email"`
+	Active bool       `query:"active"`
+	Addr   netip.Addr `query:"addr"`
+	Ratio  float64    `form:"ratio"`
+}
+
+var _ = Describe("Bind", func() {
+	It("should bind every source", func() {
+		req := httptest.NewRequest(http.MethodPost, "/users/42?page=3&sort=name&tag=a&tag=b&active=true&addr=192.0.2.1", strings.NewReader(`{"name":"bob"}`))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		var dst bindTarget
+		Expect(minimux.Bind(req, map[string]string{"id": "42"}, &dst)).To(Succeed())
+		Expect(dst).To(Equal(bindTarget{
+			bindPage: bindPage{Page: 3, Sort: "name"},
+			ID:       42,
+			Name:     "bob",
+			Tags:     []string{"a", "b"},
+			Active:   true,
+			Addr:     netip.MustParseAddr("192.0.2.1"),
+		}))
+	})
+
+	It("should bind forms", func() {
+		req := httptest.NewRequest(http.MethodPost, "/users/42?email=ignored", strings.NewReader("email=bob%40example.com&ratio=0.5"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		var dst bindTarget
+		Expect(minimux.Bind(req, nil, &dst)).To(Succeed())
+		Expect(dst.Email).To(Equal("bob@example.com"))
+		Expect(dst.Ratio).To(Equal(0.5))
+	})
+
+	It("should bind XML bodies", func() {
+		req := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader(`<user><Name>bob</Name></user>`))
+		req.Header.Set("Content-Type", "application/xml")
+		var dst bindTarget
+		Expect(minimux.Bind(req, map[string]string{"id": "42"}, &dst)).To(Succeed())
+		Expect(dst.ID).To(Equal(int64(42)))
+		Expect(dst.Name).To(Equal("bob"))
+	})
+
+	It("should report every invalid value as a bad request", func() {
+		req := httptest.NewRequest(http.MethodPost, "/users/x?page=one&active=maybe", strings.NewReader(`{"name":`))
+		req.Header.Set("Content-Type", "application/json")
+		var dst bindTarget
+		err := minimux.Bind(req, map[string]string{"id": "x"}, &dst)
+		Expect(minimux.StatusOf(err)).To(Equal(http.StatusBadRequest))
+		var names []string
+		for _, err := range err.(*minimux.HTTPError).Internal.(interface{ Unwrap() []error }).Unwrap() {
+			var bindErr *minimux.BindError
+			Expect(errors.As(err, &bindErr)).To(BeTrue())
+			names = append(names, bindErr.Source+" "+bindErr.Name)
+		}
+		Expect(names).To(ConsistOf("body ", "query page", "query active", "path id"))
+	})
+
+	It("should reject destinations which are not pointers to structs", func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		var dst bindTarget
+		Expect(minimux.Bind(req, nil, dst)).To(MatchError(ContainSubstring("pointer to a struct")))
+	})
+})
@@ -0,0 +1,252 @@
+package minimux
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBreakerFailureRate is the fraction of failed requests which opens a CircuitBreaker, if its FailureRate is not set
+	DefaultBreakerFailureRate = 0.5
+	// DefaultBreakerMinRequests is how many requests a CircuitBreaker must see in a window before it can open,
+	// if its MinRequests is not set
+	DefaultBreakerMinRequests = 10
+	// DefaultBreakerWindow is how long a CircuitBreaker counts failures for, if its Window is not set
+	DefaultBreakerWindow = 10 * time.Second
+	// DefaultBreakerOpenDuration is how long a CircuitBreaker stays open before trying again, if its OpenDuration is not set
+	DefaultBreakerOpenDuration = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned when a request is not sent because a CircuitBreaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests through, while counting failures
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails all requests immediately
+	CircuitOpen
+	// CircuitHalfOpen lets a trial request through to decide whether to close or open again
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "CircuitState(" + strconv.Itoa(int(s)) + ")"
+}
+
+// A CircuitBreaker stops sending requests to a failing backend, such as one behind a proxy, so that requests fail
+// fast instead of piling up timeouts. Once enough requests in a window have failed, it opens, failing every request,
+// until, after a cooldown, it lets a single trial request through, closing again if it succeeds.
+// The same CircuitBreaker can protect a Handler, with Protect, and an outgoing transport, with Transport.
+type CircuitBreaker struct {
+	// FailureRate is the fraction of failed requests in a window which opens the breaker.
+	// If zero, DefaultBreakerFailureRate is used.
+	FailureRate float64
+	// MinRequests is how many requests must be seen in a window before the breaker can open.
+	// If zero, DefaultBreakerMinRequests is used.
+	MinRequests int
+	// Window is how long failures are counted for before the counts start again. If zero, DefaultBreakerWindow is used.
+	Window time.Duration
+	// OpenDuration is how long the breaker stays open. If zero, DefaultBreakerOpenDuration is used.
+	OpenDuration time.Duration
+	// Failed returns true if a request failed, given its status code, or error if it has none.
+	// If nil, errors and 5xx statuses are failures.
+	Failed func(statusCode int, err error) bool
+	// OnStateChange is an optional function called whenever the state changes, such as to log it. It must not block.
+	OnStateChange func(from, to CircuitState)
+
+	lock        sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trial       bool
+}
+
+// State returns the current state
+func (c *CircuitBreaker) State() CircuitState {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cooldown(time.Now())
+	return c.state
+}
+
+func (c *CircuitBreaker) setState(state CircuitState) {
+	if c.state == state {
+		return
+	}
+	from := c.state
+	c.state = state
+	if c.OnStateChange != nil {
+		c.OnStateChange(from, state)
+	}
+}
+
+// cooldown moves an open breaker to half-open once it has been open long enough
+func (c *CircuitBreaker) cooldown(now time.Time) {
+	openDuration := c.OpenDuration
+	if openDuration == 0 {
+		openDuration = DefaultBreakerOpenDuration
+	}
+	if c.state == CircuitOpen && now.Sub(c.openedAt) >= openDuration {
+		c.setState(CircuitHalfOpen)
+		c.trial = false
+	}
+}
+
+// retryAfter returns how long until the breaker will let a request through
+func (c *CircuitBreaker) retryAfter() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	openDuration := c.OpenDuration
+	if openDuration == 0 {
+		openDuration = DefaultBreakerOpenDuration
+	}
+	return max(time.Until(c.openedAt.Add(openDuration)), time.Second)
+}
+
+// allow returns true if a request may be sent, and, if so, whether it is a trial
+func (c *CircuitBreaker) allow() (allowed bool, trial bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	c.cooldown(now)
+	switch c.state {
+	case CircuitOpen:
+		return false, false
+	case CircuitHalfOpen:
+		if c.trial {
+			return false, false
+		}
+		c.trial = true
+		return true, true
+	}
+	window := c.Window
+	if window == 0 {
+		window = DefaultBreakerWindow
+	}
+	if now.Sub(c.windowStart) >= window {
+		c.windowStart = now
+		c.requests = 0
+		c.failures = 0
+	}
+	return true, false
+}
+
+// record records the result of an allowed request
+func (c *CircuitBreaker) record(trial bool, failed bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if trial {
+		c.trial = false
+		if failed {
+			c.open()
+		} else {
+			c.requests, c.failures, c.windowStart = 0, 0, time.Now()
+			c.setState(CircuitClosed)
+		}
+		return
+	}
+	if c.state != CircuitClosed {
+		return
+	}
+	c.requests++
+	if failed {
+		c.failures++
+	}
+	minRequests := c.MinRequests
+	if minRequests == 0 {
+		minRequests = DefaultBreakerMinRequests
+	}
+	failureRate := c.FailureRate
+	if failureRate == 0 {
+		failureRate = DefaultBreakerFailureRate
+	}
+	if c.requests >= minRequests && float64(c.failures) >= failureRate*float64(c.requests) {
+		c.open()
+	}
+}
+
+func (c *CircuitBreaker) open() {
+	c.openedAt = time.Now()
+	c.setState(CircuitOpen)
+}
+
+func (c *CircuitBreaker) failed(statusCode int, err error) bool {
+	if c.Failed != nil {
+		return c.Failed(statusCode, err)
+	}
+	return err != nil || statusCode >= http.StatusInternalServerError
+}
+
+// Protect returns a handler which calls another while the breaker is not open, and answers requests
+// with 503 Service Unavailable and a Retry-After header while it is
+func (c *CircuitBreaker) Protect(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		allowed, trial := c.allow()
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int((c.retryAfter()+time.Second-1)/time.Second)))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return nil
+		}
+		// A panic counts as a failure
+		failed := true
+		defer func() { c.record(trial, failed) }()
+		snoopW := &snoopingResponseWriter{inner: w}
+		err := next.ServeHTTP(ctx, snoopW, req, pathVars, formErr)
+		statusCode := snoopW.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		failed = c.failed(statusCode, err)
+		return err
+	})
+}
+
+// Transport returns a transport which sends requests with another while the breaker is not open,
+// and returns ErrCircuitOpen while it is
+func (c *CircuitBreaker) Transport(inner http.RoundTripper) http.RoundTripper {
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+	return breakerTransport{breaker: c, inner: inner}
+}
+
+type breakerTransport struct {
+	breaker *CircuitBreaker
+	inner   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	allowed, trial := t.breaker.allow()
+	if !allowed {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, ErrCircuitOpen
+	}
+	resp, err := t.inner.RoundTrip(req)
+	var statusCode int
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+	t.breaker.record(trial, t.breaker.failed(statusCode, err))
+	return resp, err
+}
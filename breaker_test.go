@@ -0,0 +1,79 @@
+package minimux_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	var breaker *minimux.CircuitBreaker
+	var transitions []string
+	BeforeEach(func() {
+		transitions = nil
+		breaker = &minimux.CircuitBreaker{
+			MinRequests:  4,
+			OpenDuration: 50 * time.Millisecond,
+			OnStateChange: func(from, to minimux.CircuitState) {
+				transitions = append(transitions, to.String())
+			},
+		}
+	})
+
+	It("should fail fast while the handler is failing, and recover once it succeeds", func() {
+		healthy := false
+		calls := 0
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/").IsHandledBy(breaker.Protect(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					calls++
+					if !healthy {
+						w.WriteHeader(http.StatusBadGateway)
+					}
+					return nil
+				}))),
+			},
+		}
+		get := func() *httptest.ResponseRecorder {
+			return serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+		}
+		for ix := 0; ix < 4; ix++ {
+			Expect(get().Code).To(Equal(http.StatusBadGateway))
+		}
+		Expect(breaker.State()).To(Equal(minimux.CircuitOpen))
+		resp := get()
+		Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(resp.Header().Get("Retry-After")).To(Equal("1"))
+		Expect(calls).To(Equal(4))
+
+		Eventually(breaker.State).Should(Equal(minimux.CircuitHalfOpen))
+		Expect(get().Code).To(Equal(http.StatusBadGateway))
+		Expect(breaker.State()).To(Equal(minimux.CircuitOpen))
+
+		healthy = true
+		Eventually(breaker.State).Should(Equal(minimux.CircuitHalfOpen))
+		Expect(get().Code).To(Equal(http.StatusOK))
+		Expect(breaker.State()).To(Equal(minimux.CircuitClosed))
+		Expect(transitions).To(Equal([]string{"open", "half-open", "open", "half-open", "closed"}))
+	})
+
+	It("should stop sending outgoing requests to a dead backend", func() {
+		backend := httptest.NewServer(http.NotFoundHandler())
+		backend.Close()
+		client := &http.Client{Transport: breaker.Transport(nil)}
+		for ix := 0; ix < 4; ix++ {
+			_, err := client.Get(backend.URL)
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, minimux.ErrCircuitOpen)).To(BeFalse())
+		}
+		_, err := client.Get(backend.URL)
+		Expect(errors.Is(err, minimux.ErrCircuitOpen)).To(BeTrue())
+	})
+})
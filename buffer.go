@@ -0,0 +1,233 @@
+package minimux
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// bufferClasses are the capacities of pooled buffers. Buffers which grow beyond the largest are not pooled.
+var bufferClasses = [...]int{4 << 10, 64 << 10, 1 << 20}
+
+var bufferPools [len(bufferClasses)]sync.Pool
+
+// getBuffer returns an empty buffer from the pool with at least a given capacity, if possible
+func getBuffer(sizeHint int) *bytes.Buffer {
+	for ix, size := range bufferClasses {
+		if sizeHint > size {
+			continue
+		}
+		if buf, ok := bufferPools[ix].Get().(*bytes.Buffer); ok {
+			return buf
+		}
+		buf := &bytes.Buffer{}
+		buf.Grow(size)
+		return buf
+	}
+	buf := &bytes.Buffer{}
+	buf.Grow(sizeHint)
+	return buf
+}
+
+// putBuffer returns a buffer to the pool of the largest class it can hold, unless it has grown too large to keep
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > 2*bufferClasses[len(bufferClasses)-1] {
+		return
+	}
+	buf.Reset()
+	for ix := len(bufferClasses) - 1; ix >= 0; ix-- {
+		if buf.Cap() >= bufferClasses[ix] {
+			bufferPools[ix].Put(buf)
+			return
+		}
+	}
+}
+
+// DefaultSpillThreshold is the number of bytes a SpillBuffer holds in memory if none is specified
+const DefaultSpillThreshold = 1 << 20
+
+// A SpillBuffer holds data in a pooled memory buffer until it exceeds a threshold,
+// after which it is moved to a temporary file. A SpillBuffer must be closed to release its
+// memory and remove its file.
+type SpillBuffer struct {
+	// Threshold is the maximum number of bytes to hold in memory. If zero, DefaultSpillThreshold is used.
+	Threshold int
+	// TempDir is the directory to create the temporary file in. If empty, os.TempDir() is used.
+	TempDir string
+
+	mem  *bytes.Buffer
+	file *os.File
+	size int64
+}
+
+// NewSpillBuffer returns an empty buffer which moves to a temporary file once it exceeds a threshold
+func NewSpillBuffer(threshold int) *SpillBuffer {
+	return &SpillBuffer{Threshold: threshold}
+}
+
+func (b *SpillBuffer) threshold() int {
+	if b.Threshold == 0 {
+		return DefaultSpillThreshold
+	}
+	return b.Threshold
+}
+
+// Write implements io.Writer
+func (b *SpillBuffer) Write(p []byte) (int, error) {
+	if b.file == nil && int(b.size)+len(p) > b.threshold() {
+		if err := b.spill(); err != nil {
+			return 0, err
+		}
+	}
+	if b.file != nil {
+		n, err := b.file.Write(p)
+		b.size += int64(n)
+		return n, err
+	}
+	if b.mem == nil {
+		b.mem = getBuffer(len(p))
+	}
+	n, err := b.mem.Write(p)
+	b.size += int64(n)
+	return n, err
+}
+
+// spill moves the contents of the buffer to a temporary file
+func (b *SpillBuffer) spill() error {
+	file, err := os.CreateTemp(b.TempDir, "minimux-buffer-*")
+	if err != nil {
+		return err
+	}
+	if b.mem != nil {
+		_, err = file.Write(b.mem.Bytes())
+		putBuffer(b.mem)
+		b.mem = nil
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return err
+		}
+	}
+	b.file = file
+	return nil
+}
+
+// Len returns the number of bytes written to the buffer
+func (b *SpillBuffer) Len() int64 {
+	return b.size
+}
+
+// Spilled returns true if the buffer has been moved to a temporary file
+func (b *SpillBuffer) Spilled() bool {
+	return b.file != nil
+}
+
+// Reader returns a reader for the contents of the buffer, starting from the beginning.
+// Multiple readers may be used concurrently, but the buffer must not be written to or closed while they are in use.
+func (b *SpillBuffer) Reader() io.Reader {
+	if b.file != nil {
+		return io.NewSectionReader(b.file, 0, b.size)
+	}
+	if b.mem == nil {
+		return bytes.NewReader(nil)
+	}
+	return bytes.NewReader(b.mem.Bytes())
+}
+
+// WriteTo implements io.WriterTo by writing the contents of the buffer, leaving them intact
+func (b *SpillBuffer) WriteTo(w io.Writer) (int64, error) {
+	if b.file == nil {
+		if b.mem == nil {
+			return 0, nil
+		}
+		n, err := w.Write(b.mem.Bytes())
+		return int64(n), err
+	}
+	return io.Copy(w, b.Reader())
+}
+
+// Close releases the memory of the buffer and removes its temporary file, if any
+func (b *SpillBuffer) Close() error {
+	if b.mem != nil {
+		putBuffer(b.mem)
+		b.mem = nil
+	}
+	b.size = 0
+	if b.file == nil {
+		return nil
+	}
+	file := b.file
+	b.file = nil
+	err := file.Close()
+	if removeErr := os.Remove(file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// A BufferedResponseWriter is a ResponseWriter which records the status, headers, and body of a response
+// instead of sending them, so that they can be inspected or replaced before calling SendTo.
+// Close must be called to release the body.
+type BufferedResponseWriter struct {
+	// StatusCode is the status code passed to WriteHeader, or zero if it was not called
+	StatusCode int
+	// Body is the body of the response
+	Body *SpillBuffer
+
+	header http.Header
+}
+
+var _ = http.ResponseWriter(&BufferedResponseWriter{})
+
+// NewBufferedResponseWriter returns an empty BufferedResponseWriter whose body moves to a temporary file
+// if it exceeds a threshold
+func NewBufferedResponseWriter(threshold int) *BufferedResponseWriter {
+	return &BufferedResponseWriter{
+		Body:   NewSpillBuffer(threshold),
+		header: http.Header{},
+	}
+}
+
+// Header implements http.ResponseWriter
+func (b *BufferedResponseWriter) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader implements http.ResponseWriter
+func (b *BufferedResponseWriter) WriteHeader(statusCode int) {
+	if b.StatusCode != 0 {
+		return
+	}
+	b.StatusCode = statusCode
+}
+
+// Write implements http.ResponseWriter
+func (b *BufferedResponseWriter) Write(p []byte) (int, error) {
+	if b.StatusCode == 0 {
+		b.StatusCode = http.StatusOK
+	}
+	return b.Body.Write(p)
+}
+
+// SendTo writes the recorded headers, status, and body to another ResponseWriter.
+// It may be called more than once.
+func (b *BufferedResponseWriter) SendTo(w http.ResponseWriter) error {
+	header := w.Header()
+	for k, v := range b.header {
+		header[k] = append([]string(nil), v...)
+	}
+	statusCode := b.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	w.WriteHeader(statusCode)
+	_, err := b.Body.WriteTo(w)
+	return err
+}
+
+// Close releases the body
+func (b *BufferedResponseWriter) Close() error {
+	return b.Body.Close()
+}
@@ -0,0 +1,67 @@
+package minimux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SpillBuffer", func() {
+	It("should hold small contents in memory", func() {
+		buf := minimux.NewSpillBuffer(8)
+		defer buf.Close()
+		_, err := buf.Write([]byte("foo"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = buf.Write([]byte("bar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.Spilled()).To(BeFalse())
+		Expect(buf.Len()).To(BeEquivalentTo(6))
+		Expect(readString(buf.Reader())).To(Equal("foobar"))
+	})
+	It("should move large contents to a temporary file and remove it when closed", func() {
+		dir := GinkgoT().TempDir()
+		buf := &minimux.SpillBuffer{Threshold: 4, TempDir: dir}
+		_, err := buf.Write([]byte("foo"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = buf.Write([]byte("bar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.Spilled()).To(BeTrue())
+		Expect(os.ReadDir(dir)).To(HaveLen(1))
+		// Reading more than once must return the same contents
+		Expect(readString(buf.Reader())).To(Equal("foobar"))
+		var out strings.Builder
+		_, err = buf.WriteTo(&out)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(Equal("foobar"))
+
+		Expect(buf.Close()).To(Succeed())
+		Expect(os.ReadDir(dir)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("BufferedResponseWriter", func() {
+	It("should record a response and send it later", func() {
+		buf := minimux.NewBufferedResponseWriter(2)
+		defer buf.Close()
+		buf.Header().Set("Content-Type", "text/plain")
+		buf.WriteHeader(http.StatusTeapot)
+		buf.WriteHeader(http.StatusOK)
+		_, err := buf.Write([]byte("short and stout"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.StatusCode).To(Equal(http.StatusTeapot))
+
+		for i := 0; i < 2; i++ {
+			resp := httptest.NewRecorder()
+			Expect(buf.SendTo(resp)).To(Succeed())
+			Expect(resp.Code).To(Equal(http.StatusTeapot))
+			Expect(resp.Header()).To(HaveKeyWithValue("Content-Type", []string{"text/plain"}))
+			Expect(resp.Body.String()).To(Equal("short and stout"))
+		}
+	})
+})
@@ -0,0 +1,73 @@
+package minimux
+
+import (
+	"container/list"
+	"sync"
+)
+
+// boundedCache is a concurrency-safe map which evicts its least recently used entry once it is full
+type boundedCache[K comparable, V any] struct {
+	lock    sync.Mutex
+	size    int
+	entries map[K]*list.Element
+	order   *list.List
+}
+
+type boundedCacheEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newBoundedCache[K comparable, V any](size int) *boundedCache[K, V] {
+	return &boundedCache[K, V]{
+		size:    size,
+		entries: make(map[K]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// get returns the value for a key, and false if it is not present
+func (c *boundedCache[K, V]) get(key K) (value V, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return value, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*boundedCacheEntry[K, V]).value, true
+}
+
+// put sets the value for a key, evicting the least recently used entry if the cache is full
+func (c *boundedCache[K, V]) put(key K, value V) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*boundedCacheEntry[K, V]).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*boundedCacheEntry[K, V]).key)
+	}
+	c.entries[key] = c.order.PushFront(&boundedCacheEntry[K, V]{key: key, value: value})
+}
+
+// remove removes the value for a key, if present
+func (c *boundedCache[K, V]) remove(key K) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// matchKey identifies the parts of a request which are used to match routes
+type matchKey struct {
+	method string
+	host   string
+	path   string
+}
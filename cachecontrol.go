@@ -0,0 +1,60 @@
+package minimux
+
+import (
+	"context"
+	"net/http"
+)
+
+// Cached returns a handler which sends a Cache-Control header, such as "public, max-age=3600", with the responses
+// of another, so that cache directives can be declared where routes are built. Responses which set their own
+// Cache-Control header keep it, and errors, with a status of 400 or above, are sent without one.
+func Cached(h Handler, policy string) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		return h.ServeHTTP(ctx, &cacheControlWriter{ResponseWriter: w, policy: policy}, req, pathVars, formErr)
+	})
+}
+
+// WithCacheControl sends a Cache-Control header, such as "public, max-age=3600", with the responses of the handler,
+// as with Cached, inside of any Middleware added before it
+func (r *Route) WithCacheControl(policy string) *Route {
+	return r.Use(func(next Handler) Handler {
+		return Cached(next, policy)
+	})
+}
+
+// cacheControlWriter adds a Cache-Control header to a response when its status is written
+type cacheControlWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+func (c *cacheControlWriter) WriteHeader(statusCode int) {
+	if !c.wroteHeader && statusCode >= 200 {
+		c.wroteHeader = true
+		if h := c.Header(); statusCode < 400 && h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", c.policy)
+		}
+	}
+	c.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (c *cacheControlWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher
+func (c *cacheControlWriter) Flush() {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// Unwrap returns the wrapped ResponseWriter, for use by http.ResponseController
+func (c *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
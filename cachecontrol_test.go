@@ -0,0 +1,56 @@
+package minimux_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache-Control", func() {
+	status := func(statusCode int, headers ...string) minimux.Handler {
+		return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+			for ix := 0; ix < len(headers); ix += 2 {
+				w.Header().Set(headers[ix], headers[ix+1])
+			}
+			w.WriteHeader(statusCode)
+			return nil
+		})
+	}
+	mux := &minimux.Mux{
+		ErrorHandler: minimux.WriteError,
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/assets").WithCacheControl("public, max-age=3600").IsHandledBy(status(http.StatusOK)),
+			minimux.LiteralPath("/written").WithCacheControl("public, max-age=3600").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				_, err := io.WriteString(w, "body")
+				return err
+			}),
+			minimux.LiteralPath("/own").WithCacheControl("public, max-age=3600").IsHandledBy(status(http.StatusOK, "Cache-Control", "no-store")),
+			minimux.LiteralPath("/missing").WithCacheControl("public, max-age=3600").IsHandledBy(status(http.StatusNotFound)),
+			minimux.LiteralPath("/failed").WithCacheControl("public, max-age=3600").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				return minimux.ErrConflict
+			}),
+			minimux.LiteralPath("/wrapped").IsHandledBy(minimux.Cached(status(http.StatusNotModified), "no-cache")),
+		},
+	}
+
+	DescribeTable("should send the policy with successful responses",
+		func(path string, expectedStatus int, expected string) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			Expect(w.Code).To(Equal(expectedStatus))
+			Expect(w.Header().Get("Cache-Control")).To(Equal(expected))
+		},
+		Entry("a status", "/assets", http.StatusOK, "public, max-age=3600"),
+		Entry("a body", "/written", http.StatusOK, "public, max-age=3600"),
+		Entry("a policy of its own", "/own", http.StatusOK, "no-store"),
+		Entry("an error status", "/missing", http.StatusNotFound, ""),
+		Entry("a returned error", "/failed", http.StatusConflict, ""),
+		Entry("a wrapped handler", "/wrapped", http.StatusNotModified, "no-cache"),
+	)
+})
@@ -0,0 +1,168 @@
+package minimux
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultChallengeAfter is how many consecutive failures a Challenge allows before requiring one to be solved,
+// if its After is not set
+const DefaultChallengeAfter = 3
+
+// A ChallengeProvider issues and verifies challenges, such as CAPTCHAs, which prove a request was made by a person
+type ChallengeProvider interface {
+	// Widget returns the HTML which presents a challenge within a form
+	Widget(ctx context.Context, req *http.Request) (template.HTML, error)
+	// Verify returns true if a request, submitted by a form containing the widget, includes a solution to the challenge
+	Verify(ctx context.Context, req *http.Request) (bool, error)
+}
+
+// SiteVerifyChallenge is a ChallengeProvider for services which verify solutions with a "siteverify" API,
+// such as reCAPTCHA, hCaptcha, and Turnstile
+type SiteVerifyChallenge struct {
+	// VerifyURL is the URL of the service's siteverify API
+	VerifyURL string
+	// Secret is the secret key of the site
+	Secret string
+	// ResponseField is the name of the form field the widget submits the solution in, e.g. "h-captcha-response"
+	ResponseField string
+	// WidgetHTML is the HTML of the widget, which, along with the script it needs, is provided by the service
+	WidgetHTML template.HTML
+	// Client is the client used to verify solutions. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Widget implements ChallengeProvider
+func (s *SiteVerifyChallenge) Widget(ctx context.Context, req *http.Request) (template.HTML, error) {
+	return s.WidgetHTML, nil
+}
+
+// Verify implements ChallengeProvider
+func (s *SiteVerifyChallenge) Verify(ctx context.Context, req *http.Request) (bool, error) {
+	response := req.PostFormValue(s.ResponseField)
+	if response == "" {
+		return false, nil
+	}
+	form := url.Values{"secret": {s.Secret}, "response": {response}}
+	verifyReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	verifyReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(verifyReq)
+	if err != nil {
+		return false, fmt.Errorf("verifying challenge: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("verifying challenge: unexpected status %s", resp.Status)
+	}
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("verifying challenge: %w", err)
+	}
+	return result.Success, nil
+}
+
+// ChallengePage is the data a Challenge's Page is executed with
+type ChallengePage struct {
+	// Widget is the HTML of the challenge
+	Widget template.HTML
+	// Action is the URL the form should be submitted to, which is the URL of the challenged request
+	Action string
+	// Form are the values of the challenged form, without any which DefaultRedactor masks, such as passwords,
+	// to be resubmitted as hidden fields
+	Form url.Values
+}
+
+// DefaultChallengePage is the page a Challenge presents if its Page is not set. Its text is translated by T,
+// using the English text as the message keys.
+var DefaultChallengePage = template.Must(template.New("challenge").Funcs(TemplateFuncs(context.Background())).Parse(`<!DOCTYPE html>
+<html><head><title>{{ T "Verification required" }}</title></head><body>
+<form method="post" action="{{ .Action }}">
+<p>{{ T "Too many attempts have failed. Please complete the challenge below to continue." }}</p>
+{{ range $name, $values := .Form }}{{ range $values }}<input type="hidden" name="{{ $name }}" value="{{ . }}">
+{{ end }}{{ end }}{{ .Widget }}
+<button type="submit">{{ T "Continue" }}</button>
+</form>
+</body></html>
+`))
+
+// A Challenge requires requests to solve a challenge, such as a CAPTCHA, once a Lockout has recorded too many
+// consecutive failures for them, before protecting them with the Lockout.
+// Requests which must solve a challenge, but have not, are answered with 403 Forbidden and a page presenting one.
+type Challenge struct {
+	// Provider issues and verifies challenges
+	Provider ChallengeProvider
+	// Lockout tracks failures, and protects the handler once the challenge has been solved
+	Lockout *Lockout
+	// After is how many consecutive failures are allowed before a challenge is required.
+	// If zero, DefaultChallengeAfter is used. This should be less than the Threshold of the Lockout.
+	After int
+	// Page presents a challenge, and is executed with a ChallengePage, in the locale of the request, as with ExecuteLocalized.
+	// If nil, DefaultChallengePage is used.
+	Page *template.Template
+}
+
+// Protect returns a handler which requires requests to solve a challenge once they have failed too many times,
+// then calls another protected by the Lockout
+func (c *Challenge) Protect(next Handler) Handler {
+	protected := c.Lockout.Protect(next)
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		after := c.After
+		if after == 0 {
+			after = DefaultChallengeAfter
+		}
+		failures, err := c.Lockout.failures(ctx, req)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return err
+		}
+		if failures < after {
+			return protected.ServeHTTP(ctx, w, req, pathVars, formErr)
+		}
+		solved, err := c.Provider.Verify(ctx, req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return err
+		}
+		if solved {
+			return protected.ServeHTTP(ctx, w, req, pathVars, formErr)
+		}
+		AuditAuthDecision(ctx, AuthDecision{Authenticator: "challenge", Request: req, Reason: "challenge required"})
+		return c.present(ctx, w, req)
+	})
+}
+
+func (c *Challenge) present(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	widget, err := c.Provider.Widget(ctx, req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return err
+	}
+	page := ChallengePage{Widget: widget, Action: req.URL.RequestURI(), Form: url.Values{}}
+	req.ParseForm()
+	for name, values := range req.PostForm {
+		if !sensitive(DefaultRedactor.QueryParams, name) && !sensitive(DefaultRedactor.JSONFields, name) {
+			page.Form[name] = values
+		}
+	}
+	tmpl := c.Page
+	if tmpl == nil {
+		tmpl = DefaultChallengePage
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	return ExecuteLocalized(ctx, w, tmpl, page)
+}
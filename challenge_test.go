@@ -0,0 +1,75 @@
+package minimux_test
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// stubChallenge is solved by submitting "solved" in the "challenge" field
+type stubChallenge struct{}
+
+func (stubChallenge) Widget(ctx context.Context, req *http.Request) (template.HTML, error) {
+	return `<input name="challenge">`, nil
+}
+
+func (stubChallenge) Verify(ctx context.Context, req *http.Request) (bool, error) {
+	return req.PostFormValue("challenge") == "solved", nil
+}
+
+var _ = Describe("Challenge", func() {
+	var mux *minimux.Mux
+	BeforeEach(func() {
+		challenge := &minimux.Challenge{
+			Provider: stubChallenge{},
+			Lockout:  &minimux.Lockout{Keys: minimux.LockoutByFormValue("username")},
+			After:    2,
+		}
+		mux = &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/login").WithMethods(http.MethodPost).IsHandledBy(challenge.Protect(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					if req.PostFormValue("password") != "right" {
+						w.WriteHeader(http.StatusUnauthorized)
+					}
+					return nil
+				}))),
+			},
+		}
+	})
+
+	login := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(mux, req)
+	}
+
+	It("should require a challenge after repeated failures", func() {
+		for ix := 0; ix < 2; ix++ {
+			Expect(login(url.Values{"username": {"alice"}, "password": {"wrong"}}).Code).To(Equal(http.StatusUnauthorized))
+		}
+
+		resp := login(url.Values{"username": {"alice"}, "password": {"right"}})
+		Expect(resp.Code).To(Equal(http.StatusForbidden))
+		Expect(resp.Body.String()).To(ContainSubstring(`<input name="challenge">`))
+		Expect(resp.Body.String()).To(ContainSubstring(`name="username" value="alice"`))
+		Expect(resp.Body.String()).ToNot(ContainSubstring("right"))
+
+		Expect(login(url.Values{"username": {"alice"}, "password": {"right"}, "challenge": {"wrong"}}).Code).To(Equal(http.StatusForbidden))
+		Expect(login(url.Values{"username": {"alice"}, "password": {"right"}, "challenge": {"solved"}}).Code).To(Equal(http.StatusOK))
+
+		// The failures of the account are forgotten, but not those of the address, which may be shared
+		Expect(login(url.Values{"username": {"alice"}, "password": {"right"}}).Code).To(Equal(http.StatusForbidden))
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{"username": {"alice"}, "password": {"right"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "192.0.2.2:1234"
+		Expect(serve(mux, req).Code).To(Equal(http.StatusOK))
+	})
+})
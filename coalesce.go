@@ -0,0 +1,133 @@
+package minimux
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrCoalescedPanic is returned to the requests which shared a handler call that panicked
+var ErrCoalescedPanic = errors.New("the coalesced handler call panicked")
+
+// CoalesceByURL is a function for Coalesce.Key which collapses requests with the same host and URL
+func CoalesceByURL(req *http.Request, pathVars map[string]string) string {
+	return req.Host + " " + req.URL.RequestURI()
+}
+
+// A Coalesce collapses concurrent identical GET requests into a single call to a handler, whose buffered response
+// is sent to every request which was waiting for it, so that expensive read endpoints are protected from
+// thundering herds, such as when a cache expires. Requests are identical if they have the same key, and so the
+// responses must not depend on anything else about them, such as who is asking, unless the key includes it.
+// Set-Cookie headers are only sent to the request which called the handler.
+// The handler is called with a context which is not canceled if that request is, so that the others still receive
+// the response. If the handler panics, the panic continues in that request, and the others are answered with
+// 500 Internal Server Error, and ErrCoalescedPanic.
+type Coalesce struct {
+	// Key returns the key identifying identical requests. If nil, CoalesceByURL is used.
+	Key func(req *http.Request, pathVars map[string]string) string
+	// BufferThreshold is the number of bytes of the response to hold in memory before moving it to a temporary file.
+	// If zero, DefaultSpillThreshold is used.
+	BufferThreshold int
+
+	lock  sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is a call to a handler shared by concurrent requests
+type coalescedCall struct {
+	done     chan struct{}
+	response *BufferedResponseWriter
+	err      error
+	panicked bool
+	// users is how many requests have yet to send the response, guarded by the Coalesce's lock
+	users int
+}
+
+// release records that a request has sent the response, closing it once every request has
+func (c *Coalesce) release(call *coalescedCall) {
+	c.lock.Lock()
+	call.users--
+	last := call.users == 0
+	c.lock.Unlock()
+	if last {
+		call.response.Close()
+	}
+}
+
+// Wrap returns a handler which collapses concurrent identical GET requests into a single call to another
+func (c *Coalesce) Wrap(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		if req.Method != http.MethodGet {
+			return next.ServeHTTP(ctx, w, req, pathVars, formErr)
+		}
+		key := CoalesceByURL
+		if c.Key != nil {
+			key = c.Key
+		}
+		k := key(req, pathVars)
+
+		c.lock.Lock()
+		if call, ok := c.calls[k]; ok {
+			call.users++
+			c.lock.Unlock()
+			defer c.release(call)
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if call.panicked {
+				w.WriteHeader(http.StatusInternalServerError)
+				return ErrCoalescedPanic
+			}
+			if err := call.sendShared(w); err != nil {
+				return err
+			}
+			return call.err
+		}
+		call := &coalescedCall{done: make(chan struct{}), response: NewBufferedResponseWriter(c.BufferThreshold), users: 1}
+		if c.calls == nil {
+			c.calls = make(map[string]*coalescedCall)
+		}
+		c.calls[k] = call
+		c.lock.Unlock()
+		defer c.release(call)
+
+		var once sync.Once
+		finish := func() {
+			once.Do(func() {
+				c.lock.Lock()
+				delete(c.calls, k)
+				c.lock.Unlock()
+				close(call.done)
+			})
+		}
+		call.panicked = true
+		defer finish()
+		call.err = next.ServeHTTP(context.WithoutCancel(ctx), call.response, req, pathVars, formErr)
+		call.panicked = false
+		finish()
+		if err := call.response.SendTo(w); err != nil {
+			return err
+		}
+		return call.err
+	})
+}
+
+// sendShared writes the response of a call to a request which shared it, without its Set-Cookie headers
+func (call *coalescedCall) sendShared(w http.ResponseWriter) error {
+	header := w.Header()
+	for k, v := range call.response.Header() {
+		if k != "Set-Cookie" {
+			header[k] = append([]string(nil), v...)
+		}
+	}
+	statusCode := call.response.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	w.WriteHeader(statusCode)
+	_, err := call.response.Body.WriteTo(w)
+	return err
+}
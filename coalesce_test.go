@@ -0,0 +1,97 @@
+package minimux_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Coalesce", func() {
+	var calls atomic.Int32
+	var release chan struct{}
+	var mux *minimux.Mux
+	BeforeEach(func() {
+		calls.Store(0)
+		release = make(chan struct{})
+		coalesce := &minimux.Coalesce{}
+		mux = &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.PathPattern("/.*").IsHandledBy(coalesce.Wrap(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					n := calls.Add(1)
+					<-release
+					if req.URL.Path == "/panic" {
+						panic("oops")
+					}
+					http.SetCookie(w, &http.Cookie{Name: "session", Value: "first"})
+					w.Header().Set("X-Call", string(rune('0'+n)))
+					w.WriteHeader(http.StatusTeapot)
+					w.Write([]byte("expensive"))
+					return nil
+				}))),
+			},
+		}
+	})
+
+	// serveConcurrently starts requests for a path, one first, and the rest once it has called the handler
+	serveConcurrently := func(method, path string, count int) []*httptest.ResponseRecorder {
+		resps := make([]*httptest.ResponseRecorder, count)
+		var wg sync.WaitGroup
+		for ix := 0; ix < count; ix++ {
+			ix := ix
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				resps[ix] = httptest.NewRecorder()
+				mux.ServeHTTP(resps[ix], httptest.NewRequest(method, path, nil))
+			}()
+			if ix == 0 {
+				Eventually(calls.Load).Should(BeEquivalentTo(1))
+			}
+		}
+		// Give the rest time to wait for the first
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		return resps
+	}
+
+	It("should call the handler once for concurrent GET requests", func() {
+		resps := serveConcurrently(http.MethodGet, "/expensive", 5)
+		Expect(calls.Load()).To(BeEquivalentTo(1))
+		for ix, resp := range resps {
+			Expect(resp.Code).To(Equal(http.StatusTeapot))
+			Expect(resp.Header().Get("X-Call")).To(Equal("1"))
+			Expect(resp.Body.String()).To(Equal("expensive"))
+			if ix == 0 {
+				Expect(resp.Header().Values("Set-Cookie")).To(HaveLen(1))
+			} else {
+				Expect(resp.Header().Values("Set-Cookie")).To(BeEmpty())
+			}
+		}
+	})
+
+	It("should not coalesce other methods", func() {
+		resps := serveConcurrently(http.MethodPost, "/expensive", 3)
+		Expect(calls.Load()).To(BeEquivalentTo(3))
+		for _, resp := range resps {
+			Expect(resp.Code).To(Equal(http.StatusTeapot))
+		}
+	})
+
+	It("should answer the waiting requests with 500 if the handler panics", func() {
+		resps := serveConcurrently(http.MethodGet, "/panic", 3)
+		Expect(calls.Load()).To(BeEquivalentTo(1))
+		for _, resp := range resps {
+			Expect(resp.Code).To(Equal(http.StatusInternalServerError))
+		}
+	})
+})
@@ -0,0 +1,249 @@
+package minimux
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// A Codec encodes and decodes the values of typed handlers, such as TypedHandler and Bind, in one format.
+// A Codec may also have a Supports(v any) bool method, which returns false if the value v points to
+// cannot be encoded and decoded, in which case it is not chosen for that value.
+type Codec interface {
+	// ContentTypes are the media types of the values it encodes, the first of which is their Content-Type.
+	// Values with a media type whose structured syntax suffix is one of them, such as application/problem+json
+	// for application/json, are decoded too.
+	ContentTypes() []string
+	// Encode writes a value, given a pointer to it
+	Encode(w io.Writer, v any) error
+	// Decode reads a value into the value v points to
+	Decode(r io.Reader, v any) error
+}
+
+// codecFuncs is a Codec made of functions
+type codecFuncs struct {
+	contentTypes []string
+	encode       func(w io.Writer, v any) error
+	decode       func(r io.Reader, v any) error
+	supports     func(v any) bool
+}
+
+// ContentTypes implements Codec
+func (c codecFuncs) ContentTypes() []string {
+	return c.contentTypes
+}
+
+// Encode implements Codec
+func (c codecFuncs) Encode(w io.Writer, v any) error {
+	return c.encode(w, v)
+}
+
+// Decode implements Codec
+func (c codecFuncs) Decode(r io.Reader, v any) error {
+	return c.decode(r, v)
+}
+
+// Supports returns false if the value v points to cannot be encoded and decoded
+func (c codecFuncs) Supports(v any) bool {
+	return c.supports == nil || c.supports(v)
+}
+
+var (
+	// JSONCodec encodes and decodes values with encoding/json
+	JSONCodec Codec = codecFuncs{
+		contentTypes: []string{"application/json"},
+		encode:       func(w io.Writer, v any) error { return json.NewEncoder(w).Encode(v) },
+		decode:       func(r io.Reader, v any) error { return json.NewDecoder(r).Decode(v) },
+	}
+	// XMLCodec encodes and decodes values with encoding/xml
+	XMLCodec Codec = codecFuncs{
+		contentTypes: []string{"application/xml", "text/xml"},
+		encode: func(w io.Writer, v any) error {
+			if _, err := io.WriteString(w, xml.Header); err != nil {
+				return err
+			}
+			return xml.NewEncoder(w).Encode(v)
+		},
+		decode: func(r io.Reader, v any) error { return xml.NewDecoder(r).Decode(v) },
+	}
+	// ProtobufCodec encodes and decodes Protocol Buffers messages with their own Marshal and Unmarshal methods,
+	// such as those generated by gogo/protobuf, and supports no other values
+	ProtobufCodec = NewProtobufCodec(
+		func(m gogoMessage) ([]byte, error) { return m.Marshal() },
+		func(data []byte, m gogoMessage) error { return m.Unmarshal(data) },
+	)
+	// defaultCodecs are the codecs every Mux has, after its own, in order of preference
+	defaultCodecs = []Codec{JSONCodec, XMLCodec, ProtobufCodec}
+)
+
+type codecsKey struct{}
+
+// codecsFromContext returns the codecs of the Mux serving a request, and of those serving it, in order of preference
+func codecsFromContext(ctx context.Context) []Codec {
+	if codecs, ok := ctx.Value(codecsKey{}).([]Codec); ok {
+		return codecs
+	}
+	return defaultCodecs
+}
+
+// withCodecs returns a context with codecs preferred over those already in it
+func withCodecs(ctx context.Context, codecs []Codec) context.Context {
+	return context.WithValue(ctx, codecsKey{}, append(slices.Clip(codecs), codecsFromContext(ctx)...))
+}
+
+// codecSupports returns true if a codec can encode and decode the value v points to
+func codecSupports(c Codec, v any) bool {
+	s, ok := c.(interface{ Supports(v any) bool })
+	return !ok || s.Supports(v)
+}
+
+// codecDecodes returns true if a codec decodes values of a media type
+func codecDecodes(c Codec, mediaType string) bool {
+	contentTypes := c.ContentTypes()
+	if slices.Contains(contentTypes, mediaType) {
+		return true
+	}
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	if ix := strings.LastIndexByte(subtype, '+'); ix != -1 {
+		return slices.Contains(contentTypes, typ+"/"+subtype[ix+1:]) || slices.Contains(contentTypes, "application/"+subtype[ix+1:])
+	}
+	return false
+}
+
+// requestCodec returns the first of the codecs which decodes the body of a request by its Content-Type, or the first
+// codec if it has none, or false if it has one which no codec decodes
+func requestCodec(req *http.Request, codecs []Codec) (Codec, bool) {
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		return codecs[0], true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	for _, c := range codecs {
+		if codecDecodes(c, mediaType) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// responseCodec returns the one of the codecs which the Accept header of a request prefers for the value pointed to
+// by v, with ties going to the codec of its body, and then in order of preference, or false if it accepts none of
+// those which support it
+func responseCodec(req *http.Request, codecs []Codec, body Codec, v any) (Codec, bool) {
+	noAccept := len(req.Header.Values("Accept")) == 0
+	if noAccept && codecSupports(body, v) {
+		return body, true
+	}
+	ranges := parseAccept(req.Header)
+	if noAccept {
+		ranges = []mediaRange{{typ: "*", subtype: "*", quality: 1}}
+	}
+	var best Codec
+	bestQuality := 0.0
+	for _, c := range append([]Codec{body}, codecs...) {
+		if !codecSupports(c, v) {
+			continue
+		}
+		for _, contentType := range c.ContentTypes() {
+			if quality := acceptQuality(ranges, contentType); quality > bestQuality {
+				best, bestQuality = c, quality
+			}
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// gogoMessage is a Protocol Buffers message which marshals itself, such as those generated by gogo/protobuf
+type gogoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+// NewProtobufCodec returns a Codec which encodes and decodes Protocol Buffers messages of type M, and supports
+// no other values, with a pair of functions, so that messages which do not marshal themselves can be used without
+// minimux depending on a protobuf library. For messages generated by google.golang.org/protobuf, add
+//
+//	minimux.NewProtobufCodec[proto.Message](proto.Marshal, func(data []byte, m proto.Message) error {
+//		return proto.Unmarshal(data, m)
+//	})
+//
+// to the Codecs of the Mux, where it is preferred over ProtobufCodec.
+func NewProtobufCodec[M any](marshal func(M) ([]byte, error), unmarshal func([]byte, M) error) Codec {
+	return codecFuncs{
+		contentTypes: []string{"application/x-protobuf", "application/protobuf"},
+		encode: func(w io.Writer, v any) error {
+			m, ok := protoMessage[M](v)
+			if !ok {
+				return errors.New("value is not a protobuf message")
+			}
+			data, err := marshal(m)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(data)
+			return err
+		},
+		decode: func(r io.Reader, v any) error {
+			m, ok := protoMessage[M](v)
+			if !ok {
+				return errors.New("value is not a protobuf message")
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			return unmarshal(data, m)
+		},
+		supports: func(v any) bool {
+			_, ok := protoMessageType[M](v)
+			return ok
+		},
+	}
+}
+
+// protoMessageType returns v, or the pointer it points to, if it is a message of type M, such as for handlers
+// which take and return pointers to messages
+func protoMessageType[M any](v any) (reflect.Value, bool) {
+	if _, ok := v.(M); ok {
+		return reflect.ValueOf(v), true
+	}
+	p := reflect.ValueOf(v)
+	if p.Kind() != reflect.Pointer || p.IsNil() || p.Elem().Kind() != reflect.Pointer || !p.Elem().Type().AssignableTo(reflect.TypeOf((*M)(nil)).Elem()) {
+		return reflect.Value{}, false
+	}
+	return p.Elem(), true
+}
+
+// protoMessage returns v, or the message it points to, allocating it if it is a nil pointer, as with protoMessageType
+func protoMessage[M any](v any) (M, bool) {
+	message, ok := protoMessageType[M](v)
+	if !ok {
+		var m M
+		return m, false
+	}
+	if message.CanSet() && message.IsNil() {
+		message.Set(reflect.New(message.Type().Elem()))
+	}
+	return message.Interface().(M), true
+}
+
+// decodeBody decodes the body of a request, if it has one, into a value with a codec
+func decodeBody(c Codec, req *http.Request, v any) error {
+	if req.Body == nil {
+		return nil
+	}
+	if err := c.Decode(req.Body, v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
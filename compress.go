@@ -0,0 +1,277 @@
+package minimux
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultIncompressibleTypes are the media types, or, if they end with a slash, the types of media,
+// which a Compression does not compress if it has no Skip function, as they are compressed already
+var DefaultIncompressibleTypes = []string{
+	"image/", "video/", "audio/", "font/woff", "font/woff2",
+	"application/gzip", "application/x-gzip", "application/zip", "application/zstd", "application/x-7z-compressed",
+	"application/x-bzip2", "application/x-xz", "application/x-rar-compressed", "application/pdf",
+}
+
+// A ContentEncoder compresses responses with a content coding the standard library does not provide, such as brotli
+type ContentEncoder struct {
+	// Name is the content coding, as in the Accept-Encoding and Content-Encoding headers, such as "br"
+	Name string
+	// NewWriter returns a writer which compresses into a response, such as a brotli writer with a chosen level.
+	// If the writer has a Flush() error method, it is called when the response is flushed.
+	NewWriter func(w io.Writer) io.WriteCloser
+}
+
+// Compression compresses responses with gzip, deflate, or any of its Encoders, whichever the Accept-Encoding header
+// of a request prefers, with ties going to its Encoders, in order, and then to gzip.
+// Responses which already have a Content-Encoding, are partial, have no body, or have a Content-Type which is
+// already compressed, such as images, are left as they are.
+// As it is Middleware, the status code and the number of bytes written which are recorded by the Mux,
+// such as for PostProcess, are those of the compressed response which is sent.
+type Compression struct {
+	// Level is the compression level, as defined by compress/flate. If zero, the default level is used.
+	Level int
+	// Skip optionally returns true for the media types of responses which should not be compressed.
+	// If nil, those in DefaultIncompressibleTypes are not compressed.
+	Skip func(mediaType string) bool
+	// Encoders optionally add content codings, such as brotli, which are preferred over gzip and deflate when
+	// a request accepts them as much, as most browsers do for brotli
+	Encoders []ContentEncoder
+
+	once      sync.Once
+	gzip      sync.Pool
+	zlib      sync.Pool
+	level     int
+	encodings []string
+}
+
+func (c *Compression) init() {
+	c.once.Do(func() {
+		c.level = c.Level
+		for _, encoder := range c.Encoders {
+			c.encodings = append(c.encodings, strings.ToLower(encoder.Name))
+		}
+		c.encodings = append(c.encodings, "gzip", "deflate")
+		if c.level == 0 {
+			c.level = gzip.DefaultCompression
+		}
+		c.gzip.New = func() any {
+			w, err := gzip.NewWriterLevel(io.Discard, c.level)
+			if err != nil {
+				w = gzip.NewWriter(io.Discard)
+			}
+			return w
+		}
+		c.zlib.New = func() any {
+			w, err := zlib.NewWriterLevel(io.Discard, c.level)
+			if err != nil {
+				w = zlib.NewWriter(io.Discard)
+			}
+			return w
+		}
+	})
+}
+
+// Compress returns a handler which calls another, compressing its response if the request accepts it
+func (c *Compression) Compress(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		c.init()
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(req.Header.Values("Accept-Encoding"), c.encodings)
+		if encoding == "" || req.Method == http.MethodHead {
+			return next.ServeHTTP(ctx, w, req, pathVars, formErr)
+		}
+		cw := &compressingResponseWriter{inner: w, compression: c, encoding: encoding}
+		err := next.ServeHTTP(ctx, cw, req, pathVars, formErr)
+		if closeErr := cw.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+}
+
+// newWriter returns a writer which compresses into a response with a content coding
+func (c *Compression) newWriter(encoding string, w io.Writer) io.WriteCloser {
+	switch encoding {
+	case "gzip":
+		gw := c.gzip.Get().(*gzip.Writer)
+		gw.Reset(w)
+		return gw
+	case "deflate":
+		zw := c.zlib.Get().(*zlib.Writer)
+		zw.Reset(w)
+		return zw
+	}
+	for _, encoder := range c.Encoders {
+		if strings.EqualFold(encoder.Name, encoding) {
+			return encoder.NewWriter(w)
+		}
+	}
+	return nil
+}
+
+// release returns a writer from newWriter to its pool, if it has one
+func (c *Compression) release(w io.WriteCloser) {
+	switch w := w.(type) {
+	case *gzip.Writer:
+		w.Reset(io.Discard)
+		c.gzip.Put(w)
+	case *zlib.Writer:
+		w.Reset(io.Discard)
+		c.zlib.Put(w)
+	}
+}
+
+// skip returns true if responses with a Content-Type should not be compressed
+func (c *Compression) skip(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+	if c.Skip != nil {
+		return c.Skip(mediaType)
+	}
+	for _, skipped := range DefaultIncompressibleTypes {
+		if mediaType == skipped || (strings.HasSuffix(skipped, "/") && strings.HasPrefix(mediaType, skipped) && mediaType != "image/svg+xml") {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding returns the one of a list of content codings which the Accept-Encoding headers of a request
+// prefer, with ties going to the first, or an empty string if they accept none of them
+func negotiateEncoding(acceptEncoding []string, encodings []string) string {
+	if len(acceptEncoding) == 0 {
+		return ""
+	}
+	qualities := map[string]float64{}
+	for _, accept := range acceptEncoding {
+		for _, field := range strings.Split(accept, ",") {
+			coding, params, _ := strings.Cut(field, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			quality := 1.0
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				var err error
+				if quality, err = strconv.ParseFloat(q, 64); err != nil {
+					continue
+				}
+			}
+			if coding == "x-gzip" {
+				coding = "gzip"
+			}
+			qualities[coding] = quality
+		}
+	}
+	best, bestQuality := "", 0.0
+	for _, encoding := range encodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = qualities["*"]
+		}
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// compressingResponseWriter compresses the body of a response once it knows it should be compressed
+type compressingResponseWriter struct {
+	inner       http.ResponseWriter
+	compression *Compression
+	encoding    string
+	// started is set once the status code has been written
+	started bool
+	// writer compresses the body, or is nil if it is not compressed
+	writer io.WriteCloser
+}
+
+var _ = http.ResponseWriter(&compressingResponseWriter{})
+var _ = http.Flusher(&compressingResponseWriter{})
+var _ = http.Hijacker(&compressingResponseWriter{})
+
+func (c *compressingResponseWriter) Header() http.Header {
+	return c.inner.Header()
+}
+
+// WriteHeader decides whether to compress the response, unless it is informational
+func (c *compressingResponseWriter) WriteHeader(statusCode int) {
+	if c.started || (statusCode >= 100 && statusCode < 200) {
+		c.inner.WriteHeader(statusCode)
+		return
+	}
+	c.started = true
+	h := c.inner.Header()
+	if statusCode != http.StatusNoContent && statusCode != http.StatusNotModified && statusCode != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" && !c.compression.skip(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+		// The compressed representation is different, so it must have a different tag
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		c.writer = c.compression.newWriter(c.encoding, c.inner)
+	}
+	c.inner.WriteHeader(statusCode)
+}
+
+func (c *compressingResponseWriter) Write(b []byte) (int, error) {
+	if !c.started {
+		if c.inner.Header().Get("Content-Type") == "" {
+			// Sniff the uncompressed body, as net/http would otherwise sniff the compressed one
+			c.inner.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.writer == nil {
+		return c.inner.Write(b)
+	}
+	return c.writer.Write(b)
+}
+
+// Flush implements http.Flusher, flushing the compressed data written so far
+func (c *compressingResponseWriter) Flush() {
+	if !c.started {
+		c.WriteHeader(http.StatusOK)
+	}
+	if f, ok := c.writer.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(c.inner).Flush()
+}
+
+// Unwrap returns the wrapped ResponseWriter, for use by http.ResponseController
+func (c *compressingResponseWriter) Unwrap() http.ResponseWriter {
+	return c.inner
+}
+
+// Hijack implements http.Hijacker, such as for WebSocket upgrades, by hijacking the wrapped ResponseWriter,
+// unless the response is already being compressed
+func (c *compressingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if c.writer != nil {
+		return nil, nil, errors.New("cannot hijack a compressed response")
+	}
+	return http.NewResponseController(c.inner).Hijack()
+}
+
+// Close finishes compressing the response, if it is compressed, and returns the compressor to its pool
+func (c *compressingResponseWriter) Close() error {
+	if c.writer == nil {
+		return nil
+	}
+	err := c.writer.Close()
+	c.compression.release(c.writer)
+	c.writer = nil
+	return err
+}
@@ -0,0 +1,180 @@
+package minimux_test
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Compression", func() {
+	body := strings.Repeat("compress me ", 100)
+	var results []minimux.RequestResult
+	compression := &minimux.Compression{}
+	write := func(contentType string, headers ...string) minimux.Handler {
+		return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+			if contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			}
+			for ix := 0; ix < len(headers); ix += 2 {
+				w.Header().Set(headers[ix], headers[ix+1])
+			}
+			w.Header().Set("Content-Length", "1200")
+			_, err := io.WriteString(w, body)
+			return err
+		})
+	}
+	mux := &minimux.Mux{
+		Middleware: []minimux.Middleware{compression.Compress},
+		PostProcessResult: func(ctx context.Context, req *http.Request, result minimux.RequestResult) {
+			results = append(results, result)
+		},
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/text").IsHandledBy(write("text/plain; charset=utf-8")),
+			minimux.LiteralPath("/sniffed").IsHandledBy(write("")),
+			minimux.LiteralPath("/image").IsHandledBy(write("image/png")),
+			minimux.LiteralPath("/encoded").IsHandledBy(write("text/plain", "Content-Encoding", "br")),
+			minimux.LiteralPath("/tagged").IsHandledBy(write("text/plain", "ETag", `"v1"`)),
+			minimux.LiteralPath("/empty").IsHandledBy(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				w.WriteHeader(http.StatusNoContent)
+				return nil
+			})),
+		},
+	}
+	BeforeEach(func() {
+		results = nil
+	})
+
+	decode := func(encoding string, r io.Reader) string {
+		var err error
+		switch encoding {
+		case "gzip":
+			r, err = gzip.NewReader(r)
+		case "deflate":
+			r, err = zlib.NewReader(r)
+		}
+		Expect(err).ToNot(HaveOccurred())
+		decoded, err := io.ReadAll(r)
+		Expect(err).ToNot(HaveOccurred())
+		return string(decoded)
+	}
+
+	DescribeTable("should compress responses the client accepts",
+		func(method, path, acceptEncoding, expectedEncoding, expectedContentType string) {
+			req := httptest.NewRequest(method, path, nil)
+			if acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", acceptEncoding)
+			}
+			resp := serve(mux, req)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Values("Vary")).To(ContainElement("Accept-Encoding"))
+			Expect(resp.Header().Get("Content-Encoding")).To(Equal(expectedEncoding))
+			Expect(resp.Header().Get("Content-Type")).To(Equal(expectedContentType))
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].BytesWritten).To(Equal(int64(resp.Body.Len())))
+			if method == http.MethodHead {
+				return
+			}
+			switch expectedEncoding {
+			case "gzip", "deflate":
+				Expect(resp.Header().Get("Content-Length")).To(BeEmpty())
+				Expect(resp.Body.Len()).To(BeNumerically("<", len(body)))
+				Expect(decode(expectedEncoding, resp.Body)).To(Equal(body))
+			default:
+				Expect(resp.Body.String()).To(Equal(body))
+			}
+		},
+		Entry("gzip", http.MethodGet, "/text", "gzip, deflate", "gzip", "text/plain; charset=utf-8"),
+		Entry("deflate", http.MethodGet, "/text", "deflate", "deflate", "text/plain; charset=utf-8"),
+		Entry("preferred deflate", http.MethodGet, "/text", "gzip;q=0.5, deflate", "deflate", "text/plain; charset=utf-8"),
+		Entry("wildcard", http.MethodGet, "/text", "*", "gzip", "text/plain; charset=utf-8"),
+		Entry("refused gzip", http.MethodGet, "/text", "gzip;q=0, *", "deflate", "text/plain; charset=utf-8"),
+		Entry("nothing accepted", http.MethodGet, "/text", "identity", "", "text/plain; charset=utf-8"),
+		Entry("no Accept-Encoding", http.MethodGet, "/text", "", "", "text/plain; charset=utf-8"),
+		Entry("sniffed content type", http.MethodGet, "/sniffed", "gzip", "gzip", "text/plain; charset=utf-8"),
+		Entry("already compressed type", http.MethodGet, "/image", "gzip", "", "image/png"),
+		Entry("already encoded", http.MethodGet, "/encoded", "gzip", "br", "text/plain"),
+		Entry("HEAD", http.MethodHead, "/text", "gzip", "", "text/plain; charset=utf-8"),
+	)
+
+	It("should weaken the ETag of compressed responses", func() {
+		req := httptest.NewRequest(http.MethodGet, "/tagged", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp := serve(mux, req)
+		Expect(resp.Header().Get("ETag")).To(Equal(`W/"v1"`))
+	})
+
+	It("should let handlers hijack the connection", func() {
+		Expect(upgradedResponse(&minimux.Mux{
+			Middleware: []minimux.Middleware{compression.Compress},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/ws").IsHandledBy(upgradingHandler),
+			},
+		}, "/ws", "Accept-Encoding: gzip\r\n")).To(Equal("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\n\r\nupgraded"))
+	})
+
+	It("should not compress responses without a body", func() {
+		req := httptest.NewRequest(http.MethodGet, "/empty", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp := serve(mux, req)
+		Expect(resp.Code).To(Equal(http.StatusNoContent))
+		Expect(resp.Header().Get("Content-Encoding")).To(BeEmpty())
+		Expect(resp.Body.Len()).To(BeZero())
+	})
+})
+
+// upperWriter is a stand-in for a brotli writer, which upper-cases what it writes
+type upperWriter struct {
+	io.Writer
+	closed *bool
+}
+
+func (u upperWriter) Write(b []byte) (int, error) {
+	return u.Writer.Write([]byte(strings.ToUpper(string(b))))
+}
+
+func (u upperWriter) Close() error {
+	*u.closed = true
+	return nil
+}
+
+var _ = Describe("Compression with other encoders", func() {
+	closed := false
+	compression := &minimux.Compression{
+		Encoders: []minimux.ContentEncoder{{
+			Name:      "br",
+			NewWriter: func(w io.Writer) io.WriteCloser { return upperWriter{Writer: w, closed: &closed} },
+		}},
+	}
+	mux := &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/").Use(compression.Compress).IsHandledBy(minimux.NewStaticString("compress me", "text/plain")),
+		},
+	}
+
+	DescribeTable("should prefer them when accepted as much",
+		func(acceptEncoding, expectedEncoding string) {
+			closed = false
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+			resp := serve(mux, req)
+			Expect(resp.Header().Get("Content-Encoding")).To(Equal(expectedEncoding))
+			if expectedEncoding == "br" {
+				Expect(resp.Body.String()).To(Equal("COMPRESS ME"))
+				Expect(closed).To(BeTrue())
+			}
+		},
+		Entry("as browsers do", "gzip, deflate, br, zstd", "br"),
+		Entry("preferring gzip", "gzip, br;q=0.9", "gzip"),
+		Entry("only brotli", "br", "br"),
+		Entry("without brotli", "gzip", "gzip"),
+	)
+})
@@ -0,0 +1,63 @@
+package minimux
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// etagMatches returns true if an entity tag is in a list of them from an If-None-Match or If-Match header,
+// comparing them weakly, or strongly, in which case weak tags never match
+func etagMatches(list, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strong && strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified returns true if a GET or HEAD request for a representation with an entity tag and modification time,
+// either of which may be empty, is conditional on it having changed, and it has not, as in RFC 9110
+func notModified(req *http.Request, etag string, modTime time.Time) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag, false)
+	}
+	ifModifiedSince := req.Header.Get("If-Modified-Since")
+	if ifModifiedSince == "" || modTime.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	return err == nil && !modTime.Truncate(time.Second).After(since)
+}
+
+// ifRangeMatches returns true if the If-Range header of a request, if any, matches a representation with an entity tag
+// and modification time, either of which may be empty, such that its Range header should be honored
+func ifRangeMatches(req *http.Request, etag string, modTime time.Time) bool {
+	ifRange := req.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return etagMatches(ifRange, etag, true)
+	}
+	at, err := http.ParseTime(ifRange)
+	return err == nil && !modTime.IsZero() && modTime.Truncate(time.Second).Equal(at)
+}
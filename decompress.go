@@ -0,0 +1,63 @@
+package minimux
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DecompressRequests is a PreProcessor which decompresses the bodies of requests with a Content-Encoding of gzip
+// or deflate, such as compressed webhook deliveries, before any form is parsed or body bound.
+// Requests whose body is not a valid stream are answered with 400 Bad Request, and errors reading a stream which
+// is corrupt later on wrap ErrBadRequest. Bodies with any other Content-Encoding are left as they are.
+// As the limits of MaxBodyBytes are applied after PreProcess, they limit the size of the decompressed body.
+var DecompressRequests PreProcessor = func(ctx context.Context, req *http.Request) (context.Context, func()) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ctx, nil
+	}
+	var body io.ReadCloser
+	var err error
+	switch strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		body, err = gzip.NewReader(req.Body)
+	case "deflate":
+		body, err = zlib.NewReader(req.Body)
+	default:
+		return ctx, nil
+	}
+	if err != nil {
+		return RejectWithStatus(ctx, http.StatusBadRequest), nil
+	}
+	req.Body = &decompressedBody{ReadCloser: body, compressed: req.Body}
+	req.ContentLength = -1
+	req.Header.Del("Content-Length")
+	req.Header.Del("Content-Encoding")
+	return ctx, nil
+}
+
+// decompressedBody reads a request body through a decompressor
+type decompressedBody struct {
+	io.ReadCloser
+	compressed io.ReadCloser
+}
+
+// Read implements io.Reader, returning errors from a corrupt stream as bad requests
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = ErrBadRequest.WithInternal(err)
+	}
+	return n, err
+}
+
+// Close implements io.Closer, closing both the decompressor and the compressed body
+func (b *decompressedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if closeErr := b.compressed.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
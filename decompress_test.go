@@ -0,0 +1,100 @@
+package minimux_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DecompressRequests", func() {
+	mux := &minimux.Mux{
+		PreProcess:   minimux.DecompressRequests,
+		ErrorHandler: minimux.WriteError,
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/form").WithForm().IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				if formErr != nil {
+					return formErr
+				}
+				_, err := io.WriteString(w, req.PostForm.Get("event"))
+				return err
+			}),
+			minimux.LiteralPath("/raw").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				body, err := io.ReadAll(req.Body)
+				if err != nil {
+					return err
+				}
+				w.Header().Set("X-Encoding", req.Header.Get("Content-Encoding"))
+				_, err = w.Write(body)
+				return err
+			}),
+		},
+	}
+	compressed := func(encoding string, body string) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		var w io.WriteCloser
+		if encoding == "gzip" {
+			w = gzip.NewWriter(buf)
+		} else {
+			w = zlib.NewWriter(buf)
+		}
+		_, err := io.WriteString(w, body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+		return buf
+	}
+	post := func(path, encoding string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	DescribeTable("should decompress bodies before parsing forms",
+		func(encoding string) {
+			w := post("/form", encoding, compressed(encoding, "event=push"))
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal("push"))
+		},
+		Entry("gzip", "gzip"),
+		Entry("deflate", "deflate"),
+	)
+
+	It("should remove the Content-Encoding of decompressed bodies", func() {
+		w := post("/raw", "gzip", compressed("gzip", "payload"))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("payload"))
+		Expect(w.Header().Get("X-Encoding")).To(BeEmpty())
+	})
+
+	It("should leave other bodies as they are", func() {
+		w := post("/raw", "", bytes.NewBufferString("payload"))
+		Expect(w.Body.String()).To(Equal("payload"))
+		w = post("/raw", "br", bytes.NewBufferString("payload"))
+		Expect(w.Body.String()).To(Equal("payload"))
+		Expect(w.Header().Get("X-Encoding")).To(Equal("br"))
+	})
+
+	It("should answer bodies which are not compressed with 400", func() {
+		w := post("/raw", "gzip", bytes.NewBufferString("payload"))
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should answer bodies which are corrupt later on with 400", func() {
+		body := compressed("gzip", "a longer payload which is cut short").Bytes()
+		w := post("/raw", "gzip", bytes.NewReader(body[:len(body)-8]))
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,103 @@
+package minimux
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+)
+
+type errorStatusKey struct{}
+
+// ErrorStatusFromContext returns the status code an error page was called to answer a request with,
+// or false if it was not called as one
+func ErrorStatusFromContext(ctx context.Context) (int, bool) {
+	statusCode, ok := ctx.Value(errorStatusKey{}).(int)
+	return statusCode, ok
+}
+
+type allowedMethodsKey struct{}
+
+// AllowedMethodsFromContext returns the methods accepted by the routes which match the path of a request
+// answered with 405 Method Not Allowed, which are also sent in its Allow header, such as for an error page,
+// or false if they are not known
+func AllowedMethodsFromContext(ctx context.Context) (StringSet, bool) {
+	methods, ok := ctx.Value(allowedMethodsKey{}).(StringSet)
+	return methods, ok && methods != nil
+}
+
+// errorPageWriter is given to error pages so that the status chosen by the Mux is written,
+// whatever status the page writes, and is written even if the page writes nothing
+type errorPageWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (e *errorPageWriter) WriteHeader(int) {
+	if e.wroteHeader {
+		return
+	}
+	e.wroteHeader = true
+	e.ResponseWriter.WriteHeader(e.statusCode)
+}
+
+func (e *errorPageWriter) Write(b []byte) (int, error) {
+	e.WriteHeader(e.statusCode)
+	return e.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped ResponseWriter, for use by http.ResponseController
+func (e *errorPageWriter) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+// errorPage returns the error page for a status code, if there is one
+func (m innerMux) errorPage(statusCode int) Handler {
+	if page, ok := m.ErrorPages[statusCode]; ok {
+		return page
+	}
+	return m.ErrorPageClasses[statusCode/100]
+}
+
+// writeStatus answers a request with a status code chosen by the Mux, using its error page, if it has one
+func (m innerMux) writeStatus(ctx context.Context, w http.ResponseWriter, req *http.Request, statusCode int) error {
+	page := m.errorPage(statusCode)
+	if page == nil {
+		w.WriteHeader(statusCode)
+		return nil
+	}
+	pageW := &errorPageWriter{ResponseWriter: w, statusCode: statusCode}
+	err := page.ServeHTTP(context.WithValue(ctx, errorStatusKey{}, statusCode), pageW, req, nil, nil)
+	pageW.WriteHeader(statusCode)
+	return err
+}
+
+// ErrorPage is the data an error page template is executed with
+type ErrorPage struct {
+	// StatusCode is the status code the request is answered with
+	StatusCode int
+	// StatusText is the text of the status code, such as "Not Found", which can be translated by T
+	StatusText string
+}
+
+// DefaultErrorPage is the error page template a TemplateErrorPage executes if none is given.
+// Its text is translated by T, using the English text as the message keys.
+var DefaultErrorPage = template.Must(template.New("error").Funcs(TemplateFuncs(context.Background())).Parse(`<!DOCTYPE html>
+<html><head><title>{{ .StatusCode }} {{ T .StatusText }}</title></head><body>
+<h1>{{ .StatusCode }} {{ T .StatusText }}</h1>
+</body></html>
+`))
+
+// TemplateErrorPage returns an error page which executes an html/template with an ErrorPage, in the locale
+// of the request, as with ExecuteLocalized. If the template is nil, DefaultErrorPage is used.
+func TemplateErrorPage(tmpl *template.Template) Handler {
+	if tmpl == nil {
+		tmpl = DefaultErrorPage
+	}
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		statusCode, _ := ErrorStatusFromContext(ctx)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(statusCode)
+		return ExecuteLocalized(ctx, w, tmpl, ErrorPage{StatusCode: statusCode, StatusText: http.StatusText(statusCode)})
+	})
+}
@@ -0,0 +1,233 @@
+package minimux
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFanOutAttempts is how many times a FanOut tries to deliver a request to each target, if its Attempts is not set
+	DefaultFanOutAttempts = 5
+	// DefaultFanOutBackoff is how long a FanOut waits before retrying a delivery the first time, if its Backoff is not set.
+	// It doubles with each retry.
+	DefaultFanOutBackoff = time.Second
+	// DefaultFanOutHistory is how many deliveries a FanOut remembers the results of, if its History is not set
+	DefaultFanOutHistory = 1000
+)
+
+// fanOutSkippedHeaders are the headers which are not copied from a request to its deliveries
+var fanOutSkippedHeaders = StringSetOf(
+	"Authorization", "Cookie", "Host", "Content-Length", "Connection", "Keep-Alive", "Proxy-Connection",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Expect",
+)
+
+// FanOutResult is the result of delivering a request to one target
+type FanOutResult struct {
+	// URL is the target
+	URL string `json:"url"`
+	// Attempts is how many times delivery has been attempted
+	Attempts int `json:"attempts"`
+	// StatusCode is the status of the last response, if any
+	StatusCode int `json:"statusCode,omitempty"`
+	// Error is the error of the last attempt, if any
+	Error string `json:"error,omitempty"`
+	// Done is true once no more attempts will be made
+	Done bool `json:"done"`
+	// Delivered is true if the target accepted the request
+	Delivered bool `json:"delivered"`
+}
+
+// FanOutDelivery is the progress of delivering a request to every target
+type FanOutDelivery struct {
+	// ID identifies the delivery
+	ID string `json:"id"`
+	// Received is when the request was received
+	Received time.Time `json:"received"`
+	// Results are the results for each target
+	Results []FanOutResult `json:"results"`
+}
+
+// A FanOut is a handler which accepts requests, such as webhooks, and relays copies of them to several targets
+// in the background, retrying failed deliveries with exponential backoff. Requests are answered with 202 Accepted
+// and a FanOutDelivery, and the progress of recent deliveries can be followed with the handler returned by Status.
+// Deliveries are retried after network errors, 429 Too Many Requests, and 5xx statuses, and considered
+// delivered on a 2xx status. Authorization, cookie, and hop-by-hop headers are not relayed.
+type FanOut struct {
+	// Targets are the URLs to relay requests to. Requests are relayed with the same method.
+	Targets []string
+	// Client sends the deliveries. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// Attempts is how many times to try each delivery. If zero, DefaultFanOutAttempts is used.
+	Attempts int
+	// Backoff is how long to wait before the first retry. If zero, DefaultFanOutBackoff is used.
+	Backoff time.Duration
+	// MaxBodyBytes is the largest body which will be accepted. If zero, DefaultWebhookMaxBodyBytes is used.
+	MaxBodyBytes int64
+	// History is how many deliveries to remember the results of. If zero, DefaultFanOutHistory is used.
+	History int
+
+	once       sync.Once
+	lock       sync.Mutex
+	deliveries *boundedCache[string, *FanOutDelivery]
+	inFlight   sync.WaitGroup
+}
+
+func (f *FanOut) init() {
+	f.once.Do(func() {
+		history := f.History
+		if history == 0 {
+			history = DefaultFanOutHistory
+		}
+		f.deliveries = newBoundedCache[string, *FanOutDelivery](history)
+	})
+}
+
+// ServeHTTP implements Handler
+func (f *FanOut) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	f.init()
+	maxBodyBytes := f.MaxBodyBytes
+	if maxBodyBytes == 0 {
+		maxBodyBytes = DefaultWebhookMaxBodyBytes
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return nil
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
+	header := make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		if !fanOutSkippedHeaders.Has(k) {
+			header[k] = v
+		}
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	delivery := &FanOutDelivery{ID: hex.EncodeToString(id), Received: time.Now(), Results: make([]FanOutResult, len(f.Targets))}
+	for ix, target := range f.Targets {
+		delivery.Results[ix].URL = target
+	}
+	f.deliveries.put(delivery.ID, delivery)
+
+	ctx, _ = detachVars(ctx, pathVars)
+	for ix := range f.Targets {
+		f.inFlight.Add(1)
+		go func(ix int) {
+			defer f.inFlight.Done()
+			f.deliver(ctx, req.Method, header, body, delivery, ix)
+		}(ix)
+	}
+
+	status := f.snapshot(delivery)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(status)
+}
+
+// deliver relays a request to one target until it is delivered or the attempts run out
+func (f *FanOut) deliver(ctx context.Context, method string, header http.Header, body []byte, delivery *FanOutDelivery, ix int) {
+	attempts := f.Attempts
+	if attempts == 0 {
+		attempts = DefaultFanOutAttempts
+	}
+	backoff := f.Backoff
+	if backoff == 0 {
+		backoff = DefaultFanOutBackoff
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt != 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		statusCode, err := f.attempt(ctx, client, method, delivery.Results[ix].URL, header, body)
+		retry := err != nil || statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+		f.lock.Lock()
+		result := &delivery.Results[ix]
+		result.Attempts = attempt
+		result.StatusCode = statusCode
+		result.Error = ""
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Delivered = statusCode >= 200 && statusCode < 300
+		result.Done = !retry || attempt == attempts
+		f.lock.Unlock()
+		if !retry {
+			return
+		}
+	}
+}
+
+func (f *FanOut) attempt(ctx context.Context, client *http.Client, method, target string, header http.Header, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = header.Clone()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// snapshot returns a copy of a delivery which is safe to read while it is in progress
+func (f *FanOut) snapshot(delivery *FanOutDelivery) FanOutDelivery {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	status := *delivery
+	status.Results = append([]FanOutResult(nil), delivery.Results...)
+	return status
+}
+
+// Delivery returns the progress of a remembered delivery, and false if it is unknown
+func (f *FanOut) Delivery(id string) (FanOutDelivery, bool) {
+	f.init()
+	delivery, ok := f.deliveries.get(id)
+	if !ok {
+		return FanOutDelivery{}, false
+	}
+	return f.snapshot(delivery), true
+}
+
+// Status returns a handler which answers with the FanOutDelivery identified by a path variable,
+// or 404 Not Found if it is not remembered
+func (f *FanOut) Status(idVar string) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		delivery, ok := f.Delivery(pathVars[idVar])
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return nil
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		return json.NewEncoder(w).Encode(delivery)
+	})
+}
+
+// Wait waits for every delivery in progress to finish, such as when shutting down
+func (f *FanOut) Wait() {
+	f.inFlight.Wait()
+}
@@ -0,0 +1,70 @@
+package minimux_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FanOut", func() {
+	It("should relay requests to every target, retrying failures, and report the results", func() {
+		var received atomic.Value
+		good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			received.Store(req.Header.Get("X-Event") + ":" + string(body) + ":" + req.Header.Get("Authorization"))
+		}))
+		DeferCleanup(good.Close)
+		var flakyCalls atomic.Int32
+		flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if flakyCalls.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		DeferCleanup(flaky.Close)
+		bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		DeferCleanup(bad.Close)
+
+		fanOut := &minimux.FanOut{Targets: []string{good.URL, flaky.URL, bad.URL}, Backoff: time.Millisecond}
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/events").WithMethods(http.MethodPost).IsHandledBy(fanOut),
+				minimux.PathWithVars("/events/([0-9a-f]+)", "id").IsHandledBy(fanOut.Status("id")),
+			},
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader("payload"))
+		req.Header.Set("X-Event", "push")
+		req.Header.Set("Authorization", "secret")
+		resp := serve(mux, req)
+		Expect(resp.Code).To(Equal(http.StatusAccepted))
+		var accepted minimux.FanOutDelivery
+		Expect(json.Unmarshal(resp.Body.Bytes(), &accepted)).To(Succeed())
+		Expect(accepted.Results).To(HaveLen(3))
+
+		fanOut.Wait()
+		Expect(received.Load()).To(Equal("push:payload:"))
+
+		resp = serve(mux, httptest.NewRequest(http.MethodGet, "/events/"+accepted.ID, nil))
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		var status minimux.FanOutDelivery
+		Expect(json.Unmarshal(resp.Body.Bytes(), &status)).To(Succeed())
+		Expect(status.Results).To(Equal([]minimux.FanOutResult{
+			{URL: good.URL, Attempts: 1, StatusCode: http.StatusOK, Done: true, Delivered: true},
+			{URL: flaky.URL, Attempts: 2, StatusCode: http.StatusOK, Done: true, Delivered: true},
+			{URL: bad.URL, Attempts: 1, StatusCode: http.StatusBadRequest, Done: true},
+		}))
+
+		Expect(serve(mux, httptest.NewRequest(http.MethodGet, "/events/00", nil)).Code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,155 @@
+package minimux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// A FileServerOption configures a handler returned by FileServer
+type FileServerOption func(*fileServer)
+
+// FileServerPathVar uses a path variable as the path of the file instead of the entire URL path, as with
+// StaticData.PathVar, such as to serve a directory under a prefix. If the variable is not present, the file is not found.
+func FileServerPathVar(name string) FileServerOption {
+	return func(f *fileServer) {
+		f.pathVar = name
+	}
+}
+
+// FileServerDefaultHandler answers requests for files which do not exist with a handler instead of 404 Not Found
+func FileServerDefaultHandler(handler Handler) FileServerOption {
+	return func(f *fileServer) {
+		f.defaultHandler = handler
+	}
+}
+
+// FileServerIndex serves a file with a name other than index.html for requests for its directory
+func FileServerIndex(name string) FileServerOption {
+	return func(f *fileServer) {
+		f.index = name
+	}
+}
+
+// FileServerFallback serves a file, such as index.html, for GET and HEAD requests for any path which does not exist
+// and does not look like an asset, as its last segment has no extension, so that single-page apps which route
+// on the client can be loaded from any of their paths. Missing assets are still not found.
+func FileServerFallback(name string) FileServerOption {
+	return func(f *fileServer) {
+		f.fallback = strings.TrimPrefix(path.Clean("/"+name), "/")
+	}
+}
+
+// fileServer serves files from an fs.FS
+type fileServer struct {
+	fsys           fs.FS
+	pathVar        string
+	defaultHandler Handler
+	index          string
+	fallback       string
+}
+
+// FileServer returns a handler which serves the files in an fs.FS, such as an embed.FS, with a Content-Type
+// chosen by their extension, or by their content if it is unknown, answering requests with a Range header,
+// and requests conditional on their modification time, as net/http.ServeContent does.
+// Requests for a directory are answered with its index.html file, redirecting to the path with a trailing slash
+// if it lacks one, and are not found if it has none, as directories are not listed.
+// Requests for files which do not exist are answered with 404 Not Found, unless there is a default handler,
+// and requests for paths which fail CheckPath are answered with 400 Bad Request.
+// With FileServerFallback, requests for paths which do not exist and are not assets are answered with a fallback file.
+func FileServer(fsys fs.FS, opts ...FileServerOption) Handler {
+	f := &fileServer{fsys: fsys, index: "index.html"}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// ServeHTTP implements Handler
+func (f *fileServer) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	ok := true
+	key := req.URL.Path
+	if f.pathVar != "" {
+		key, ok = pathVars[f.pathVar]
+	}
+	if !ok {
+		return f.notFound(ctx, w, req, pathVars, formErr, "")
+	}
+	if CheckPath(key) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	name := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(f.fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f.notFound(ctx, w, req, pathVars, formErr, name)
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(req.URL.Path, "/") {
+			http.Redirect(w, req, path.Base(req.URL.Path)+"/", http.StatusMovedPermanently)
+			return nil
+		}
+		name = path.Join(name, f.index)
+		if info, err = fs.Stat(f.fsys, name); errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+			return f.notFound(ctx, w, req, pathVars, formErr, path.Dir(name))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return f.serveFile(w, req, name, info.ModTime())
+}
+
+// serveFile answers a request with the content of a file
+func (f *fileServer) serveFile(w http.ResponseWriter, req *http.Request, name string, modTime time.Time) error {
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, req, name, modTime, content)
+	return nil
+}
+
+// notFound answers a request for a file which does not exist, given its name, or an empty name if there is none,
+// with the fallback file if it is not an asset
+func (f *fileServer) notFound(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error, name string) error {
+	if f.fallback != "" && name != "" && path.Ext(name) == "" && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		info, err := fs.Stat(f.fsys, f.fallback)
+		if err == nil && !info.IsDir() {
+			return f.serveFile(w, req, f.fallback, info.ModTime())
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if f.defaultHandler != nil {
+		return f.defaultHandler.ServeHTTP(ctx, w, req, pathVars, formErr)
+	}
+	w.WriteHeader(http.StatusNotFound)
+	return nil
+}
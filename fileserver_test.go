@@ -0,0 +1,120 @@
+package minimux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileServer", func() {
+	modTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("<html>home</html>"), ModTime: modTime},
+		"app.js":          {Data: []byte("console.log(1)"), ModTime: modTime},
+		"data":            {Data: []byte("plain text"), ModTime: modTime},
+		"docs/index.html": {Data: []byte("<html>docs</html>"), ModTime: modTime},
+		"empty/file.txt":  {Data: []byte("file"), ModTime: modTime},
+	}
+	mux := &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.PathWithVars("/static(/.*)?", "path").IsHandledBy(minimux.FileServer(fsys,
+				minimux.FileServerPathVar("path"),
+				minimux.FileServerDefaultHandler(respondWith("default")),
+			)),
+			minimux.PathPattern("/.*").IsHandledBy(minimux.FileServer(fsys)),
+		},
+	}
+	request := func(path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for ix := 0; ix < len(headers); ix += 2 {
+			req.Header.Set(headers[ix], headers[ix+1])
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	DescribeTable("should serve files",
+		func(path, contentType, body string) {
+			w := request(path)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("Content-Type")).To(HavePrefix(contentType))
+			Expect(w.Header().Get("Last-Modified")).To(Equal("Mon, 06 May 2024 07:08:09 GMT"))
+			Expect(w.Body.String()).To(Equal(body))
+		},
+		Entry("by extension", "/app.js", "text/javascript", "console.log(1)"),
+		Entry("by content", "/data", "text/plain", "plain text"),
+		Entry("the root index", "/", "text/html", "<html>home</html>"),
+		Entry("a directory index", "/docs/", "text/html", "<html>docs</html>"),
+		Entry("from a path variable", "/static/app.js", "text/javascript", "console.log(1)"),
+		Entry("the index from a path variable", "/static/docs/", "text/html", "<html>docs</html>"),
+	)
+
+	DescribeTable("should redirect directories to their path with a trailing slash",
+		func(path, location string) {
+			w := request(path)
+			Expect(w.Code).To(Equal(http.StatusMovedPermanently))
+			Expect(w.Header().Get("Location")).To(Equal(location))
+		},
+		Entry("at the root", "/docs", "/docs/"),
+		Entry("from a path variable", "/static/docs", "/static/docs/"),
+		Entry("at the path variable's root", "/static", "/static/"),
+	)
+
+	DescribeTable("should answer requests for missing files",
+		func(path string, expectedStatus int, body string) {
+			w := request(path)
+			Expect(w.Code).To(Equal(expectedStatus))
+			Expect(w.Body.String()).To(Equal(body))
+		},
+		Entry("with 404", "/missing.js", http.StatusNotFound, ""),
+		Entry("with 404 for a directory without an index", "/empty/", http.StatusNotFound, ""),
+		Entry("with the default handler", "/static/missing.js", http.StatusOK, "default"),
+		Entry("with 400 for unsafe paths", "/static/..%2fsecret", http.StatusBadRequest, ""),
+	)
+
+	It("should answer range and conditional requests", func() {
+		w := request("/app.js", "Range", "bytes=0-6")
+		Expect(w.Code).To(Equal(http.StatusPartialContent))
+		Expect(w.Body.String()).To(Equal("console"))
+		w = request("/app.js", "If-Modified-Since", "Mon, 06 May 2024 07:08:09 GMT")
+		Expect(w.Code).To(Equal(http.StatusNotModified))
+	})
+})
+
+var _ = Describe("FileServer with a fallback", func() {
+	fsys := fstest.MapFS{
+		"index.html":     {Data: []byte("<html>app</html>")},
+		"assets/app.js":  {Data: []byte("console.log(1)")},
+		"empty/file.txt": {Data: []byte("file")},
+	}
+	mux := &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.PathWithVars("/app(/.*)?", "path").IsHandledBy(minimux.FileServer(fsys,
+				minimux.FileServerPathVar("path"),
+				minimux.FileServerFallback("index.html"),
+			)),
+		},
+	}
+
+	DescribeTable("should answer requests",
+		func(method, path string, expectedStatus int, body string) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+			Expect(w.Code).To(Equal(expectedStatus))
+			Expect(w.Body.String()).To(Equal(body))
+		},
+		Entry("for files", http.MethodGet, "/app/assets/app.js", http.StatusOK, "console.log(1)"),
+		Entry("for the index", http.MethodGet, "/app/", http.StatusOK, "<html>app</html>"),
+		Entry("for client-side routes with the fallback", http.MethodGet, "/app/users/42", http.StatusOK, "<html>app</html>"),
+		Entry("for directories without an index with the fallback", http.MethodGet, "/app/empty/", http.StatusOK, "<html>app</html>"),
+		Entry("for missing assets with 404", http.MethodGet, "/app/assets/missing.js", http.StatusNotFound, ""),
+		Entry("with other methods with 404", http.MethodPost, "/app/users/42", http.StatusNotFound, ""),
+	)
+})
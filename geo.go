@@ -0,0 +1,82 @@
+package minimux
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// GeoLocation is where a client is, as far as a GeoResolver can tell
+type GeoLocation struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country, e.g. "US", or empty if it is unknown
+	Country string
+	// Region is the ISO 3166-2 code of the region within the country, e.g. "US-CA", or empty if it is unknown
+	Region string
+}
+
+// A GeoResolver looks up where an IP address is, such as from a GeoIP database
+type GeoResolver interface {
+	// Resolve returns the location of an address. Unknown addresses should return an empty location, not an error.
+	Resolve(ctx context.Context, addr netip.Addr) (GeoLocation, error)
+}
+
+// GeoResolverFunc wraps a function into a GeoResolver
+type GeoResolverFunc func(ctx context.Context, addr netip.Addr) (GeoLocation, error)
+
+// Resolve implements GeoResolver
+func (f GeoResolverFunc) Resolve(ctx context.Context, addr netip.Addr) (GeoLocation, error) {
+	return f(ctx, addr)
+}
+
+type geoKey struct{}
+
+// ResolveGeo returns a PreProcessor which records the location of the client address of a request in the context,
+// where handlers and PostProcessors, such as those recording metrics, can find it with GeoFromContext,
+// and routes constrained with WithGeo check it. If the location cannot be resolved, none is recorded.
+func ResolveGeo(resolver GeoResolver) PreProcessor {
+	return func(ctx context.Context, req *http.Request) (context.Context, func()) {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return ctx, nil
+		}
+		location, err := resolver.Resolve(ctx, addr.Unmap())
+		if err != nil {
+			return ctx, nil
+		}
+		return context.WithValue(ctx, geoKey{}, location), nil
+	}
+}
+
+// GeoFromContext returns the location of the client of a request, or false if it was not resolved
+func GeoFromContext(ctx context.Context) (GeoLocation, bool) {
+	location, ok := ctx.Value(geoKey{}).(GeoLocation)
+	return location, ok
+}
+
+// InCountries returns a function for WithGeo which accepts locations in any of a set of countries or regions,
+// such as "US" or "US-CA"
+func InCountries(codes ...string) func(GeoLocation) bool {
+	allowed := StringSet{}
+	for _, code := range codes {
+		allowed[strings.ToUpper(code)] = struct{}{}
+	}
+	return func(location GeoLocation) bool {
+		return (location.Country != "" && allowed.Has(strings.ToUpper(location.Country))) ||
+			(location.Region != "" && allowed.Has(strings.ToUpper(location.Region)))
+	}
+}
+
+// NotInCountries returns a function for WithGeo which accepts locations outside all of a set of countries or regions,
+// such as for export restrictions. Locations which could not be resolved are not accepted.
+func NotInCountries(codes ...string) func(GeoLocation) bool {
+	in := InCountries(codes...)
+	return func(location GeoLocation) bool {
+		return location.Country != "" && !in(location)
+	}
+}
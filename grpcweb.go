@@ -0,0 +1,276 @@
+package minimux
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	// grpcWebTrailerFlag marks the frame of a gRPC-Web response which carries the trailers
+	grpcWebTrailerFlag = 0x80
+	// grpcWebTextLimit is the largest base64-encoded request body a GRPCWeb decodes, if its MaxBodyBytes is not set.
+	// Browsers can only send unary and server-streaming calls, so request bodies are a single message.
+	grpcWebTextLimit = 4 << 20
+)
+
+// GRPCWeb is a handler which translates gRPC-Web requests from browsers, in either the binary
+// (application/grpc-web) or text (application/grpc-web-text) format, into gRPC requests to a backend,
+// and translates the responses back, including the trailers, which browsers cannot read.
+// Requests with any other content type are answered with 415 Unsupported Media Type.
+// CORS, if needed, must be handled separately, and should expose the grpc-status and grpc-message headers.
+type GRPCWeb struct {
+	// Backend, if set, serves the gRPC requests in-process, such as a *grpc.Server from google.golang.org/grpc.
+	// It is called with an HTTP/2 request, and must set its trailers as net/http handlers do.
+	Backend http.Handler
+	// Target, if Backend is not set, is the base URL of a gRPC server to send requests to, e.g. "https://backend:8443"
+	Target *url.URL
+	// Transport sends requests to Target. It must use HTTP/2, which, for a Target using TLS, the default
+	// transport negotiates automatically. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+	// MaxBodyBytes, if non-zero, is the largest request body to accept, after decoding
+	MaxBodyBytes int64
+}
+
+// ServeHTTP implements Handler
+func (g *GRPCWeb) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	contentType := req.Header.Get("Content-Type")
+	subtype, text, ok := grpcWebSubtype(contentType)
+	if !ok || req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return nil
+	}
+
+	backendReq := req.Clone(ctx)
+	backendReq.Proto, backendReq.ProtoMajor, backendReq.ProtoMinor = "HTTP/2.0", 2, 0
+	backendReq.Header.Set("Content-Type", "application/grpc"+subtype)
+	backendReq.Header.Set("Te", "trailers")
+	backendReq.Header.Del("X-Grpc-Web")
+	backendReq.Header.Del("X-User-Agent")
+	backendReq.Header.Del("Content-Length")
+	if text {
+		body, err := decodeGRPCWebText(req.Body, g.MaxBodyBytes)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return err
+		}
+		backendReq.Body = io.NopCloser(bytes.NewReader(body))
+		backendReq.ContentLength = int64(len(body))
+	} else if g.MaxBodyBytes != 0 {
+		backendReq.Body = http.MaxBytesReader(w, req.Body, g.MaxBodyBytes)
+	}
+
+	backend := g.Backend
+	if backend == nil {
+		backend = http.HandlerFunc(g.roundTrip)
+	}
+	webW := &grpcWebResponseWriter{inner: w, header: make(http.Header), contentType: contentType, text: text}
+	backend.ServeHTTP(webW, backendReq)
+	return webW.finish()
+}
+
+// grpcWebSubtype returns the gRPC subtype, such as "+proto", of a gRPC-Web content type, and if it is the text format
+func grpcWebSubtype(contentType string) (subtype string, text bool, ok bool) {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	contentType = strings.TrimSpace(contentType)
+	if rest, found := strings.CutPrefix(contentType, "application/grpc-web-text"); found {
+		return rest, true, rest == "" || strings.HasPrefix(rest, "+")
+	}
+	if rest, found := strings.CutPrefix(contentType, "application/grpc-web"); found {
+		return rest, false, rest == "" || strings.HasPrefix(rest, "+")
+	}
+	return "", false, false
+}
+
+// decodeGRPCWebText decodes a text format request body, which may be several padded base64 chunks one after another
+func decodeGRPCWebText(body io.Reader, maxBodyBytes int64) ([]byte, error) {
+	limit := int64(grpcWebTextLimit)
+	if maxBodyBytes != 0 {
+		limit = int64(base64.StdEncoding.EncodedLen(int(maxBodyBytes)))
+	}
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("gRPC-Web request body larger than %d bytes", limit)
+	}
+	data = bytes.TrimSpace(data)
+	decoded := make([]byte, 0, base64.StdEncoding.DecodedLen(len(data)))
+	for len(data) != 0 {
+		end := bytes.IndexByte(data, '=')
+		if end == -1 {
+			end = len(data)
+		}
+		for end < len(data) && data[end] == '=' {
+			end++
+		}
+		n, err := base64.StdEncoding.Decode(decoded[len(decoded):cap(decoded)], data[:end])
+		if err != nil {
+			return nil, err
+		}
+		decoded = decoded[:len(decoded)+n]
+		data = data[end:]
+	}
+	return decoded, nil
+}
+
+// roundTrip sends a gRPC request to the Target, and writes the response as a net/http handler would
+func (g *GRPCWeb) roundTrip(w http.ResponseWriter, req *http.Request) {
+	req.URL.Scheme = g.Target.Scheme
+	req.URL.Host = g.Target.Host
+	req.URL.Path = strings.TrimSuffix(g.Target.Path, "/") + req.URL.Path
+	req.URL.RawPath = ""
+	req.Host = g.Target.Host
+	req.RequestURI = ""
+	transport := g.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		// 14 is UNAVAILABLE
+		w.Header().Set("Grpc-Status", "14")
+		w.Header().Set("Grpc-Message", url.PathEscape(err.Error()))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n != 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+		if err != nil {
+			break
+		}
+	}
+	for k, v := range resp.Trailer {
+		w.Header()[http.TrailerPrefix+k] = v
+	}
+}
+
+// grpcWebResponseWriter translates a gRPC response into a gRPC-Web response as it is written
+type grpcWebResponseWriter struct {
+	inner       http.ResponseWriter
+	header      http.Header
+	contentType string
+	text        bool
+	wroteHeader bool
+	// err is the first error writing to inner
+	err error
+}
+
+// trailers returns the names of the headers which were declared as trailers
+func (g *grpcWebResponseWriter) trailers() []string {
+	var names []string
+	for _, declared := range g.header.Values("Trailer") {
+		for _, name := range strings.Split(declared, ",") {
+			names = append(names, http.CanonicalHeaderKey(strings.TrimSpace(name)))
+		}
+	}
+	return names
+}
+
+// Header implements http.ResponseWriter
+func (g *grpcWebResponseWriter) Header() http.Header {
+	return g.header
+}
+
+// WriteHeader implements http.ResponseWriter
+func (g *grpcWebResponseWriter) WriteHeader(statusCode int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	trailers := g.trailers()
+	h := g.inner.Header()
+	for k, v := range g.header {
+		if k == "Trailer" || k == "Content-Length" || slices.Contains(trailers, k) || strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		h[k] = v
+	}
+	h.Set("Content-Type", g.contentType)
+	h.Set("Access-Control-Expose-Headers", "Grpc-Status, Grpc-Message")
+	g.inner.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter
+func (g *grpcWebResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.text {
+		_, g.err = io.WriteString(g.inner, base64.StdEncoding.EncodeToString(b))
+	} else {
+		_, g.err = g.inner.Write(b)
+	}
+	if g.err != nil {
+		return 0, g.err
+	}
+	return len(b), nil
+}
+
+// Flush implements http.Flusher
+func (g *grpcWebResponseWriter) Flush() {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(g.inner).Flush()
+}
+
+// finish writes the trailers, sorted by name, as the final frame of the response
+func (g *grpcWebResponseWriter) finish() error {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	trailerValues := make(http.Header)
+	for _, name := range g.trailers() {
+		trailerValues[name] = append(trailerValues[name], g.header.Values(name)...)
+	}
+	for k, v := range g.header {
+		if name, ok := strings.CutPrefix(k, http.TrailerPrefix); ok {
+			name = http.CanonicalHeaderKey(name)
+			trailerValues[name] = append(trailerValues[name], v...)
+		}
+	}
+	names := make([]string, 0, len(trailerValues))
+	for name := range trailerValues {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var trailers bytes.Buffer
+	for _, name := range names {
+		for _, value := range trailerValues[name] {
+			trailers.WriteString(strings.ToLower(name))
+			trailers.WriteString(": ")
+			trailers.WriteString(value)
+			trailers.WriteString("\r\n")
+		}
+	}
+	frame := make([]byte, 5, 5+trailers.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(trailers.Len()))
+	frame = append(frame, trailers.Bytes()...)
+	_, err := g.Write(frame)
+	return err
+}
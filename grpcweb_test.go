@@ -0,0 +1,98 @@
+package minimux_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// grpcFrame returns a length-prefixed gRPC message frame
+func grpcFrame(flags byte, message string) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+// echoGRPC is a gRPC backend which answers each request with the message it was sent
+var echoGRPC = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	if req.ProtoMajor != 2 || req.Header.Get("Content-Type") != "application/grpc+proto" || req.Header.Get("Te") != "trailers" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Write(body)
+	w.Header().Set("Grpc-Status", "0")
+	w.Header().Set("Grpc-Message", "")
+})
+
+var _ = Describe("GRPCWeb", func() {
+	request := grpcFrame(0, "hello")
+	response := append(grpcFrame(0, "hello"), grpcFrame(0x80, "grpc-message: \r\ngrpc-status: 0\r\n")...)
+
+	call := func(grpcWeb *minimux.GRPCWeb, contentType string, body []byte) *httptest.ResponseRecorder {
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.PathPattern("/echo\\.Echo/.*").WithMethods(http.MethodPost).IsHandledBy(grpcWeb),
+			},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/echo.Echo/Echo", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Grpc-Web", "1")
+		return serve(mux, req)
+	}
+
+	It("should translate binary requests for an in-process backend", func() {
+		resp := call(&minimux.GRPCWeb{Backend: echoGRPC}, "application/grpc-web+proto", request)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("Content-Type")).To(Equal("application/grpc-web+proto"))
+		Expect(resp.Header().Get("Grpc-Status")).To(BeEmpty())
+		Expect(resp.Body.Bytes()).To(Equal(response))
+	})
+
+	It("should translate text requests split into padded chunks", func() {
+		body := base64.StdEncoding.EncodeToString(request[:4]) + base64.StdEncoding.EncodeToString(request[4:])
+		resp := call(&minimux.GRPCWeb{Backend: echoGRPC}, "application/grpc-web-text+proto", []byte(body))
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("Content-Type")).To(Equal("application/grpc-web-text+proto"))
+		var decoded []byte
+		for _, chunk := range regexp.MustCompile(`[^=]+=*`).FindAllString(resp.Body.String(), -1) {
+			data, err := base64.StdEncoding.DecodeString(chunk)
+			Expect(err).ToNot(HaveOccurred())
+			decoded = append(decoded, data...)
+		}
+		Expect(decoded).To(Equal(response))
+	})
+
+	It("should translate requests for a backend over HTTP/2", func() {
+		backend := httptest.NewUnstartedServer(echoGRPC)
+		backend.EnableHTTP2 = true
+		backend.StartTLS()
+		DeferCleanup(backend.Close)
+		target, err := url.Parse(backend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		resp := call(&minimux.GRPCWeb{Target: target, Transport: backend.Client().Transport}, "application/grpc-web+proto", request)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.Bytes()).To(Equal(response))
+	})
+
+	It("should reject requests which are not gRPC-Web", func() {
+		Expect(call(&minimux.GRPCWeb{Backend: echoGRPC}, "application/json", request).Code).To(Equal(http.StatusUnsupportedMediaType))
+	})
+})
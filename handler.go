@@ -1,14 +1,22 @@
 package minimux
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // A Handler handles requests
 type Handler interface {
 	// ServeHTTP serves an http request, along with parsed route variables and the error
 	// from parsing form data, if any.
+	// The pathVars map belongs to the request, so it may be kept after ServeHTTP returns.
 	ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error
 }
 
@@ -20,8 +28,10 @@ func (f HandlerFunc) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *
 	return f(ctx, w, req, pathVars, formErr)
 }
 
-// Simple wraps a net/http.Handler to implement Handler by discarding the context, path variables
-// and form error, and returning a nil error
+// Simple wraps a net/http.Handler to implement Handler by discarding the path variables and form error,
+// and returning a nil error. If there are any path variables, the request is given the context, so that
+// they can be found with VarsFromContext, and, since Go 1.22, they are also returned by its PathValue method,
+// so handlers written for net/http.ServeMux work unchanged.
 func Simple(handler http.Handler) Handler {
 	return simple{Handler: handler}
 }
@@ -31,12 +41,11 @@ type simple struct {
 }
 
 func (s simple) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
-	s.Handler.ServeHTTP(w, req)
+	s.Handler.ServeHTTP(w, withContextIfVars(ctx, req, pathVars))
 	return nil
 }
 
-// SimpleFunc wraps a net/http.HandlerFunc to implement Handler by discarding the context, path variables
-// and form error, and returning a nil error
+// SimpleFunc wraps a net/http.HandlerFunc to implement Handler, as with Simple
 func SimpleFunc(handlerFunc http.HandlerFunc) Handler {
 	return simpleFunc{HandlerFunc: handlerFunc}
 }
@@ -46,10 +55,24 @@ type simpleFunc struct {
 }
 
 func (s simpleFunc) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
-	s.HandlerFunc(w, req)
+	s.HandlerFunc(w, withContextIfVars(ctx, req, pathVars))
 	return nil
 }
 
+// withContextIfVars returns a copy of the request with a context holding the path variables, which are also
+// returned by its PathValue method since Go 1.22, if there are any, or the request unchanged otherwise
+func withContextIfVars(ctx context.Context, req *http.Request, pathVars map[string]string) *http.Request {
+	if len(pathVars) == 0 {
+		return req
+	}
+	if VarsFromContext(ctx) == nil {
+		ctx = withVars(ctx, pathVars)
+	}
+	req = req.WithContext(ctx)
+	setPathValues(req, pathVars)
+	return req
+}
+
 // NotFound is a handler that returns a 404 status and does nothing else
 var NotFound Handler = HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
 	w.WriteHeader(http.StatusNotFound)
@@ -68,12 +91,79 @@ func RedirectingTo(url string, statusCode int) Handler {
 type StaticBytes struct {
 	Data        []byte
 	ContentType string
+	// ModTime is optionally when the data last changed, which is sent as its Last-Modified time,
+	// so that requests with an If-Modified-Since header can be answered with 304 Not Modified
+	ModTime time.Time
+	// ETag is an optional entity tag for the data, including its quotes, so that requests with an If-None-Match
+	// header can be answered with 304 Not Modified
+	ETag string
+	// CacheControl is an optional Cache-Control header to send with the data, such as "public, max-age=3600"
+	CacheControl string
+
+	// headers are the precomputed response headers, if constructed with NewStaticBytes or NewHashedStaticBytes
+	headers staticHeaders
 }
 
-// ServeHTTP implements Handler
+// NewStaticBytes returns static data to return with its response headers computed ahead of time,
+// so that serving it does not allocate. Data must not be modified afterwards.
+func NewStaticBytes(data []byte, contentType string) StaticBytes {
+	return StaticBytes{
+		Data:        data,
+		ContentType: contentType,
+		headers:     newStaticHeaders(contentType, len(data), "", time.Time{}),
+	}
+}
+
+// NewHashedStaticBytes returns static data to return, as with NewStaticBytes, along with its modification time,
+// which may be zero, and an ETag computed by hashing it once, ahead of time
+func NewHashedStaticBytes(data []byte, contentType string, modTime time.Time) StaticBytes {
+	sum := sha256.Sum256(data)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	return StaticBytes{
+		Data:        data,
+		ContentType: contentType,
+		ModTime:     modTime,
+		ETag:        etag,
+		headers:     newStaticHeaders(contentType, len(data), etag, modTime),
+	}
+}
+
+// WithCacheControl returns a copy of static data which is sent with a Cache-Control header, such as
+// "public, max-age=3600", computed ahead of time
+func (s StaticBytes) WithCacheControl(policy string) StaticBytes {
+	s.CacheControl = policy
+	s.headers.cacheControl = []string{policy}[:1:1]
+	return s
+}
+
+// ServeHTTP implements Handler.
+// Requests with a Range header are answered with the requested ranges, as multipart/byteranges if there are several,
+// requests conditional on the ETag or ModTime with 304 Not Modified, and HEAD requests with only the headers.
+// Every response, including a 304, has the CacheControl header, if there is one.
 func (s StaticBytes) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
-	w.Header().Add("Content-Type", s.ContentType)
+	if s.headers.cacheControl != nil && s.headers.cacheControl[0] == s.CacheControl {
+		w.Header()["Cache-Control"] = s.headers.cacheControl
+	} else if s.CacheControl != "" {
+		w.Header().Set("Cache-Control", s.CacheControl)
+	}
+	if s.ETag != "" || !s.ModTime.IsZero() {
+		if notModified(req, s.ETag, s.ModTime) {
+			s.headers.setValidators(w.Header(), s.ETag, s.ModTime)
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+	if _, ok := req.Header["Range"]; ok {
+		s.headers.setValidators(w.Header(), s.ETag, s.ModTime)
+		if served, err := serveRanges(w, req, s.ContentType, s.ETag, s.ModTime, bytes.NewReader(s.Data), int64(len(s.Data))); served {
+			return err
+		}
+	}
+	s.headers.set(w.Header(), s.ContentType, len(s.Data), s.ETag, s.ModTime)
 	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodHead {
+		return nil
+	}
 	_, err := w.Write(s.Data)
 	return err
 }
@@ -82,21 +172,101 @@ func (s StaticBytes) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *
 type StaticString struct {
 	Data        string
 	ContentType string
+
+	// headers are the precomputed response headers, if constructed with NewStaticString
+	headers staticHeaders
 }
 
-// ServeHTTP implements Handler
+// NewStaticString returns static data to return with its response headers computed ahead of time,
+// so that serving it does not allocate
+func NewStaticString(data string, contentType string) StaticString {
+	return StaticString{
+		Data:        data,
+		ContentType: contentType,
+		headers:     newStaticHeaders(contentType, len(data), "", time.Time{}),
+	}
+}
+
+// ServeHTTP implements Handler.
+// Requests with a Range header are answered with the requested ranges, as multipart/byteranges if there are several,
+// and HEAD requests with only the headers.
 func (s StaticString) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
-	return StaticBytes{Data: []byte(s.Data), ContentType: s.ContentType}.ServeHTTP(ctx, w, req, pathVars, formErr)
+	if _, ok := req.Header["Range"]; ok {
+		if served, err := serveRanges(w, req, s.ContentType, "", time.Time{}, strings.NewReader(s.Data), int64(len(s.Data))); served {
+			return err
+		}
+	}
+	s.headers.set(w.Header(), s.ContentType, len(s.Data), "", time.Time{})
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodHead {
+		return nil
+	}
+	_, err := io.WriteString(w, s.Data)
+	return err
+}
+
+// staticHeaders are the precomputed values of the headers for static data
+type staticHeaders struct {
+	contentType   []string
+	contentLength []string
+	etag          []string
+	lastModified  []string
+	cacheControl  []string
+}
+
+func newStaticHeaders(contentType string, contentLength int, etag string, modTime time.Time) staticHeaders {
+	// The capacity is limited so that appending to the header values copies them
+	// instead of modifying the shared values
+	s := staticHeaders{
+		contentType:   []string{contentType}[:1:1],
+		contentLength: []string{strconv.Itoa(contentLength)}[:1:1],
+	}
+	if etag != "" {
+		s.etag = []string{etag}[:1:1]
+	}
+	if !modTime.IsZero() {
+		s.lastModified = []string{modTime.UTC().Format(http.TimeFormat)}[:1:1]
+	}
+	return s
+}
+
+// set sets the headers for static data, using the precomputed values if present
+func (s staticHeaders) set(h http.Header, contentType string, contentLength int, etag string, modTime time.Time) {
+	if s.contentType == nil {
+		s = newStaticHeaders(contentType, contentLength, etag, modTime)
+	}
+	h["Content-Type"] = s.contentType
+	h["Content-Length"] = s.contentLength
+	h["Accept-Ranges"] = acceptRanges
+	s.setValidators(h, etag, modTime)
+}
+
+// setValidators sets the ETag and Last-Modified headers for static data, if it has them,
+// using the precomputed values if present
+func (s staticHeaders) setValidators(h http.Header, etag string, modTime time.Time) {
+	if s.etag != nil {
+		h["Etag"] = s.etag
+	} else if etag != "" {
+		h.Set("Etag", etag)
+	}
+	if s.lastModified != nil {
+		h["Last-Modified"] = s.lastModified
+	} else if !modTime.IsZero() {
+		h.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
 }
 
 // StaticData is a set of static strings and bytes which answers requests with the matching data.
+// Use NewStaticBytes to construct the data to avoid allocating when serving it.
 // If there is no match, and Default is non-nil, it will be called, otherwise, the response will be untouched.
 // If PathVar is non-empty, that path variable will be used as the map key instead of the entire URL path.
 // If that variable is not present, it will act as if the path was not matched.
+// If CacheControl is non-empty, it is sent as the Cache-Control header of data without a CacheControl of its own.
 type StaticData struct {
 	StaticBytes    map[string]StaticBytes
 	DefaultHandler Handler
 	PathVar        string
+	CacheControl   string
 }
 
 // ServeHTTP implements Handler
@@ -111,6 +281,9 @@ func (s StaticData) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *h
 		byteData, ok = s.StaticBytes[key]
 	}
 	if ok {
+		if byteData.CacheControl == "" {
+			byteData.CacheControl = s.CacheControl
+		}
 		return byteData.ServeHTTP(ctx, w, req, pathVars, formErr)
 	}
 	if s.DefaultHandler != nil {
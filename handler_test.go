@@ -2,8 +2,13 @@ package minimux_test
 
 import (
 	"context"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"time"
 
 	"github.com/meln5674/minimux"
 
@@ -78,6 +83,20 @@ var _ = Describe("Redirecting", func() {
 	})
 })
 
+var _ = Describe("StaticString", func() {
+	It("should return the string", func() {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		resp := httptest.NewRecorder()
+		Expect(minimux.NewStaticString("bar", "baz").ServeHTTP(context.Background(), resp, req, nil, nil)).To(Succeed())
+		res := resp.Result()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(res.Header).To(HaveKeyWithValue("Content-Type", []string{"baz"}))
+		Expect(res.Header).To(HaveKeyWithValue("Content-Length", []string{"3"}))
+		Expect(resp.Body.String()).To(Equal("bar"))
+	})
+})
+
 var _ = Describe("StaticData", func() {
 	When("no path variable is specified", func() {
 		When("there is data that matches the whole URL", func() {
@@ -97,6 +116,26 @@ var _ = Describe("StaticData", func() {
 			})
 		})
 	})
+	When("the data was constructed with NewStaticBytes", func() {
+		It("should return that data with precomputed headers", func() {
+			s := minimux.StaticData{
+				StaticBytes: map[string]minimux.StaticBytes{"/foo": minimux.NewStaticBytes([]byte("bar"), "baz")},
+			}
+			for i := 0; i < 2; i++ {
+				req, err := http.NewRequest(http.MethodGet, "http://localhost/foo", nil)
+				Expect(err).ToNot(HaveOccurred())
+				resp := httptest.NewRecorder()
+				Expect(s.ServeHTTP(context.Background(), resp, req, nil, nil)).To(Succeed())
+				res := resp.Result()
+				Expect(res.StatusCode).To(Equal(http.StatusOK))
+				Expect(res.Header).To(HaveKeyWithValue("Content-Type", []string{"baz"}))
+				Expect(res.Header).To(HaveKeyWithValue("Content-Length", []string{"3"}))
+				Expect(resp.Body.String()).To(Equal("bar"))
+				// Modifying the headers of one response must not affect the next
+				resp.Header().Add("Content-Type", "qux")
+			}
+		})
+	})
 	When("a path variable is specified", func() {
 		When("there is data that matches the path variable", func() {
 			It("should return that data", func() {
@@ -151,3 +190,175 @@ var _ = Describe("StaticData", func() {
 		})
 	})
 })
+
+var _ = Describe("Switchable", func() {
+	It("should call whichever handler was set last", func() {
+		blue := minimux.NewStaticString("blue", "text/plain")
+		green := minimux.NewStaticString("green", "text/plain")
+		switchable := &minimux.Switchable{}
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{minimux.PathPattern("/.*").IsHandledBy(switchable)},
+		}
+		get := func() *httptest.ResponseRecorder {
+			return serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+		}
+		Expect(get().Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(switchable.Set(blue)).To(BeNil())
+		Expect(get().Body.String()).To(Equal("blue"))
+		Expect(switchable.Set(green)).To(Equal(blue))
+		Expect(switchable.Get()).To(Equal(green))
+		Expect(get().Body.String()).To(Equal("green"))
+	})
+})
+
+var _ = Describe("Range requests for static data", func() {
+	data := minimux.NewStaticString("0123456789", "text/plain")
+	request := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Range", rangeHeader)
+		resp := httptest.NewRecorder()
+		Expect(data.ServeHTTP(context.Background(), resp, req, nil, nil)).To(Succeed())
+		return resp
+	}
+
+	DescribeTable("should serve a single range",
+		func(rangeHeader, contentRange, body string) {
+			resp := request(rangeHeader)
+			Expect(resp.Code).To(Equal(http.StatusPartialContent))
+			Expect(resp.Header().Get("Content-Range")).To(Equal(contentRange))
+			Expect(resp.Header().Get("Content-Length")).To(Equal(strconv.Itoa(len(body))))
+			Expect(resp.Body.String()).To(Equal(body))
+		},
+		Entry("bounded", "bytes=2-4", "bytes 2-4/10", "234"),
+		Entry("open-ended", "bytes=7-", "bytes 7-9/10", "789"),
+		Entry("suffix", "bytes=-2", "bytes 8-9/10", "89"),
+		Entry("past the end", "bytes=8-20", "bytes 8-9/10", "89"),
+	)
+
+	It("should serve multiple ranges as multipart/byteranges", func() {
+		resp := request("bytes=0-1, 5-6")
+		Expect(resp.Code).To(Equal(http.StatusPartialContent))
+		mediaType, params, err := mime.ParseMediaType(resp.Header().Get("Content-Type"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mediaType).To(Equal("multipart/byteranges"))
+		reader := multipart.NewReader(resp.Body, params["boundary"])
+		for _, expected := range [][]string{{"bytes 0-1/10", "01"}, {"bytes 5-6/10", "56"}} {
+			part, err := reader.NextPart()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(part.Header.Get("Content-Type")).To(Equal("text/plain"))
+			Expect(part.Header.Get("Content-Range")).To(Equal(expected[0]))
+			Expect(io.ReadAll(part)).To(Equal([]byte(expected[1])))
+		}
+		_, err = reader.NextPart()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("should reject unsatisfiable ranges", func() {
+		resp := request("bytes=20-30")
+		Expect(resp.Code).To(Equal(http.StatusRequestedRangeNotSatisfiable))
+		Expect(resp.Header().Get("Content-Range")).To(Equal("bytes */10"))
+	})
+
+	DescribeTable("should ignore ranges it should not serve",
+		func(rangeHeader string) {
+			resp := request(rangeHeader)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Accept-Ranges")).To(Equal("bytes"))
+			Expect(resp.Body.String()).To(Equal("0123456789"))
+		},
+		Entry("invalid", "bytes=4-2"),
+		Entry("another unit", "items=0-1"),
+		Entry("overlapping", "bytes=0-8, 1-9"),
+	)
+})
+
+var _ = Describe("StaticBytes with validators", func() {
+	modTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	data := minimux.NewHashedStaticBytes([]byte("0123456789"), "text/plain", modTime)
+	request := func(method string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		for ix := 0; ix < len(headers); ix += 2 {
+			req.Header.Set(headers[ix], headers[ix+1])
+		}
+		resp := httptest.NewRecorder()
+		Expect(data.ServeHTTP(context.Background(), resp, req, nil, nil)).To(Succeed())
+		return resp
+	}
+
+	It("should send its caching headers", func() {
+		resp := request(http.MethodGet)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("ETag")).To(Equal(data.ETag))
+		Expect(data.ETag).To(MatchRegexp(`^"[A-Za-z0-9_-]+"$`))
+		Expect(resp.Header().Get("Last-Modified")).To(Equal("Mon, 06 May 2024 07:08:09 GMT"))
+		Expect(resp.Body.String()).To(Equal("0123456789"))
+	})
+
+	It("should answer HEAD requests without a body", func() {
+		resp := request(http.MethodHead)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("Content-Length")).To(Equal("10"))
+		Expect(resp.Header().Get("ETag")).To(Equal(data.ETag))
+		Expect(resp.Body.String()).To(BeEmpty())
+	})
+
+	DescribeTable("should answer conditional requests",
+		func(expectedStatus int, headers ...string) {
+			resp := request(http.MethodGet, headers...)
+			Expect(resp.Code).To(Equal(expectedStatus))
+			if expectedStatus == http.StatusNotModified {
+				Expect(resp.Body.String()).To(BeEmpty())
+				Expect(resp.Header().Get("ETag")).To(Equal(data.ETag))
+			}
+		},
+		Entry("matching ETag", http.StatusNotModified, "If-None-Match", `"other", `+data.ETag),
+		Entry("matching weak ETag", http.StatusNotModified, "If-None-Match", "W/"+data.ETag),
+		Entry("other ETag", http.StatusOK, "If-None-Match", `"other"`),
+		Entry("not modified since", http.StatusNotModified, "If-Modified-Since", "Mon, 06 May 2024 07:08:09 GMT"),
+		Entry("modified since", http.StatusOK, "If-Modified-Since", "Mon, 06 May 2024 07:08:08 GMT"),
+		Entry("ETag takes precedence", http.StatusOK, "If-None-Match", `"other"`, "If-Modified-Since", "Mon, 06 May 2024 07:08:09 GMT"),
+		Entry("range with a matching If-Range", http.StatusPartialContent, "Range", "bytes=0-1", "If-Range", data.ETag),
+		Entry("range with a stale If-Range", http.StatusOK, "Range", "bytes=0-1", "If-Range", `"other"`),
+		Entry("range with a matching If-Range date", http.StatusPartialContent, "Range", "bytes=0-1", "If-Range", "Mon, 06 May 2024 07:08:09 GMT"),
+	)
+})
+
+var _ = Describe("StaticData with Cache-Control", func() {
+	s := minimux.StaticData{
+		StaticBytes: map[string]minimux.StaticBytes{
+			"/app.js":     minimux.NewHashedStaticBytes([]byte("app"), "text/javascript", time.Time{}).WithCacheControl("public, max-age=31536000, immutable"),
+			"/index.html": minimux.NewHashedStaticBytes([]byte("index"), "text/html", time.Time{}),
+		},
+		CacheControl: "no-cache",
+	}
+	request := func(path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for ix := 0; ix < len(headers); ix += 2 {
+			req.Header.Set(headers[ix], headers[ix+1])
+		}
+		resp := httptest.NewRecorder()
+		Expect(s.ServeHTTP(context.Background(), resp, req, nil, nil)).To(Succeed())
+		return resp
+	}
+
+	It("should send the Cache-Control of the data", func() {
+		resp := request("/app.js")
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("Cache-Control")).To(Equal("public, max-age=31536000, immutable"))
+	})
+
+	It("should send its own Cache-Control for data without one", func() {
+		resp := request("/index.html")
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("Cache-Control")).To(Equal("no-cache"))
+	})
+
+	It("should send the Cache-Control with 304 Not Modified", func() {
+		etag := s.StaticBytes["/index.html"].ETag
+		resp := request("/index.html", "If-None-Match", etag)
+		Expect(resp.Code).To(Equal(http.StatusNotModified))
+		Expect(resp.Header().Get("Cache-Control")).To(Equal("no-cache"))
+		Expect(resp.Header().Get("ETag")).To(Equal(etag))
+		Expect(resp.Body.String()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,60 @@
+package minimux
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// WithHostPattern limits a handler to requests whose host, without any port, matches a regular expression,
+// such as "[a-z]+\.example\.com" for any subdomain, and panics if it is invalid. Hosts are compared in lower case.
+// The values of its named capture groups, such as "(?P<tenant>[a-z]+)\.example\.com", become route variables,
+// along with those of the path, which take precedence if they have the same name.
+func (r *Route) WithHostPattern(pattern string) *Route {
+	r.HostPattern = regexp.MustCompile("^(?:" + pattern + ")$")
+	return r
+}
+
+// matchesHost returns true if the host of a request is one of Hosts, if any, and matches HostPattern, if any
+func (r *Route) matchesHost(req *http.Request) bool {
+	return matchesHost(r.Hosts, r.HostPattern, req)
+}
+
+// matchesHost returns true if the host of a request is in a set of hosts, if not nil,
+// and matches a host pattern, if not nil
+func matchesHost(hosts StringSet, pattern *regexp.Regexp, req *http.Request) bool {
+	if hosts != nil && !hosts.Has(req.Host) {
+		return false
+	}
+	return pattern == nil || pattern.MatchString(hostWithoutPort(req.Host))
+}
+
+// anyHost returns true if this route handles requests for any host
+func (r *Route) anyHost() bool {
+	return r.Hosts == nil && r.HostPattern == nil
+}
+
+// HostVarMap adds the values of the named capture groups of HostPattern for a request to a map of route variables
+func (r *Route) HostVarMap(req *http.Request, varMap map[string]string) {
+	if r.HostPattern == nil {
+		return
+	}
+	groups := r.HostPattern.FindStringSubmatch(hostWithoutPort(req.Host))
+	if groups == nil {
+		return
+	}
+	for ix, name := range r.HostPattern.SubexpNames() {
+		if ix != 0 && name != "" {
+			varMap[name] = groups[ix]
+		}
+	}
+}
+
+// hostWithoutPort returns the host of a Host header, without any port, in lower case
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
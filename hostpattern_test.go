@@ -0,0 +1,47 @@
+package minimux_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Routes with host patterns", func() {
+	tenantHandler := func(prefix string) minimux.Handler {
+		return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+			_, err := w.Write([]byte(prefix + pathVars["tenant"] + "/" + pathVars["id"]))
+			return err
+		})
+	}
+	mux := &minimux.Mux{
+		AllowRouteHosts: true,
+		Routes: []minimux.Route{
+			minimux.PathWithVars("/users/([^/]+)", "id").
+				WithHostPattern(`(?P<tenant>[a-z]+)\.example\.com`).
+				WithMethods(http.MethodGet).
+				IsHandledBy(tenantHandler("users-")),
+			minimux.LiteralPath("/").WithHostPattern(`.*\.example\.org`).IsHandledBy(tenantHandler("org-")),
+			minimux.LiteralPath("/").WithHosts("www.example.com").IsHandledBy(tenantHandler("www-")),
+		},
+	}
+
+	DescribeTable("should route requests by host",
+		func(method, url string, expectedStatus int, expectedBody string) {
+			resp := serve(mux, httptest.NewRequest(method, url, nil))
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("host variable", http.MethodGet, "http://acme.example.com/users/bob", http.StatusOK, "users-acme/bob"),
+		Entry("host variable with a port and upper case", http.MethodGet, "http://ACME.example.com:8080/users/bob", http.StatusOK, "users-acme/bob"),
+		Entry("wildcard", http.MethodGet, "http://a.b.example.org/", http.StatusOK, "org-/"),
+		Entry("exact host", http.MethodGet, "http://www.example.com/", http.StatusOK, "www-/"),
+		Entry("method not allowed", http.MethodPost, "http://acme.example.com/users/bob", http.StatusMethodNotAllowed, ""),
+		Entry("host not matching the pattern", http.MethodGet, "http://acme.example.net/users/bob", http.StatusMisdirectedRequest, ""),
+		Entry("host matching only part of the pattern", http.MethodGet, "http://evil.acme.example.com.attacker.net/users/bob", http.StatusMisdirectedRequest, ""),
+	)
+})
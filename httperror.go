@@ -0,0 +1,94 @@
+package minimux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HTTPError is an error for a handler to return which says how the request should be answered,
+// by an ErrorHandler such as WriteError
+type HTTPError struct {
+	// Code is the status code to answer the request with
+	Code int
+	// Message is the message to answer the request with, which is shown to the client
+	Message string
+	// Internal is the optional underlying error, which is not shown to the client
+	Internal error
+}
+
+// NewHTTPError returns an error which answers a request with a status code and message
+func NewHTTPError(code int, message string) *HTTPError {
+	return &HTTPError{Code: code, Message: message}
+}
+
+var (
+	// ErrBadRequest answers a request with 400 Bad Request
+	ErrBadRequest = NewHTTPError(http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+	// ErrUnauthorized answers a request with 401 Unauthorized
+	ErrUnauthorized = NewHTTPError(http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+	// ErrForbidden answers a request with 403 Forbidden
+	ErrForbidden = NewHTTPError(http.StatusForbidden, http.StatusText(http.StatusForbidden))
+	// ErrNotFound answers a request with 404 Not Found
+	ErrNotFound = NewHTTPError(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	// ErrConflict answers a request with 409 Conflict
+	ErrConflict = NewHTTPError(http.StatusConflict, http.StatusText(http.StatusConflict))
+)
+
+// Error implements error
+func (e *HTTPError) Error() string {
+	if e.Internal != nil {
+		return fmt.Sprintf("%d %s: %v", e.Code, e.Message, e.Internal)
+	}
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// Unwrap returns the internal error, for errors.Is and errors.As
+func (e *HTTPError) Unwrap() error {
+	return e.Internal
+}
+
+// WithInternal returns a copy of the error with an underlying error, such as to log why it happened
+func (e *HTTPError) WithInternal(err error) *HTTPError {
+	copied := *e
+	copied.Internal = err
+	return &copied
+}
+
+// StatusOf returns the status code an error should be answered with, which is 413 Request Entity Too Large if it wraps
+// an *http.MaxBytesError, the Code of the first HTTPError it wraps, or 500 Internal Server Error otherwise
+func StatusOf(err error) int {
+	return httpErrorOf(err).Code
+}
+
+// httpErrorOf returns the HTTPError to answer an error with, as with StatusOf
+func httpErrorOf(err error) *HTTPError {
+	// A body which was too large may have been reported as a bad request while decoding it
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return NewHTTPError(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+	return NewHTTPError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+type errorHandledKey struct{}
+
+// errorHandled returns true if the errors returned by handlers of a request will be answered by the ErrorHandler
+// of a Mux serving it
+func errorHandled(ctx context.Context) bool {
+	handled, _ := ctx.Value(errorHandledKey{}).(bool)
+	return handled
+}
+
+// WriteError is an ErrorHandler which answers requests whose handler returned an HTTPError with its code and message,
+// as plain text, an *http.MaxBytesError with 413 Request Entity Too Large, even if wrapped in an HTTPError,
+// and any other error with 500 Internal Server Error, without revealing it
+func WriteError(ctx context.Context, w http.ResponseWriter, req *http.Request, err error) {
+	httpErr := httpErrorOf(err)
+	http.Error(w, httpErr.Message, httpErr.Code)
+}
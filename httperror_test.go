@@ -0,0 +1,53 @@
+package minimux_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTPError", func() {
+	errDatabase := errors.New("connection refused")
+	failWith := func(err error) minimux.Handler {
+		return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+			return err
+		})
+	}
+	mux := &minimux.Mux{
+		ErrorHandler: minimux.WriteError,
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/missing").IsHandledBy(failWith(minimux.ErrNotFound)),
+			minimux.LiteralPath("/invalid").IsHandledBy(failWith(minimux.NewHTTPError(http.StatusUnprocessableEntity, "bad input"))),
+			minimux.LiteralPath("/wrapped").IsHandledBy(failWith(fmt.Errorf("loading: %w", minimux.ErrConflict.WithInternal(errDatabase)))),
+			minimux.LiteralPath("/other").IsHandledBy(failWith(errDatabase)),
+		},
+	}
+
+	DescribeTable("should answer requests with the status and message of the error",
+		func(path string, expectedStatus int, expectedBody string) {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, path, nil))
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Body.String()).To(Equal(expectedBody + "\n"))
+		},
+		Entry("sentinel", "/missing", http.StatusNotFound, "Not Found"),
+		Entry("custom", "/invalid", http.StatusUnprocessableEntity, "bad input"),
+		Entry("wrapped", "/wrapped", http.StatusConflict, "Conflict"),
+		Entry("other errors", "/other", http.StatusInternalServerError, "Internal Server Error"),
+	)
+
+	It("should wrap its internal error", func() {
+		err := minimux.ErrConflict.WithInternal(errDatabase)
+		Expect(err).To(MatchError(errDatabase))
+		Expect(err.Error()).To(Equal("409 Conflict: connection refused"))
+		Expect(minimux.ErrConflict.Internal).To(BeNil())
+		Expect(minimux.StatusOf(err)).To(Equal(http.StatusConflict))
+		Expect(minimux.StatusOf(errDatabase)).To(Equal(http.StatusInternalServerError))
+	})
+})
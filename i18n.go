@@ -0,0 +1,152 @@
+package minimux
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Catalogs are the translated messages of each locale
+type Catalogs struct {
+	// Default is the locale used when a client accepts none of the others, and for messages missing from
+	// a client's locale
+	Default string
+
+	messages map[string]map[string]string
+}
+
+// LoadCatalogs loads message catalogs from the JSON files in the root of a filesystem, such as an embed.FS,
+// where each file is named for its locale, e.g. "en.json" or "pt-BR.json", and contains an object of message keys
+// to messages, which may contain fmt verbs for their arguments
+func LoadCatalogs(fsys fs.FS, defaultLocale string) (*Catalogs, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalogs{Default: defaultLocale, messages: make(map[string]map[string]string, len(files))}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		messages := make(map[string]string)
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("loading catalog %s: %w", file, err)
+		}
+		c.messages[strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))] = messages
+	}
+	if _, ok := c.messages[strings.ToLower(defaultLocale)]; !ok {
+		return nil, fmt.Errorf("no catalog for default locale %q", defaultLocale)
+	}
+	return c, nil
+}
+
+// Negotiate returns the locale with a catalog which best matches an Accept-Language header, matching either
+// exactly, or by the language alone, e.g. "fr-CA" matches "fr", or the default locale if none match
+func (c *Catalogs) Negotiate(acceptLanguage string) string {
+	type accepted struct {
+		tag     string
+		quality float64
+	}
+	var tags []accepted
+	for _, field := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(field), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if tag != "" && tag != "*" && quality > 0 {
+			tags = append(tags, accepted{tag: strings.ToLower(tag), quality: quality})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+	for _, tag := range tags {
+		if _, ok := c.messages[tag.tag]; ok {
+			return tag.tag
+		}
+		if language, _, ok := strings.Cut(tag.tag, "-"); ok {
+			if _, ok := c.messages[language]; ok {
+				return language
+			}
+		}
+	}
+	return strings.ToLower(c.Default)
+}
+
+// Message returns the message for a key in a locale, falling back to the default locale, and then to the key itself
+func (c *Catalogs) Message(locale, key string) string {
+	if message, ok := c.messages[strings.ToLower(locale)][key]; ok {
+		return message
+	}
+	if message, ok := c.messages[strings.ToLower(c.Default)][key]; ok {
+		return message
+	}
+	return key
+}
+
+type localeKey struct{}
+
+// locale is the locale chosen for a request, along with the catalogs to translate it with
+type locale struct {
+	catalogs *Catalogs
+	name     string
+}
+
+// Localize returns a PreProcessor which chooses the locale for a request from its Accept-Language header,
+// recording it in the context, where T and TemplateFuncs use it, and LocaleFromContext finds it
+func (c *Catalogs) Localize() PreProcessor {
+	return func(ctx context.Context, req *http.Request) (context.Context, func()) {
+		return context.WithValue(ctx, localeKey{}, locale{catalogs: c, name: c.Negotiate(req.Header.Get("Accept-Language"))}), nil
+	}
+}
+
+// LocaleFromContext returns the locale chosen for a request, or false if none was
+func LocaleFromContext(ctx context.Context) (string, bool) {
+	l, ok := ctx.Value(localeKey{}).(locale)
+	return l.name, ok
+}
+
+// T returns the message for a key in the locale chosen for a request, formatted with any arguments.
+// If no locale was chosen, the key itself is formatted.
+func T(ctx context.Context, key string, args ...any) string {
+	message := key
+	if l, ok := ctx.Value(localeKey{}).(locale); ok {
+		message = l.catalogs.Message(l.name, key)
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// TemplateFuncs returns the functions templates use to localize their text, currently only "T", as with T.
+// Templates must be parsed with them, using context.Background() if no request is available,
+// and executed with ExecuteLocalized.
+func TemplateFuncs(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		"T": func(key string, args ...any) string {
+			return T(ctx, key, args...)
+		},
+	}
+}
+
+// ExecuteLocalized executes a template in the locale chosen for a request. The template is cloned to do so,
+// and so must never be executed directly.
+func ExecuteLocalized(ctx context.Context, w io.Writer, tmpl *template.Template, data any) error {
+	localized, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	return localized.Funcs(TemplateFuncs(ctx)).Execute(w, data)
+}
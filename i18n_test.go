@@ -0,0 +1,67 @@
+package minimux_test
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Catalogs", func() {
+	catalogs, err := minimux.LoadCatalogs(fstest.MapFS{
+		"en.json":    {Data: []byte(`{"greeting": "Hello, %s", "farewell": "Goodbye"}`)},
+		"fr.json":    {Data: []byte(`{"greeting": "Bonjour, %s"}`)},
+		"pt-BR.json": {Data: []byte(`{"greeting": "Olá, %s"}`)},
+	}, "en")
+	page := template.Must(template.New("page").Funcs(minimux.TemplateFuncs(context.Background())).Parse(`{{ T "greeting" .Name }} / {{ T "farewell" }}`))
+	mux := &minimux.Mux{
+		PreProcess: catalogs.Localize(),
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				return minimux.ExecuteLocalized(ctx, w, page, map[string]string{"Name": "Alice"})
+			}),
+		},
+	}
+
+	It("should load every catalog", func() {
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	DescribeTable("should negotiate the locale",
+		func(acceptLanguage, expected string) {
+			Expect(catalogs.Negotiate(acceptLanguage)).To(Equal(expected))
+		},
+		Entry("exactly", "fr", "fr"),
+		Entry("ignoring case", "PT-br", "pt-br"),
+		Entry("by language", "fr-CA", "fr"),
+		Entry("by quality", "de, fr;q=0.5, en;q=0.8", "en"),
+		Entry("by default", "de", "en"),
+		Entry("without a header", "", "en"),
+	)
+
+	DescribeTable("should render templates in the client's language",
+		func(acceptLanguage, expected string) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Language", acceptLanguage)
+			Expect(serve(mux, req).Body.String()).To(Equal(expected))
+		},
+		Entry("English", "en-US", "Hello, Alice / Goodbye"),
+		Entry("French, falling back to English", "fr", "Bonjour, Alice / Goodbye"),
+		Entry("Portuguese", "pt-BR", "Olá, Alice / Goodbye"),
+	)
+
+	It("should use the key without a locale", func() {
+		Expect(minimux.T(context.Background(), "greeting")).To(Equal("greeting"))
+	})
+
+	It("should require a catalog for the default locale", func() {
+		_, err := minimux.LoadCatalogs(fstest.MapFS{"fr.json": {Data: []byte(`{}`)}}, "en")
+		Expect(err).To(HaveOccurred())
+	})
+})
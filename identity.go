@@ -0,0 +1,127 @@
+package minimux
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// IdentityMethodClientCert is the Method of an Identity established by a verified TLS client certificate
+	IdentityMethodClientCert = "client-cert"
+	// IdentityMethodOIDC is the Method of an Identity established by a session created by logging in with OIDC
+	IdentityMethodOIDC = "oidc"
+	// IdentityMethodBearerToken is the Method of an Identity established by a signed bearer token
+	IdentityMethodBearerToken = "bearer-token"
+	// IdentityMethodWebhookSignature is the Method of an Identity established by a webhook signature.
+	// The Name of such an Identity is the name of the sender whose secret signed the request.
+	IdentityMethodWebhookSignature = "webhook-signature"
+)
+
+// An Identity is who is making a request, as established by authentication
+type Identity struct {
+	// Name is the primary name of the caller
+	Name string
+	// Method is how the caller was authenticated, e.g. IdentityMethodClientCert
+	Method string
+	// ID uniquely identifies the caller among those authenticated by the same Method, and, unlike Name,
+	// can't be chosen or changed by the caller. It is the subject of a token, the SHA-256 fingerprint of a
+	// client certificate, in hex, or the name of a webhook sender.
+	ID string
+
+	// Subject is the distinguished name of the caller's verified TLS client certificate, if any
+	Subject pkix.Name
+	// DNSNames are the DNS subject alternative names of the caller's verified TLS client certificate, if any
+	DNSNames []string
+	// EmailAddresses are the email subject alternative names of the caller's verified TLS client certificate, if any
+	EmailAddresses []string
+	// IPAddresses are the IP subject alternative names of the caller's verified TLS client certificate, if any
+	IPAddresses []net.IP
+	// URIs are the URI subject alternative names of the caller's verified TLS client certificate, if any
+	URIs []*url.URL
+	// Certificate is the caller's verified TLS client certificate, if any
+	Certificate *x509.Certificate
+	// Claims are the claims of the caller's verified token, if any
+	Claims TokenClaims
+}
+
+// String returns the name and method of the identity
+func (i *Identity) String() string {
+	if i == nil {
+		return "<anonymous>"
+	}
+	return i.Name + " (" + i.Method + ")"
+}
+
+// Key returns the method and ID of the identity, such as "oidc:1234", which identify it across all methods,
+// or an empty string if it has no ID
+func (i *Identity) Key() string {
+	if i.ID == "" {
+		return ""
+	}
+	return i.Method + ":" + i.ID
+}
+
+// ClientCertIdentity returns the identity described by a TLS client certificate.
+// Its name is the common name of the certificate's subject, or, if that is empty, the first DNS name,
+// email address, or URI subject alternative name. Its ID is the fingerprint of the certificate.
+func ClientCertIdentity(cert *x509.Certificate) *Identity {
+	fingerprint := sha256.Sum256(cert.Raw)
+	id := &Identity{
+		Name:           cert.Subject.CommonName,
+		Method:         IdentityMethodClientCert,
+		ID:             hex.EncodeToString(fingerprint[:]),
+		Subject:        cert.Subject,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+		Certificate:    cert,
+	}
+	switch {
+	case id.Name != "":
+	case len(cert.DNSNames) != 0:
+		id.Name = cert.DNSNames[0]
+	case len(cert.EmailAddresses) != 0:
+		id.Name = cert.EmailAddresses[0]
+	case len(cert.URIs) != 0:
+		id.Name = cert.URIs[0].String()
+	}
+	return id
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context which records who is making a request
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns who is making a request, or false if they were not authenticated
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
+
+// verifiedClientCert returns the verified TLS client certificate of a request, or nil if there isn't one
+func verifiedClientCert(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return req.TLS.VerifiedChains[0][0]
+}
+
+// ExtractClientCertIdentity is a PreProcessor that records the identity from the verified TLS client certificate
+// of a request, if any, in the context
+var ExtractClientCertIdentity PreProcessor = func(ctx context.Context, req *http.Request) (context.Context, func()) {
+	cert := verifiedClientCert(req)
+	if cert == nil {
+		return ctx, nil
+	}
+	return WithIdentity(ctx, ClientCertIdentity(cert)), nil
+}
@@ -0,0 +1,47 @@
+package minimux_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExtractClientCertIdentity", func() {
+	It("should record the identity of a verified client certificate", func() {
+		spiffe, err := url.Parse("spiffe://example.com/admin")
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(http.MethodGet, "https://localhost/", nil)
+		req.TLS = &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{
+				Subject:  pkix.Name{Organization: []string{"example"}},
+				DNSNames: []string{"admin.example.com"},
+				URIs:     []*url.URL{spiffe},
+			}}},
+		}
+		ctx, _ := minimux.ExtractClientCertIdentity(context.Background(), req)
+		id, ok := minimux.IdentityFromContext(ctx)
+		Expect(ok).To(BeTrue())
+		Expect(id.Name).To(Equal("admin.example.com"))
+		Expect(id.Method).To(Equal(minimux.IdentityMethodClientCert))
+		Expect(id.Subject.Organization).To(Equal([]string{"example"}))
+		Expect(id.URIs).To(Equal([]*url.URL{spiffe}))
+	})
+	It("should not record an identity without a verified client certificate", func() {
+		req := httptest.NewRequest(http.MethodGet, "https://localhost/", nil)
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "admin"}}},
+		}
+		ctx, _ := minimux.ExtractClientCertIdentity(context.Background(), req)
+		_, ok := minimux.IdentityFromContext(ctx)
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,393 @@
+package minimux
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidToken is returned when a token is malformed, has an invalid signature, or has invalid claims
+var ErrInvalidToken = errors.New("invalid token")
+
+// jwtClockSkew is how far the clocks of a token issuer and this server are allowed to disagree
+const jwtClockSkew = time.Minute
+
+// A KeySet finds the public keys used to verify the signatures of JSON Web Tokens
+type KeySet interface {
+	// Key returns the key with an ID
+	Key(ctx context.Context, keyID string) (crypto.PublicKey, error)
+}
+
+// jsonWebKey is a public key in the JSON Web Key format, per RFC 7517
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	// Algorithm is the optional algorithm the key is used with, which tokens it signed must use
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// publicKey returns the key, or nil if it is of an unsupported type
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// DefaultKeySetRefetchInterval is how often a RemoteKeySet may fetch its key set if its RefetchInterval is not set
+const DefaultKeySetRefetchInterval = time.Minute
+
+// RemoteKeySet is a KeySet which fetches a JSON Web Key Set from a URL, and fetches it again
+// when asked for a key it does not have, at most once per RefetchInterval, whether or not the last fetch succeeded.
+// Only one fetch is made at a time, and requests for keys which need it wait for it, while those for keys it
+// already has do not.
+type RemoteKeySet struct {
+	// URL is the URL of the key set
+	URL string
+	// Client is the client used to fetch the key set. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// RefetchInterval is the least time between fetches. If zero, DefaultKeySetRefetchInterval is used.
+	RefetchInterval time.Duration
+
+	lock       sync.Mutex
+	keys       map[string]crypto.PublicKey
+	algorithms map[string]string
+	fetchedAt  time.Time
+	fetchErr   error
+	// fetching is closed once the fetch in progress, if any, is finished
+	fetching chan struct{}
+}
+
+// keyAlgorithms is implemented by KeySets which know the algorithms their keys are used with,
+// such as from the "alg" of a JSON Web Key
+type keyAlgorithms interface {
+	// keyAlgorithm returns the algorithm of the key with an ID, or an empty string if it is not known
+	keyAlgorithm(keyID string) string
+}
+
+// keyAlgorithm implements keyAlgorithms
+func (r *RemoteKeySet) keyAlgorithm(keyID string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.algorithms[keyID]
+}
+
+func (r *RemoteKeySet) refetchInterval() time.Duration {
+	if r.RefetchInterval == 0 {
+		return DefaultKeySetRefetchInterval
+	}
+	return r.RefetchInterval
+}
+
+// Key implements KeySet
+func (r *RemoteKeySet) Key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	r.lock.Lock()
+	if key, ok := r.keys[keyID]; ok {
+		r.lock.Unlock()
+		return key, nil
+	}
+	fetching := r.fetching
+	if fetching == nil && time.Since(r.fetchedAt) >= r.refetchInterval() {
+		// The attempt is recorded before fetching, so that a failed fetch is not retried for every token
+		fetching = make(chan struct{})
+		r.fetching = fetching
+		r.fetchedAt = time.Now()
+		r.lock.Unlock()
+		keys, algorithms, err := r.fetch(ctx)
+		r.lock.Lock()
+		if err == nil {
+			r.keys = keys
+			r.algorithms = algorithms
+		}
+		r.fetchErr = err
+		r.fetching = nil
+		close(fetching)
+		r.lock.Unlock()
+	} else if fetching != nil {
+		r.lock.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	} else {
+		r.lock.Unlock()
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if key, ok := r.keys[keyID]; ok {
+		return key, nil
+	}
+	if r.fetchErr != nil {
+		return nil, r.fetchErr
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, keyID)
+}
+
+func (r *RemoteKeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, map[string]string, error) {
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, r.Client, r.URL, &keySet); err != nil {
+		return nil, nil, fmt.Errorf("fetching key set: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(keySet.Keys))
+	algorithms := make(map[string]string, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing key %q: %w", jwk.KeyID, err)
+		}
+		if key != nil {
+			keys[jwk.KeyID] = key
+			if jwk.Algorithm != "" {
+				algorithms[jwk.KeyID] = jwk.Algorithm
+			}
+		}
+	}
+	return keys, algorithms, nil
+}
+
+// getJSON fetches and decodes a JSON document
+func getJSON(ctx context.Context, client *http.Client, url string, value any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+// TokenClaims are the claims of a verified JSON Web Token
+type TokenClaims map[string]any
+
+// String returns a string claim, or an empty string if it is not present or not a string
+func (c TokenClaims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// time returns a numeric date claim, and false if it is not present or not a number
+func (c TokenClaims) time(name string) (time.Time, bool) {
+	f, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// HasAudience returns true if the audience claim is, or contains, an audience
+func (c TokenClaims) HasAudience(audience string) bool {
+	switch aud := c["aud"].(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TokenVerifier verifies the signatures and standard claims of JSON Web Tokens
+type TokenVerifier struct {
+	// Keys are the keys which may sign tokens
+	Keys KeySet
+	// Issuer is the required issuer of tokens, if not empty
+	Issuer string
+	// Audience is the required audience of tokens, if not empty
+	Audience string
+}
+
+// Verify checks the signature, issuer, audience, and validity period of a token, and returns its claims
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	key, err := v.Keys.Key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	// The algorithm of the key, if known, is trusted over that of the token
+	algorithm := header.Algorithm
+	if keys, ok := v.Keys.(keyAlgorithms); ok {
+		if keyAlgorithm := keys.keyAlgorithm(header.KeyID); keyAlgorithm != "" {
+			if keyAlgorithm != algorithm {
+				return nil, fmt.Errorf("%w: algorithm %q does not match key", ErrInvalidToken, algorithm)
+			}
+			algorithm = keyAlgorithm
+		}
+	}
+	if err := verifySignature(algorithm, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+	var claims TokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if exp, ok := claims.time("exp"); !ok || now.After(exp.Add(jwtClockSkew)) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Before(nbf.Add(-jwtClockSkew)) {
+		return nil, fmt.Errorf("%w: not yet valid", ErrInvalidToken)
+	}
+	if v.Issuer != "" && claims.String("iss") != v.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if v.Audience != "" && !claims.HasAudience(v.Audience) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func decodeTokenPart(part string, value any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(b, value); err != nil {
+		return fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	return nil
+}
+
+// ecdsaCurves are the curves used by the ECDSA algorithms, by their hash sizes, per RFC 7518
+var ecdsaCurves = map[string]elliptic.Curve{
+	"256": elliptic.P256(),
+	"384": elliptic.P384(),
+	"512": elliptic.P521(),
+}
+
+// verifySignature checks a signature with an asymmetric algorithm. Symmetric algorithms and "none" are never accepted.
+func verifySignature(algorithm string, key crypto.PublicKey, signed string, signature []byte) error {
+	if len(algorithm) != 5 {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, algorithm)
+	}
+	var hash crypto.Hash
+	switch algorithm[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, algorithm)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	var valid bool
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		switch algorithm[:2] {
+		case "RS":
+			valid = rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+		case "PS":
+			valid = rsa.VerifyPSS(key, hash, digest, signature, nil) == nil
+		default:
+			return fmt.Errorf("%w: algorithm %q does not match key", ErrInvalidToken, algorithm)
+		}
+	case *ecdsa.PublicKey:
+		// Each algorithm uses one curve, whose signatures are the fixed-size r and s, one after the other
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if algorithm[:2] != "ES" || key.Curve != ecdsaCurves[algorithm[2:]] {
+			return fmt.Errorf("%w: algorithm %q does not match key", ErrInvalidToken, algorithm)
+		}
+		if len(signature) != 2*size {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		r := new(big.Int).SetBytes(signature[:len(signature)/2])
+		s := new(big.Int).SetBytes(signature[len(signature)/2:])
+		valid = ecdsa.Verify(key, digest, r, s)
+	default:
+		return fmt.Errorf("%w: unsupported key type %T", ErrInvalidToken, key)
+	}
+	if !valid {
+		return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package minimux
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLockoutThreshold is how many consecutive failures are allowed before a Lockout delays further attempts,
+	// if its Threshold is not set
+	DefaultLockoutThreshold = 5
+	// DefaultLockoutBaseDelay is how long a Lockout delays attempts after reaching its threshold, if its BaseDelay is not set
+	DefaultLockoutBaseDelay = time.Second
+	// DefaultLockoutMaxDelay is the longest a Lockout delays attempts, if its MaxDelay is not set
+	DefaultLockoutMaxDelay = 15 * time.Minute
+	// DefaultLockoutForgetAfter is how long after the last failure of a key a Lockout forgets its failures,
+	// if its ForgetAfter is not set
+	DefaultLockoutForgetAfter = time.Hour
+	// DefaultFailureStoreSize is how many keys a MemoryFailureStore remembers, if its Size is not set
+	DefaultFailureStoreSize = 10000
+)
+
+// A FailureStore records consecutive failures, such as failed logins, by key. Implementations backed by
+// a shared database allow multiple servers to enforce the same Lockout.
+type FailureStore interface {
+	// Failures returns the number of consecutive failures for a key, and when the last one happened
+	Failures(ctx context.Context, key string) (count int, last time.Time, err error)
+	// Attempt atomically checks whether an attempt for a key may be made at a time, and, if so, records it as a failure
+	// until it is known to have succeeded. Failures from before forgetBefore are forgotten first. If the attempt
+	// may not be made yet, as the wait for the number and time of the failures so far has not passed,
+	// nothing is recorded, and how much longer it must wait is returned.
+	Attempt(ctx context.Context, key string, at, forgetBefore time.Time, wait func(count int, last time.Time) time.Duration) (time.Duration, error)
+	// Forgive removes the failure recorded for an attempt which did not fail
+	Forgive(ctx context.Context, key string) error
+	// Reset forgets the failures for a key
+	Reset(ctx context.Context, key string) error
+}
+
+type failureRecord struct {
+	count int
+	last  time.Time
+}
+
+// MemoryFailureStore is a FailureStore which remembers the failures of a limited number of keys in memory,
+// forgetting the least recently failed keys first
+type MemoryFailureStore struct {
+	// Size is the maximum number of keys to remember. If zero, DefaultFailureStoreSize is used.
+	Size int
+
+	once    sync.Once
+	lock    sync.Mutex
+	records *boundedCache[string, failureRecord]
+}
+
+func (m *MemoryFailureStore) cache() *boundedCache[string, failureRecord] {
+	m.once.Do(func() {
+		size := m.Size
+		if size == 0 {
+			size = DefaultFailureStoreSize
+		}
+		m.records = newBoundedCache[string, failureRecord](size)
+	})
+	return m.records
+}
+
+// Failures implements FailureStore
+func (m *MemoryFailureStore) Failures(ctx context.Context, key string) (int, time.Time, error) {
+	record, _ := m.cache().get(key)
+	return record.count, record.last, nil
+}
+
+// Attempt implements FailureStore
+func (m *MemoryFailureStore) Attempt(ctx context.Context, key string, at, forgetBefore time.Time, wait func(count int, last time.Time) time.Duration) (time.Duration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	record, _ := m.cache().get(key)
+	if record.last.Before(forgetBefore) {
+		record = failureRecord{}
+	}
+	if w := wait(record.count, record.last); w > 0 {
+		return w, nil
+	}
+	m.cache().put(key, failureRecord{count: record.count + 1, last: at})
+	return 0, nil
+}
+
+// Forgive implements FailureStore
+func (m *MemoryFailureStore) Forgive(ctx context.Context, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	record, ok := m.cache().get(key)
+	if !ok {
+		return nil
+	}
+	if record.count <= 1 {
+		m.cache().remove(key)
+		return nil
+	}
+	record.count--
+	m.cache().put(key, record)
+	return nil
+}
+
+// Reset implements FailureStore
+func (m *MemoryFailureStore) Reset(ctx context.Context, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.cache().remove(key)
+	return nil
+}
+
+// lockoutIPPrefix starts the keys of LockoutByIP, which are shared by everyone using an address
+const lockoutIPPrefix = "ip:"
+
+// LockoutByIP is a function for Lockout.Keys which tracks failures by the IP address of the client.
+// As an address can be shared by many users, including an attacker, its failures are only forgotten after
+// a success if the request has no other keys, such as for an account.
+func LockoutByIP(req *http.Request) []string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return []string{lockoutIPPrefix + host}
+}
+
+// LockoutByFormValue returns a function for Lockout.Keys which tracks failures by the IP address of the client,
+// and, separately, by a form value, such as a username, so that attempts against one account from many
+// addresses are also delayed
+func LockoutByFormValue(name string) func(req *http.Request) []string {
+	return func(req *http.Request) []string {
+		keys := LockoutByIP(req)
+		if value := req.PostFormValue(name); value != "" {
+			keys = append(keys, "form:"+name+"="+value)
+		}
+		return keys
+	}
+}
+
+// A Lockout protects login and token endpoints from brute-force attacks by delaying further attempts after
+// repeated failures, doubling the delay with each additional failure. Attempts made before the delay has passed
+// are answered with 429 Too Many Requests, and a Retry-After header, without calling the protected handler.
+// Each attempt is recorded before the handler is called, so that concurrent attempts can't all pass the check.
+// A success forgets the failures of the keys of the request, other than those shared by an address.
+type Lockout struct {
+	// Store records failures. If nil, a MemoryFailureStore is used.
+	Store FailureStore
+	// Keys returns the keys to track the failures of a request by. If nil, LockoutByIP is used.
+	Keys func(req *http.Request) []string
+	// Threshold is how many consecutive failures are allowed without delay. If zero, DefaultLockoutThreshold is used.
+	Threshold int
+	// BaseDelay is the delay after reaching the threshold. If zero, DefaultLockoutBaseDelay is used.
+	BaseDelay time.Duration
+	// MaxDelay is the longest delay. If zero, DefaultLockoutMaxDelay is used.
+	MaxDelay time.Duration
+	// ForgetAfter is how long after its last failure the failures of a key are forgotten.
+	// If zero, DefaultLockoutForgetAfter is used.
+	ForgetAfter time.Duration
+	// Failed returns true if the status code of a response means the attempt failed.
+	// If nil, 401 Unauthorized and 403 Forbidden are failures, and any other status below 400 is a success.
+	Failed func(statusCode int) bool
+
+	once  sync.Once
+	store FailureStore
+}
+
+func (l *Lockout) init() {
+	l.once.Do(func() {
+		l.store = l.Store
+		if l.store == nil {
+			l.store = &MemoryFailureStore{}
+		}
+	})
+}
+
+// delay returns how long after the last failure another attempt is allowed
+func (l *Lockout) delay(failures int) time.Duration {
+	threshold := l.Threshold
+	if threshold == 0 {
+		threshold = DefaultLockoutThreshold
+	}
+	if failures < threshold {
+		return 0
+	}
+	delay := l.BaseDelay
+	if delay == 0 {
+		delay = DefaultLockoutBaseDelay
+	}
+	maxDelay := l.MaxDelay
+	if maxDelay == 0 {
+		maxDelay = DefaultLockoutMaxDelay
+	}
+	for ix := threshold; ix < failures && delay < maxDelay; ix++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+func (l *Lockout) failed(statusCode int) bool {
+	if l.Failed != nil {
+		return l.Failed(statusCode)
+	}
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+}
+
+func (l *Lockout) keys(req *http.Request) []string {
+	if l.Keys == nil {
+		return LockoutByIP(req)
+	}
+	return l.Keys(req)
+}
+
+// failures returns the largest number of consecutive failures of any of the keys of a request
+func (l *Lockout) failures(ctx context.Context, req *http.Request) (int, error) {
+	l.init()
+	var most int
+	for _, key := range l.keys(req) {
+		failures, _, err := l.store.Failures(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		most = max(most, failures)
+	}
+	return most, nil
+}
+
+func (l *Lockout) forgetAfter() time.Duration {
+	if l.ForgetAfter == 0 {
+		return DefaultLockoutForgetAfter
+	}
+	return l.ForgetAfter
+}
+
+// wait returns how long after a time an attempt must wait, given the failures so far
+func (l *Lockout) wait(now time.Time) func(count int, last time.Time) time.Duration {
+	return func(count int, last time.Time) time.Duration {
+		return last.Add(l.delay(count)).Sub(now)
+	}
+}
+
+// forgive removes the failures recorded for the attempts of keys which did not fail, returning the first error
+func (l *Lockout) forgive(ctx context.Context, keys []string) error {
+	var err error
+	for _, key := range keys {
+		if forgiveErr := l.store.Forgive(ctx, key); err == nil {
+			err = forgiveErr
+		}
+	}
+	return err
+}
+
+// Protect returns a handler which calls another unless the keys of a request are locked out,
+// and records whether the attempt failed
+func (l *Lockout) Protect(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		l.init()
+		keys := l.keys(req)
+		now := time.Now()
+		var wait time.Duration
+		attempted := make([]string, 0, len(keys))
+		for _, key := range keys {
+			keyWait, err := l.store.Attempt(ctx, key, now, now.Add(-l.forgetAfter()), l.wait(now))
+			if err != nil {
+				l.forgive(ctx, attempted)
+				w.WriteHeader(http.StatusInternalServerError)
+				return err
+			}
+			if keyWait > 0 {
+				wait = max(wait, keyWait)
+			} else {
+				attempted = append(attempted, key)
+			}
+		}
+		if wait > 0 {
+			AuditAuthDecision(ctx, AuthDecision{Authenticator: "lockout", Request: req, Reason: "too many failures"})
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return l.forgive(ctx, attempted)
+		}
+
+		snoopW, wrapped := snoop(w)
+		err := next.ServeHTTP(ctx, wrapped, req, pathVars, formErr)
+		statusCode := snoopW.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		if l.failed(statusCode) {
+			return err
+		}
+		// Only a success forgets earlier failures, and only those of keys not shared by an address,
+		// unless there are no others, so that an attacker's successes can't hide their failures against others
+		sharedOnly := true
+		for _, key := range keys {
+			sharedOnly = sharedOnly && strings.HasPrefix(key, lockoutIPPrefix)
+		}
+		for _, key := range keys {
+			var storeErr error
+			if statusCode < http.StatusBadRequest && (sharedOnly || !strings.HasPrefix(key, lockoutIPPrefix)) {
+				storeErr = l.store.Reset(ctx, key)
+			} else {
+				storeErr = l.store.Forgive(ctx, key)
+			}
+			if err == nil {
+				err = storeErr
+			}
+		}
+		return err
+	})
+}
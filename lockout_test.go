@@ -0,0 +1,148 @@
+package minimux_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// upgradingHandler hijacks the connection of a request to answer it as if it had switched protocols.
+// Like many WebSocket libraries, it requires the ResponseWriter itself to be an http.Hijacker.
+var upgradingHandler = minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return errors.New("not a hijacker")
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\n\r\nupgraded")
+	return err
+})
+
+// upgradedResponse requests a path of a handler over a real connection, asking to upgrade it, with any other
+// header lines, and returns everything the handler sent back
+func upgradedResponse(handler http.Handler, path string, headers ...string) (string, error) {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	// A response which was not upgraded leaves the connection open
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: test\r\n"+strings.Join(headers, "")+"\r\n"); err != nil {
+		return "", err
+	}
+	response, err := io.ReadAll(conn)
+	return string(response), err
+}
+
+var _ = Describe("Lockout", func() {
+	var mux *minimux.Mux
+	BeforeEach(func() {
+		lockout := &minimux.Lockout{
+			Keys:      minimux.LockoutByFormValue("username"),
+			Threshold: 2,
+			BaseDelay: time.Minute,
+		}
+		mux = &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/login").WithForm().IsHandledBy(lockout.Protect(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					if req.PostForm.Get("password") != "right" {
+						w.WriteHeader(http.StatusUnauthorized)
+					}
+					return nil
+				}))),
+			},
+		}
+	})
+	login := func(remoteAddr, username, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/login", strings.NewReader(url.Values{"username": {username}, "password": {password}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = remoteAddr
+		return serve(mux, req)
+	}
+
+	It("should lock out an address after repeated failures", func() {
+		Expect(login("192.0.2.1:1234", "alice", "wrong").Code).To(Equal(http.StatusUnauthorized))
+		Expect(login("192.0.2.1:1234", "bob", "wrong").Code).To(Equal(http.StatusUnauthorized))
+		resp := login("192.0.2.1:5678", "carol", "right")
+		Expect(resp.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(resp.Header().Get("Retry-After")).To(Equal("60"))
+		Expect(login("192.0.2.2:1234", "carol", "right").Code).To(Equal(http.StatusOK))
+	})
+	It("should lock out a username attacked from many addresses", func() {
+		Expect(login("192.0.2.1:1234", "alice", "wrong").Code).To(Equal(http.StatusUnauthorized))
+		Expect(login("192.0.2.2:1234", "alice", "wrong").Code).To(Equal(http.StatusUnauthorized))
+		Expect(login("192.0.2.3:1234", "alice", "right").Code).To(Equal(http.StatusTooManyRequests))
+	})
+	It("should forget the failures of an account after a success", func() {
+		Expect(login("192.0.2.1:1234", "alice", "wrong").Code).To(Equal(http.StatusUnauthorized))
+		Expect(login("192.0.2.2:1234", "alice", "right").Code).To(Equal(http.StatusOK))
+		Expect(login("192.0.2.3:1234", "alice", "wrong").Code).To(Equal(http.StatusUnauthorized))
+		Expect(login("192.0.2.4:1234", "alice", "right").Code).To(Equal(http.StatusOK))
+	})
+	It("should not forget the failures of an address after a success", func() {
+		Expect(login("192.0.2.1:1234", "mallory", "right").Code).To(Equal(http.StatusOK))
+		Expect(login("192.0.2.1:1234", "alice", "wrong").Code).To(Equal(http.StatusUnauthorized))
+		Expect(login("192.0.2.1:1234", "mallory", "right").Code).To(Equal(http.StatusOK))
+		Expect(login("192.0.2.1:1234", "bob", "wrong").Code).To(Equal(http.StatusUnauthorized))
+		Expect(login("192.0.2.1:1234", "mallory", "right").Code).To(Equal(http.StatusTooManyRequests))
+	})
+	It("should let the protected handler hijack the connection", func() {
+		lockout := &minimux.Lockout{}
+		Expect(upgradedResponse(&minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/ws").IsHandledBy(lockout.Protect(upgradingHandler)),
+			},
+		}, "/ws")).To(Equal("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\n\r\nupgraded"))
+	})
+	It("should count concurrent attempts before they finish", func() {
+		release := make(chan struct{})
+		lockout := &minimux.Lockout{Threshold: 2, BaseDelay: time.Minute}
+		slow := lockout.Protect(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+			<-release
+			w.WriteHeader(http.StatusUnauthorized)
+			return nil
+		}))
+		codes := make(chan int, 5)
+		for ix := 0; ix < 5; ix++ {
+			go func() {
+				defer GinkgoRecover()
+				req := httptest.NewRequest(http.MethodPost, "http://localhost/login", nil)
+				req.RemoteAddr = "192.0.2.1:1234"
+				resp := httptest.NewRecorder()
+				Expect(slow.ServeHTTP(context.Background(), resp, req, nil, nil)).To(Succeed())
+				codes <- resp.Code
+			}()
+		}
+		var locked int
+		for ix := 0; ix < 3; ix++ {
+			if <-codes == http.StatusTooManyRequests {
+				locked++
+			}
+		}
+		close(release)
+		for ix := 0; ix < 2; ix++ {
+			Expect(<-codes).To(Equal(http.StatusUnauthorized))
+		}
+		Expect(locked).To(Equal(3))
+	})
+})
@@ -0,0 +1,15 @@
+package minimux
+
+// A Middleware wraps a Handler, such as to replace the ResponseWriter, or to answer some requests itself.
+// Methods such as Lockout.Protect and Queue.Limit are Middleware.
+type Middleware func(next Handler) Handler
+
+// Chain returns a Middleware which wraps a Handler in several others, the first outermost
+func Chain(middleware ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for ix := len(middleware) - 1; ix >= 0; ix-- {
+			next = middleware[ix](next)
+		}
+		return next
+	}
+}
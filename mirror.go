@@ -0,0 +1,157 @@
+package minimux
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// DefaultMirrorQueueSize is how many mirrored requests a Mirror sends at once, if its QueueSize is not set
+	DefaultMirrorQueueSize = 100
+	// DefaultMirrorMaxBodyBytes is the largest body a Mirror buffers to mirror a request, if its MaxBodyBytes is not set
+	DefaultMirrorMaxBodyBytes = 1 << 20
+)
+
+// A Mirror duplicates requests to a shadow handler or URL, whose responses are discarded, so that a new
+// implementation can be validated against production traffic without affecting it. Copies are sent in the background,
+// and, if too many are already in flight, or a body is too large to buffer, requests are not mirrored.
+// Any panic in Shadow is recovered and ignored.
+type Mirror struct {
+	// Shadow, if set, is called in-process with each copy
+	Shadow Handler
+	// Target, if Shadow is not set, is the base URL to send each copy to, with the path and query of the request appended
+	Target *url.URL
+	// Client sends copies to Target. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// Select is an optional function which decides which requests to mirror. If nil, all requests are mirrored.
+	Select func(req *http.Request) bool
+	// QueueSize is how many copies may be in flight at once. If zero, DefaultMirrorQueueSize is used.
+	QueueSize int
+	// MaxBodyBytes is the largest body to buffer for a copy. If zero, DefaultMirrorMaxBodyBytes is used.
+	MaxBodyBytes int64
+
+	once     sync.Once
+	slots    chan struct{}
+	inFlight sync.WaitGroup
+	dropped  atomic.Uint64
+}
+
+func (m *Mirror) init() {
+	m.once.Do(func() {
+		size := m.QueueSize
+		if size == 0 {
+			size = DefaultMirrorQueueSize
+		}
+		m.slots = make(chan struct{}, size)
+	})
+}
+
+// Wrap returns a handler which calls another, and mirrors the requests it serves
+func (m *Mirror) Wrap(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		m.init()
+		if m.Select != nil && !m.Select(req) {
+			return next.ServeHTTP(ctx, w, req, pathVars, formErr)
+		}
+		select {
+		case m.slots <- struct{}{}:
+		default:
+			m.dropped.Add(1)
+			return next.ServeHTTP(ctx, w, req, pathVars, formErr)
+		}
+		maxBodyBytes := m.MaxBodyBytes
+		if maxBodyBytes == 0 {
+			maxBodyBytes = DefaultMirrorMaxBodyBytes
+		}
+		var body []byte
+		if req.Body != nil && req.Body != http.NoBody {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(req.Body, maxBodyBytes+1))
+			// The original request continues with whatever was read, followed by the rest of the body
+			req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body}
+			if err != nil || int64(len(body)) > maxBodyBytes {
+				<-m.slots
+				m.dropped.Add(1)
+				return next.ServeHTTP(ctx, w, req, pathVars, formErr)
+			}
+		}
+
+		shadowCtx, shadowVars := detachVars(ctx, pathVars)
+		shadowReq := req.Clone(shadowCtx)
+		shadowReq.Body = io.NopCloser(bytes.NewReader(body))
+		m.inFlight.Add(1)
+		go func() {
+			defer m.inFlight.Done()
+			defer func() { <-m.slots }()
+			m.send(shadowReq, shadowVars)
+		}()
+		return next.ServeHTTP(ctx, w, req, pathVars, formErr)
+	})
+}
+
+// send sends a copy of a request to the shadow, discarding the response
+func (m *Mirror) send(req *http.Request, pathVars map[string]string) {
+	if m.Shadow != nil {
+		defer func() { recover() }()
+		m.Shadow.ServeHTTP(req.Context(), discardResponseWriter{header: make(http.Header)}, req, pathVars, nil)
+		return
+	}
+	target := *m.Target
+	target.Path = strings.TrimSuffix(target.Path, "/") + req.URL.Path
+	target.RawPath = ""
+	target.RawQuery = req.URL.RawQuery
+	req.URL = &target
+	req.Host = target.Host
+	req.RequestURI = ""
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+}
+
+// Dropped returns how many selected requests were not mirrored because too many copies were in flight,
+// or their bodies were too large
+func (m *Mirror) Dropped() uint64 {
+	return m.dropped.Load()
+}
+
+// Wait waits for every copy in flight to finish, such as when shutting down
+func (m *Mirror) Wait() {
+	m.inFlight.Wait()
+}
+
+// readCloser combines a Reader and a Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// discardResponseWriter is a ResponseWriter which discards the response
+type discardResponseWriter struct {
+	header http.Header
+}
+
+// Header implements http.ResponseWriter
+func (d discardResponseWriter) Header() http.Header {
+	return d.header
+}
+
+// Write implements http.ResponseWriter
+func (d discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// WriteHeader implements http.ResponseWriter
+func (d discardResponseWriter) WriteHeader(statusCode int) {}
@@ -0,0 +1,105 @@
+package minimux_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mirror", func() {
+	echo := minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		w.Write([]byte(pathVars["id"] + ":" + string(body)))
+		return nil
+	})
+
+	It("should send copies of requests to a shadow handler", func() {
+		var lock sync.Mutex
+		var shadowed []string
+		mirror := &minimux.Mirror{
+			Shadow: minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				body, _ := io.ReadAll(req.Body)
+				lock.Lock()
+				defer lock.Unlock()
+				shadowed = append(shadowed, pathVars["id"]+":"+string(body))
+				w.WriteHeader(http.StatusInternalServerError)
+				return nil
+			}),
+			MaxBodyBytes: 10,
+		}
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/items/([^/]+)", "id").IsHandledBy(mirror.Wrap(echo)),
+			},
+		}
+		resp := serve(mux, httptest.NewRequest(http.MethodPut, "/items/1", strings.NewReader("small")))
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(Equal("1:small"))
+
+		resp = serve(mux, httptest.NewRequest(http.MethodPut, "/items/2", strings.NewReader("much too large to mirror")))
+		Expect(resp.Body.String()).To(Equal("2:much too large to mirror"))
+
+		mirror.Wait()
+		Expect(shadowed).To(Equal([]string{"1:small"}))
+		Expect(mirror.Dropped()).To(Equal(uint64(1)))
+	})
+
+	It("should give the shadow handler path variables which outlive the request", func() {
+		finished := make(chan struct{})
+		shadowed := make(chan string, 1)
+		mirror := &minimux.Mirror{
+			Shadow: minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				<-finished
+				shadowed <- minimux.Var(ctx, "id") + ":" + minimux.Var(req.Context(), "id") + ":" + pathVars["id"]
+				return nil
+			}),
+		}
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/items/([^/]+)", "id").IsHandledBy(mirror.Wrap(echo)),
+			},
+		}
+		serve(mux, httptest.NewRequest(http.MethodGet, "/items/1", nil))
+		serve(mux, httptest.NewRequest(http.MethodGet, "/other", nil))
+		close(finished)
+		mirror.Wait()
+		Expect(<-shadowed).To(Equal("1:1:1"))
+	})
+
+	It("should send copies of selected requests to a shadow URL", func() {
+		shadowed := make(chan string, 10)
+		shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			shadowed <- req.Method + " " + req.URL.String() + " " + string(body)
+		}))
+		DeferCleanup(shadow.Close)
+		target, err := url.Parse(shadow.URL + "/v2")
+		Expect(err).ToNot(HaveOccurred())
+		mirror := &minimux.Mirror{
+			Target: target,
+			Select: func(req *http.Request) bool { return req.Method == http.MethodPost },
+		}
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/items/([^/]+)", "id").IsHandledBy(mirror.Wrap(echo)),
+			},
+		}
+		Expect(serve(mux, httptest.NewRequest(http.MethodGet, "/items/1", nil)).Body.String()).To(Equal("1:"))
+		Expect(serve(mux, httptest.NewRequest(http.MethodPost, "/items/2?q=1", strings.NewReader("new"))).Body.String()).To(Equal("2:new"))
+		mirror.Wait()
+		Expect(shadowed).To(HaveLen(1))
+		Expect(<-shadowed).To(Equal("POST /v2/items/2?q=1 new"))
+	})
+})
@@ -2,8 +2,17 @@ package minimux
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // StringSet is a set of strings
@@ -26,64 +35,310 @@ func StringSetOf(elems ...string) StringSet {
 
 type snoopingResponseWriter struct {
 	inner      http.ResponseWriter
-	statusCode *int
+	statusCode int
+	written    int64
+	// writeErr is the first error from writing the response, such as when the client has gone away
+	writeErr error
 }
 
-var _ = http.ResponseWriter(snoopingResponseWriter{})
+var _ = http.ResponseWriter(&snoopingResponseWriter{})
+var _ = http.Flusher(&snoopingResponseWriter{})
+var _ = http.Pusher(&snoopingResponseWriter{})
+var _ = io.ReaderFrom(&snoopingResponseWriter{})
 
 type snoopingHijackingResponseWriter struct {
-	snoopingResponseWriter
+	*snoopingResponseWriter
 	http.Hijacker
 }
 
-var _ = http.ResponseWriter(snoopingHijackingResponseWriter{})
-var _ = http.Hijacker(snoopingHijackingResponseWriter{})
+var _ = http.ResponseWriter(&snoopingHijackingResponseWriter{})
+var _ = http.Hijacker(&snoopingHijackingResponseWriter{})
 
-func (s snoopingResponseWriter) Header() http.Header {
+func (s *snoopingResponseWriter) Header() http.Header {
 	return s.inner.Header()
 }
 
-func (s snoopingResponseWriter) Write(b []byte) (int, error) {
-	return s.inner.Write(b)
+func (s *snoopingResponseWriter) Write(b []byte) (int, error) {
+	// Writing the body writes the header, as with net/http
+	if s.statusCode == 0 {
+		s.statusCode = http.StatusOK
+	}
+	n, err := s.inner.Write(b)
+	s.written += int64(n)
+	s.recordWriteErr(err)
+	return n, err
 }
 
-func (s snoopingResponseWriter) WriteHeader(statusCode int) {
-	*s.statusCode = statusCode
+func (s *snoopingResponseWriter) WriteHeader(statusCode int) {
+	s.statusCode = statusCode
 	s.inner.WriteHeader(statusCode)
 }
 
-func snoopOn(w http.ResponseWriter, statusCode *int) http.ResponseWriter {
-	snooping := snoopingResponseWriter{
-		statusCode: statusCode,
-		inner:      w,
+// Unwrap returns the wrapped ResponseWriter, for use by http.ResponseController
+func (s *snoopingResponseWriter) Unwrap() http.ResponseWriter {
+	return s.inner
+}
+
+// Flush implements http.Flusher, if the wrapped ResponseWriter supports flushing, directly or through Unwrap
+func (s *snoopingResponseWriter) Flush() {
+	if s.statusCode == 0 {
+		s.statusCode = http.StatusOK
+	}
+	if f, ok := s.inner.(http.Flusher); ok {
+		f.Flush()
+		return
+	}
+	http.NewResponseController(s.inner).Flush()
+}
+
+// Push implements http.Pusher, returning http.ErrNotSupported if the wrapped ResponseWriter does not
+func (s *snoopingResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := s.inner.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// ReadFrom implements io.ReaderFrom, so that the wrapped ResponseWriter can use sendfile if it supports it
+func (s *snoopingResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if s.statusCode == 0 {
+		s.statusCode = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := s.inner.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(writerOnly{Writer: s.inner}, r)
+	}
+	s.written += n
+	s.recordWriteErr(err)
+	return n, err
+}
+
+// recordWriteErr remembers the first error from writing the response
+func (s *snoopingResponseWriter) recordWriteErr(err error) {
+	if err != nil && s.writeErr == nil {
+		s.writeErr = err
+	}
+}
+
+// writerOnly hides any other methods of a writer, so that io.Copy does not call ReadFrom on it again
+type writerOnly struct {
+	io.Writer
+}
+
+// headResponseWriter discards the body written by a GET handler serving a HEAD request
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (h headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Unwrap returns the wrapped ResponseWriter, for use by http.ResponseController
+func (h headResponseWriter) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
+
+// requestState is the bookkeeping a Mux needs for a single request.
+// These are pooled so that serving a request does not need to allocate them, except for the path variables,
+// which handlers may keep.
+type requestState struct {
+	pathVars  map[string]string
+	writer    snoopingResponseWriter
+	hijacking snoopingHijackingResponseWriter
+}
+
+var requestStatePool = sync.Pool{
+	New: func() any { return &requestState{} },
+}
+
+// getRequestState returns an empty request state from the pool, with a new map for its path variables
+func getRequestState() *requestState {
+	state := requestStatePool.Get().(*requestState)
+	state.pathVars = map[string]string{}
+	return state
+}
+
+// putRequestState clears a request state and returns it to the pool
+func putRequestState(state *requestState) {
+	state.pathVars = nil
+	state.writer = snoopingResponseWriter{}
+	state.hijacking = snoopingHijackingResponseWriter{}
+	requestStatePool.Put(state)
+}
+
+// snoop wraps a response writer to record its status code, keeping it an http.Hijacker if it is one,
+// for handlers which need to know how another answered a request
+func snoop(w http.ResponseWriter) (*snoopingResponseWriter, http.ResponseWriter) {
+	snoopW := &snoopingResponseWriter{inner: w}
+	if hj, ok := w.(http.Hijacker); ok {
+		return snoopW, &snoopingHijackingResponseWriter{snoopingResponseWriter: snoopW, Hijacker: hj}
 	}
+	return snoopW, snoopW
+}
+
+// snoopOn wraps a response writer to record its status code in this state
+func (state *requestState) snoopOn(w http.ResponseWriter) http.ResponseWriter {
+	state.writer.inner = w
 	hj, ok := w.(http.Hijacker)
 	if !ok {
-		return snooping
+		return &state.writer
 	}
-	return snoopingHijackingResponseWriter{
-		snoopingResponseWriter: snooping,
+	state.hijacking = snoopingHijackingResponseWriter{
+		snoopingResponseWriter: &state.writer,
 		Hijacker:               hj,
 	}
+	return &state.hijacking
 }
 
 // Mux routes http requests to handlers
 type Mux struct {
-	// Routes is the set of potential handlers to consider, in the order to check them
+	// Routes is the set of potential handlers to consider, in the order to check them.
+	// They are built into a RouteTable for the first request, which is only rebuilt if the slice is replaced,
+	// so routes which are changed in place, such as with m.Routes[i] = ..., are not used until Compile
+	// or SetRoutes is called.
 	Routes []Route
 	// DefaultHander is an optional handler to use if no routes match a request
 	DefaultHandler Handler
+	// NotFoundHandler is an optional handler for requests which match no route, if there is no DefaultHandler.
+	// Unlike DefaultHandler, it is also used by any InnerMux without a DefaultHandler or NotFoundHandler of its own,
+	// so that nested muxes can share one 404 page. It must write its own status.
+	NotFoundHandler Handler
+	// StrictNotFound, if set, answers requests which match no route with 404 Not Found if there is no DefaultHandler,
+	// instead of leaving the response untouched, which net/http sends as an empty 200 OK
+	StrictNotFound bool
+	// BaseContext optionally returns the context to serve a request with, before PreProcess.
+	// If nil, the request's own context is used, so that handlers see values set by outer middleware and by
+	// net/http.Server.BaseContext, and are canceled when the client disconnects.
+	BaseContext func(req *http.Request) context.Context
 	// PreProcess is an optional function to call before attempting to match any routes, and to
 	// generate the context for the request, along with a function to defer to the end of the request.
 	// PreProcess is intended for logging and other "transparent" operations.
-	// If PreProcess is not specified, context.Background() is used
+	// It is called with the context from BaseContext, and if PreProcess is not specified, that context is used.
 	PreProcess PreProcessor
+	// Middleware optionally wraps the Handler of every route, the first outermost, outside of the route's own Middleware.
+	// It is called after PreProcess, once a route has been matched, its requests checked, and any form parsed,
+	// and the result, including any panic, is seen by PostProcess. It does not wrap the DefaultHandler, nor the
+	// responses the Mux chooses itself. It must not be changed while serving requests, except along with the Routes.
+	Middleware []Middleware
 	// PostProcess is an optional function to call with the result
 	// PostProcess is intended for logging and other "transparent" operations.
 	// PostProcess is only called if one of Routes or DefaultHandler is called.
 	// If a handler panics, statusCode will be -1, and err will be either the panic'ed error,
 	// or an error containing a string representation of the panic'ed value.
 	PostProcess PostProcessor
+	// ErrorHandler is optionally called with the error returned by any handler, including the DefaultHandler, if the
+	// handler had not written anything, so that errors can be turned into responses in one place.
+	// PostProcess still sees the error, along with the status the ErrorHandler wrote.
+	ErrorHandler func(ctx context.Context, w http.ResponseWriter, req *http.Request, err error)
+	// RecoverHandler is optionally called instead of answering with 500 Internal Server Error when a handler or PreProcess
+	// panics before writing a status, with the value it panicked with and its stack trace, such as to log the trace and render
+	// an error page. PostProcess still sees the panic, as a *PanicError.
+	RecoverHandler func(ctx context.Context, w http.ResponseWriter, req *http.Request, recovered any, stack []byte)
+	// PostProcessResult is an optional function to call with the result, as with PostProcess, after it, along with the
+	// route which handled the request, how long it took and how much was written, such as for access logs and metrics
+	// labeled by route
+	PostProcessResult ResultPostProcessor
+	// NotFoundCacheSize is the maximum number of requests which matched no route to remember, by method,
+	// host, and path, so that repeated requests for nonexistent paths, such as from scanners, do not evaluate
+	// the routes again. If zero, requests which match no route are not remembered.
+	// The remembered requests are forgotten whenever the routes are rebuilt.
+	// This must not be used with any route whose Matcher depends on other parts of the request.
+	NotFoundCacheSize int
+	// MatchCacheSize is the maximum number of requests which matched a route to remember, by method,
+	// host, and path, so that requests for frequently used paths, such as webhooks, do not evaluate the
+	// routes again. If zero, matched requests are not remembered.
+	// The remembered requests are forgotten whenever the routes are rebuilt.
+	// This must not be used with any route whose Matcher depends on other parts of the request.
+	MatchCacheSize int
+	// AllowedHosts is an optional set of hosts which requests must be for, to protect routes which match any
+	// host from host header injection and DNS rebinding. A request's host is allowed if it is in the set either
+	// as sent, or in lower case without its port. Requests for other hosts are answered with 421 Misdirected Request,
+	// and requests without a host with 400 Bad Request, without calling any route or DefaultHandler.
+	AllowedHosts StringSet
+	// AllowRouteHosts, if set, also allows the Hosts of every route, and rejects requests as with AllowedHosts
+	// even if AllowedHosts is nil
+	AllowRouteHosts bool
+	// ErrorPages are optional handlers to answer requests with, by status code, whenever the Mux itself chooses the
+	// status, such as a 405 when a route only allows other methods, a 503 in maintenance mode, or a 500 when a route panics,
+	// instead of an empty body. If there is an error page for 404, requests which match no route are answered with it if there
+	// is no DefaultHandler. Error pages always write the chosen status, which they can find with ErrorStatusFromContext,
+	// and are not recovered from if they panic.
+	ErrorPages map[int]Handler
+	// ErrorPageClasses are optional handlers to answer requests with, by the class of status code, e.g. 4 for any 4xx,
+	// as with ErrorPages, for statuses which have no page there
+	ErrorPageClasses map[int]Handler
+	// MethodNotAllowedHandler is an optional handler for requests which match a route except for their method,
+	// instead of answering them with 405 Method Not Allowed, such as to write an error body in the format of an API.
+	// The Allow header is already set, and the allowed methods can be found with AllowedMethodsFromContext,
+	// and the path variables are those of the first route which would match the request with one of those methods.
+	// It must write its own status.
+	MethodNotAllowedHandler Handler
+	// HeadFallback, if set, serves HEAD requests which match a route except for their method with the route
+	// which would have matched a GET request instead, with the body it writes discarded, as net/http.ServeMux does.
+	// The handler still sees the HEAD method.
+	HeadFallback bool
+	// ServerOptions optionally writes the body of the response to an OPTIONS request for the whole server, i.e.
+	// "OPTIONS *", such as a description of its capabilities, after the Allow header has been set to the methods
+	// accepted by any route. If nil, such requests are answered with only the headers.
+	// A net/http.Server only passes these requests on if its DisableGeneralOptionsHandler is set.
+	ServerOptions Handler
+	// RequireTLS, if set, only handles requests made over TLS, as with WithSchemes("https") on every route.
+	// Plain HTTP requests are answered by InsecureHandler.
+	RequireTLS bool
+	// TrustForwardedProto, if set, takes the scheme of a request not made over TLS from its X-Forwarded-Proto header,
+	// such as when behind a proxy which terminates TLS. It must only be set if every request comes through such a proxy,
+	// as otherwise clients could claim to use TLS.
+	TrustForwardedProto bool
+	// InsecureHandler optionally answers plain HTTP requests which must be made over TLS, such as with RedirectToHTTPS.
+	// If nil, they are answered with 403 Forbidden.
+	InsecureHandler Handler
+	// ValidateInput optionally checks every value decoded by Bind and JSONHandler for the routes of this Mux, or of any
+	// Mux it serves, after any Validate method of its own, such as with a validation library. Invalid values are
+	// answered with 422 Unprocessable Entity by the ErrorHandler. Bind finds it through the context of the request.
+	ValidateInput func(ctx context.Context, v any) error
+	// Codecs are the formats TypedHandler and Bind can use for the routes of this Mux, or of any Mux it serves,
+	// such as MessagePack or YAML, which are preferred over those of any Mux serving it, and then over JSONCodec,
+	// XMLCodec, and ProtobufCodec.
+	Codecs []Codec
+	// MaxBodyBytes, if positive, limits the size of the body of requests to routes without a limit of their own,
+	// as with WithMaxBodyBytes
+	MaxBodyBytes int64
+
+	// table is the index of Routes used to find matching routes
+	table atomic.Pointer[RouteTable]
+	// maintenance is set while in maintenance mode
+	maintenance atomic.Pointer[maintenance]
+}
+
+// maintenance is the configuration of maintenance mode
+type maintenance struct {
+	retryAfter string
+	allowed    StringSet
+}
+
+// SetMaintenance turns maintenance mode on or off. While it is on, requests for any path except those in the
+// allowlist, such as health checks and status pages, are answered with 503 Service Unavailable, with a Retry-After
+// header if retryAfter is positive, without calling any route or DefaultHandler. This is safe to call while serving
+// requests, such as during a deploy or an incident. For an InnerMux, paths are those seen by the inner Mux.
+func (m *Mux) SetMaintenance(on bool, retryAfter time.Duration, allowlist []string) {
+	if !on {
+		m.maintenance.Store(nil)
+		return
+	}
+	mt := &maintenance{allowed: StringSetOf(allowlist...)}
+	if retryAfter > 0 {
+		mt.retryAfter = strconv.Itoa(int((retryAfter + time.Second - 1) / time.Second))
+	}
+	m.maintenance.Store(mt)
+}
+
+// InMaintenance returns true if maintenance mode is on
+func (m *Mux) InMaintenance() bool {
+	return m.maintenance.Load() != nil
 }
 
 // InnerMux wraps a Mux so that it implements minimux.Handler instead of net/http.Handler .
@@ -104,34 +359,55 @@ type innerMux struct {
 	suffixVar string
 }
 
-// ServeHTTP implements Handler
+// ServeHTTP implements Handler.
+// The inner Mux receives a copy of pathVars, so its routes do not modify the variables seen by the outer Mux.
 func (m innerMux) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) (err error) {
+	state := getRequestState()
+	defer putRequestState(state)
+	for k, v := range pathVars {
+		state.pathVars[k] = v
+	}
 	if m.suffixVar != "" {
-		req.URL.Path = pathVars[m.suffixVar]
-		delete(pathVars, m.suffixVar)
+		req.URL.Path = state.pathVars[m.suffixVar]
+		delete(state.pathVars, m.suffixVar)
 	}
-	var statusCode int
+	return m.serve(ctx, w, req, state)
+}
 
+// serve routes a request using a fresh request state, whose path variables may already be populated
+func (m innerMux) serve(ctx context.Context, w http.ResponseWriter, req *http.Request, state *requestState) (err error) {
 	// Set up a handler in case pre-processor panics
 	preProcessorDone := false
-	if m.PostProcess != nil {
+	var start time.Time
+	if m.PostProcessResult != nil {
+		start = time.Now()
+	}
+	if m.PostProcess != nil || m.PostProcessResult != nil || m.RecoverHandler != nil {
 		defer func() {
 			if preProcessorDone {
 				return
 			}
 			r := recover()
 			if r != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				statusCode = StatusPreProcessPanic
-				var ok bool
-				err, ok = r.(error)
-				if !ok {
-					err = fmt.Errorf("%v", r)
-				}
-				m.PostProcess(ctx, req, statusCode, err)
+				p := panicError(r)
+				err = p
+				m.recovered(ctx, w, req, p)
+				m.postProcess(ctx, req, RequestResult{StatusCode: StatusPreProcessPanic, Err: err}, start)
 			}
 		}()
 	}
+	if m.NotFoundHandler != nil {
+		ctx = context.WithValue(ctx, notFoundHandlerKey{}, m.NotFoundHandler)
+	}
+	if m.ValidateInput != nil {
+		ctx = context.WithValue(ctx, validateInputKey{}, m.ValidateInput)
+	}
+	if m.ErrorHandler != nil {
+		ctx = context.WithValue(ctx, errorHandledKey{}, true)
+	}
+	if m.Codecs != nil {
+		ctx = withCodecs(ctx, m.Codecs)
+	}
 	// Call the pre-processor, and defer the function it returns, if any
 	if m.PreProcess != nil {
 		var toDefer func()
@@ -144,62 +420,437 @@ func (m innerMux) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *htt
 	preProcessorDone = true
 
 	// Set up the method not allowed handler, default handler, and post-processor
-	snoopW := snoopOn(w, &statusCode)
+	snoopW := w
+	snooping := m.needsStatus()
+	if snooping {
+		snoopW = state.snoopOn(w)
+	}
 	found := false
 	methodNotAllowed := false
+	var allowed StringSet
+	// hooked is the matched route if it has its own PreProcess or PostProcess, which are called with routeCtx
+	var hooked *Route
+	// matched is the route which handled the request, if any, and defaulted is true if the DefaultHandler did
+	var matched *Route
+	defaulted := false
+	routeCtx := ctx
+	var routeDefer func()
 	defer func() {
 		r := recover()
 		if r != nil {
-			if statusCode == 0 {
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-			statusCode = StatusPanic
-			var ok bool
-			err, ok = r.(error)
-			if !ok {
-				err = fmt.Errorf("%v", r)
+			p := panicError(r)
+			err = p
+			if state.writer.statusCode == 0 {
+				m.recovered(ctx, w, req, p)
 			}
 			// The panicked part of the stack trace is only available within this block,
 			// which means if the use wants to potentially handle the panic by displaying
 			// the trace, e.g. logr.Logger.Error, this has to be called here, and we must
 			// duplicate the call
-			m.PostProcess(ctx, req, statusCode, err)
+			if hooked != nil {
+				hooked.postProcess(routeCtx, req, StatusPanic, err, routeDefer)
+			}
+			m.postProcess(ctx, req, RequestResult{StatusCode: StatusPanic, Err: err, Route: matched, DefaultHandler: defaulted, BytesWritten: state.writer.written, WriteErr: state.writer.writeErr}, start)
 		} else {
 			if methodNotAllowed {
-				statusCode = http.StatusMethodNotAllowed
-				w.WriteHeader(statusCode)
+				allowedCtx := context.WithValue(ctx, allowedMethodsKey{}, allowed)
+				if m.MethodNotAllowedHandler != nil {
+					err = m.MethodNotAllowedHandler.ServeHTTP(allowedCtx, snoopW, req, state.pathVars, nil)
+				} else {
+					err = m.writeStatus(allowedCtx, snoopW, req, http.StatusMethodNotAllowed)
+				}
 			} else if !found {
-				if m.DefaultHandler == nil {
+				if m.DefaultHandler != nil {
+					defaulted = true
+					err = m.DefaultHandler.ServeHTTP(ctx, snoopW, req, nil, nil)
+				} else if notFound := m.notFoundHandler(ctx); notFound != nil {
+					err = notFound.ServeHTTP(ctx, snoopW, req, state.pathVars, nil)
+				} else if m.StrictNotFound || m.errorPage(http.StatusNotFound) != nil {
+					err = m.writeStatus(ctx, snoopW, req, http.StatusNotFound)
+				} else {
 					return
 				}
-				err = m.DefaultHandler.ServeHTTP(ctx, snoopW, req, nil, nil)
 			}
+			if err != nil && snooping && state.writer.statusCode == 0 && state.writer.written == 0 {
+				var tooLarge *http.MaxBytesError
+				if m.ErrorHandler != nil {
+					m.ErrorHandler(ctx, snoopW, req, err)
+				} else if errors.As(err, &tooLarge) {
+					err = m.writeStatus(ctx, snoopW, req, http.StatusRequestEntityTooLarge)
+				}
+			}
+			statusCode := state.writer.statusCode
 			if statusCode == 0 {
 				statusCode = http.StatusOK
 			}
-			if m.PostProcess != nil {
-				m.PostProcess(ctx, req, statusCode, err)
+			if hooked != nil {
+				hooked.postProcess(routeCtx, req, statusCode, err, routeDefer)
 			}
+			m.postProcess(ctx, req, RequestResult{StatusCode: statusCode, Err: err, Route: matched, DefaultHandler: defaulted, BytesWritten: state.writer.written, WriteErr: state.writer.writeErr}, start)
 		}
 	}()
 
+	if m.PreProcess != nil {
+		if rej := rejectionFromContext(ctx); rej != nil {
+			found = true
+			err = m.reject(ctx, snoopW, req, state, rej)
+			return
+		}
+	}
+
 	// Find the first matching route and call it
-	for _, r := range m.Routes {
-		var values []string
-		values, found, methodNotAllowed = r.Matches(req)
-		if !found {
-			continue
+	var r *Route
+	var values []string
+	t, tableErr := m.currentTable()
+	if tableErr != nil {
+		found = true
+		if err = m.writeStatus(ctx, snoopW, req, http.StatusInternalServerError); err == nil {
+			err = tableErr
+		}
+		return
+	}
+	if status := m.hostRejection(t, req); status != 0 {
+		found = true
+		err = m.writeStatus(ctx, snoopW, req, status)
+		return
+	}
+	if m.RequireTLS {
+		if found, err = m.checkScheme(ctx, snoopW, req, state.pathVars, httpsOnly); found {
+			return
+		}
+	}
+	if mt := m.maintenance.Load(); mt != nil && !mt.allowed.Has(req.URL.Path) {
+		found = true
+		if mt.retryAfter != "" {
+			snoopW.Header().Set("Retry-After", mt.retryAfter)
+		}
+		err = m.writeStatus(ctx, snoopW, req, http.StatusServiceUnavailable)
+		return
+	}
+	if req.Method == http.MethodOptions && req.URL.Path == "*" {
+		found = true
+		err = m.serverOptions(ctx, snoopW, req, t)
+		return
+	}
+	r, values, methodNotAllowed = m.match(ctx, t, req)
+	head := false
+	if methodNotAllowed && m.HeadFallback && req.Method == http.MethodHead {
+		if r, values = m.matchAs(ctx, t, req, http.MethodGet); r != nil {
+			methodNotAllowed = false
+			head = true
+		}
+	}
+	found = r != nil
+	var bodyLimit int64
+	if found {
+		bodyLimit = r.bodyLimit(m.MaxBodyBytes)
+	}
+	if found && (r.PostProcess != nil || bodyLimit > 0) && !snooping {
+		snoopW = state.snoopOn(w)
+		snooping = true
+	}
+	if head {
+		snoopW = headResponseWriter{ResponseWriter: snoopW}
+	}
+	if methodNotAllowed {
+		var ok bool
+		if allowed, ok = t.AllowedMethods(req); ok {
+			if m.HeadFallback && allowed.Has(http.MethodGet) {
+				allowed[http.MethodHead] = struct{}{}
+			}
+			snoopW.Header().Set("Allow", allowHeader(allowed))
+			if m.MethodNotAllowedHandler != nil {
+				if allowedR, allowedValues := m.matchAs(ctx, t, req, firstMethod(allowed)); allowedR != nil {
+					allowedR.HostVarMap(req, state.pathVars)
+					allowedR.VarMap(allowedValues, state.pathVars)
+				}
+			}
+		}
+	}
+	if found {
+		matched = r
+		r.HostVarMap(req, state.pathVars)
+		r.VarMap(values, state.pathVars)
+		if len(r.Accept) != 0 || len(r.acceptRivals) != 0 {
+			snoopW.Header().Add("Vary", "Accept")
+		}
+		if r.PreProcess != nil || r.PostProcess != nil {
+			hooked = r
+			if r.PreProcess != nil {
+				routeCtx, routeDefer = r.PreProcess(ctx, req)
+				if rej := rejectionFromContext(routeCtx); rej != nil {
+					err = m.reject(routeCtx, snoopW, req, state, rej)
+					return
+				}
+			}
+		}
+		ctx := routeCtx
+		if r.Schemes != nil {
+			var rejected bool
+			if rejected, err = m.checkScheme(ctx, snoopW, req, state.pathVars, r.Schemes); rejected {
+				return
+			}
+		}
+		if r.Schedule != nil && !r.Schedule.Open(time.Now()) {
+			if r.Closed == nil {
+				err = m.writeStatus(ctx, snoopW, req, http.StatusServiceUnavailable)
+				return
+			}
+			err = r.Closed.ServeHTTP(ctx, snoopW, req, state.pathVars, nil)
+			return
+		}
+		if status := r.rejection(ctx, req); status != 0 {
+			err = m.writeStatus(ctx, snoopW, req, status)
+			return
+		}
+		if r.Policy != nil {
+			var status int
+			if status, err = authorize(ctx, r.Policy, r, req); status != 0 {
+				if pageErr := m.writeStatus(ctx, snoopW, req, status); err == nil {
+					err = pageErr
+				}
+				return
+			}
+		}
+		r.setReadDeadline(w)
+		if bodyLimit > 0 && req.Body != nil {
+			req.Body = http.MaxBytesReader(w, req.Body, bodyLimit)
 		}
-		r.VarMap(values, pathVars)
 		formErr := r.ParseFormIfNeeded(req)
-		err = r.Handler.ServeHTTP(ctx, snoopW, req, pathVars, formErr)
-		break
+		err = t.handler(r, m.Middleware).ServeHTTP(withVars(r.withLazyFormIfNeeded(ctx), state.pathVars), snoopW, req, state.pathVars, formErr)
 	}
 	return
 }
 
+// postProcess calls PostProcess and PostProcessResult, if set, with the result of a request which started at a time
+func (m innerMux) postProcess(ctx context.Context, req *http.Request, result RequestResult, start time.Time) {
+	if m.PostProcess != nil {
+		m.PostProcess(ctx, req, result.StatusCode, result.Err)
+	}
+	if m.PostProcessResult == nil {
+		return
+	}
+	result.Duration = time.Since(start)
+	if result.Route != nil && result.Route.Pattern != nil {
+		result.Pattern = result.Route.Pattern.String()
+	}
+	m.PostProcessResult(ctx, req, result)
+}
+
+// reject answers a request which a PreProcessor rejected
+func (m innerMux) reject(ctx context.Context, w http.ResponseWriter, req *http.Request, state *requestState, rej *rejection) error {
+	if rej.handler != nil {
+		return rej.handler.ServeHTTP(ctx, w, req, state.pathVars, nil)
+	}
+	return m.writeStatus(ctx, w, req, rej.statusCode)
+}
+
+type notFoundHandlerKey struct{}
+
+// notFoundHandler returns the NotFoundHandler of this Mux, or of the innermost Mux serving it which has one
+func (m innerMux) notFoundHandler(ctx context.Context) Handler {
+	if m.NotFoundHandler != nil {
+		return m.NotFoundHandler
+	}
+	handler, _ := ctx.Value(notFoundHandlerKey{}).(Handler)
+	return handler
+}
+
+// commonMethods are the methods listed in the Allow header of an OPTIONS request for the whole server
+// if any method may be accepted
+var commonMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// serverOptions answers an OPTIONS request for the whole server with the methods accepted by any route
+func (m innerMux) serverOptions(ctx context.Context, w http.ResponseWriter, req *http.Request, t *RouteTable) error {
+	allow := strings.Join(commonMethods, ", ")
+	if methods, ok := t.ServerMethods(); ok {
+		methods[http.MethodOptions] = struct{}{}
+		allow = allowHeader(methods)
+	}
+	w.Header().Set("Allow", allow)
+	if m.ServerOptions != nil {
+		return m.ServerOptions.ServeHTTP(ctx, w, req, nil, nil)
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// firstMethod returns the alphabetically first method in a non-empty set
+func firstMethod(methods StringSet) string {
+	first := ""
+	for method := range methods {
+		if first == "" || method < first {
+			first = method
+		}
+	}
+	return first
+}
+
+// allowHeader returns the value of an Allow header listing a set of methods
+func allowHeader(methods StringSet) string {
+	allow := make([]string, 0, len(methods))
+	for method := range methods {
+		allow = append(allow, method)
+	}
+	sort.Strings(allow)
+	return strings.Join(allow, ", ")
+}
+
+// hostRejection returns the status code to answer a request with because its host is not allowed,
+// or zero if it is
+func (m innerMux) hostRejection(t *RouteTable, req *http.Request) int {
+	if m.AllowedHosts == nil && !m.AllowRouteHosts {
+		return 0
+	}
+	if req.Host == "" {
+		return http.StatusBadRequest
+	}
+	if m.AllowedHosts.Has(req.Host) || (m.AllowRouteHosts && t.hosts.Has(req.Host)) {
+		return 0
+	}
+	host := hostWithoutPort(req.Host)
+	if m.AllowedHosts.Has(host) || (m.AllowRouteHosts && t.hasHost(host)) {
+		return 0
+	}
+	return http.StatusMisdirectedRequest
+}
+
+// needsStatus returns true if the status code of responses must be recorded.
+// If not, handlers are given the original ResponseWriter, and a 500 status is written if a handler
+// panics, even if it had already written a status.
+func (m innerMux) needsStatus() bool {
+	return m.PostProcess != nil || m.PostProcessResult != nil || m.ErrorHandler != nil || m.ErrorPages != nil || m.ErrorPageClasses != nil ||
+		m.RecoverHandler != nil
+}
+
+// panicError converts a recovered value to an error, if it is not already one
+func panicError(r any) *PanicError {
+	return &PanicError{Value: r, Stack: debug.Stack()}
+}
+
+// PanicError is the error passed to PostProcess when a handler or PreProcess panics
+type PanicError struct {
+	// Value is the value passed to panic
+	Value any
+	// Stack is the stack trace of the goroutine which panicked, as from runtime/debug.Stack
+	Stack []byte
+}
+
+// Error implements error
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("%v", p.Value)
+}
+
+// Unwrap returns the value passed to panic, if it was an error, for errors.Is and errors.As
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// recovered answers a request whose handler or PreProcess panicked, with the RecoverHandler if there is one,
+// and 500 Internal Server Error otherwise
+func (m innerMux) recovered(ctx context.Context, w http.ResponseWriter, req *http.Request, p *PanicError) {
+	if m.RecoverHandler != nil {
+		m.RecoverHandler(ctx, w, req, p.Value, p.Stack)
+		return
+	}
+	m.writeStatus(ctx, w, req, http.StatusInternalServerError)
+}
+
+// match finds the route for a request, using the remembered results of previous requests, if enabled.
+// Results which depend on whether a route is Enabled, its Conditions, or the body of the request, are not remembered.
+func (m *Mux) match(ctx context.Context, t *RouteTable, req *http.Request) (route *Route, varValues []string, methodNotAllowed bool) {
+	if m.NotFoundCacheSize <= 0 && m.MatchCacheSize <= 0 {
+		route, varValues, methodNotAllowed, _ = t.match(ctx, req)
+		return route, varValues, methodNotAllowed
+	}
+	key := matchKey{method: req.Method, host: req.Host, path: req.URL.Path}
+	if m.MatchCacheSize > 0 {
+		if result, ok := t.matchCache(m.MatchCacheSize).get(key); ok {
+			return result.route, result.values, false
+		}
+	}
+	if m.NotFoundCacheSize > 0 {
+		if methodNotAllowed, ok := t.notFoundCache(m.NotFoundCacheSize).get(key); ok {
+			return nil, nil, methodNotAllowed
+		}
+	}
+	route, varValues, methodNotAllowed, skipped := t.match(ctx, req)
+	if skipped {
+		return route, varValues, methodNotAllowed
+	}
+	if route != nil && !route.skippable() && m.MatchCacheSize > 0 {
+		t.matchCache(m.MatchCacheSize).put(key, matchResult{route: route, values: varValues})
+	}
+	if route == nil && m.NotFoundCacheSize > 0 {
+		t.notFoundCache(m.NotFoundCacheSize).put(key, methodNotAllowed)
+	}
+	return route, varValues, methodNotAllowed
+}
+
+// matchAs finds the first route which would match a request if it had a different method
+func (m *Mux) matchAs(ctx context.Context, t *RouteTable, req *http.Request, method string) (route *Route, varValues []string) {
+	asReq := *req
+	asReq.Method = method
+	route, varValues, _ = m.match(ctx, t, &asReq)
+	// The body may have been read ahead by a route's Body
+	req.Body = asReq.Body
+	return route, varValues
+}
+
+// Compile builds a RouteTable from a copy of the current Routes, and uses it to serve all requests until
+// Compile is called again. Changes to Routes after calling Compile have no effect until then.
+// If Compile is never called, a RouteTable is built automatically for the first request, and rebuilt
+// if Routes is replaced, but not if its routes are changed in place, in which case any invalid routes
+// cause every request to be answered with 500 Internal Server Error, returning the error to the PostProcessor.
+// If any routes are invalid, the previous routes continue to be used.
+func (m *Mux) Compile() (*RouteTable, error) {
+	return m.SetRoutes(m.Routes)
+}
+
+// SetRoutes builds a RouteTable from a copy of a set of routes, and uses it to serve all requests after it returns,
+// as if by Compile, but without modifying Routes. Unlike modifying Routes, this is safe to call while serving requests.
+// Requests which are already being served continue to use the routes they were matched against.
+func (m *Mux) SetRoutes(routes []Route) (*RouteTable, error) {
+	t, err := NewRouteTable(routes)
+	if err != nil {
+		return nil, err
+	}
+	t.pinned = true
+	m.table.Store(t)
+	return t, nil
+}
+
+// currentTable returns the RouteTable used to serve requests, rebuilding it if needed, or an error if the Routes
+// are invalid
+func (m *Mux) currentTable() (*RouteTable, error) {
+	for {
+		t := m.table.Load()
+		if t != nil && (t.pinned || t.builtFrom(m.Routes)) {
+			return t, t.err
+		}
+		rebuilt, err := NewRouteTable(m.Routes)
+		if err != nil {
+			// The invalid routes are remembered so that they aren't built again for every request
+			rebuilt = &RouteTable{source: m.Routes, err: err}
+		}
+		// If the table was replaced with SetRoutes in the meantime, that one must be used instead
+		if m.table.CompareAndSwap(t, rebuilt) {
+			return rebuilt, rebuilt.err
+		}
+	}
+}
+
 // ServeHTTP implements net/http.Handler
 func (m *Mux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	ctx := context.Background()
-	innerMux{Mux: m}.ServeHTTP(ctx, w, req, map[string]string{}, nil)
+	ctx := req.Context()
+	if m.BaseContext != nil {
+		ctx = m.BaseContext(req)
+	}
+	state := getRequestState()
+	defer putRequestState(state)
+	innerMux{Mux: m}.serve(ctx, w, req, state)
 }
@@ -0,0 +1,117 @@
+package minimux_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/meln5674/minimux"
+)
+
+// discardResponseWriter is a ResponseWriter which does nothing, so that benchmarks only measure the mux
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d discardResponseWriter) Header() http.Header {
+	return d.header
+}
+
+func (d discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (d discardResponseWriter) WriteHeader(statusCode int) {}
+
+func noopHandler(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	return nil
+}
+
+func benchmarkMux(b *testing.B, mux *minimux.Mux, method, url string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := req.URL.Path
+	w := discardResponseWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Nested muxes with prefixes modify the path
+		req.URL.Path = path
+		mux.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkLiteralRoute(b *testing.B) {
+	benchmarkMux(b, &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/foo").IsHandledByFunc(noopHandler),
+		},
+	}, http.MethodGet, "http://localhost/foo")
+}
+
+func BenchmarkPatternRoute(b *testing.B) {
+	benchmarkMux(b, &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.PathWithVars("/foo/([^/]+)", "id").IsHandledByFunc(noopHandler),
+		},
+	}, http.MethodGet, "http://localhost/foo/bar")
+}
+
+func BenchmarkNestedMux(b *testing.B) {
+	benchmarkMux(b, &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.PathWithVars("/foo(/.*)", "suffix").IsHandledBy(minimux.InnerMuxWithPrefix("suffix", &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.LiteralPath("/bar").IsHandledByFunc(noopHandler),
+				},
+			})),
+		},
+	}, http.MethodGet, "http://localhost/foo/bar")
+}
+
+func BenchmarkStaticData(b *testing.B) {
+	benchmarkMux(b, &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.PathWithVars("/static(/.*)", "path").IsHandledBy(minimux.StaticData{
+				StaticBytes: map[string]minimux.StaticBytes{
+					"/index.html": minimux.NewStaticBytes([]byte("<html></html>"), "text/html"),
+				},
+				PathVar: "path",
+			}),
+		},
+	}, http.MethodGet, "http://localhost/static/index.html")
+}
+
+// manyRoutes returns 500 routes with variables, as though for 100 resources, where the last route matches
+// /resource99/{id}/items/{item}. If regex is true, each route is given a Matcher, so that every pattern must
+// be evaluated, instead of matching them by their segments.
+func manyRoutes(regex bool) []minimux.Route {
+	routes := make([]minimux.Route, 0, 500)
+	for i := 0; i < 100; i++ {
+		for _, pattern := range []string{
+			"/resource%d/([^/]+)",
+			"/resource%d/([^/]+)/items",
+			"/resource%d/([^/]+)/owner/([^/]+)",
+			"/resource%d/([^/]+)/items/([^/]+)/owner",
+			"/resource%d/([^/]+)/items/([^/]+)",
+		} {
+			route := minimux.PathWithVars(fmt.Sprintf(pattern, i), "id", "item").IsHandledByFunc(noopHandler)
+			if regex {
+				route.Matcher = minimux.RegexMatcher{Pattern: route.Pattern}
+			}
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+func BenchmarkManyRoutesBySegment(b *testing.B) {
+	benchmarkMux(b, &minimux.Mux{Routes: manyRoutes(false)}, http.MethodGet, "http://localhost/resource99/foo/items/bar")
+}
+
+func BenchmarkManyRoutesByRegex(b *testing.B) {
+	benchmarkMux(b, &minimux.Mux{Routes: manyRoutes(true)}, http.MethodGet, "http://localhost/resource99/foo/items/bar")
+}
@@ -3,16 +3,23 @@ package minimux_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"testing/fstest"
+	"time"
 
 	"github.com/meln5674/minimux"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
 )
 
 func stringReader(s string) io.Reader {
@@ -58,6 +65,28 @@ func expectResponse(handler http.Handler, req *http.Request, statusCode int, bod
 	Expect(actualBody).To(Equal(body), "Unexpected body")
 }
 
+// exactPaths is a Matcher which maps exact paths to the value of a single route variable
+type exactPaths map[string]string
+
+func (e exactPaths) Match(req *http.Request) (varValues []string, matches bool, methodNotAllowed bool) {
+	value, ok := e[req.URL.Path]
+	if !ok {
+		return nil, false, false
+	}
+	if req.Method != http.MethodGet {
+		return nil, false, true
+	}
+	return []string{value}, true, false
+}
+
+// respondWith returns a handler which writes a body followed by the "name" path variable
+func respondWith(body string) minimux.Handler {
+	return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		w.Write([]byte(body + pathVars["name"]))
+		return nil
+	})
+}
+
 var _ = Describe("A mux", func() {
 	DescribeTable(
 		"that is empty should return 200 and an empty body for any method or path",
@@ -327,6 +356,37 @@ var _ = Describe("A mux", func() {
 			Expect(postProcessorCalled).To(BeTrue(), "PostProcessor was not called")
 		})
 	})
+	Describe("without a post-processor", func() {
+		It("should pass the original response writer to the route", func() {
+			resp := httptest.NewRecorder()
+			var routeWriter http.ResponseWriter
+			mux := &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.
+						LiteralPath("/foo").
+						IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+							routeWriter = w
+							return nil
+						}),
+				},
+			}
+			mux.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "http://localhost/foo", nil))
+			Expect(routeWriter).To(BeIdenticalTo(resp))
+		})
+		It("should return 500 if the route panics before writing the header", func() {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/foo", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(&minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.
+						LiteralPath("/foo").
+						IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+							panic("oops")
+						}),
+				},
+			}, req, http.StatusInternalServerError, "")
+		})
+	})
 	Describe("nested in another mux with a prefix", func() {
 		It("should pass down any path variables and strip the prefix", func() {
 			routeCalled := false
@@ -356,6 +416,61 @@ var _ = Describe("A mux", func() {
 			Expect(routeCalled).To(BeTrue(), "Route was not called")
 		})
 	})
+	Describe("nested in another mux with path variables", func() {
+		It("should not modify the path variables of the outer mux", func() {
+			var outerVars, innerVars map[string]string
+			inner := minimux.InnerMuxWithPrefix("suffix", &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.
+						PathWithVars("/(bar)", "name").
+						IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+							innerVars = map[string]string{}
+							for k, v := range pathVars {
+								innerVars[k] = v
+							}
+							return nil
+						}),
+				},
+			})
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/foo/bar", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(&minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.
+						PathWithVars("/(foo)(/.*)", "name", "suffix").
+						IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+							err := inner.ServeHTTP(ctx, w, req, pathVars, formErr)
+							outerVars = map[string]string{}
+							for k, v := range pathVars {
+								outerVars[k] = v
+							}
+							return err
+						}),
+				},
+			}, req, http.StatusOK, "")
+			Expect(innerVars).To(Equal(map[string]string{"name": "bar"}))
+			Expect(outerVars).To(Equal(map[string]string{"name": "foo", "suffix": "/bar"}))
+		})
+	})
+	It("should give each request its own path variables, which handlers may keep", func() {
+		var kept []map[string]string
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.
+					PathWithVars("/users/([^/]+)", "name").
+					IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+						kept = append(kept, pathVars)
+						return nil
+					}),
+			},
+		}
+		for _, name := range []string{"alice", "bob"} {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/users/"+name, nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "")
+		}
+		Expect(kept).To(Equal([]map[string]string{{"name": "alice"}, {"name": "bob"}}))
+	})
 	Describe("nested in another mux without a prefix", func() {
 		It("should pass down any path variables and keep the prefix", func() {
 			routeCalled := false
@@ -410,4 +525,910 @@ var _ = Describe("A mux", func() {
 			Expect(routeCalled).To(BeTrue(), "Route was not called")
 		})
 	})
+	Describe("with both literal and pattern routes", func() {
+		var mux *minimux.Mux
+		BeforeEach(func() {
+			mux = &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.PathWithVars("/users/(admin)", "name").WithMethods(http.MethodGet).IsHandledBy(respondWith("pattern-")),
+					minimux.LiteralPath("/users/admin").IsHandledBy(respondWith("literal")),
+					minimux.LiteralPath("/users/self").WithMethods(http.MethodGet).IsHandledBy(respondWith("self")),
+					minimux.PathWithVars("/([^/]+)/edit", "name").IsHandledBy(respondWith("edit-")),
+					minimux.PathWithVars("/users/([^/]+)", "name").WithMethods(http.MethodGet).IsHandledBy(respondWith("user-")),
+					minimux.LiteralPath("/groups").WithMethods(http.MethodGet).IsHandledBy(respondWith("groups")),
+					minimux.LiteralPath("/other").IsHandledBy(respondWith("other")),
+				},
+			}
+		})
+		It("should prefer an earlier pattern route over a later literal route", func() {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/users/admin", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "pattern-admin")
+		})
+		It("should fall through to a later literal route", func() {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/users/admin", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "literal")
+		})
+		It("should prefer an earlier literal route over a later pattern route", func() {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/users/self", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "self")
+		})
+		It("should fall through to a later pattern route", func() {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/users/bob", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "user-bob")
+		})
+		It("should interleave routes which don't start with a literal segment", func() {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/users/edit", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "edit-users")
+		})
+		It("should return method not allowed if only the method of a literal route doesn't match", func() {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/groups", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusMethodNotAllowed, "")
+		})
+		It("should use routes added after the first request", func() {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/other", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "other")
+			mux.Routes = append([]minimux.Route{minimux.LiteralPath("/other").IsHandledBy(respondWith("new"))}, mux.Routes...)
+			req, err = http.NewRequest(http.MethodGet, "http://localhost/other", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "new")
+		})
+	})
+	Describe("with a route that has a lazy form", func() {
+		It("Should not parse the form until it is requested", func() {
+			routeCalled := false
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/foo?bar=qux", stringReader("body"))
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(&minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.
+						LiteralPath("/foo").
+						WithLazyForm().
+						IsHandledBy(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+							defer GinkgoRecover()
+							routeCalled = true
+							Expect(formErr).ToNot(HaveOccurred())
+							Expect(req.Form).To(BeNil(), "Form was parsed before it was requested")
+							Expect(minimux.ParseLazyForm(ctx, req)).To(Succeed())
+							Expect(req.Form.Get("bar")).To(Equal("qux"), "Form was not parsed")
+							Expect(minimux.ParseLazyForm(ctx, req)).To(Succeed())
+							w.Write([]byte("resp"))
+							return nil
+						})),
+				},
+			}, req, http.StatusOK, "resp")
+			Expect(routeCalled).To(BeTrue(), "Route was not called")
+		})
+	})
+	Describe("with a route that has a multipart form", func() {
+		var mux *minimux.Mux
+		BeforeEach(func() {
+			mux = &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.
+						LiteralPath("/upload").
+						WithMultipartForm(1024).
+						IsHandledBy(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+							if formErr != nil {
+								w.WriteHeader(http.StatusBadRequest)
+								return nil
+							}
+							name := req.FormValue("name")
+							if req.MultipartForm != nil {
+								file, _, err := req.FormFile("file")
+								if err != nil {
+									return err
+								}
+								defer file.Close()
+								contents, err := io.ReadAll(file)
+								if err != nil {
+									return err
+								}
+								name += ":" + string(contents)
+							}
+							w.Write([]byte(name))
+							return nil
+						})),
+				},
+			}
+		})
+		It("should parse uploaded files", func() {
+			body := &strings.Builder{}
+			form := multipart.NewWriter(body)
+			Expect(form.WriteField("name", "report")).To(Succeed())
+			file, err := form.CreateFormFile("file", "report.txt")
+			Expect(err).ToNot(HaveOccurred())
+			file.Write([]byte("contents"))
+			Expect(form.Close()).To(Succeed())
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/upload", stringReader(body.String()))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			expectResponse(mux, req, http.StatusOK, "report:contents")
+		})
+		It("should parse other forms", func() {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/upload", stringReader("name=report"))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			expectResponse(mux, req, http.StatusOK, "report")
+		})
+		It("should pass errors to the handler", func() {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/upload", stringReader("--broken"))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Content-Type", "multipart/form-data; boundary=other")
+			expectResponse(mux, req, http.StatusBadRequest, "")
+		})
+	})
+	Describe("with body size limits", func() {
+		readBody := minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return err
+			}
+			w.Write(body)
+			return nil
+		})
+		routes := []minimux.Route{
+			minimux.LiteralPath("/small").IsHandledBy(readBody),
+			minimux.LiteralPath("/large").WithMaxBodyBytes(8).IsHandledBy(readBody),
+			minimux.LiteralPath("/unlimited").WithMaxBodyBytes(-1).IsHandledBy(readBody),
+			minimux.LiteralPath("/form").WithForm().IsHandledBy(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				return formErr
+			})),
+			minimux.LiteralPath("/json").IsHandledBy(minimux.JSONHandler(func(ctx context.Context, req string, vars map[string]string) (string, error) {
+				return req, nil
+			})),
+		}
+		DescribeTable("should answer requests with bodies which are too large with 413",
+			func(errorHandler bool, path, body, contentType string, expectedStatus int, expectedBody string) {
+				mux := minimux.Mux{MaxBodyBytes: 4, Routes: routes}
+				if errorHandler {
+					mux.ErrorHandler = minimux.WriteError
+				}
+				req, err := http.NewRequest(http.MethodPost, "http://localhost"+path, stringReader(body))
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set("Content-Type", contentType)
+				expectResponse(&mux, req, expectedStatus, expectedBody)
+			},
+			Entry("within the limit of the mux", false, "/small", "abcd", "text/plain", http.StatusOK, "abcd"),
+			Entry("beyond the limit of the mux", false, "/small", "abcde", "text/plain", http.StatusRequestEntityTooLarge, ""),
+			Entry("within the limit of the route", false, "/large", "abcdefgh", "text/plain", http.StatusOK, "abcdefgh"),
+			Entry("beyond the limit of the route", false, "/large", "abcdefghi", "text/plain", http.StatusRequestEntityTooLarge, ""),
+			Entry("without a limit", false, "/unlimited", "abcdefghi", "text/plain", http.StatusOK, "abcdefghi"),
+			Entry("while parsing the form", false, "/form", "a=bcde", "application/x-www-form-urlencoded", http.StatusRequestEntityTooLarge, ""),
+			Entry("with an error handler", true, "/small", "abcde", "text/plain", http.StatusRequestEntityTooLarge, "Request Entity Too Large\n"),
+			Entry("while decoding", true, "/json", `"abcde"`, "application/json", http.StatusRequestEntityTooLarge, "Request Entity Too Large\n"),
+		)
+	})
+	Describe("with a route with a custom matcher", func() {
+		var mux *minimux.Mux
+		BeforeEach(func() {
+			mux = &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.LiteralPath("/first").IsHandledBy(respondWith("literal")),
+					minimux.MatchedBy(exactPaths{"/first": "1", "/second": "2"}, "name").IsHandledBy(respondWith("custom-")),
+					minimux.PathPattern("/.*").IsHandledBy(respondWith("pattern")),
+				},
+			}
+		})
+		It("should use the matcher in declaration order", func() {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost/first", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "literal")
+			req, err = http.NewRequest(http.MethodGet, "http://localhost/second", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "custom-2")
+			req, err = http.NewRequest(http.MethodGet, "http://localhost/third", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "pattern")
+		})
+		It("should fall through when the matcher reports the method isn't allowed", func() {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/second", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "pattern")
+		})
+	})
+	Describe("with allowed hosts", func() {
+		var mux *minimux.Mux
+		var statuses []int
+		BeforeEach(func() {
+			statuses = nil
+			mux = &minimux.Mux{
+				AllowedHosts:    minimux.StringSetOf("example.com"),
+				AllowRouteHosts: true,
+				Routes: []minimux.Route{
+					minimux.LiteralPath("/admin").WithHosts("admin.example.com").IsHandledBy(respondWith("admin")),
+					minimux.PathPattern("/.*").IsHandledBy(respondWith("public")),
+				},
+				DefaultHandler: minimux.NotFound,
+				PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {
+					statuses = append(statuses, statusCode)
+				},
+			}
+		})
+		DescribeTable("should only route requests for those hosts",
+			func(host string, expectedStatus int, expectedBody string) {
+				req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+				req.Host = host
+				resp := serve(mux, req)
+				Expect(resp.Code).To(Equal(expectedStatus))
+				Expect(resp.Body.String()).To(Equal(expectedBody))
+				Expect(statuses).To(Equal([]int{expectedStatus}))
+			},
+			Entry("allowed host", "example.com", http.StatusOK, "public"),
+			Entry("allowed host with a port and in upper case", "EXAMPLE.com:8080", http.StatusOK, "public"),
+			Entry("route host", "admin.example.com", http.StatusOK, "public"),
+			Entry("other host", "attacker.example", http.StatusMisdirectedRequest, ""),
+			Entry("rebound IP address", "127.0.0.1:8080", http.StatusMisdirectedRequest, ""),
+			Entry("missing host", "", http.StatusBadRequest, ""),
+		)
+	})
+	When("in maintenance mode", func() {
+		var mux *minimux.Mux
+		BeforeEach(func() {
+			mux = &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.LiteralPath("/healthz").IsHandledBy(respondWith("ok")),
+					minimux.PathPattern("/.*").IsHandledBy(respondWith("app")),
+				},
+			}
+			mux.SetMaintenance(true, 90*time.Second, []string{"/healthz"})
+		})
+		It("should answer 503 except for the allowlist until it is turned off", func() {
+			Expect(mux.InMaintenance()).To(BeTrue())
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/app", nil))
+			Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(resp.Header().Get("Retry-After")).To(Equal("90"))
+			Expect(resp.Body.String()).To(BeEmpty())
+			Expect(serve(mux, httptest.NewRequest(http.MethodGet, "/healthz", nil)).Body.String()).To(Equal("ok"))
+
+			mux.SetMaintenance(false, 0, nil)
+			Expect(mux.InMaintenance()).To(BeFalse())
+			Expect(serve(mux, httptest.NewRequest(http.MethodGet, "/app", nil)).Body.String()).To(Equal("app"))
+		})
+	})
+	When("it has error pages", func() {
+		var mux *minimux.Mux
+		BeforeEach(func() {
+			catalogs, err := minimux.LoadCatalogs(fstest.MapFS{
+				"en.json": {Data: []byte(`{}`)},
+				"fr.json": {Data: []byte(`{"Not Found": "Introuvable"}`)},
+			}, "en")
+			Expect(err).ToNot(HaveOccurred())
+			mux = &minimux.Mux{
+				PreProcess: catalogs.Localize(),
+				Routes: []minimux.Route{
+					minimux.LiteralPath("/get").WithMethods(http.MethodGet).IsHandledBy(respondWith("ok")),
+					minimux.LiteralPath("/panic").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+						panic("oops")
+					}),
+				},
+				ErrorPages: map[int]minimux.Handler{
+					http.StatusNotFound: minimux.TemplateErrorPage(nil),
+				},
+				ErrorPageClasses: map[int]minimux.Handler{
+					5: minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+						statusCode, _ := minimux.ErrorStatusFromContext(ctx)
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprintf(w, `{"status":%d}`, statusCode)
+						return nil
+					}),
+				},
+			}
+		})
+		DescribeTable("should answer with them when the mux chooses the status",
+			func(method, path, acceptLanguage string, expectedStatus int, expectedBody types.GomegaMatcher) {
+				req := httptest.NewRequest(method, path, nil)
+				req.Header.Set("Accept-Language", acceptLanguage)
+				resp := serve(mux, req)
+				Expect(resp.Code).To(Equal(expectedStatus))
+				Expect(resp.Body.String()).To(expectedBody)
+			},
+			Entry("no route", http.MethodGet, "/missing", "", http.StatusNotFound, ContainSubstring("<h1>404 Not Found</h1>")),
+			Entry("no route, translated", http.MethodGet, "/missing", "fr", http.StatusNotFound, ContainSubstring("<h1>404 Introuvable</h1>")),
+			Entry("panic", http.MethodGet, "/panic", "", http.StatusInternalServerError, Equal(`{"status":500}`)),
+			Entry("status without a page", http.MethodPost, "/get", "", http.StatusMethodNotAllowed, BeEmpty()),
+			Entry("route", http.MethodGet, "/get", "", http.StatusOK, Equal("ok")),
+		)
+		It("should use them in maintenance mode", func() {
+			mux.SetMaintenance(true, 0, nil)
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/get", nil))
+			Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(resp.Body.String()).To(Equal(`{"status":503}`))
+		})
+	})
+	When("asked for the options of the whole server", func() {
+		It("should list the methods of every route", func() {
+			mux := &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.LiteralPath("/a").WithMethods(http.MethodGet, http.MethodHead).IsHandledBy(respondWith("a")),
+					minimux.PathPattern("/b/.*").WithMethods(http.MethodPost).IsHandledBy(respondWith("b")),
+				},
+			}
+			resp := serve(mux, httptest.NewRequest(http.MethodOptions, "*", nil))
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Allow")).To(Equal("GET, HEAD, OPTIONS, POST"))
+			Expect(resp.Body.String()).To(BeEmpty())
+		})
+		It("should list common methods if any route accepts any method, and describe the server", func() {
+			mux := &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.LiteralPath("/a").IsHandledBy(respondWith("a")),
+				},
+				ServerOptions: minimux.NewStaticString(`{"dav":false}`, "application/json"),
+			}
+			srv := httptest.NewUnstartedServer(mux)
+			srv.Config.DisableGeneralOptionsHandler = true
+			srv.Start()
+			DeferCleanup(srv.Close)
+			req, err := http.NewRequest(http.MethodOptions, srv.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.URL.Path = "*"
+			resp, err := srv.Client().Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Allow")).To(Equal("GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"))
+			Expect(io.ReadAll(resp.Body)).To(Equal([]byte(`{"dav":false}`)))
+		})
+	})
+	When("serving a request with its own context", func() {
+		type key struct{}
+		var seen context.Context
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					seen = ctx
+					return nil
+				}),
+			},
+		}
+		It("should serve it with that context", func() {
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "outer"))
+			serve(mux, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+			Expect(seen.Value(key{})).To(Equal("outer"))
+			cancel()
+			Expect(seen.Err()).To(MatchError(context.Canceled))
+		})
+		It("should serve it with the BaseContext instead, if set", func() {
+			mux.BaseContext = func(req *http.Request) context.Context {
+				return context.WithValue(context.Background(), key{}, "base")
+			}
+			DeferCleanup(func() { mux.BaseContext = nil })
+			serve(mux, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(context.WithValue(context.Background(), key{}, "outer")))
+			Expect(seen.Value(key{})).To(Equal("base"))
+		})
+	})
+	When("it has middleware", func() {
+		var calls []string
+		record := func(name string) minimux.Middleware {
+			return func(next minimux.Handler) minimux.Handler {
+				return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					calls = append(calls, name+" before")
+					err := next.ServeHTTP(ctx, w, req, pathVars, formErr)
+					calls = append(calls, name+" after")
+					return err
+				})
+			}
+		}
+		teapot := func(next minimux.Handler) minimux.Handler {
+			return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				w.WriteHeader(http.StatusTeapot)
+				return nil
+			})
+		}
+		mux := &minimux.Mux{
+			PreProcess: func(ctx context.Context, req *http.Request) (context.Context, func()) {
+				calls = append(calls, "pre-process")
+				return ctx, nil
+			},
+			Middleware: []minimux.Middleware{record("mux 1"), record("mux 2")},
+			PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {
+				calls = append(calls, fmt.Sprintf("post-process %d", statusCode))
+			},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/").Use(record("route")).IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					calls = append(calls, "handler")
+					return nil
+				}),
+				minimux.LiteralPath("/short-circuit").Use(teapot, record("unreachable")).IsHandledBy(respondWith("unreachable")),
+			},
+		}
+		BeforeEach(func() {
+			calls = nil
+		})
+		It("should wrap the handler, the mux's outside of the route's", func() {
+			serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(calls).To(Equal([]string{
+				"pre-process",
+				"mux 1 before", "mux 2 before", "route before",
+				"handler",
+				"route after", "mux 2 after", "mux 1 after",
+				"post-process 200",
+			}))
+		})
+		It("should allow middleware to answer requests itself", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/short-circuit", nil))
+			Expect(resp.Code).To(Equal(http.StatusTeapot))
+			Expect(calls).To(Equal([]string{"pre-process", "mux 1 before", "mux 2 before", "mux 2 after", "mux 1 after", "post-process 418"}))
+		})
+	})
+
+	When("strict about requests which match no route", func() {
+		var statuses []int
+		mux := &minimux.Mux{
+			StrictNotFound: true,
+			PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {
+				statuses = append(statuses, statusCode)
+			},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/").IsHandledBy(respondWith("root")),
+			},
+		}
+		BeforeEach(func() {
+			statuses = nil
+		})
+		It("should answer them with 404", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/missing", nil))
+			Expect(resp.Code).To(Equal(http.StatusNotFound))
+			Expect(statuses).To(Equal([]int{http.StatusNotFound}))
+		})
+		It("should still serve matching requests", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(resp.Body.String()).To(Equal("root"))
+		})
+		It("should answer every request to an empty mux with 404", func() {
+			resp := serve(&minimux.Mux{StrictNotFound: true}, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(resp.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	When("a path is matched but not its method", func() {
+		mux := &minimux.Mux{
+			ErrorPages: map[int]minimux.Handler{
+				http.StatusMethodNotAllowed: minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					methods, ok := minimux.AllowedMethodsFromContext(ctx)
+					fmt.Fprint(w, ok, len(methods))
+					return nil
+				}),
+			},
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/users/([^/]+)", "id").WithMethods(http.MethodGet, http.MethodHead).IsHandledBy(respondWith("get-")),
+				minimux.PathWithVars("/users/([a-z]+)", "name").WithMethods(http.MethodDelete).IsHandledBy(respondWith("delete-")),
+				minimux.PathWithVars("/users/([^/]+)", "id").WithMethods(http.MethodPatch).WithHosts("admin").IsHandledBy(respondWith("patch-")),
+			},
+		}
+		It("should list the methods of every route matching the path in the Allow header", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodPut, "http://localhost/users/bob", nil))
+			Expect(resp.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(resp.Header().Get("Allow")).To(Equal("DELETE, GET, HEAD"))
+			Expect(resp.Body.String()).To(Equal("true 3"))
+		})
+		It("should only list the methods of routes for the host", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodPut, "http://admin/users/1", nil))
+			Expect(resp.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(resp.Header().Get("Allow")).To(Equal("GET, HEAD, PATCH"))
+		})
+	})
+
+	When("HEAD requests fall back to GET routes", func() {
+		mux := &minimux.Mux{
+			HeadFallback: true,
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/users").WithMethods(http.MethodGet).IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					w.Header().Set("X-Method", req.Method)
+					_, err := w.Write([]byte("users"))
+					return err
+				}),
+				minimux.LiteralPath("/users").WithMethods(http.MethodPost).IsHandledBy(respondWith("create")),
+				minimux.LiteralPath("/forms").WithMethods(http.MethodPost).IsHandledBy(respondWith("form")),
+			},
+		}
+		It("should serve them with the GET route without a body", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodHead, "/users", nil))
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("X-Method")).To(Equal(http.MethodHead))
+			Expect(resp.Body.String()).To(BeEmpty())
+		})
+		It("should not serve them with other routes", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodHead, "/forms", nil))
+			Expect(resp.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(resp.Header().Get("Allow")).To(Equal(http.MethodPost))
+		})
+		It("should list HEAD as allowed for GET routes", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodPut, "/users", nil))
+			Expect(resp.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(resp.Header().Get("Allow")).To(Equal("GET, HEAD, POST"))
+		})
+	})
+
+	When("it has a MethodNotAllowedHandler", func() {
+		mux := &minimux.Mux{
+			MethodNotAllowedHandler: minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				methods, _ := minimux.AllowedMethodsFromContext(ctx)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return json.NewEncoder(w).Encode(map[string]any{"id": pathVars["id"], "allowed": len(methods)})
+			}),
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/users/([^/]+)", "id").WithMethods(http.MethodGet, http.MethodPut).IsHandledBy(respondWith("user-")),
+			},
+		}
+		It("should answer requests with other methods with it", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodDelete, "/users/bob", nil))
+			Expect(resp.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(resp.Header().Get("Allow")).To(Equal("GET, PUT"))
+			Expect(resp.Body.String()).To(MatchJSON(`{"id": "bob", "allowed": 2}`))
+		})
+	})
+
+	When("it has a NotFoundHandler", func() {
+		notFound := func(name string) minimux.Handler {
+			return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				w.WriteHeader(http.StatusNotFound)
+				_, err := w.Write([]byte(name + " not found"))
+				return err
+			})
+		}
+		mux := &minimux.Mux{
+			NotFoundHandler: notFound("outer"),
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/api(/.*)", "path").IsHandledBy(minimux.InnerMuxWithPrefix("path", &minimux.Mux{
+					Routes: []minimux.Route{
+						minimux.LiteralPath("/users").IsHandledBy(respondWith("users")),
+					},
+				})),
+				minimux.PathWithVars("/admin(/.*)", "path").IsHandledBy(minimux.InnerMuxWithPrefix("path", &minimux.Mux{
+					NotFoundHandler: notFound("admin"),
+				})),
+				minimux.PathWithVars("/static(/.*)", "path").IsHandledBy(minimux.InnerMuxWithPrefix("path", &minimux.Mux{
+					DefaultHandler: respondWith("default"),
+				})),
+			},
+		}
+		DescribeTable("should answer requests which match no route with the innermost one",
+			func(path string, expectedStatus int, expectedBody string) {
+				resp := serve(mux, httptest.NewRequest(http.MethodGet, path, nil))
+				Expect(resp.Code).To(Equal(expectedStatus))
+				Expect(resp.Body.String()).To(Equal(expectedBody))
+			},
+			Entry("outer", "/missing", http.StatusNotFound, "outer not found"),
+			Entry("inner without its own", "/api/missing", http.StatusNotFound, "outer not found"),
+			Entry("inner match", "/api/users", http.StatusOK, "users"),
+			Entry("inner with its own", "/admin/missing", http.StatusNotFound, "admin not found"),
+			Entry("inner with a default", "/static/missing", http.StatusOK, "default"),
+		)
+	})
+
+	When("routes have their own PreProcess and PostProcess", func() {
+		var calls []string
+		type routeKey struct{}
+		pre := func(name string) minimux.PreProcessor {
+			return func(ctx context.Context, req *http.Request) (context.Context, func()) {
+				calls = append(calls, name+" pre-process")
+				return context.WithValue(ctx, routeKey{}, name), func() { calls = append(calls, name+" deferred") }
+			}
+		}
+		post := func(name string) minimux.PostProcessor {
+			return func(ctx context.Context, req *http.Request, statusCode int, err error) {
+				calls = append(calls, fmt.Sprintf("%s post-process %d %v", name, statusCode, ctx.Value(routeKey{})))
+			}
+		}
+		mux := &minimux.Mux{
+			PreProcess: pre("mux"),
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/").WithPreProcess(pre("route")).WithPostProcess(post("route")).IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					calls = append(calls, fmt.Sprintf("handler %v", ctx.Value(routeKey{})))
+					w.WriteHeader(http.StatusCreated)
+					return nil
+				}),
+				minimux.LiteralPath("/panic").WithPostProcess(post("route")).IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					panic("oops")
+				}),
+			},
+		}
+		BeforeEach(func() {
+			calls = nil
+		})
+		It("should call them inside of the mux's", func() {
+			mux.PostProcess = post("mux")
+			serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(calls).To(Equal([]string{
+				"mux pre-process",
+				"route pre-process",
+				"handler route",
+				"route post-process 201 route",
+				"route deferred",
+				"mux post-process 201 mux",
+				"mux deferred",
+			}))
+		})
+		It("should record the status without a PostProcess for the mux", func() {
+			mux.PostProcess = nil
+			serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(calls).To(ContainElement("route post-process 201 route"))
+		})
+		It("should call them when the route panics", func() {
+			mux.PostProcess = post("mux")
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/panic", nil))
+			Expect(resp.Code).To(Equal(http.StatusInternalServerError))
+			Expect(calls).To(Equal([]string{
+				"mux pre-process",
+				"route post-process -1 mux",
+				"mux post-process -1 mux",
+				"mux deferred",
+			}))
+		})
+	})
+
+	When("it has a PostProcessResult", func() {
+		var results []minimux.RequestResult
+		mux := &minimux.Mux{
+			PostProcessResult: func(ctx context.Context, req *http.Request, result minimux.RequestResult) {
+				results = append(results, result)
+			},
+			DefaultHandler: respondWith("default"),
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/users/([^/]+)", "id").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					time.Sleep(10 * time.Millisecond)
+					w.WriteHeader(http.StatusAccepted)
+					_, err := w.Write([]byte("hello"))
+					return err
+				}),
+			},
+		}
+		BeforeEach(func() {
+			results = nil
+		})
+		It("should be called with the route, duration and bytes written", func() {
+			serve(mux, httptest.NewRequest(http.MethodGet, "/users/bob", nil))
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].StatusCode).To(Equal(http.StatusAccepted))
+			Expect(results[0].Route.Pattern).To(BeIdenticalTo(mux.Routes[0].Pattern))
+			Expect(results[0].Pattern).To(Equal("^/users/([^/]+)$"))
+			Expect(results[0].Duration).To(BeNumerically(">=", 10*time.Millisecond))
+			Expect(results[0].BytesWritten).To(BeEquivalentTo(5))
+			Expect(results[0].DefaultHandler).To(BeFalse())
+		})
+		It("should report when the default handler was used", func() {
+			serve(mux, httptest.NewRequest(http.MethodGet, "/missing", nil))
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Route).To(BeNil())
+			Expect(results[0].Pattern).To(BeEmpty())
+			Expect(results[0].DefaultHandler).To(BeTrue())
+			Expect(results[0].BytesWritten).To(BeEquivalentTo(len("default")))
+		})
+	})
+
+	When("a PreProcess rejects requests", func() {
+		var statuses []int
+		var routeCalled, laterCalled bool
+		limited := func(ctx context.Context, req *http.Request) (context.Context, func()) {
+			switch req.URL.Query().Get("reject") {
+			case "status":
+				return minimux.RejectWithStatus(ctx, http.StatusTooManyRequests), nil
+			case "handler":
+				return minimux.Reject(ctx, respondWith("denied")), nil
+			}
+			return ctx, nil
+		}
+		later := func(ctx context.Context, req *http.Request) (context.Context, func()) {
+			laterCalled = true
+			return ctx, nil
+		}
+		mux := &minimux.Mux{
+			PreProcess: minimux.PreProcessorChain(limited, later),
+			PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {
+				statuses = append(statuses, statusCode)
+			},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/admin").WithPreProcess(func(ctx context.Context, req *http.Request) (context.Context, func()) {
+					return minimux.RejectWithStatus(ctx, http.StatusForbidden), nil
+				}).IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					routeCalled = true
+					return nil
+				}),
+				minimux.LiteralPath("/").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					routeCalled = true
+					return nil
+				}),
+			},
+		}
+		BeforeEach(func() {
+			statuses = nil
+			routeCalled = false
+			laterCalled = false
+		})
+		It("should answer them with the status without routing them", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/?reject=status", nil))
+			Expect(resp.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(routeCalled).To(BeFalse())
+			Expect(laterCalled).To(BeFalse())
+			Expect(statuses).To(Equal([]int{http.StatusTooManyRequests}))
+		})
+		It("should answer them with the handler without routing them", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/?reject=handler", nil))
+			Expect(resp.Body.String()).To(Equal("denied"))
+			Expect(routeCalled).To(BeFalse())
+			Expect(statuses).To(Equal([]int{http.StatusOK}))
+		})
+		It("should route requests which are not rejected", func() {
+			serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(routeCalled).To(BeTrue())
+			Expect(laterCalled).To(BeTrue())
+		})
+		It("should allow routes to reject requests", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/admin", nil))
+			Expect(resp.Code).To(Equal(http.StatusForbidden))
+			Expect(routeCalled).To(BeFalse())
+			Expect(statuses).To(Equal([]int{http.StatusForbidden}))
+		})
+	})
+
+	When("it tracks the status of responses", func() {
+		var written int64
+		mux := &minimux.Mux{
+			PostProcessResult: func(ctx context.Context, req *http.Request, result minimux.RequestResult) {
+				written = result.BytesWritten
+			},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					defer GinkgoRecover()
+					Expect(w.(http.Pusher).Push("/style.css", nil)).To(MatchError(http.ErrNotSupported))
+					_, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader("streamed"))
+					Expect(err).ToNot(HaveOccurred())
+					w.(http.Flusher).Flush()
+					return nil
+				}),
+			},
+		}
+		It("should still give handlers the capabilities of the original ResponseWriter", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(resp.Flushed).To(BeTrue())
+			Expect(resp.Body.String()).To(Equal("streamed"))
+			Expect(written).To(BeEquivalentTo(len("streamed")))
+		})
+	})
+
+	When("the client goes away partway through a response", func() {
+		var result minimux.RequestResult
+		mux := &minimux.Mux{
+			PostProcessResult: func(ctx context.Context, req *http.Request, r minimux.RequestResult) {
+				result = r
+			},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					w.Write([]byte("first"))
+					w.Write([]byte("second"))
+					w.Write([]byte("third"))
+					return nil
+				}),
+			},
+		}
+		It("should report the first write error and the bytes written before it", func() {
+			w := &brokenResponseWriter{ResponseRecorder: httptest.NewRecorder(), limit: len("first") + 2}
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(result.BytesWritten).To(BeEquivalentTo(len("first") + 2))
+			Expect(result.WriteErr).To(MatchError(io.ErrClosedPipe))
+			Expect(result.Err).ToNot(HaveOccurred())
+		})
+	})
+	When("it has an ErrorHandler", func() {
+		var postProcessed []string
+		errBroken := errors.New("broken")
+		mux := &minimux.Mux{
+			ErrorHandler: func(ctx context.Context, w http.ResponseWriter, req *http.Request, err error) {
+				w.WriteHeader(http.StatusBadGateway)
+				fmt.Fprintf(w, "error: %v", err)
+			},
+			PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {
+				postProcessed = append(postProcessed, fmt.Sprintf("%d %v", statusCode, err))
+			},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/silent").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					return errBroken
+				}),
+				minimux.LiteralPath("/partial").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					w.Write([]byte("partial"))
+					return errBroken
+				}),
+			},
+		}
+		BeforeEach(func() {
+			postProcessed = nil
+		})
+		It("should answer requests whose handler returned an error without writing anything", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/silent", nil))
+			Expect(resp.Code).To(Equal(http.StatusBadGateway))
+			Expect(resp.Body.String()).To(Equal("error: broken"))
+			Expect(postProcessed).To(Equal([]string{"502 broken"}))
+		})
+		It("should not be called once the handler has written a response", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/partial", nil))
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(Equal("partial"))
+			Expect(postProcessed).To(Equal([]string{"200 broken"}))
+		})
+	})
+	When("it has a RecoverHandler", func() {
+		var recovered any
+		var stack []byte
+		var postProcessErr error
+		errBoom := errors.New("boom")
+		mux := &minimux.Mux{
+			RecoverHandler: func(ctx context.Context, w http.ResponseWriter, req *http.Request, r any, s []byte) {
+				recovered, stack = r, s
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("sorry"))
+			},
+			PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {
+				postProcessErr = err
+			},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/").IsHandledByFunc(panickingHandler(errBoom)),
+			},
+		}
+		It("should be called with the panicked value and stack trace", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(resp.Code).To(Equal(http.StatusInternalServerError))
+			Expect(resp.Body.String()).To(Equal("sorry"))
+			Expect(recovered).To(BeIdenticalTo(errBoom))
+			Expect(string(stack)).To(ContainSubstring("panickingHandler"))
+
+			var panicErr *minimux.PanicError
+			Expect(errors.As(postProcessErr, &panicErr)).To(BeTrue())
+			Expect(panicErr.Stack).To(Equal(stack))
+			Expect(postProcessErr).To(MatchError(errBoom))
+		})
+	})
+	When("it has only a RecoverHandler", func() {
+		var called bool
+		mux := &minimux.Mux{
+			RecoverHandler: func(ctx context.Context, w http.ResponseWriter, req *http.Request, r any, s []byte) {
+				called = true
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("sorry"))
+			},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/partial").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					w.Write([]byte("partial"))
+					panic("boom")
+				}),
+			},
+		}
+		It("should not be called once the handler has written a response", func() {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/partial", nil))
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(Equal("partial"))
+			Expect(called).To(BeFalse())
+		})
+	})
 })
+
+// brokenResponseWriter fails to write any more than a limited number of bytes
+type brokenResponseWriter struct {
+	*httptest.ResponseRecorder
+	limit int
+}
+
+func (b *brokenResponseWriter) Write(p []byte) (int, error) {
+	if len(p) <= b.limit {
+		b.limit -= len(p)
+		return b.ResponseRecorder.Write(p)
+	}
+	n, _ := b.ResponseRecorder.Write(p[:b.limit])
+	b.limit = 0
+	return n, io.ErrClosedPipe
+}
+
+// panickingHandler returns a handler which panics with a value
+func panickingHandler(value any) minimux.HandlerFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		panic(value)
+	}
+}
@@ -0,0 +1,342 @@
+package minimux
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcLoginMaxAge is how long a user has to complete a login with the provider
+const oidcLoginMaxAge = 10 * time.Minute
+
+// OIDCProvider is the configuration of an OpenID Connect provider.
+// An OIDCProvider is also an OIDCDiscoverer which always returns itself, for providers configured statically.
+type OIDCProvider struct {
+	// Issuer is the issuer identifier of the provider
+	Issuer string `json:"issuer"`
+	// AuthorizationEndpoint is the URL users are redirected to to log in
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	// TokenEndpoint is the URL authorization codes are exchanged at
+	TokenEndpoint string `json:"token_endpoint"`
+	// JWKSURI is the URL of the keys which sign the provider's tokens
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// Discover implements OIDCDiscoverer
+func (p *OIDCProvider) Discover(ctx context.Context) (*OIDCProvider, error) {
+	return p, nil
+}
+
+// An OIDCDiscoverer finds the configuration of an OpenID Connect provider
+type OIDCDiscoverer interface {
+	// Discover returns the configuration of the provider
+	Discover(ctx context.Context) (*OIDCProvider, error)
+}
+
+// WellKnownDiscovery is an OIDCDiscoverer which fetches the configuration of a provider from its
+// /.well-known/openid-configuration document, and remembers it once it has been fetched successfully
+type WellKnownDiscovery struct {
+	// Issuer is the issuer identifier of the provider
+	Issuer string
+	// Client is the client used to fetch the configuration. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	lock     sync.Mutex
+	provider *OIDCProvider
+}
+
+// Discover implements OIDCDiscoverer
+func (d *WellKnownDiscovery) Discover(ctx context.Context) (*OIDCProvider, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.provider != nil {
+		return d.provider, nil
+	}
+	provider := &OIDCProvider{}
+	if err := getJSON(ctx, d.Client, strings.TrimSuffix(d.Issuer, "/")+"/.well-known/openid-configuration", provider); err != nil {
+		return nil, fmt.Errorf("discovering OIDC provider: %w", err)
+	}
+	if provider.Issuer != d.Issuer {
+		return nil, fmt.Errorf("discovering OIDC provider: issuer %q does not match %q", provider.Issuer, d.Issuer)
+	}
+	d.provider = provider
+	return provider, nil
+}
+
+// OIDC authenticates requests with an OpenID Connect provider, using the authorization code flow
+// for browsers, and bearer tokens signed by the provider for API calls
+type OIDC struct {
+	// Provider finds the configuration of the provider
+	Provider OIDCDiscoverer
+	// ClientID is the client ID registered with the provider
+	ClientID string
+	// ClientSecret is the client secret registered with the provider
+	ClientSecret string
+	// RedirectURL is the absolute URL of the route handled by Callback()
+	RedirectURL string
+	// Scopes are the scopes to request. If empty, "openid", "profile", and "email" are requested.
+	Scopes []string
+	// Sessions stores the claims of logged in users. A second cookie, with the suffix "-login",
+	// holds the state of logins in progress.
+	Sessions *CookieSessions
+	// Audience is the required audience of bearer tokens. If empty, ClientID is used.
+	Audience string
+	// Client is the client used to talk to the provider. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	lock sync.Mutex
+	keys *RemoteKeySet
+}
+
+// oidcLogin is the state of a login in progress
+type oidcLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"returnTo"`
+}
+
+func (o *OIDC) loginSessions() *CookieSessions {
+	login := o.Sessions.derived("-login")
+	login.MaxAge = oidcLoginMaxAge
+	return login
+}
+
+func (o *OIDC) scopes() string {
+	if len(o.Scopes) == 0 {
+		return "openid profile email"
+	}
+	return strings.Join(o.Scopes, " ")
+}
+
+// verifier returns a verifier for tokens issued by the provider for an audience
+func (o *OIDC) verifier(provider *OIDCProvider, audience string) *TokenVerifier {
+	o.lock.Lock()
+	if o.keys == nil || o.keys.URL != provider.JWKSURI {
+		o.keys = &RemoteKeySet{URL: provider.JWKSURI, Client: o.Client}
+	}
+	keys := o.keys
+	o.lock.Unlock()
+	return &TokenVerifier{Keys: keys, Issuer: provider.Issuer, Audience: audience}
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// isBrowserRequest returns true if a request appears to be a page load by a browser, which can follow a redirect to log in
+func isBrowserRequest(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) && strings.Contains(req.Header.Get("Accept"), "text/html")
+}
+
+// OIDCIdentity returns the identity described by the claims of a token.
+// Its name is the preferred username, or, if that is empty, the email address or subject, and its ID is the subject.
+func OIDCIdentity(claims TokenClaims, method string) *Identity {
+	id := &Identity{
+		Name:   claims.String("preferred_username"),
+		Method: method,
+		ID:     claims.String("sub"),
+		Claims: claims,
+	}
+	if id.Name == "" {
+		id.Name = claims.String("email")
+	}
+	if id.Name == "" {
+		id.Name = claims.String("sub")
+	}
+	return id
+}
+
+// Require returns a handler which calls another with the identity of the user recorded in the context.
+// Users are identified by their session, or, failing that, by a bearer token in the Authorization header.
+// Browsers without either are redirected to the provider to log in, and other requests are rejected with a 401 status.
+func (o *OIDC) Require(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		var claims TokenClaims
+		// Only a session saved by Callback has a subject
+		if err := o.Sessions.LoadAndRewrap(w, req, &claims); err == nil && claims.String("sub") != "" {
+			id := OIDCIdentity(claims, IdentityMethodOIDC)
+			AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodOIDC, Identity: id, Request: req, Allowed: true, Reason: "valid session"})
+			return next.ServeHTTP(WithIdentity(ctx, id), w, req, pathVars, formErr)
+		}
+		provider, err := o.Provider.Discover(ctx)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return err
+		}
+		if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+			audience := o.Audience
+			if audience == "" {
+				audience = o.ClientID
+			}
+			claims, err := o.verifier(provider, audience).Verify(ctx, token)
+			if err != nil {
+				AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodBearerToken, Request: req, Reason: err.Error()})
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return nil
+			}
+			id := OIDCIdentity(claims, IdentityMethodBearerToken)
+			AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodBearerToken, Identity: id, Request: req, Allowed: true, Reason: "valid token"})
+			return next.ServeHTTP(WithIdentity(ctx, id), w, req, pathVars, formErr)
+		}
+		AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodOIDC, Request: req, Reason: "no session or token"})
+		if !isBrowserRequest(req) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return nil
+		}
+		return o.login(w, req, provider)
+	})
+}
+
+// login redirects to the provider to log in, remembering where to return to afterwards
+func (o *OIDC) login(w http.ResponseWriter, req *http.Request, provider *OIDCProvider) error {
+	login := oidcLogin{ReturnTo: req.URL.RequestURI()}
+	var err error
+	for _, s := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		if *s, err = randomString(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return err
+		}
+	}
+	if err := o.loginSessions().Save(w, login); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	challenge := sha256.Sum256([]byte(login.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.ClientID},
+		"redirect_uri":          {o.RedirectURL},
+		"scope":                 {o.scopes()},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, req, provider.AuthorizationEndpoint+separator+query.Encode(), http.StatusFound)
+	return nil
+}
+
+// safeReturnTo returns a URL to redirect to after logging in, which must be a path on this server
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return "/"
+	}
+	return returnTo
+}
+
+// Callback returns a handler for the route at RedirectURL, which exchanges the authorization code from the provider
+// for an ID token, establishes a session with its claims, and redirects to the page which required logging in
+func (o *OIDC) Callback() Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		loginSessions := o.loginSessions()
+		var login oidcLogin
+		if err := loginSessions.Load(req, &login); err != nil {
+			http.Error(w, "Login expired, please try again", http.StatusBadRequest)
+			return nil
+		}
+		query := req.URL.Query()
+		if query.Get("state") != login.State {
+			http.Error(w, "Login state mismatch, please try again", http.StatusBadRequest)
+			return nil
+		}
+		loginSessions.Clear(w)
+		if query.Get("error") != "" {
+			AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodOIDC, Request: req, Reason: "provider error: " + query.Get("error")})
+			http.Error(w, "Login failed: "+query.Get("error"), http.StatusUnauthorized)
+			return nil
+		}
+		provider, err := o.Provider.Discover(ctx)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return err
+		}
+		idToken, err := o.exchange(ctx, provider, query.Get("code"), login.Verifier)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return err
+		}
+		claims, err := o.verifier(provider, o.ClientID).Verify(ctx, idToken)
+		if err == nil && claims.String("nonce") != login.Nonce {
+			err = fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+		}
+		if err != nil {
+			AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodOIDC, Request: req, Reason: err.Error()})
+			w.WriteHeader(http.StatusBadGateway)
+			return err
+		}
+		AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodOIDC, Identity: OIDCIdentity(claims, IdentityMethodOIDC), Request: req, Allowed: true, Reason: "logged in"})
+		if err := o.Sessions.Save(w, claims); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return err
+		}
+		http.Redirect(w, req, safeReturnTo(login.ReturnTo), http.StatusFound)
+		return nil
+	})
+}
+
+// exchange exchanges an authorization code for an ID token
+func (o *OIDC) exchange(ctx context.Context, provider *OIDCProvider, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("exchanging authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("exchanging authorization code: unexpected status %s", resp.Status)
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("exchanging authorization code: %w", err)
+	}
+	if token.IDToken == "" {
+		return "", fmt.Errorf("exchanging authorization code: no id_token in response")
+	}
+	return token.IDToken, nil
+}
+
+// Logout returns a handler which ends the session and redirects to a URL
+func (o *OIDC) Logout(redirectTo string) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		o.Sessions.Clear(w)
+		http.Redirect(w, req, redirectTo, http.StatusSeeOther)
+		return nil
+	})
+}
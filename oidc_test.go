@@ -0,0 +1,357 @@
+package minimux_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeOIDCProvider is an OpenID Connect provider which issues tokens for any authorization code
+type fakeOIDCProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	nonce string
+}
+
+func newFakeOIDCProvider() *fakeOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).ToNot(HaveOccurred())
+	p := &fakeOIDCProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		if id, secret, _ := req.BasicAuth(); id != "client" || secret != "secret" || req.PostFormValue("code") != "code" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.token("client", map[string]any{"nonce": p.nonce})})
+	})
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// token returns a token for alice signed by the provider
+func (p *fakeOIDCProvider) token(audience string, extraClaims map[string]any) string {
+	claims := map[string]any{
+		"iss":                p.URL,
+		"aud":                audience,
+		"sub":                "1234",
+		"preferred_username": "alice",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range extraClaims {
+		claims[k] = v
+	}
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	Expect(err).ToNot(HaveOccurred())
+	payload, err := json.Marshal(claims)
+	Expect(err).ToNot(HaveOccurred())
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	Expect(err).ToNot(HaveOccurred())
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+var _ = Describe("OIDC", func() {
+	var provider *fakeOIDCProvider
+	var mux *minimux.Mux
+	BeforeEach(func() {
+		provider = newFakeOIDCProvider()
+		DeferCleanup(provider.Close)
+		auth := &minimux.OIDC{
+			Provider:     &minimux.WellKnownDiscovery{Issuer: provider.URL},
+			ClientID:     "client",
+			ClientSecret: "secret",
+			RedirectURL:  "https://localhost/callback",
+			Sessions:     &minimux.CookieSessions{Name: "session", Key: []byte("key")},
+		}
+		mux = &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/callback").IsHandledBy(auth.Callback()),
+				minimux.LiteralPath("/private").IsHandledBy(auth.Require(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					id, _ := minimux.IdentityFromContext(ctx)
+					w.Write([]byte(id.String()))
+					return nil
+				}))),
+			},
+		}
+	})
+
+	It("should log in browsers with the provider and return them to where they started", func() {
+		req := httptest.NewRequest(http.MethodGet, "https://localhost/private", nil)
+		req.Header.Set("Accept", "text/html")
+		resp := serve(mux, req)
+		Expect(resp.Code).To(Equal(http.StatusFound))
+		location, err := url.Parse(resp.Header().Get("Location"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(location.Path).To(Equal("/authorize"))
+		Expect(location.Query().Get("code_challenge_method")).To(Equal("S256"))
+		provider.nonce = location.Query().Get("nonce")
+
+		req = httptest.NewRequest(http.MethodGet, "https://localhost/callback?code=code&state="+url.QueryEscape(location.Query().Get("state")), nil)
+		for _, cookie := range resp.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+		resp = serve(mux, req)
+		Expect(resp.Code).To(Equal(http.StatusFound))
+		Expect(resp.Header().Get("Location")).To(Equal("/private"))
+
+		req = httptest.NewRequest(http.MethodGet, "https://localhost/private", nil)
+		for _, cookie := range resp.Result().Cookies() {
+			if cookie.Name == "session" {
+				req.AddCookie(cookie)
+			}
+		}
+		resp = serve(mux, req)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(Equal("alice (oidc)"))
+	})
+
+	It("should not accept a login in progress as a session", func() {
+		req := httptest.NewRequest(http.MethodGet, "https://localhost/private", nil)
+		req.Header.Set("Accept", "text/html")
+		resp := serve(mux, req)
+		Expect(resp.Code).To(Equal(http.StatusFound))
+		req = httptest.NewRequest(http.MethodGet, "https://localhost/private", nil)
+		for _, cookie := range resp.Result().Cookies() {
+			if cookie.Name == "session-login" {
+				cookie.Name = "session"
+				req.AddCookie(cookie)
+			}
+		}
+		Expect(req.Cookies()).To(HaveLen(1))
+		Expect(serve(mux, req).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should not accept a session without a subject", func() {
+		sessions := &minimux.CookieSessions{Name: "session", Key: []byte("key")}
+		cookieValue, err := sessions.Encode(map[string]string{"preferred_username": "alice"})
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(http.MethodGet, "https://localhost/private", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: cookieValue})
+		Expect(serve(mux, req).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should reject a callback with the wrong state", func() {
+		req := httptest.NewRequest(http.MethodGet, "https://localhost/private", nil)
+		req.Header.Set("Accept", "text/html")
+		resp := serve(mux, req)
+		req = httptest.NewRequest(http.MethodGet, "https://localhost/callback?code=code&state=forged", nil)
+		for _, cookie := range resp.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+		Expect(serve(mux, req).Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should authenticate API calls with bearer tokens", func() {
+		req := httptest.NewRequest(http.MethodGet, "https://localhost/private", nil)
+		req.Header.Set("Authorization", "Bearer "+provider.token("client", nil))
+		resp := serve(mux, req)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(Equal("alice (bearer-token)"))
+	})
+
+	DescribeTable("should reject API calls without a valid bearer token",
+		func(authorization func() string) {
+			req := httptest.NewRequest(http.MethodGet, "https://localhost/private", nil)
+			req.Header.Set("Authorization", authorization())
+			resp := serve(mux, req)
+			Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+			Expect(resp.Header().Get("WWW-Authenticate")).To(HavePrefix("Bearer"))
+		},
+		Entry("missing", func() string { return "" }),
+		Entry("wrong audience", func() string { return "Bearer " + provider.token("other", nil) }),
+		Entry("expired", func() string {
+			return "Bearer " + provider.token("client", map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})
+		}),
+		Entry("tampered", func() string { return "Bearer " + provider.token("client", nil) + "x" }),
+	)
+})
+
+// staticKeySet is a KeySet with a single key
+type staticKeySet struct {
+	key crypto.PublicKey
+}
+
+func (s staticKeySet) Key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	return s.key, nil
+}
+
+var _ = Describe("TokenVerifier", func() {
+	// signedToken returns an unexpired token with an algorithm, signed by a function of its digest
+	signedToken := func(algorithm string, sign func(signed []byte) []byte) string {
+		header, err := json.Marshal(map[string]string{"alg": algorithm, "kid": "test"})
+		Expect(err).ToNot(HaveOccurred())
+		payload, err := json.Marshal(map[string]any{"sub": "1234", "exp": time.Now().Add(time.Hour).Unix()})
+		Expect(err).ToNot(HaveOccurred())
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+	}
+	// es256 signs with ECDSA and SHA-256, with r and s each padded to a size
+	es256 := func(key *ecdsa.PrivateKey, size int) func([]byte) []byte {
+		return func(signed []byte) []byte {
+			digest := sha256.Sum256(signed)
+			r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+			Expect(err).ToNot(HaveOccurred())
+			signature := make([]byte, 2*size)
+			r.FillBytes(signature[:size])
+			s.FillBytes(signature[size:])
+			return signature
+		}
+	}
+
+	It("should accept ECDSA signatures on the curve of their algorithm", func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		verifier := &minimux.TokenVerifier{Keys: staticKeySet{key: &key.PublicKey}}
+		claims, err := verifier.Verify(context.Background(), signedToken("ES256", es256(key, 32)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claims.String("sub")).To(Equal("1234"))
+	})
+
+	It("should reject ECDSA signatures of the wrong length", func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		verifier := &minimux.TokenVerifier{Keys: staticKeySet{key: &key.PublicKey}}
+		_, err = verifier.Verify(context.Background(), signedToken("ES256", es256(key, 40)))
+		Expect(err).To(MatchError(minimux.ErrInvalidToken))
+	})
+
+	It("should reject ECDSA keys on another curve than that of the algorithm", func() {
+		key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		verifier := &minimux.TokenVerifier{Keys: staticKeySet{key: &key.PublicKey}}
+		_, err = verifier.Verify(context.Background(), signedToken("ES256", es256(key, 48)))
+		Expect(err).To(MatchError(minimux.ErrInvalidToken))
+	})
+
+	Describe("RemoteKeySet", func() {
+		var key *rsa.PrivateKey
+		var fetches atomic.Int32
+		var release chan struct{}
+		var keys *httptest.Server
+		BeforeEach(func() {
+			var err error
+			key, err = rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).ToNot(HaveOccurred())
+			fetches.Store(0)
+			release = make(chan struct{})
+			// The first fetch succeeds, and the rest fail once released
+			keys = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if fetches.Add(1) > 1 {
+					<-release
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+					"kty": "RSA",
+					"kid": "test",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				}}})
+			}))
+			DeferCleanup(keys.Close)
+		})
+
+		It("should not make requests for known keys wait for a fetch", func() {
+			keySet := &minimux.RemoteKeySet{URL: keys.URL, RefetchInterval: time.Nanosecond}
+			Expect(keySet.Key(context.Background(), "test")).ToNot(BeNil())
+			failed := make(chan error)
+			go func() {
+				_, err := keySet.Key(context.Background(), "unknown")
+				failed <- err
+			}()
+			Eventually(fetches.Load).Should(BeNumerically("==", 2))
+			Expect(keySet.Key(context.Background(), "test")).ToNot(BeNil())
+			close(release)
+			Expect(<-failed).To(MatchError(ContainSubstring("503")))
+		})
+
+		It("should make one fetch at a time, and not retry a failed fetch until the interval has passed", func() {
+			fetches.Store(1)
+			keySet := &minimux.RemoteKeySet{URL: keys.URL, RefetchInterval: time.Hour}
+			failed := make(chan error, 3)
+			for ix := 0; ix < 3; ix++ {
+				go func() {
+					_, err := keySet.Key(context.Background(), "test")
+					failed <- err
+				}()
+			}
+			Eventually(fetches.Load).Should(BeNumerically("==", 2))
+			close(release)
+			for ix := 0; ix < 3; ix++ {
+				Expect(<-failed).To(MatchError(ContainSubstring("503")))
+			}
+			_, err := keySet.Key(context.Background(), "test")
+			Expect(err).To(MatchError(ContainSubstring("503")))
+			Expect(fetches.Load()).To(BeNumerically("==", 2))
+		})
+	})
+
+	It("should reject tokens with another algorithm than that of their key", func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).ToNot(HaveOccurred())
+		keys := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		}))
+		DeferCleanup(keys.Close)
+		verifier := &minimux.TokenVerifier{Keys: &minimux.RemoteKeySet{URL: keys.URL}}
+		sign := func(pss bool) func([]byte) []byte {
+			return func(signed []byte) []byte {
+				digest := sha256.Sum256(signed)
+				var signature []byte
+				var err error
+				if pss {
+					signature, err = rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], nil)
+				} else {
+					signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+				}
+				Expect(err).ToNot(HaveOccurred())
+				return signature
+			}
+		}
+		_, err = verifier.Verify(context.Background(), signedToken("RS256", sign(false)))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = verifier.Verify(context.Background(), signedToken("PS256", sign(true)))
+		Expect(err).To(MatchError(minimux.ErrInvalidToken))
+	})
+})
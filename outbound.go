@@ -0,0 +1,123 @@
+package minimux
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenDestination is returned when an outgoing request or connection is not allowed by an OutboundPolicy
+var ErrForbiddenDestination = errors.New("forbidden destination")
+
+// sharedAddressSpace is the carrier-grade NAT range, which, like private ranges, is not reachable from the internet
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// An OutboundPolicy restricts where outgoing requests may be sent, so that handlers which send requests to
+// user-influenced destinations, such as an httputil.ReverseProxy, cannot be abused to reach internal services.
+// Addresses are checked when connecting, after host names are resolved, so a host name cannot be
+// re-resolved to a forbidden address after it is checked.
+type OutboundPolicy struct {
+	// AllowPrivate allows connections to loopback, private, link-local, shared, unspecified, and multicast addresses
+	AllowPrivate bool
+	// AllowedHosts is an optional set of hosts which requests may be sent to. Hosts are compared in lower case,
+	// without a port.
+	AllowedHosts StringSet
+	// AllowedPorts is an optional list of ports which connections may be made to
+	AllowedPorts []int
+}
+
+// CheckURL returns ErrForbiddenDestination if a request may not be sent to a URL because of its host or port.
+// Its address is not checked until connecting.
+func (p *OutboundPolicy) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q", ErrForbiddenDestination, u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if p.AllowedHosts != nil && !p.AllowedHosts.Has(host) {
+		return fmt.Errorf("%w: host %q", ErrForbiddenDestination, host)
+	}
+	if p.AllowedPorts == nil {
+		return nil
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return p.checkPort(port)
+}
+
+func (p *OutboundPolicy) checkPort(port string) error {
+	if p.AllowedPorts == nil {
+		return nil
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || !slices.Contains(p.AllowedPorts, n) {
+		return fmt.Errorf("%w: port %q", ErrForbiddenDestination, port)
+	}
+	return nil
+}
+
+// CheckAddress returns ErrForbiddenDestination if a connection may not be made to an IP address and port
+func (p *OutboundPolicy) CheckAddress(address string) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrForbiddenDestination, err)
+	}
+	if err := p.checkPort(strconv.Itoa(int(addrPort.Port()))); err != nil {
+		return err
+	}
+	if p.AllowPrivate {
+		return nil
+	}
+	addr := addrPort.Addr().Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() || sharedAddressSpace.Contains(addr) {
+		return fmt.Errorf("%w: address %s", ErrForbiddenDestination, addr)
+	}
+	return nil
+}
+
+// Control checks each connection as it is made, for use as the Control function of a net.Dialer
+func (p *OutboundPolicy) Control(network, address string, c syscall.RawConn) error {
+	return p.CheckAddress(address)
+}
+
+// Transport returns a transport which only sends requests allowed by this policy, ignoring any proxy
+// configured in the environment, which would hide the real destination from the checks
+func (p *OutboundPolicy) Transport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   p.Control,
+	}).DialContext
+	return outboundTransport{policy: p, inner: transport}
+}
+
+type outboundTransport struct {
+	policy *OutboundPolicy
+	inner  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.CheckURL(req.URL); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.inner.RoundTrip(req)
+}
@@ -0,0 +1,70 @@
+package minimux_test
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OutboundPolicy", func() {
+	DescribeTable("should check addresses",
+		func(address string, allowed bool) {
+			err := (&minimux.OutboundPolicy{}).CheckAddress(address)
+			if allowed {
+				Expect(err).ToNot(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(minimux.ErrForbiddenDestination))
+			}
+		},
+		Entry("public", "93.184.216.34:443", true),
+		Entry("public IPv6", "[2606:2800:220:1::]:443", true),
+		Entry("loopback", "127.0.0.1:80", false),
+		Entry("private", "10.1.2.3:80", false),
+		Entry("link-local metadata service", "169.254.169.254:80", false),
+		Entry("unspecified", "0.0.0.0:80", false),
+		Entry("shared", "100.64.0.1:80", false),
+		Entry("IPv6 loopback", "[::1]:80", false),
+		Entry("IPv4-mapped IPv6 loopback", "[::ffff:127.0.0.1]:80", false),
+		Entry("IPv6 unique local", "[fd00::1]:80", false),
+	)
+
+	It("should stop a reverse proxy from reaching internal services", func() {
+		internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("secret"))
+		}))
+		defer internal.Close()
+		internalURL, err := url.Parse(internal.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		proxyTo := func(policy *minimux.OutboundPolicy) *httptest.ResponseRecorder {
+			proxy := httputil.NewSingleHostReverseProxy(internalURL)
+			proxy.Transport = policy.Transport()
+			proxy.ErrorLog = log.New(io.Discard, "", 0)
+			mux := &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.PathPattern("/.*").IsHandledBy(minimux.Simple(proxy)),
+				},
+			}
+			return serve(mux, httptest.NewRequest(http.MethodGet, "http://localhost/", nil))
+		}
+
+		Expect(proxyTo(&minimux.OutboundPolicy{}).Code).To(Equal(http.StatusBadGateway))
+		Expect(proxyTo(&minimux.OutboundPolicy{AllowPrivate: true, AllowedHosts: minimux.StringSetOf("example.com")}).Code).To(Equal(http.StatusBadGateway))
+		Expect(proxyTo(&minimux.OutboundPolicy{AllowPrivate: true, AllowedPorts: []int{443}}).Code).To(Equal(http.StatusBadGateway))
+
+		port, err := strconv.Atoi(internalURL.Port())
+		Expect(err).ToNot(HaveOccurred())
+		resp := proxyTo(&minimux.OutboundPolicy{AllowPrivate: true, AllowedHosts: minimux.StringSetOf("127.0.0.1"), AllowedPorts: []int{port}})
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(Equal("secret"))
+	})
+})
@@ -0,0 +1,184 @@
+package minimux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPageLimit is the number of items in a page if the request does not ask for a number,
+	// and a Pagination's DefaultLimit is not set
+	DefaultPageLimit = 20
+	// DefaultMaxPageLimit is the largest number of items in a page, if a Pagination's MaxLimit is not set
+	DefaultMaxPageLimit = 100
+)
+
+// ErrInvalidPage is returned when a request asks for a page with invalid parameters
+var ErrInvalidPage = errors.New("invalid page")
+
+// A Page is the part of a list a request asks for, either by offset or by an opaque cursor
+type Page struct {
+	// Limit is the most items to return
+	Limit int
+	// Offset is the number of items to skip
+	Offset int
+	// Cursor is the opaque position to continue from, if the list is paginated by cursor
+	Cursor string
+}
+
+// Next returns the page after this one, by offset
+func (p Page) Next() Page {
+	return Page{Limit: p.Limit, Offset: p.Offset + p.Limit}
+}
+
+// Prev returns the page before this one, by offset, or false if this is the first
+func (p Page) Prev() (Page, bool) {
+	if p.Offset == 0 {
+		return Page{}, false
+	}
+	return Page{Limit: p.Limit, Offset: max(p.Offset-p.Limit, 0)}, true
+}
+
+// Pagination parses the page a request for a list asks for, from its query, or its form, if it has been parsed,
+// and builds the Link headers to other pages, as in RFC 8288
+type Pagination struct {
+	// DefaultLimit is the limit if the request does not have one. If zero, DefaultPageLimit is used.
+	DefaultLimit int
+	// MaxLimit is the largest limit allowed, which larger limits are reduced to. If zero, DefaultMaxPageLimit is used.
+	MaxLimit int
+	// LimitParam is the name of the limit parameter. If empty, "limit" is used.
+	LimitParam string
+	// OffsetParam is the name of the offset parameter. If empty, "offset" is used.
+	OffsetParam string
+	// CursorParam is the name of the cursor parameter. If empty, "cursor" is used.
+	CursorParam string
+}
+
+func (p Pagination) params() (limit, offset, cursor string) {
+	limit, offset, cursor = p.LimitParam, p.OffsetParam, p.CursorParam
+	if limit == "" {
+		limit = "limit"
+	}
+	if offset == "" {
+		offset = "offset"
+	}
+	if cursor == "" {
+		cursor = "cursor"
+	}
+	return limit, offset, cursor
+}
+
+// Parse returns the page a request asks for, or an error wrapping ErrInvalidPage if its parameters are not
+// non-negative numbers, or if it has both an offset and a cursor
+func (p Pagination) Parse(req *http.Request) (Page, error) {
+	values := req.Form
+	if values == nil {
+		values = req.URL.Query()
+	}
+	limitParam, offsetParam, cursorParam := p.params()
+	page := Page{Limit: p.DefaultLimit, Cursor: values.Get(cursorParam)}
+	if page.Limit == 0 {
+		page.Limit = DefaultPageLimit
+	}
+	maxLimit := p.MaxLimit
+	if maxLimit == 0 {
+		maxLimit = DefaultMaxPageLimit
+	}
+	if limit := values.Get(limitParam); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return Page{}, fmt.Errorf("%w: %s must be a positive number", ErrInvalidPage, limitParam)
+		}
+		page.Limit = n
+	}
+	page.Limit = min(page.Limit, maxLimit)
+	if offset := values.Get(offsetParam); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return Page{}, fmt.Errorf("%w: %s must be a non-negative number", ErrInvalidPage, offsetParam)
+		}
+		if page.Cursor != "" {
+			return Page{}, fmt.Errorf("%w: %s and %s cannot both be given", ErrInvalidPage, offsetParam, cursorParam)
+		}
+		page.Offset = n
+	}
+	return page, nil
+}
+
+// URL returns the URL of another page of the list a request is for, relative to the host,
+// keeping any other query parameters
+func (p Pagination) URL(req *http.Request, page Page) string {
+	limitParam, offsetParam, cursorParam := p.params()
+	query := req.URL.Query()
+	query.Set(limitParam, strconv.Itoa(page.Limit))
+	query.Del(offsetParam)
+	query.Del(cursorParam)
+	if page.Cursor != "" {
+		query.Set(cursorParam, page.Cursor)
+	} else if page.Offset != 0 {
+		query.Set(offsetParam, strconv.Itoa(page.Offset))
+	}
+	return (&url.URL{Path: req.URL.Path, RawQuery: query.Encode()}).String()
+}
+
+// SetLinks adds a Link header with the URLs of other pages of the list a request is for, by their relation,
+// such as "next" or "prev"
+func (p Pagination) SetLinks(h http.Header, req *http.Request, pages map[string]Page) {
+	rels := make([]string, 0, len(pages))
+	for rel := range pages {
+		rels = append(rels, rel)
+	}
+	// Keep the header in a predictable order, with the usual relations first
+	rank := func(rel string) int {
+		for ix, known := range []string{"first", "prev", "next", "last"} {
+			if rel == known {
+				return ix
+			}
+		}
+		return 4
+	}
+	sort.Slice(rels, func(i, j int) bool {
+		if rank(rels[i]) != rank(rels[j]) {
+			return rank(rels[i]) < rank(rels[j])
+		}
+		return rels[i] < rels[j]
+	})
+	links := make([]string, 0, len(rels))
+	for _, rel := range rels {
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, p.URL(req, pages[rel]), rel))
+	}
+	if len(links) != 0 {
+		h.Add("Link", strings.Join(links, ", "))
+	}
+}
+
+// SetOffsetLinks adds a Link header with the URLs of the first, previous, next, and last pages of a list
+// paginated by offset, with a total number of items
+func (p Pagination) SetOffsetLinks(h http.Header, req *http.Request, page Page, total int) {
+	pages := map[string]Page{"first": {Limit: page.Limit}}
+	if prev, ok := page.Prev(); ok {
+		pages["prev"] = prev
+	}
+	if next := page.Next(); next.Offset < total {
+		pages["next"] = next
+	}
+	if total > 0 {
+		pages["last"] = Page{Limit: page.Limit, Offset: (total - 1) / page.Limit * page.Limit}
+	}
+	p.SetLinks(h, req, pages)
+}
+
+// SetCursorLinks adds a Link header with the URLs of the first and next pages of a list paginated by cursor,
+// where the next page starts from a cursor, which is empty if there is no next page
+func (p Pagination) SetCursorLinks(h http.Header, req *http.Request, page Page, nextCursor string) {
+	pages := map[string]Page{"first": {Limit: page.Limit}}
+	if nextCursor != "" {
+		pages["next"] = Page{Limit: page.Limit, Cursor: nextCursor}
+	}
+	p.SetLinks(h, req, pages)
+}
@@ -0,0 +1,66 @@
+package minimux_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pagination", func() {
+	pagination := minimux.Pagination{DefaultLimit: 10, MaxLimit: 50}
+
+	DescribeTable("should parse pages",
+		func(query string, expected minimux.Page) {
+			page, err := pagination.Parse(httptest.NewRequest(http.MethodGet, "/items"+query, nil))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(page).To(Equal(expected))
+		},
+		Entry("with defaults", "", minimux.Page{Limit: 10}),
+		Entry("by offset", "?limit=5&offset=15", minimux.Page{Limit: 5, Offset: 15}),
+		Entry("by cursor", "?cursor=abc", minimux.Page{Limit: 10, Cursor: "abc"}),
+		Entry("with too large a limit", "?limit=1000", minimux.Page{Limit: 50}),
+	)
+
+	DescribeTable("should reject invalid pages",
+		func(query string) {
+			_, err := pagination.Parse(httptest.NewRequest(http.MethodGet, "/items"+query, nil))
+			Expect(errors.Is(err, minimux.ErrInvalidPage)).To(BeTrue())
+		},
+		Entry("zero limit", "?limit=0"),
+		Entry("non-numeric limit", "?limit=all"),
+		Entry("negative offset", "?offset=-1"),
+		Entry("both offset and cursor", "?offset=1&cursor=abc"),
+	)
+
+	It("should link to other pages by offset", func() {
+		req := httptest.NewRequest(http.MethodGet, "/items?q=x&limit=10&offset=20", nil)
+		page, err := pagination.Parse(req)
+		Expect(err).ToNot(HaveOccurred())
+		h := http.Header{}
+		pagination.SetOffsetLinks(h, req, page, 45)
+		Expect(h.Get("Link")).To(Equal(`</items?limit=10&q=x>; rel="first", </items?limit=10&offset=10&q=x>; rel="prev", </items?limit=10&offset=30&q=x>; rel="next", </items?limit=10&offset=40&q=x>; rel="last"`))
+	})
+
+	It("should link to other pages by cursor", func() {
+		req := httptest.NewRequest(http.MethodGet, "/items?cursor=abc", nil)
+		page, err := pagination.Parse(req)
+		Expect(err).ToNot(HaveOccurred())
+		h := http.Header{}
+		pagination.SetCursorLinks(h, req, page, "def")
+		Expect(h.Get("Link")).To(Equal(`</items?limit=10>; rel="first", </items?cursor=def&limit=10>; rel="next"`))
+	})
+
+	It("should not link past the last page", func() {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		page, err := pagination.Parse(req)
+		Expect(err).ToNot(HaveOccurred())
+		h := http.Header{}
+		pagination.SetOffsetLinks(h, req, page, 5)
+		Expect(h.Get("Link")).To(Equal(`</items?limit=10>; rel="first", </items?limit=10>; rel="last"`))
+	})
+})
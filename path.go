@@ -0,0 +1,70 @@
+package minimux
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnsafePath is returned when a path requested by a client could refer to something outside of where it should
+var ErrUnsafePath = errors.New("unsafe path")
+
+// CheckPath returns ErrUnsafePath if a slash-separated path from a request, such as a path variable,
+// contains a ".." segment, or anything which could become one, or a separator, once decoded or interpreted
+// by another system: backslashes, percent signs left over from encoding it more than once, NUL bytes,
+// and invalid UTF-8, such as overlong encodings of "." and "/".
+func CheckPath(p string) error {
+	if !utf8.ValidString(p) {
+		return ErrUnsafePath
+	}
+	segmentStart := 0
+	for ix := 0; ix <= len(p); ix++ {
+		if ix < len(p) {
+			switch p[ix] {
+			case '\\', '%', 0:
+				return ErrUnsafePath
+			case '/':
+			default:
+				continue
+			}
+		}
+		if p[segmentStart:ix] == ".." {
+			return ErrUnsafePath
+		}
+		segmentStart = ix + 1
+	}
+	return nil
+}
+
+// ContainedPath returns the path of a file or directory within a root directory, given its slash-separated
+// path from a request, after resolving any symbolic links. It returns ErrUnsafePath if the path fails CheckPath,
+// or if a symbolic link leads outside of the root directory, and an error satisfying errors.Is(err, fs.ErrNotExist)
+// if it does not exist.
+func ContainedPath(root, name string) (string, error) {
+	if err := CheckPath(name); err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(name, "/"))))
+	if err != nil {
+		return "", err
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", ErrUnsafePath
+	}
+	return resolved, nil
+}
@@ -0,0 +1,106 @@
+package minimux_test
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CheckPath", func() {
+	DescribeTable("should accept paths which stay where they are",
+		func(p string) {
+			Expect(minimux.CheckPath(p)).To(Succeed())
+		},
+		Entry("empty", ""),
+		Entry("root", "/"),
+		Entry("file", "/index.html"),
+		Entry("nested", "css/site.css"),
+		Entry("dots in names", "/..foo/bar../.../.hidden"),
+	)
+	DescribeTable("should reject paths which could escape",
+		func(p string) {
+			Expect(minimux.CheckPath(p)).To(MatchError(minimux.ErrUnsafePath))
+		},
+		Entry("parent", ".."),
+		Entry("leading parent", "../etc/passwd"),
+		Entry("rooted parent", "/../etc/passwd"),
+		Entry("nested parent", "/static/../../etc/passwd"),
+		Entry("trailing parent", "/static/.."),
+		Entry("backslash", `..\windows\win.ini`),
+		Entry("double encoded dots", "/%2e%2e/etc/passwd"),
+		Entry("double encoded slash", "/..%2fetc/passwd"),
+		Entry("overlong slash", "/..\xc0\xafetc/passwd"),
+		Entry("overlong dot", "/\xc0\xae\xc0\xae/etc/passwd"),
+		Entry("NUL", "/index.html\x00.png"),
+	)
+})
+
+var _ = Describe("ContainedPath", func() {
+	var root, outside string
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+		outside = GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(root, "index.html"), []byte("index"), 0o644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o644)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(root, "sub"), 0o755)).To(Succeed())
+		Expect(os.Symlink(filepath.Join(root, "index.html"), filepath.Join(root, "sub", "link"))).To(Succeed())
+		Expect(os.Symlink(outside, filepath.Join(root, "escape"))).To(Succeed())
+	})
+	It("should resolve files within the root", func() {
+		p, err := minimux.ContainedPath(root, "/index.html")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.ReadFile(p)).To(Equal([]byte("index")))
+	})
+	It("should follow symbolic links which stay within the root", func() {
+		p, err := minimux.ContainedPath(root, "sub/link")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.ReadFile(p)).To(Equal([]byte("index")))
+	})
+	It("should reject symbolic links which escape the root", func() {
+		_, err := minimux.ContainedPath(root, "/escape/secret")
+		Expect(err).To(MatchError(minimux.ErrUnsafePath))
+	})
+	It("should reject traversal", func() {
+		_, err := minimux.ContainedPath(filepath.Join(root, "sub"), "../index.html")
+		Expect(err).To(MatchError(minimux.ErrUnsafePath))
+	})
+	It("should report missing files", func() {
+		_, err := minimux.ContainedPath(root, "/missing")
+		Expect(err).To(MatchError(fs.ErrNotExist))
+	})
+})
+
+var _ = Describe("StaticData with a path variable", func() {
+	mux := &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.PathWithVars("/static(/.*)", "path").IsHandledBy(minimux.StaticData{
+				StaticBytes: map[string]minimux.StaticBytes{
+					"/index.html": minimux.NewStaticBytes([]byte("index"), "text/html"),
+					"/100%.txt":   minimux.NewStaticBytes([]byte("percent"), "text/plain"),
+					`/a\b..c.txt`: minimux.NewStaticBytes([]byte("odd"), "text/plain"),
+				},
+				DefaultHandler: respondWith("default"),
+				PathVar:        "path",
+			}),
+		},
+	}
+	DescribeTable("should serve any key in its map, as it does not touch the filesystem",
+		func(rawPath string, expected string) {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost"+rawPath, nil)
+			Expect(err).ToNot(HaveOccurred())
+			resp := serve(mux, req)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(HavePrefix(expected))
+		},
+		Entry("a safe path", "/static/index.html", "index"),
+		Entry("a percent sign", "/static/100%25.txt", "percent"),
+		Entry("a backslash and dots", "/static/a%5cb..c.txt", "odd"),
+		Entry("a traversal which is not a key", "/static/..%2f..%2fetc%2fpasswd", "default"),
+	)
+})
@@ -0,0 +1,13 @@
+//go:build go1.22
+
+package minimux
+
+import "net/http"
+
+// setPathValues sets the path variables of a request so that they are returned by its PathValue method,
+// as they would be by a net/http.ServeMux
+func setPathValues(req *http.Request, pathVars map[string]string) {
+	for name, value := range pathVars {
+		req.SetPathValue(name, value)
+	}
+}
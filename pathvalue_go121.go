@@ -0,0 +1,8 @@
+//go:build !go1.22
+
+package minimux
+
+import "net/http"
+
+// setPathValues does nothing before Go 1.22, which added PathValue
+func setPathValues(req *http.Request, pathVars map[string]string) {}
@@ -0,0 +1,41 @@
+//go:build go1.22
+
+package minimux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Path values of wrapped net/http handlers", func() {
+	mux := &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.Pattern("GET /users/{id}/posts/{post...}").IsHandledBy(minimux.SimpleFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte(req.PathValue("id") + " " + req.PathValue("post")))
+			})),
+			minimux.PathWithVars("/groups/([^/]+)", "id").IsHandledBy(minimux.Simple(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte(req.PathValue("id")))
+			}))),
+		},
+	}
+
+	It("should be set from pattern wildcards", func() {
+		resp := serve(mux, httptest.NewRequest(http.MethodGet, "/users/bob/posts/2024/hello", nil))
+		Expect(resp.Body.String()).To(Equal("bob 2024/hello"))
+	})
+	It("should be set from variable names", func() {
+		resp := serve(mux, httptest.NewRequest(http.MethodGet, "/groups/admins", nil))
+		Expect(resp.Body.String()).To(Equal("admins"))
+	})
+	It("should not change the request given to the wrapper", func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		handler := minimux.SimpleFunc(func(w http.ResponseWriter, req *http.Request) {})
+		Expect(handler.ServeHTTP(req.Context(), httptest.NewRecorder(), req, map[string]string{"id": "1"}, nil)).To(Succeed())
+		Expect(req.PathValue("id")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,117 @@
+package minimux
+
+import (
+	"fmt"
+	"go/token"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Pattern starts building a handler for a route written in the pattern syntax of net/http.ServeMux since Go 1.22,
+// such as "GET /users/{id}/posts/{postID...}", and panics if it is invalid.
+// See ParsePattern for how the pattern is interpreted.
+func Pattern(pattern string) *Route {
+	r, err := ParsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// ParsePattern starts building a handler for a route written in the pattern syntax of net/http.ServeMux since Go 1.22,
+// so that routes can be moved between the two without being rewritten.
+// A pattern is an optional method and a space, an optional host, and a path. A GET route also matches HEAD.
+// Each {name} segment of the path matches one non-empty segment, and a final {name...} segment matches the rest
+// of the path, both of which become route variables. A path ending in a slash matches every path beneath it,
+// unless it ends with {$}, in which case it matches only itself. Unlike net/http.ServeMux, routes are still chosen
+// in declaration order, not by which pattern is most specific, and the host is compared with the request's
+// Host header as-is, as with WithHosts.
+func ParsePattern(pattern string) (*Route, error) {
+	method, rest, found := strings.Cut(pattern, " ")
+	if !found {
+		method, rest = "", pattern
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	if method != "" && !validMethod(method) {
+		return nil, fmt.Errorf("pattern %q: invalid method %q", pattern, method)
+	}
+	slash := strings.IndexByte(rest, '/')
+	if slash == -1 {
+		return nil, fmt.Errorf("pattern %q: host/path missing /", pattern)
+	}
+	host, path := rest[:slash], rest[slash:]
+	var b strings.Builder
+	b.WriteString("^")
+	var vars []string
+	names := StringSet{}
+	segments := strings.Split(path[1:], "/")
+	for ix, segment := range segments {
+		last := ix == len(segments)-1
+		b.WriteString("/")
+		if !strings.HasPrefix(segment, "{") {
+			if strings.ContainsAny(segment, "{}") {
+				return nil, fmt.Errorf("pattern %q: wildcards must be entire segments", pattern)
+			}
+			literal, err := url.PathUnescape(segment)
+			if err != nil {
+				return nil, fmt.Errorf("pattern %q: %w", pattern, err)
+			}
+			b.WriteString(regexp.QuoteMeta(literal))
+			if last && segment == "" {
+				// A trailing slash matches everything beneath it
+				b.WriteString("(?s:.*)")
+			}
+			continue
+		}
+		name, ok := strings.CutSuffix(segment[1:], "}")
+		if !ok {
+			return nil, fmt.Errorf("pattern %q: wildcards must be entire segments", pattern)
+		}
+		if name == "$" {
+			if !last {
+				return nil, fmt.Errorf("pattern %q: {$} must be the final segment", pattern)
+			}
+			// The slash before {$} is the end of the path
+			break
+		}
+		name, remainder := strings.CutSuffix(name, "...")
+		if remainder && !last {
+			return nil, fmt.Errorf("pattern %q: {%s...} must be the final segment", pattern, name)
+		}
+		if !token.IsIdentifier(name) {
+			return nil, fmt.Errorf("pattern %q: invalid wildcard name %q", pattern, name)
+		}
+		if names.Has(name) {
+			return nil, fmt.Errorf("pattern %q: duplicate wildcard name %q", pattern, name)
+		}
+		names[name] = struct{}{}
+		vars = append(vars, name)
+		if remainder {
+			b.WriteString("((?s:.*))")
+		} else {
+			b.WriteString("([^/]+)")
+		}
+	}
+	b.WriteString("$")
+	r := &Route{Pattern: regexp.MustCompile(b.String()), VarNames: vars}
+	switch method {
+	case "":
+	case http.MethodGet:
+		r.WithMethods(http.MethodGet, http.MethodHead)
+	default:
+		r.WithMethods(method)
+	}
+	if host != "" {
+		r.WithHosts(host)
+	}
+	return r, nil
+}
+
+// validMethod returns true if a method is a valid token
+func validMethod(method string) bool {
+	return strings.IndexFunc(method, func(c rune) bool {
+		return c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c)
+	}) == -1
+}
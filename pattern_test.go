@@ -0,0 +1,58 @@
+package minimux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("A mux with Go 1.22 patterns", func() {
+	mux := &minimux.Mux{
+		DefaultHandler: minimux.NotFound,
+		Routes: []minimux.Route{
+			minimux.Pattern("GET /users/{name}/posts/{post...}").IsHandledBy(respondWith("posts-")),
+			minimux.Pattern("POST /users/{name}").IsHandledBy(respondWith("create-")),
+			minimux.Pattern("admin/users/{name}").IsHandledBy(respondWith("admin-")),
+			minimux.Pattern("/users/{$}").IsHandledBy(respondWith("list")),
+			minimux.Pattern("/static/").IsHandledBy(respondWith("static")),
+			minimux.Pattern("/a%20b").IsHandledBy(respondWith("escaped")),
+		},
+	}
+
+	DescribeTable("should route requests",
+		func(method, url string, expectedStatus int, expectedBody string) {
+			resp := serve(mux, httptest.NewRequest(method, url, nil))
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("wildcard and remainder", http.MethodGet, "http://localhost/users/bob/posts/2024/hello", http.StatusOK, "posts-bob"),
+		Entry("empty remainder", http.MethodGet, "http://localhost/users/bob/posts/", http.StatusOK, "posts-bob"),
+		Entry("HEAD for GET", http.MethodHead, "http://localhost/users/bob/posts/1", http.StatusOK, "posts-bob"),
+		Entry("method", http.MethodPost, "http://localhost/users/bob", http.StatusOK, "create-bob"),
+		Entry("method mismatch", http.MethodDelete, "http://localhost/users/bob", http.StatusMethodNotAllowed, ""),
+		Entry("host", http.MethodDelete, "http://admin/users/bob", http.StatusOK, "admin-bob"),
+		Entry("exact trailing slash", http.MethodGet, "http://localhost/users/", http.StatusOK, "list"),
+		Entry("beneath exact trailing slash", http.MethodGet, "http://localhost/users/bob/other", http.StatusNotFound, ""),
+		Entry("prefix", http.MethodGet, "http://localhost/static/css/site.css", http.StatusOK, "static"),
+		Entry("escaped literal", http.MethodGet, "http://localhost/a%20b", http.StatusOK, "escaped"),
+	)
+
+	DescribeTable("should reject invalid patterns",
+		func(pattern string) {
+			_, err := minimux.ParsePattern(pattern)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("no path", "GET"),
+		Entry("partial wildcard", "/users/id{id}"),
+		Entry("unterminated wildcard", "/users/{id"),
+		Entry("remainder before the end", "/files/{path...}/raw"),
+		Entry("{$} before the end", "/{$}/more"),
+		Entry("invalid name", "/users/{1d}"),
+		Entry("duplicate name", "/{id}/{id}"),
+		Entry("invalid method", "G:T /"),
+	)
+})
@@ -0,0 +1,112 @@
+package minimux
+
+import (
+	"context"
+	"net/http"
+)
+
+// policyAuthenticator is the Authenticator of the AuthDecisions made by Policies
+const policyAuthenticator = "policy"
+
+// A Policy decides whether an identity may make a request
+type Policy interface {
+	// Allow returns true if an identity, which is nil for unauthenticated requests, may make a request to a route.
+	// The route is nil if the policy is applied by Authorize rather than Route.WithPolicy.
+	Allow(ctx context.Context, id *Identity, route *Route, req *http.Request) (bool, error)
+}
+
+// PolicyFunc wraps a function into a Policy
+type PolicyFunc func(ctx context.Context, id *Identity, route *Route, req *http.Request) (bool, error)
+
+// Allow implements Policy
+func (f PolicyFunc) Allow(ctx context.Context, id *Identity, route *Route, req *http.Request) (bool, error) {
+	return f(ctx, id, route, req)
+}
+
+// authorize applies a policy to a request, returning the status code to answer it with if it is not allowed,
+// or zero if it is
+func authorize(ctx context.Context, policy Policy, route *Route, req *http.Request) (int, error) {
+	id, _ := IdentityFromContext(ctx)
+	allowed, err := policy.Allow(ctx, id, route, req)
+	decision := AuthDecision{Authenticator: policyAuthenticator, Identity: id, Request: req, Route: route, Allowed: allowed && err == nil}
+	switch {
+	case err != nil:
+		decision.Reason = "policy failed: " + err.Error()
+	case allowed:
+		decision.Reason = "allowed by policy"
+	default:
+		decision.Reason = "denied by policy"
+	}
+	AuditAuthDecision(ctx, decision)
+	switch {
+	case err != nil:
+		return http.StatusInternalServerError, err
+	case allowed:
+		return 0, nil
+	case id == nil:
+		return http.StatusUnauthorized, nil
+	default:
+		return http.StatusForbidden, nil
+	}
+}
+
+// Authorize returns a handler which calls another only if a policy allows the identity in the context to make
+// the request, for use after an authenticator which wraps handlers, such as OIDC.Require, or to protect a group
+// of routes in an InnerMux. Unauthenticated requests which are not allowed are answered with 401 Unauthorized,
+// and other requests which are not allowed with 403 Forbidden.
+func Authorize(policy Policy, next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		if status, err := authorize(ctx, policy, nil, req); status != 0 {
+			w.WriteHeader(status)
+			return err
+		}
+		return next.ServeHTTP(ctx, w, req, pathVars, formErr)
+	})
+}
+
+// RolePolicy is a Policy which allows identities with any of a set of roles
+type RolePolicy struct {
+	// Roles are the roles which are allowed
+	Roles StringSet
+	// Assignments are optional roles of identities, in addition to those from IdentityRoles, by their Key,
+	// such as "oidc:1234" for the subject of an OIDC session, or "client-cert:" and the fingerprint of a certificate.
+	// They are not by name, as names can be chosen by callers, and can be the same for callers authenticated differently.
+	Assignments map[string][]string
+}
+
+// RequireRoles returns a policy which allows identities with any of a set of roles
+func RequireRoles(roles ...string) *RolePolicy {
+	return &RolePolicy{Roles: StringSetOf(roles...)}
+}
+
+// Allow implements Policy
+func (p *RolePolicy) Allow(ctx context.Context, id *Identity, route *Route, req *http.Request) (bool, error) {
+	if id == nil {
+		return false, nil
+	}
+	for _, role := range p.Assignments[id.Key()] {
+		if p.Roles.Has(role) {
+			return true, nil
+		}
+	}
+	for _, role := range IdentityRoles(id) {
+		if p.Roles.Has(role) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IdentityRoles returns the roles of an identity from the "roles" and "groups" claims of its token, if any
+func IdentityRoles(id *Identity) []string {
+	var roles []string
+	for _, claim := range []string{"roles", "groups"} {
+		values, _ := id.Claims[claim].([]any)
+		for _, value := range values {
+			if role, ok := value.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
+}
@@ -0,0 +1,73 @@
+package minimux_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("A route with a policy", func() {
+	policy := minimux.RequireRoles("admin")
+	fingerprint := func(raw string) string {
+		sum := sha256.Sum256([]byte(raw))
+		return minimux.IdentityMethodClientCert + ":" + hex.EncodeToString(sum[:])
+	}
+	policy.Assignments = map[string][]string{fingerprint("alice"): {"admin"}, fingerprint("bob"): {"viewer"}, "oidc:1234": {"admin"}}
+	mux := &minimux.Mux{
+		PreProcess: minimux.ExtractClientCertIdentity,
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/admin").WithPolicy(policy).IsHandledBy(minimux.NewStaticString("admin", "text/plain")),
+			minimux.LiteralPath("/broken").WithPolicy(minimux.PolicyFunc(func(ctx context.Context, id *minimux.Identity, route *minimux.Route, req *http.Request) (bool, error) {
+				return true, errors.New("policy unavailable")
+			})).IsHandledBy(minimux.NewStaticString("broken", "text/plain")),
+		},
+	}
+	DescribeTable("should only handle requests the policy allows",
+		func(path, commonName string, expectedStatus int) {
+			req := httptest.NewRequest(http.MethodGet, "https://localhost"+path, nil)
+			if commonName != "" {
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Raw: []byte(commonName), Subject: pkix.Name{CommonName: commonName}}}}}
+			}
+			Expect(serve(mux, req).Code).To(Equal(expectedStatus))
+		},
+		Entry("allowed", "/admin", "alice", http.StatusOK),
+		Entry("without the role", "/admin", "bob", http.StatusForbidden),
+		Entry("unauthenticated", "/admin", "", http.StatusUnauthorized),
+		Entry("failing policy", "/broken", "alice", http.StatusInternalServerError),
+	)
+	It("should assign roles by method and ID rather than by name", func() {
+		for sub, expectedStatus := range map[string]int{"1234": http.StatusOK, "5678": http.StatusForbidden} {
+			ctx := minimux.WithIdentity(context.Background(), minimux.OIDCIdentity(minimux.TokenClaims{"sub": sub, "preferred_username": "alice"}, minimux.IdentityMethodOIDC))
+			resp := httptest.NewRecorder()
+			Expect(minimux.Authorize(policy, minimux.NewStaticString("admin", "text/plain")).ServeHTTP(ctx, resp, httptest.NewRequest(http.MethodGet, "https://localhost/admin", nil), nil, nil)).To(Succeed())
+			Expect(resp.Code).To(Equal(expectedStatus))
+		}
+	})
+})
+
+var _ = Describe("Authorize", func() {
+	It("should use the roles from an identity's claims", func() {
+		handler := minimux.Authorize(minimux.RequireRoles("admin"), minimux.NewStaticString("admin", "text/plain"))
+		for claims, expectedStatus := range map[string]int{"admin": http.StatusOK, "viewer": http.StatusForbidden} {
+			ctx := minimux.WithIdentity(context.Background(), &minimux.Identity{
+				Name:   "alice",
+				Method: minimux.IdentityMethodOIDC,
+				Claims: minimux.TokenClaims{"groups": []any{"users", claims}},
+			})
+			resp := httptest.NewRecorder()
+			Expect(handler.ServeHTTP(ctx, resp, httptest.NewRequest(http.MethodGet, "https://localhost/admin", nil), nil, nil)).To(Succeed())
+			Expect(resp.Code).To(Equal(expectedStatus))
+		}
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
 const (
@@ -20,10 +21,33 @@ const (
 // A PostProcessor is a function which can handle the result of a request
 type PostProcessor func(ctx context.Context, req *http.Request, statusCode int, err error)
 
+// RequestResult is the result of a request, for a ResultPostProcessor
+type RequestResult struct {
+	// StatusCode is the status code of the response, or StatusPanic or StatusPreProcessPanic
+	StatusCode int
+	// Err is the error returned by the handler, or from a panic
+	Err error
+	// Route is the route which matched the request, if any
+	Route *Route
+	// Pattern is the pattern of Route, such as for a metric label, or empty if there is no Route, or it has a Matcher
+	Pattern string
+	// Duration is how long the request took, from before PreProcess
+	Duration time.Duration
+	// BytesWritten is the length of the response body
+	BytesWritten int64
+	// WriteErr is the first error from writing the response body, such as when the client went away partway through
+	WriteErr error
+	// DefaultHandler is true if no route matched and the request was handled by the DefaultHandler
+	DefaultHandler bool
+}
+
+// A ResultPostProcessor is a function which can handle the result of a request, along with how it was handled
+type ResultPostProcessor func(ctx context.Context, req *http.Request, result RequestResult)
+
 // LogCompletedRequest returns a PostProcessor that logs the method, url, agent, status code,
-// and fatal error of a request
+// and fatal error of a request, with the URL redacted by DefaultRedactor
 func LogCompletedRequest(w io.Writer) PostProcessor {
 	return func(ctx context.Context, req *http.Request, statusCode int, err error) {
-		fmt.Fprintf(w, "%s %s %s %d %v\n", req.Method, req.URL, req.UserAgent(), statusCode, err)
+		fmt.Fprintf(w, "%s %s %s %d %v\n", req.Method, DefaultRedactor.URL(req.URL), req.UserAgent(), statusCode, err)
 	}
 }
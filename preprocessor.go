@@ -15,16 +15,43 @@ var CancelWhenDone PreProcessor = func(ctx context.Context, req *http.Request) (
 }
 
 // LogPendingRequest returns a PreProcessor that logs the method, url, and agent of a request to
-// the given writer
+// the given writer, with the URL redacted by DefaultRedactor
 func LogPendingRequest(w io.Writer) PreProcessor {
 	return func(ctx context.Context, req *http.Request) (context.Context, func()) {
-		fmt.Fprintf(w, "%s %s %s\n", req.Method, req.URL, req.UserAgent())
+		fmt.Fprintf(w, "%s %s %s\n", req.Method, DefaultRedactor.URL(req.URL), req.UserAgent())
 		return ctx, func() {}
 	}
 }
 
+type rejectionKey struct{}
+
+// rejection is how a PreProcessor chose to answer a request instead of routing it
+type rejection struct {
+	handler    Handler
+	statusCode int
+}
+
+// Reject returns a context for a PreProcessor to return so that the Mux answers the request with a handler,
+// such as to deny access or limit its rate, instead of routing it. PostProcess is still called with the result.
+func Reject(ctx context.Context, handler Handler) context.Context {
+	return context.WithValue(ctx, rejectionKey{}, &rejection{handler: handler})
+}
+
+// RejectWithStatus returns a context for a PreProcessor to return so that the Mux answers the request with a status,
+// using any error page for it, instead of routing it, as with Reject
+func RejectWithStatus(ctx context.Context, statusCode int) context.Context {
+	return context.WithValue(ctx, rejectionKey{}, &rejection{statusCode: statusCode})
+}
+
+// rejectionFromContext returns how a PreProcessor chose to answer a request instead of routing it, or nil if it did not
+func rejectionFromContext(ctx context.Context) *rejection {
+	rej, _ := ctx.Value(rejectionKey{}).(*rejection)
+	return rej
+}
+
 // PreProcessorChain takes a sequence of PreProcessor and returns one which calls them in order,
-// and returns a defered function which calls their defered functions in reverse order
+// and returns a defered function which calls their defered functions in reverse order.
+// Once one of them rejects the request, as with Reject, the rest are not called.
 func PreProcessorChain(chain ...PreProcessor) PreProcessor {
 	return func(ctx context.Context, req *http.Request) (context.Context, func()) {
 		fs := [](func()){}
@@ -34,6 +61,9 @@ func PreProcessorChain(chain ...PreProcessor) PreProcessor {
 			if f != nil {
 				fs = append(fs, f)
 			}
+			if rejectionFromContext(ctx) != nil {
+				break
+			}
 		}
 		return ctx, func() {
 			for _, f := range fs {
@@ -0,0 +1,116 @@
+package minimux
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultQueueConcurrency is how many requests a Queue serves at once, if its Concurrency is not set
+	DefaultQueueConcurrency = 64
+	// DefaultQueueWait is how long a request may wait in a Queue, if its Wait is not set
+	DefaultQueueWait = 10 * time.Second
+)
+
+// A Queue limits how many requests a handler serves at once, holding a limited number of further requests
+// until they can be served, so that bursts are smoothed out instead of rejected. Requests which arrive when
+// the queue is full, or which wait too long, are answered with 503 Service Unavailable and a Retry-After header.
+// Use a separate Queue for each route to limit them separately.
+type Queue struct {
+	// Concurrency is how many requests may be served at once. If zero, DefaultQueueConcurrency is used.
+	Concurrency int
+	// Depth is how many requests may wait to be served. If zero, requests are not queued.
+	Depth int
+	// Wait is how long a request may wait to be served. If zero, DefaultQueueWait is used.
+	Wait time.Duration
+	// Observe is an optional function which is called with the number of requests being served and waiting
+	// whenever either changes, such as to record queue depth metrics. It must not block.
+	Observe func(active, queued int)
+
+	once    sync.Once
+	slots   chan struct{}
+	active  atomic.Int64
+	queued  atomic.Int64
+	timeout time.Duration
+}
+
+func (q *Queue) init() {
+	q.once.Do(func() {
+		concurrency := q.Concurrency
+		if concurrency == 0 {
+			concurrency = DefaultQueueConcurrency
+		}
+		q.slots = make(chan struct{}, concurrency)
+		q.timeout = q.Wait
+		if q.timeout == 0 {
+			q.timeout = DefaultQueueWait
+		}
+	})
+}
+
+// Active returns how many requests are being served
+func (q *Queue) Active() int {
+	return int(q.active.Load())
+}
+
+// Queued returns how many requests are waiting to be served
+func (q *Queue) Queued() int {
+	return int(q.queued.Load())
+}
+
+func (q *Queue) observe() {
+	if q.Observe != nil {
+		q.Observe(q.Active(), q.Queued())
+	}
+}
+
+// acquire waits for a slot to serve a request in, returning false if the request must be rejected
+func (q *Queue) acquire(ctx context.Context, req *http.Request) bool {
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if q.queued.Add(1) > int64(q.Depth) {
+		q.queued.Add(-1)
+		return false
+	}
+	q.observe()
+	defer func() {
+		q.queued.Add(-1)
+		q.observe()
+	}()
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	case <-req.Context().Done():
+	}
+	return false
+}
+
+// Limit returns a handler which calls another once there is room, or rejects the request
+func (q *Queue) Limit(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		q.init()
+		if !q.acquire(ctx, req) {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return nil
+		}
+		q.active.Add(1)
+		q.observe()
+		defer func() {
+			q.active.Add(-1)
+			<-q.slots
+			q.observe()
+		}()
+		return next.ServeHTTP(ctx, w, req, pathVars, formErr)
+	})
+}
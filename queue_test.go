@@ -0,0 +1,82 @@
+package minimux_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Queue", func() {
+	var release chan struct{}
+	var queue *minimux.Queue
+	var mux *minimux.Mux
+	var lock sync.Mutex
+	var depths []int
+	BeforeEach(func() {
+		release = make(chan struct{})
+		depths = nil
+		queue = &minimux.Queue{
+			Concurrency: 1,
+			Depth:       1,
+			Wait:        time.Minute,
+			Observe: func(active, queued int) {
+				lock.Lock()
+				defer lock.Unlock()
+				depths = append(depths, queued)
+			},
+		}
+		mux = &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/batch").IsHandledBy(queue.Limit(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					<-release
+					return nil
+				}))),
+			},
+		}
+	})
+
+	// start serves a request in the background, returning a channel which receives its status
+	start := func() chan int {
+		status := make(chan int, 1)
+		go func() {
+			status <- serve(mux, httptest.NewRequest(http.MethodPost, "/batch", nil)).Code
+		}()
+		return status
+	}
+
+	It("should queue requests beyond the concurrency limit, and reject them beyond the depth", func() {
+		first := start()
+		Eventually(queue.Active).Should(Equal(1))
+		second := start()
+		Eventually(queue.Queued).Should(Equal(1))
+
+		resp := serve(mux, httptest.NewRequest(http.MethodPost, "/batch", nil))
+		Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(resp.Header().Get("Retry-After")).To(Equal("1"))
+
+		close(release)
+		Expect(<-first).To(Equal(http.StatusOK))
+		Expect(<-second).To(Equal(http.StatusOK))
+		Expect(queue.Active()).To(Equal(0))
+		Expect(queue.Queued()).To(Equal(0))
+		lock.Lock()
+		defer lock.Unlock()
+		Expect(depths).To(ContainElement(1))
+	})
+
+	It("should reject requests which wait too long", func() {
+		queue.Wait = 10 * time.Millisecond
+		first := start()
+		Eventually(queue.Active).Should(Equal(1))
+		Expect(<-start()).To(Equal(http.StatusServiceUnavailable))
+		close(release)
+		Expect(<-first).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,138 @@
+package minimux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxByteRanges is the most ranges a request may ask for before they are ignored, and the entire content served
+const maxByteRanges = 32
+
+// errUnsatisfiableRange is returned when none of the ranges requested overlap the content
+var errUnsatisfiableRange = errors.New("no requested range is satisfiable")
+
+// acceptRanges is the value of the Accept-Ranges header for content which supports ranges, shared by all responses
+var acceptRanges = []string{"bytes"}[:1:1]
+
+// byteRange is a range of the bytes of some content
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseByteRanges parses the value of a Range header, as in RFC 9110, for content of a size, returning
+// errUnsatisfiableRange if none of the ranges overlap it, or another error if the header is invalid
+func parseByteRanges(header string, size int64) ([]byteRange, error) {
+	unit, spec, ok := strings.Cut(header, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, fmt.Errorf("invalid range %q", header)
+	}
+	var ranges []byteRange
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(field, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid range %q", field)
+		}
+		if first == "" {
+			suffix, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, fmt.Errorf("invalid range %q", field)
+			}
+			if suffix > 0 && size > 0 {
+				suffix = min(suffix, size)
+				ranges = append(ranges, byteRange{start: size - suffix, length: suffix})
+			}
+			continue
+		}
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid range %q", field)
+		}
+		end := size - 1
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return nil, fmt.Errorf("invalid range %q", field)
+			}
+			end = min(end, size-1)
+		}
+		if start < size {
+			ranges = append(ranges, byteRange{start: start, length: end - start + 1})
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// serveRanges answers a GET request with a Range header with the requested ranges of some content, either as
+// a single part, or as multipart/byteranges, returning false if the ranges should be ignored and the entire content
+// served instead. Ranges are ignored if the request has an If-Range which does not match the entity tag or modification time
+// of the content, either of which may be empty, if there are too many, or if they would add up to more than the content.
+func serveRanges(w http.ResponseWriter, req *http.Request, contentType, etag string, modTime time.Time, content io.ReaderAt, size int64) (bool, error) {
+	if req.Method != http.MethodGet || !ifRangeMatches(req, etag, modTime) {
+		return false, nil
+	}
+	ranges, err := parseByteRanges(req.Header.Get("Range"), size)
+	if errors.Is(err, errUnsatisfiableRange) {
+		w.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return true, nil
+	}
+	if err != nil || len(ranges) > maxByteRanges {
+		return false, nil
+	}
+	var total int64
+	for _, r := range ranges {
+		total += r.length
+	}
+	if total > size {
+		return false, nil
+	}
+
+	h := w.Header()
+	h["Accept-Ranges"] = acceptRanges
+	if len(ranges) == 1 {
+		r := ranges[0]
+		if contentType != "" {
+			h.Set("Content-Type", contentType)
+		}
+		h.Set("Content-Range", r.contentRange(size))
+		h.Set("Content-Length", strconv.FormatInt(r.length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		_, err := io.Copy(w, io.NewSectionReader(content, r.start, r.length))
+		return true, err
+	}
+	mw := multipart.NewWriter(w)
+	h.Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusPartialContent)
+	for _, r := range ranges {
+		partHeader := textproto.MIMEHeader{"Content-Range": {r.contentRange(size)}}
+		if contentType != "" {
+			partHeader.Set("Content-Type", contentType)
+		}
+		part, err := mw.CreatePart(partHeader)
+		if err != nil {
+			return true, err
+		}
+		if _, err := io.Copy(part, io.NewSectionReader(content, r.start, r.length)); err != nil {
+			return true, err
+		}
+	}
+	return true, mw.Close()
+}
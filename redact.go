@@ -0,0 +1,123 @@
+package minimux
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultRedactionMask replaces redacted values if a Redactor's Mask is not set
+const DefaultRedactionMask = "REDACTED"
+
+// A Redactor masks sensitive values, such as credentials, before they are logged.
+// Names are compared case-insensitively.
+type Redactor struct {
+	// Headers are the names of headers whose values are masked
+	Headers StringSet
+	// QueryParams are the names of URL query parameters whose values are masked
+	QueryParams StringSet
+	// JSONFields are the names of JSON object fields whose values are masked, at any depth
+	JSONFields StringSet
+	// Mask replaces masked values. If empty, DefaultRedactionMask is used.
+	Mask string
+}
+
+// DefaultRedactor is used by the built-in logging processors, such as LogPendingRequest and LogCompletedRequest.
+// It may be replaced or modified during initialization to mask other values.
+var DefaultRedactor = &Redactor{
+	Headers: StringSetOf("authorization", "proxy-authorization", "cookie", "set-cookie", "x-api-key"),
+	QueryParams: StringSetOf(
+		"access_token", "id_token", "refresh_token", "token", "code", "password", "secret", "client_secret",
+		"api_key", "apikey", "key", "signature", "sig",
+	),
+	JSONFields: StringSetOf(
+		"access_token", "id_token", "refresh_token", "token", "password", "secret", "client_secret", "api_key", "apikey",
+	),
+}
+
+func (r *Redactor) mask() string {
+	if r.Mask == "" {
+		return DefaultRedactionMask
+	}
+	return r.Mask
+}
+
+// sensitive returns true if a name is in a set, ignoring case
+func sensitive(names StringSet, name string) bool {
+	return names.Has(name) || names.Has(strings.ToLower(name))
+}
+
+// URL returns a URL as a string, with the values of sensitive query parameters, and any password, masked.
+// The order of the query parameters is preserved.
+func (r *Redactor) URL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Redacted()
+	}
+	redacted := *u
+	params := strings.Split(u.RawQuery, "&")
+	for ix, param := range params {
+		rawName, _, _ := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if sensitive(r.QueryParams, name) {
+			params[ix] = rawName + "=" + url.QueryEscape(r.mask())
+		}
+	}
+	redacted.RawQuery = strings.Join(params, "&")
+	return redacted.Redacted()
+}
+
+// Header returns a copy of a header with the values of sensitive headers masked
+func (r *Redactor) Header(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for name, values := range h {
+		if !sensitive(r.Headers, name) {
+			redacted[name] = values
+			continue
+		}
+		masked := make([]string, len(values))
+		for ix := range masked {
+			masked[ix] = r.mask()
+		}
+		redacted[name] = masked
+	}
+	return redacted
+}
+
+// JSON returns a copy of a JSON document with the values of sensitive fields masked.
+// If the document is not valid JSON, it is masked entirely, as it cannot be known what it contains.
+func (r *Redactor) JSON(data []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return []byte(r.mask())
+	}
+	redacted, err := json.Marshal(r.redactJSON(value))
+	if err != nil {
+		return []byte(r.mask())
+	}
+	return redacted
+}
+
+func (r *Redactor) redactJSON(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for name, field := range value {
+			if sensitive(r.JSONFields, name) {
+				value[name] = r.mask()
+			} else {
+				value[name] = r.redactJSON(field)
+			}
+		}
+	case []any:
+		for ix, elem := range value {
+			value[ix] = r.redactJSON(elem)
+		}
+	}
+	return value
+}
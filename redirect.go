@@ -0,0 +1,128 @@
+package minimux
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultRedirectStatus is the status a RedirectMap redirects with, if its StatusCode is not set
+const DefaultRedirectStatus = http.StatusMovedPermanently
+
+// A RedirectMap is a handler which redirects requests for legacy paths to their new locations, such as when
+// migrating a site, and is typically used as the DefaultHandler of a Mux. Each rule maps an old path to a new
+// path or URL. A rule whose old path ends with "*" matches every path with that prefix, and, if its new path
+// also ends with "*", the rest of the path replaces it. Exact rules take priority, then the longest prefix.
+// The query of a request is kept unless the new location has its own.
+// If no rule matches, DefaultHandler is called if set, otherwise the request is answered with 404 Not Found.
+type RedirectMap struct {
+	// Rules maps old paths to new ones
+	Rules map[string]string
+	// StatusCode is the redirect status, such as 301 Moved Permanently or 308 Permanent Redirect.
+	// If zero, DefaultRedirectStatus is used.
+	StatusCode int
+	// DefaultHandler is an optional handler for requests which match no rule
+	DefaultHandler Handler
+
+	once     sync.Once
+	exact    map[string]string
+	prefixes []redirectPrefix
+}
+
+type redirectPrefix struct {
+	from string
+	to   string
+	// rest is true if the rest of the path is appended to to
+	rest bool
+}
+
+func (r *RedirectMap) init() {
+	r.once.Do(func() {
+		r.exact = make(map[string]string, len(r.Rules))
+		for from, to := range r.Rules {
+			prefix, isPrefix := strings.CutSuffix(from, "*")
+			if !isPrefix {
+				r.exact[from] = to
+				continue
+			}
+			to, rest := strings.CutSuffix(to, "*")
+			r.prefixes = append(r.prefixes, redirectPrefix{from: prefix, to: to, rest: rest})
+		}
+		sort.Slice(r.prefixes, func(i, j int) bool { return len(r.prefixes[i].from) > len(r.prefixes[j].from) })
+	})
+}
+
+// Location returns where a path is redirected to, and false if no rule matches it
+func (r *RedirectMap) Location(path string) (string, bool) {
+	r.init()
+	if to, ok := r.exact[path]; ok {
+		return to, true
+	}
+	for _, prefix := range r.prefixes {
+		rest, ok := strings.CutPrefix(path, prefix.from)
+		if !ok {
+			continue
+		}
+		if prefix.rest {
+			return prefix.to + rest, true
+		}
+		return prefix.to, true
+	}
+	return "", false
+}
+
+// ServeHTTP implements Handler
+func (r *RedirectMap) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	location, ok := r.Location(req.URL.Path)
+	if !ok {
+		if r.DefaultHandler != nil {
+			return r.DefaultHandler.ServeHTTP(ctx, w, req, pathVars, formErr)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	if req.URL.RawQuery != "" && !strings.Contains(location, "?") {
+		location += "?" + req.URL.RawQuery
+	}
+	statusCode := r.StatusCode
+	if statusCode == 0 {
+		statusCode = DefaultRedirectStatus
+	}
+	http.Redirect(w, req, location, statusCode)
+	return nil
+}
+
+// ReadRedirectsCSV reads RedirectMap rules from CSV records of an old path and a new path. Blank lines,
+// and lines starting with "#", are ignored.
+func ReadRedirectsCSV(r io.Reader) (map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	rules := make(map[string]string)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rules, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading redirects: %w", err)
+		}
+		rules[record[0]] = record[1]
+	}
+}
+
+// ReadRedirectsJSON reads RedirectMap rules from a JSON object of old paths to new paths
+func ReadRedirectsJSON(r io.Reader) (map[string]string, error) {
+	rules := make(map[string]string)
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("reading redirects: %w", err)
+	}
+	return rules, nil
+}
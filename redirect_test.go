@@ -0,0 +1,47 @@
+package minimux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RedirectMap", func() {
+	rules, err := minimux.ReadRedirectsCSV(strings.NewReader(`# old, new
+/about.html, /about
+/blog/*, /posts/*
+/blog/archive/*, /archive
+/shop/*, https://shop.example.com/*
+`))
+	Expect(err).ToNot(HaveOccurred())
+	mux := &minimux.Mux{
+		DefaultHandler: &minimux.RedirectMap{Rules: rules, StatusCode: http.StatusPermanentRedirect},
+	}
+
+	DescribeTable("should redirect legacy paths",
+		func(target string, location string) {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, target, nil))
+			Expect(resp.Code).To(Equal(http.StatusPermanentRedirect))
+			Expect(resp.Header().Get("Location")).To(Equal(location))
+		},
+		Entry("exact", "/about.html", "/about"),
+		Entry("prefix", "/blog/2020/hello?ref=rss", "/posts/2020/hello?ref=rss"),
+		Entry("longest prefix", "/blog/archive/2019", "/archive"),
+		Entry("other site", "/shop/cart", "https://shop.example.com/cart"),
+	)
+
+	It("should answer 404 for other paths", func() {
+		Expect(serve(mux, httptest.NewRequest(http.MethodGet, "/about", nil)).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should read rules from JSON", func() {
+		rules, err := minimux.ReadRedirectsJSON(strings.NewReader(`{"/a": "/b"}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rules).To(Equal(map[string]string{"/a": "/b"}))
+	})
+})
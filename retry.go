@@ -0,0 +1,272 @@
+package minimux
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRetryAttempts is how many times a RetryPolicy tries a request, if its Attempts is not set
+	DefaultRetryAttempts = 3
+	// DefaultRetryBackoff is how long a RetryPolicy waits before the first retry, if its Backoff is not set.
+	// It doubles with each retry.
+	DefaultRetryBackoff = 50 * time.Millisecond
+	// DefaultRetryMaxBodyBytes is the largest request body a RetryPolicy buffers to retry, if its MaxBodyBytes is not set
+	DefaultRetryMaxBodyBytes = 1 << 20
+	// DefaultRetryBudgetRatio is the fraction of requests a RetryBudget allows to be retried, if its Ratio is not set
+	DefaultRetryBudgetRatio = 0.2
+	// DefaultRetryBudgetMinRetries is how many retries a RetryBudget always allows in a window, if its MinRetries is not set
+	DefaultRetryBudgetMinRetries = 10
+	// DefaultRetryBudgetWindow is how long a RetryBudget counts requests for, if its Window is not set
+	DefaultRetryBudgetWindow = 10 * time.Second
+)
+
+type retrySafeKey struct{}
+
+// RetrySafe returns a handler which marks its requests as safe to retry, even if their method is not,
+// for any RetryPolicy transport which sends requests with the same context, such as a proxy
+func RetrySafe(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		ctx = context.WithValue(ctx, retrySafeKey{}, true)
+		return next.ServeHTTP(ctx, w, req.WithContext(ctx), pathVars, formErr)
+	})
+}
+
+// retryable returns true if a request may be sent more than once
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	safe, _ := req.Context().Value(retrySafeKey{}).(bool)
+	return safe
+}
+
+// A RetryBudget limits retries across many requests to a fraction of them, so that retries cannot multiply
+// the load on a backend which is already failing. It may be shared by several RetryPolicies.
+type RetryBudget struct {
+	// Ratio is the fraction of requests which may be retried. If zero, DefaultRetryBudgetRatio is used.
+	Ratio float64
+	// MinRetries is how many retries are allowed in each window regardless of the ratio, so that retries
+	// are possible while traffic is light. If zero, DefaultRetryBudgetMinRetries is used.
+	MinRetries int
+	// Window is how long requests and retries are counted for before the counts start again.
+	// If zero, DefaultRetryBudgetWindow is used.
+	Window time.Duration
+
+	lock        sync.Mutex
+	windowStart time.Time
+	requests    int
+	retries     int
+}
+
+// roll starts a new window if the current one is over
+func (b *RetryBudget) roll(now time.Time) {
+	window := b.Window
+	if window == 0 {
+		window = DefaultRetryBudgetWindow
+	}
+	if now.Sub(b.windowStart) >= window {
+		b.windowStart = now
+		b.requests = 0
+		b.retries = 0
+	}
+}
+
+// request records a request
+func (b *RetryBudget) request() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.roll(time.Now())
+	b.requests++
+}
+
+// retry returns true, and records a retry, if the budget allows one
+func (b *RetryBudget) retry() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.roll(time.Now())
+	ratio := b.Ratio
+	if ratio == 0 {
+		ratio = DefaultRetryBudgetRatio
+	}
+	minRetries := b.MinRetries
+	if minRetries == 0 {
+		minRetries = DefaultRetryBudgetMinRetries
+	}
+	if b.retries >= minRetries && float64(b.retries) >= ratio*float64(b.requests) {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// A RetryPolicy retries requests to backends, such as those sent by a proxy, when they fail with a network error,
+// or with 502 Bad Gateway, 503 Service Unavailable, or 504 Gateway Timeout. Only requests which are safe to repeat,
+// because their method is GET, HEAD, or OPTIONS, or because they are marked with RetrySafe, are retried,
+// and their bodies, if any, are buffered so they can be sent again.
+type RetryPolicy struct {
+	// Attempts is how many times to try a request. If zero, DefaultRetryAttempts is used.
+	Attempts int
+	// Backoff is how long to wait before the first retry, doubling, with jitter, for each retry after it.
+	// If zero, DefaultRetryBackoff is used.
+	Backoff time.Duration
+	// TryTimeout, if non-zero, limits how long each attempt may take, including reading its response
+	TryTimeout time.Duration
+	// Budget is an optional RetryBudget which limits retries across all requests
+	Budget *RetryBudget
+	// MaxBodyBytes is the largest request body to buffer. Requests with larger bodies are not retried.
+	// If zero, DefaultRetryMaxBodyBytes is used.
+	MaxBodyBytes int64
+	// BufferThreshold is the threshold of the SpillBuffers request bodies are buffered in
+	BufferThreshold int
+}
+
+// Transport returns a transport which sends requests with another, retrying them according to the policy
+func (p *RetryPolicy) Transport(inner http.RoundTripper) http.RoundTripper {
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+	return retryTransport{policy: p, inner: inner}
+}
+
+type retryTransport struct {
+	policy *RetryPolicy
+	inner  http.RoundTripper
+}
+
+// shouldRetry returns true if an attempt failed in a way which another attempt might not
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// bufferBody buffers the body of a request so that it can be sent more than once, returning false, and
+// restoring the body, if it is too large
+func (p *RetryPolicy) bufferBody(req *http.Request) (*SpillBuffer, bool, error) {
+	maxBodyBytes := p.MaxBodyBytes
+	if maxBodyBytes == 0 {
+		maxBodyBytes = DefaultRetryMaxBodyBytes
+	}
+	body := NewSpillBuffer(p.BufferThreshold)
+	n, err := io.Copy(body, io.LimitReader(req.Body, maxBodyBytes+1))
+	if err != nil {
+		body.Close()
+		return nil, false, err
+	}
+	if n > maxBodyBytes {
+		original := req.Body
+		req.Body = readCloser{Reader: io.MultiReader(body.Reader(), original), Closer: closerFunc(func() error {
+			body.Close()
+			return original.Close()
+		})}
+		return nil, false, nil
+	}
+	req.Body.Close()
+	return body, true, nil
+}
+
+// closerFunc wraps a function into an io.Closer
+type closerFunc func() error
+
+// Close implements io.Closer
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// RoundTrip implements http.RoundTripper
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.policy.Budget != nil {
+		t.policy.Budget.request()
+	}
+	if !retryable(req) {
+		return t.inner.RoundTrip(req)
+	}
+	var body *SpillBuffer
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		original := req.Body
+		var ok bool
+		var err error
+		body, ok, err = t.policy.bufferBody(req)
+		if err != nil {
+			original.Close()
+			return nil, err
+		}
+		if !ok {
+			return t.inner.RoundTrip(req)
+		}
+	}
+	cleanup := func() {
+		if body != nil {
+			body.Close()
+		}
+	}
+	attempts := t.policy.Attempts
+	if attempts == 0 {
+		attempts = DefaultRetryAttempts
+	}
+	backoff := t.policy.Backoff
+	if backoff == 0 {
+		backoff = DefaultRetryBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := req.Context(), context.CancelFunc(func() {})
+		if t.policy.TryTimeout != 0 {
+			ctx, cancel = context.WithTimeout(ctx, t.policy.TryTimeout)
+		}
+		tryReq := req.Clone(ctx)
+		switch {
+		case body != nil:
+			tryReq.Body = io.NopCloser(body.Reader())
+		case req.GetBody != nil && attempt != 1:
+			var err error
+			if tryReq.Body, err = req.GetBody(); err != nil {
+				cancel()
+				cleanup()
+				return nil, err
+			}
+		}
+		resp, err := t.inner.RoundTrip(tryReq)
+		last := attempt == attempts || req.Context().Err() != nil || !shouldRetry(resp, err) ||
+			(t.policy.Budget != nil && !t.policy.Budget.retry())
+		if last {
+			if resp == nil {
+				cancel()
+				cleanup()
+				return nil, err
+			}
+			original := resp.Body
+			resp.Body = readCloser{Reader: original, Closer: closerFunc(func() error {
+				defer cancel()
+				defer cleanup()
+				return original.Close()
+			})}
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+		cancel()
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		backoff *= 2
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			cleanup()
+			return nil, req.Context().Err()
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package minimux_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetryPolicy", func() {
+	var failures atomic.Int32
+	var calls atomic.Int32
+	var backend *httptest.Server
+	BeforeEach(func() {
+		failures.Store(0)
+		calls.Store(0)
+		backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			body, _ := io.ReadAll(req.Body)
+			if failures.Add(-1) >= 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(req.Method + ":" + string(body)))
+		}))
+		DeferCleanup(backend.Close)
+	})
+
+	send := func(policy *minimux.RetryPolicy, req *http.Request) (int, string) {
+		resp, err := policy.Transport(nil).RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return resp.StatusCode, string(body)
+	}
+
+	It("should retry idempotent requests until they succeed", func() {
+		failures.Store(2)
+		req := httptest.NewRequest(http.MethodGet, backend.URL, nil)
+		req.RequestURI = ""
+		status, body := send(&minimux.RetryPolicy{Backoff: time.Millisecond}, req)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(Equal("GET:"))
+		Expect(calls.Load()).To(Equal(int32(3)))
+	})
+
+	It("should not retry unsafe requests", func() {
+		failures.Store(1)
+		req, err := http.NewRequest(http.MethodPost, backend.URL, io.NopCloser(strings.NewReader("data")))
+		Expect(err).ToNot(HaveOccurred())
+		status, _ := send(&minimux.RetryPolicy{Backoff: time.Millisecond}, req)
+		Expect(status).To(Equal(http.StatusServiceUnavailable))
+		Expect(calls.Load()).To(Equal(int32(1)))
+	})
+
+	It("should retry requests from routes marked safe, resending their bodies", func() {
+		failures.Store(1)
+		client := &http.Client{Transport: (&minimux.RetryPolicy{Backoff: time.Millisecond}).Transport(nil)}
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/upsert").IsHandledBy(minimux.RetrySafe(minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					outReq, err := http.NewRequestWithContext(ctx, http.MethodPut, backend.URL, io.NopCloser(req.Body))
+					if err != nil {
+						return err
+					}
+					resp, err := client.Do(outReq)
+					if err != nil {
+						return err
+					}
+					defer resp.Body.Close()
+					w.WriteHeader(resp.StatusCode)
+					_, err = io.Copy(w, resp.Body)
+					return err
+				}))),
+			},
+		}
+		resp := serve(mux, httptest.NewRequest(http.MethodPut, "/upsert", strings.NewReader("data")))
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(Equal("PUT:data"))
+		Expect(calls.Load()).To(Equal(int32(2)))
+	})
+
+	It("should stop retrying once the budget is spent", func() {
+		failures.Store(100)
+		policy := &minimux.RetryPolicy{Backoff: time.Millisecond, Budget: &minimux.RetryBudget{MinRetries: 1, Ratio: 0.01}}
+		for ix := 0; ix < 3; ix++ {
+			req, err := http.NewRequest(http.MethodGet, backend.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			status, _ := send(policy, req)
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+		}
+		// Only the first request was retried, once
+		Expect(calls.Load()).To(Equal(int32(4)))
+	})
+})
@@ -1,8 +1,14 @@
 package minimux
 
 import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"net/http"
 	"regexp"
+	"sync"
+	"time"
 )
 
 // Route is a handler that accepts only certain requests
@@ -11,15 +17,135 @@ type Route struct {
 	Methods StringSet
 	// Hosts is an optional set of request hosts that this will handle
 	Hosts StringSet
+	// HostPattern is an optional regular expression which the host of a request, without any port, must match
+	// for this to handle it, as with WithHostPattern
+	HostPattern *regexp.Regexp
 	// Pattern is the regular expression that matches URL routes that this will handle.
 	// Each capture group represents a route variable.
 	Pattern *regexp.Regexp
-	// VarNames is the name of the route variables, in the order their capture groups appear in Pattern
+	// PatternSource is the uncompiled regular expression for Pattern, including any anchors.
+	// If Pattern is nil, this is compiled when the route is added to a RouteTable, which compiles
+	// the patterns of all of its routes concurrently.
+	PatternSource string
+	// VarNames is the name of the route variables, in the order their capture groups appear in Pattern.
+	// If nil, the names of any named capture groups, such as (?P<id>[0-9]+), are used instead.
 	VarNames []string
+	// VarTypes optionally maps the names of route variables to the types their values must be valid for,
+	// as with WithVarTypes. While any is invalid, the route is skipped as if it did not match.
+	VarTypes map[string]VarType
 	// HasForm indicates that ParseForm should be called for this handler
 	HasForm bool
+	// LazyForm indicates that, if HasForm is set, ParseForm should not be called until the handler
+	// calls ParseLazyForm, instead of before the handler is called
+	LazyForm bool
+	// MultipartMaxMemory, if positive and HasForm is set, parses multipart forms as well, such as file uploads,
+	// with ParseMultipartForm, storing up to this many bytes of their files in memory, and the rest on disk
+	MultipartMaxMemory int64
+	// MaxBodyBytes, if positive, limits the size of the body of a matching request, as with WithMaxBodyBytes.
+	// If zero, the MaxBodyBytes of the Mux is used instead, and, if negative, the body is not limited.
+	MaxBodyBytes int64
 	// Handler is the actual handler logic
 	Handler Handler
+	// Matcher is an optional replacement for Methods, Hosts, HostPattern, and Pattern, which decides which requests will be handled
+	Matcher Matcher
+	// ClientCert is an optional function which must accept the verified TLS client certificate of a matching request
+	// for it to be handled. Requests without a verified certificate, or whose certificate is not accepted,
+	// are answered with 403 Forbidden instead.
+	ClientCert func(*x509.Certificate) bool
+	// UserAgent is an optional function which must accept the User-Agent of a matching request, which is empty
+	// if it has none, for it to be handled. Other requests are answered with 403 Forbidden instead.
+	UserAgent func(userAgent string) bool
+	// Schemes is an optional set of schemes, such as "https", which a matching request must be made with
+	// for it to be handled, as with WithSchemes
+	Schemes StringSet
+	// Policy is an optional Policy which must allow the identity in the context, as recorded by a PreProcessor
+	// such as ExtractClientCertIdentity, to make a matching request for it to be handled.
+	// Unauthenticated requests which are not allowed are answered with 401 Unauthorized, and others with 403 Forbidden.
+	Policy Policy
+	// ReadTimeout is an optional limit on how long reading the rest of a matching request, such as its body,
+	// may take, starting from when it is matched. If negative, any read deadline set by the http.Server is removed
+	// instead, so that long-running streaming requests are not cut off.
+	ReadTimeout time.Duration
+	// Geo is an optional function which must accept the location of a matching request, as recorded by the
+	// ResolveGeo PreProcessor, for it to be handled. Requests whose location is not accepted, or was not resolved,
+	// are answered with 451 Unavailable For Legal Reasons instead.
+	Geo func(GeoLocation) bool
+	// Schedule is an optional Schedule outside of which matching requests are handled by Closed instead of Handler
+	Schedule Schedule
+	// Closed handles matching requests outside of the Schedule, such as with a maintenance window page.
+	// If nil, they are answered with 503 Service Unavailable.
+	Closed Handler
+	// Enabled is an optional function which decides, for each request, whether this route exists, such as
+	// by checking a feature flag. While it returns false, the route is skipped as if it did not match.
+	Enabled func(ctx context.Context, req *http.Request) bool
+	// Body is an optional function which must accept the first bytes of the body of a matching request, up to
+	// BodySniffBytes, for it to be handled, so that requests for the same path can be routed by the format of their
+	// payload. While it returns false, the route is skipped as if it did not match. The bytes are read ahead while
+	// matching, and read again by the handler.
+	Body func(prefix []byte) bool
+	// Conditions are optional functions which must all return true for a matching request for it to be handled,
+	// such as by checking a header or query parameter. While any returns false, the route is skipped as if it did not match.
+	Conditions []func(*http.Request) bool
+	// Accept is an optional set of media types, one of which the Accept header of a matching request must accept
+	// for it to be handled, as with WithAccept. While it does not, the route is skipped as if it did not match.
+	Accept []string
+	// Middleware optionally wraps the Handler, the first outermost, inside of the Middleware of the Mux
+	Middleware []Middleware
+	// PreProcess is optionally called once this route has been matched, after the PreProcess of the Mux, with the context
+	// it returned, to generate the context for the rest of the request, along with a function to defer to its end
+	PreProcess PreProcessor
+	// PostProcess is optionally called with the result of this route, including any checks which reject the request,
+	// before the PostProcess of the Mux, and with the context from PreProcess
+	PostProcess PostProcessor
+	// Name is an optional name to build URLs for this route by, with Mux.URL, which must be unique within a RouteTable
+	Name string
+
+	// index is the position of this route in the RouteTable it was copied into
+	index int
+	// acceptRivals are the Accept media types of the other routes in the RouteTable with the same pattern
+	acceptRivals []string
+}
+
+// AnyClientCert accepts any verified TLS client certificate
+func AnyClientCert(*x509.Certificate) bool {
+	return true
+}
+
+// A Matcher decides which requests a Route handles
+type Matcher interface {
+	// Match returns true if a request should be handled, along with the values of the route variables,
+	// in the order of the Route's VarNames. If the request would be handled but for its method,
+	// methodNotAllowed should be true instead.
+	Match(req *http.Request) (varValues []string, matches bool, methodNotAllowed bool)
+}
+
+// RegexMatcher is the default Matcher, which matches requests by method, host,
+// and a regular expression for the path.
+type RegexMatcher struct {
+	// Methods is an optional set of HTTP methods to match
+	Methods StringSet
+	// Hosts is an optional set of request hosts to match
+	Hosts StringSet
+	// HostPattern is an optional regular expression for the request host, without any port, to match
+	HostPattern *regexp.Regexp
+	// Pattern is the regular expression that matches URL paths.
+	// Each capture group represents a route variable.
+	Pattern *regexp.Regexp
+}
+
+// Match implements Matcher
+func (m RegexMatcher) Match(req *http.Request) (varValues []string, matches bool, methodNotAllowed bool) {
+	if !matchesHost(m.Hosts, m.HostPattern, req) {
+		return nil, false, false
+	}
+	groups := m.Pattern.FindStringSubmatch(req.URL.Path)
+	if groups == nil {
+		return nil, false, false
+	}
+	if m.Methods != nil && !m.Methods.Has(req.Method) {
+		return nil, false, true
+	}
+	return groups[1:], true, false
 }
 
 // LiteralPath starts building a handler for an exact route
@@ -27,15 +153,34 @@ func LiteralPath(path string) *Route {
 	return &Route{Pattern: regexp.MustCompile("^" + regexp.QuoteMeta(path) + "$")}
 }
 
-// PathPattern starts building a handler for an route without any variables defined as a regular expression
+// PathPattern starts building a handler for an route defined as a regular expression, whose only variables
+// are its named capture groups, such as (?P<id>[0-9]+)
 func PathPattern(path string) *Route {
-	return &Route{Pattern: regexp.MustCompile("^" + path + "$")}
+	pattern := regexp.MustCompile("^" + path + "$")
+	return &Route{Pattern: pattern, VarNames: namedVars(pattern)}
 }
 
 // Route with vars starts building a handler for a route with variables defined as regular expression
-// capture groups
+// capture groups. If no names are given, the names of its named capture groups are used.
 func PathWithVars(pattern string, vars ...string) *Route {
-	return &Route{Pattern: regexp.MustCompile("^" + pattern + "$"), VarNames: vars}
+	compiled := regexp.MustCompile("^" + pattern + "$")
+	if len(vars) == 0 {
+		vars = namedVars(compiled)
+	}
+	return &Route{Pattern: compiled, VarNames: vars}
+}
+
+// LazyPathWithVars is PathWithVars, but the pattern is not compiled until the route is added to a RouteTable,
+// so that the patterns of many routes can be compiled concurrently
+func LazyPathWithVars(pattern string, vars ...string) *Route {
+	return &Route{PatternSource: "^" + pattern + "$", VarNames: vars}
+}
+
+// MatchedBy starts building a handler for the requests chosen by a custom Matcher, such as
+// a faster implementation for a specific set of paths, or an alternate regular expression engine,
+// with the names of the route variables it produces
+func MatchedBy(matcher Matcher, vars ...string) *Route {
+	return &Route{Matcher: matcher, VarNames: vars}
 }
 
 // WithMethods limits a handler to specific methods
@@ -50,12 +195,169 @@ func (r *Route) WithHosts(hosts ...string) *Route {
 	return r
 }
 
+// WithClientCert limits a handler to requests with a verified TLS client certificate accepted by a function.
+// Other requests are answered with 403 Forbidden. Use AnyClientCert to accept any verified certificate.
+func (r *Route) WithClientCert(verify func(*x509.Certificate) bool) *Route {
+	r.ClientCert = verify
+	return r
+}
+
+// WithUserAgent limits a handler to requests whose User-Agent is accepted by a function, such as
+// UserAgentFilter.Allows. Other requests are answered with 403 Forbidden.
+func (r *Route) WithUserAgent(accept func(userAgent string) bool) *Route {
+	r.UserAgent = accept
+	return r
+}
+
+// WithGeo limits a handler to requests from locations accepted by a function, such as InCountries.
+// The location must be recorded in the context by the ResolveGeo PreProcessor.
+// Other requests are answered with 451 Unavailable For Legal Reasons.
+func (r *Route) WithGeo(accept func(GeoLocation) bool) *Route {
+	r.Geo = accept
+	return r
+}
+
+// WithPolicy limits a handler to requests from identities allowed by a Policy, such as one from RequireRoles.
+// The identity must be recorded in the context by a PreProcessor; to apply a policy after an authenticator
+// which wraps a handler, such as OIDC.Require, use Authorize instead.
+func (r *Route) WithPolicy(policy Policy) *Route {
+	r.Policy = policy
+	return r
+}
+
+// WithReadTimeout limits how long reading the rest of a request, such as its body, may take once it is matched,
+// to protect against clients which send requests slowly. A negative timeout removes the http.Server's read deadline instead.
+func (r *Route) WithReadTimeout(timeout time.Duration) *Route {
+	r.ReadTimeout = timeout
+	return r
+}
+
+// EnabledWhen makes a handler exist only while a function, such as a feature flag lookup, returns true for a request,
+// so that new routes can ship dark and be enabled without rebuilding the RouteTable.
+// Requests it is disabled for continue on to the next matching route.
+func (r *Route) EnabledWhen(enabled func(ctx context.Context, req *http.Request) bool) *Route {
+	r.Enabled = enabled
+	return r
+}
+
+// WithMatcher adds a condition, such as on the value of a header or query parameter, which must also hold
+// for a request to be handled, along with its method, host, and path. Requests it does not hold for continue on to
+// the next matching route. It can be called more than once, in which case every condition must hold.
+func (r *Route) WithMatcher(condition func(*http.Request) bool) *Route {
+	r.Conditions = append(r.Conditions, condition)
+	return r
+}
+
+// conditionsHold returns true if every one of the Conditions holds for a request
+func (r *Route) conditionsHold(req *http.Request) bool {
+	for _, condition := range r.Conditions {
+		if !condition(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// skippable returns true if this route can be skipped for a request which it matches, such as by Enabled,
+// Body, Conditions, Accept, or VarTypes, and so whether it handles a request depends on more than its method, host, and path
+func (r *Route) skippable() bool {
+	return r.Enabled != nil || r.Body != nil || len(r.Conditions) != 0 || len(r.Accept) != 0 || r.VarTypes != nil
+}
+
+// WithBody limits a handler to requests whose body begins with bytes accepted by a function, such as LooksLikeJSON,
+// so that payloads in different formats sent to the same path, such as webhooks from a provider which uses one URL
+// and no reliable Content-Type, can be handled differently. Requests it does not accept continue on to the next
+// matching route.
+func (r *Route) WithBody(accept func(prefix []byte) bool) *Route {
+	r.Body = accept
+	return r
+}
+
+// AvailableWhen limits a handler to the times a Schedule, such as TimeWindows, is open, handling requests at other
+// times with another handler, or, if it is nil, answering them with 503 Service Unavailable
+func (r *Route) AvailableWhen(schedule Schedule, closed Handler) *Route {
+	r.Schedule = schedule
+	r.Closed = closed
+	return r
+}
+
+// Named names a handler, so that URLs for it can be built with Mux.URL
+func (r *Route) Named(name string) *Route {
+	r.Name = name
+	return r
+}
+
 // WithForm sets a handler to indicate it needs the form data parsed
 func (r *Route) WithForm(hosts ...string) *Route {
 	r.HasForm = true
 	return r
 }
 
+// WithMultipartForm sets a handler to indicate it needs the form data parsed, including multipart forms,
+// such as file uploads, so that req.MultipartForm is populated, storing up to maxMemory bytes of their files in memory.
+// Any error parsing it is passed to the handler as its form error. It can be combined with WithLazyForm.
+func (r *Route) WithMultipartForm(maxMemory int64) *Route {
+	r.HasForm = true
+	r.MultipartMaxMemory = maxMemory
+	return r
+}
+
+// WithMaxBodyBytes limits the size of the body of requests to a handler, to protect it from unbounded uploads,
+// or, if negative, lifts the MaxBodyBytes of the Mux. Reading past the limit, including while parsing the form,
+// fails with an *http.MaxBytesError, which is answered with 413 Request Entity Too Large if the handler returns it
+// without writing a response, by the ErrorHandler of the Mux, if any, such as WriteError.
+func (r *Route) WithMaxBodyBytes(n int64) *Route {
+	r.MaxBodyBytes = n
+	return r
+}
+
+// bodyLimit returns the limit on the size of the body of a request to this route, given the default of the Mux,
+// or zero if it is not limited
+func (r *Route) bodyLimit(def int64) int64 {
+	if r.MaxBodyBytes != 0 {
+		return max(r.MaxBodyBytes, 0)
+	}
+	return max(def, 0)
+}
+
+// WithLazyForm sets a handler to indicate it needs the form data parsed, but only once it calls
+// ParseLazyForm, so that requests which do not need the form do not pay to parse it
+func (r *Route) WithLazyForm() *Route {
+	r.HasForm = true
+	r.LazyForm = true
+	return r
+}
+
+// Use wraps a handler in Middleware, the first outermost, which is called once the route has been matched and
+// its requests checked, inside of the Middleware of the Mux
+func (r *Route) Use(middleware ...Middleware) *Route {
+	r.Middleware = append(r.Middleware, middleware...)
+	return r
+}
+
+// WithPreProcess calls a PreProcessor once the route has been matched, inside of the PreProcess of the Mux,
+// such as to authenticate requests for only some routes
+func (r *Route) WithPreProcess(preProcess PreProcessor) *Route {
+	r.PreProcess = preProcess
+	return r
+}
+
+// WithPostProcess calls a PostProcessor with the result of the route, before the PostProcess of the Mux
+func (r *Route) WithPostProcess(postProcess PostProcessor) *Route {
+	r.PostProcess = postProcess
+	return r
+}
+
+// postProcess calls the PostProcess of a route, if any, and then the function deferred by its PreProcess, if any
+func (r *Route) postProcess(ctx context.Context, req *http.Request, statusCode int, err error, toDefer func()) {
+	if toDefer != nil {
+		defer toDefer()
+	}
+	if r.PostProcess != nil {
+		r.PostProcess(ctx, req, statusCode, err)
+	}
+}
+
 // IsHandledBy finishes building a handler by providing the serving logic
 func (r *Route) IsHandledBy(handler Handler) Route {
 	r.Handler = handler
@@ -68,22 +370,111 @@ func (r *Route) IsHandledByFunc(handler HandlerFunc) Route {
 	return *r
 }
 
+// Matches returns true if this route handles a request, using its Matcher, if any, or a RegexMatcher otherwise
 func (r *Route) Matches(req *http.Request) (varValues []string, matches bool, methodNotAllowed bool) {
-	if r.Hosts != nil && !r.Hosts.Has(req.Host) {
-		return nil, false, false
+	if r.Matcher != nil {
+		return r.Matcher.Match(req)
 	}
-	groups := r.Pattern.FindStringSubmatch(req.URL.Path)
-	if groups == nil {
-		return nil, false, false
+	pattern := r.Pattern
+	if pattern == nil {
+		// This route was not added to a RouteTable, so its pattern was never compiled
+		pattern = regexp.MustCompile(r.PatternSource)
+	}
+	return RegexMatcher{Methods: r.Methods, Hosts: r.Hosts, HostPattern: r.HostPattern, Pattern: pattern}.Match(req)
+}
+
+// compile compiles PatternSource into Pattern if it has not been already,
+// and names the variables after its named capture groups if they have no names
+func (r *Route) compile() error {
+	if r.Matcher != nil {
+		return nil
+	}
+	if r.Pattern == nil {
+		if r.PatternSource == "" {
+			return fmt.Errorf("route has no Pattern, PatternSource, or Matcher")
+		}
+		pattern, err := regexp.Compile(r.PatternSource)
+		if err != nil {
+			return err
+		}
+		r.Pattern = pattern
+	}
+	if r.VarNames == nil {
+		r.VarNames = namedVars(r.Pattern)
+	}
+	return nil
+}
+
+// namedVars returns the names of the capture groups of a pattern, which are empty for unnamed groups,
+// or nil if none of them are named
+func namedVars(pattern *regexp.Regexp) []string {
+	names := pattern.SubexpNames()[1:]
+	for _, name := range names {
+		if name != "" {
+			return append([]string(nil), names...)
+		}
+	}
+	return nil
+}
+
+// matchesHostAndMethod is Matches for a request whose path is already known to match
+func (r *Route) matchesHostAndMethod(req *http.Request) (matches bool, methodNotAllowed bool) {
+	if !r.matchesHost(req) {
+		return false, false
 	}
 	if r.Methods != nil && !r.Methods.Has(req.Method) {
-		return nil, false, true
+		return false, true
 	}
-	return groups[1:], true, false
+	return true, false
+}
+
+// rejection returns the status code to answer a matching request with instead of handling it, or zero if
+// it should be handled
+func (r *Route) rejection(ctx context.Context, req *http.Request) int {
+	if r.ClientCert != nil {
+		decision := AuthDecision{Authenticator: IdentityMethodClientCert, Request: req, Route: r, Reason: "no verified client certificate"}
+		if cert := verifiedClientCert(req); cert != nil {
+			decision.Identity = ClientCertIdentity(cert)
+			decision.Allowed = r.ClientCert(cert)
+			decision.Reason = "client certificate accepted"
+			if !decision.Allowed {
+				decision.Reason = "client certificate not accepted"
+			}
+		}
+		AuditAuthDecision(ctx, decision)
+		if !decision.Allowed {
+			return http.StatusForbidden
+		}
+	}
+	if r.UserAgent != nil && !r.UserAgent(req.UserAgent()) {
+		return http.StatusForbidden
+	}
+	if r.Geo != nil {
+		if location, ok := GeoFromContext(ctx); !ok || !r.Geo(location) {
+			return http.StatusUnavailableForLegalReasons
+		}
+	}
+	return 0
+}
+
+// setReadDeadline applies the ReadTimeout of this route, if any, to the connection of a request.
+// Connections which do not support deadlines, such as those of test recorders, are left as-is.
+func (r *Route) setReadDeadline(w http.ResponseWriter) {
+	if r.ReadTimeout == 0 {
+		return
+	}
+	var deadline time.Time
+	if r.ReadTimeout > 0 {
+		deadline = time.Now().Add(r.ReadTimeout)
+	}
+	http.NewResponseController(w).SetReadDeadline(deadline)
 }
 
 func (r *Route) VarMap(values []string, varMap map[string]string) {
 	for ix, name := range r.VarNames {
+		if name == "" {
+			continue
+		}
 		if ix >= len(values) {
 			varMap[name] = ""
 			continue
@@ -93,8 +484,49 @@ func (r *Route) VarMap(values []string, varMap map[string]string) {
 }
 
 func (r *Route) ParseFormIfNeeded(req *http.Request) error {
-	if !r.HasForm {
+	if !r.HasForm || r.LazyForm {
 		return nil
 	}
-	return req.ParseForm()
+	return parseForm(req, r.MultipartMaxMemory)
+}
+
+// parseForm parses the form of a request, including multipart forms if maxMemory is positive
+func parseForm(req *http.Request, maxMemory int64) error {
+	if maxMemory <= 0 {
+		return req.ParseForm()
+	}
+	// ParseMultipartForm parses other forms before checking whether the form is multipart
+	if err := req.ParseMultipartForm(maxMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+	return nil
+}
+
+type lazyFormKey struct{}
+
+// lazyForm is the result of parsing the form of a request for a route with LazyForm set
+type lazyForm struct {
+	once      sync.Once
+	err       error
+	maxMemory int64
+}
+
+// withLazyFormIfNeeded returns a context which allows ParseLazyForm to parse the form once if the
+// route has LazyForm set, or the context unchanged otherwise
+func (r *Route) withLazyFormIfNeeded(ctx context.Context) context.Context {
+	if !r.HasForm || !r.LazyForm {
+		return ctx
+	}
+	return context.WithValue(ctx, lazyFormKey{}, &lazyForm{maxMemory: r.MultipartMaxMemory})
+}
+
+// ParseLazyForm parses the form of a request for a Route built with WithLazyForm the first time it
+// is called, and returns the same error on subsequent calls. For any other request, it calls ParseForm.
+func ParseLazyForm(ctx context.Context, req *http.Request) error {
+	form, ok := ctx.Value(lazyFormKey{}).(*lazyForm)
+	if !ok {
+		return req.ParseForm()
+	}
+	form.once.Do(func() { form.err = parseForm(req, form.maxMemory) })
+	return form.err
 }
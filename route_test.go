@@ -0,0 +1,297 @@
+package minimux_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// serve serves a request directly with a handler, returning the recorded response
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
+
+var _ = Describe("A route with a client certificate constraint", func() {
+	var mux *minimux.Mux
+	BeforeEach(func() {
+		mux = &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.
+					LiteralPath("/admin").
+					WithClientCert(func(cert *x509.Certificate) bool { return cert.Subject.CommonName == "admin" }).
+					IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+						w.Write([]byte("welcome"))
+						return nil
+					}),
+			},
+		}
+	})
+	withCert := func(commonName string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "https://localhost/admin", nil)
+		req.TLS = &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}},
+		}
+		return req
+	}
+	It("should handle requests with an accepted certificate", func() {
+		resp := serve(mux, withCert("admin"))
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(Equal("welcome"))
+	})
+	It("should forbid requests with a certificate which isn't accepted", func() {
+		resp := serve(mux, withCert("guest"))
+		Expect(resp.Code).To(Equal(http.StatusForbidden))
+		Expect(resp.Body.String()).To(BeEmpty())
+	})
+	It("should forbid requests without a verified certificate", func() {
+		req := httptest.NewRequest(http.MethodGet, "https://localhost/admin", nil)
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "admin"}}},
+		}
+		Expect(serve(mux, req).Code).To(Equal(http.StatusForbidden))
+		Expect(serve(mux, httptest.NewRequest(http.MethodGet, "http://localhost/admin", nil)).Code).To(Equal(http.StatusForbidden))
+	})
+})
+
+var _ = Describe("A route with a read timeout", func() {
+	It("should stop reading slow requests without affecting other routes", func() {
+		echo := minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusRequestTimeout)
+				return nil
+			}
+			w.Write(body)
+			return nil
+		})
+		mux := &minimux.Mux{
+			PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/upload").WithReadTimeout(50 * time.Millisecond).IsHandledBy(echo),
+				minimux.LiteralPath("/stream").WithReadTimeout(-1).IsHandledBy(echo),
+			},
+		}
+		srv := httptest.NewUnstartedServer(mux)
+		srv.Config.ReadTimeout = 100 * time.Millisecond
+		srv.Start()
+		defer srv.Close()
+
+		slowly := func(path string) (int, string) {
+			body, bodyW := io.Pipe()
+			go func() {
+				bodyW.Write([]byte("a"))
+				time.Sleep(300 * time.Millisecond)
+				bodyW.Write([]byte("b"))
+				bodyW.Close()
+			}()
+			resp, err := srv.Client().Post(srv.URL+path, "text/plain", body)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			respBody, err := readString(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			return resp.StatusCode, respBody
+		}
+		Expect(slowly("/upload")).To(Equal(http.StatusRequestTimeout))
+		status, body := slowly("/stream")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(Equal("ab"))
+	})
+})
+
+var _ = Describe("A route with a User-Agent constraint", func() {
+	filter := &minimux.UserAgentFilter{
+		Blocked:    []*regexp.Regexp{minimux.KnownBots},
+		Allowed:    []*regexp.Regexp{regexp.MustCompile(`^UptimeMonitor/`)},
+		BlockEmpty: true,
+	}
+	mux := &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/robots.txt").IsHandledBy(minimux.NewStaticString("User-agent: *\nDisallow: /search\n", "text/plain")),
+			minimux.LiteralPath("/search").WithUserAgent(filter.Allows).IsHandledBy(minimux.NewStaticString("results", "text/plain")),
+		},
+	}
+	DescribeTable("should only handle requests from accepted User-Agents",
+		func(path, userAgent string, expectedStatus int) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+			req.Header.Set("User-Agent", userAgent)
+			Expect(serve(mux, req).Code).To(Equal(expectedStatus))
+		},
+		Entry("browser", "/search", "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0", http.StatusOK),
+		Entry("crawler", "/search", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", http.StatusForbidden),
+		Entry("client library", "/search", "python-requests/2.31.0", http.StatusForbidden),
+		Entry("missing", "/search", "", http.StatusForbidden),
+		Entry("allowed bot", "/search", "UptimeMonitor/1.0 (bot)", http.StatusOK),
+		Entry("crawler on an unconstrained route", "/robots.txt", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", http.StatusOK),
+	)
+})
+
+var _ = Describe("A route with a feature flag", func() {
+	It("should be skipped while the flag is off, even when matches are remembered", func() {
+		var launched atomic.Bool
+		mux := &minimux.Mux{
+			MatchCacheSize:    10,
+			NotFoundCacheSize: 10,
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/checkout").
+					EnabledWhen(func(ctx context.Context, req *http.Request) bool { return launched.Load() }).
+					IsHandledBy(minimux.NewStaticString("new", "text/plain")),
+				minimux.PathPattern("/checkout|/cart").IsHandledBy(minimux.NewStaticString("old", "text/plain")),
+				minimux.LiteralPath("/beta").
+					EnabledWhen(func(ctx context.Context, req *http.Request) bool { return launched.Load() }).
+					IsHandledBy(minimux.NewStaticString("beta", "text/plain")),
+			},
+		}
+		get := func(path string) *httptest.ResponseRecorder {
+			return serve(mux, httptest.NewRequest(http.MethodGet, "http://localhost"+path, nil))
+		}
+		Expect(get("/checkout").Body.String()).To(Equal("old"))
+		Expect(get("/beta").Body.String()).To(BeEmpty())
+
+		launched.Store(true)
+		Expect(get("/checkout").Body.String()).To(Equal("new"))
+		Expect(get("/beta").Body.String()).To(Equal("beta"))
+
+		launched.Store(false)
+		Expect(get("/checkout").Body.String()).To(Equal("old"))
+	})
+})
+
+var _ = Describe("A route with custom matchers", func() {
+	mux := &minimux.Mux{
+		MatchCacheSize: 10,
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/report").
+				WithMethods(http.MethodGet).
+				WithMatcher(func(req *http.Request) bool { return req.Header.Get("X-Beta") == "1" }).
+				WithMatcher(func(req *http.Request) bool { return req.URL.Query().Has("new") }).
+				IsHandledBy(minimux.NewStaticString("new", "text/plain")),
+			minimux.LiteralPath("/report").WithMethods(http.MethodGet).IsHandledBy(minimux.NewStaticString("old", "text/plain")),
+		},
+	}
+
+	DescribeTable("should only handle requests all of its conditions hold for",
+		func(url, beta, expectedBody string) {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			if beta != "" {
+				req.Header.Set("X-Beta", beta)
+			}
+			Expect(serve(mux, req).Body.String()).To(Equal(expectedBody))
+		},
+		Entry("all conditions", "/report?new", "1", "new"),
+		Entry("first condition only", "/report", "1", "old"),
+		Entry("second condition only", "/report?new", "", "old"),
+		Entry("all conditions again, after being remembered", "/report?new", "1", "new"),
+	)
+})
+
+var _ = Describe("A route with a geo constraint", func() {
+	resolver := minimux.GeoResolverFunc(func(ctx context.Context, addr netip.Addr) (minimux.GeoLocation, error) {
+		switch addr.String() {
+		case "192.0.2.1":
+			return minimux.GeoLocation{Country: "US", Region: "US-CA"}, nil
+		case "192.0.2.2":
+			return minimux.GeoLocation{Country: "KP"}, nil
+		case "192.0.2.3":
+			return minimux.GeoLocation{Country: "FR"}, nil
+		}
+		return minimux.GeoLocation{}, nil
+	})
+	var countries []string
+	mux := &minimux.Mux{
+		PreProcess: minimux.ResolveGeo(resolver),
+		PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {
+			location, _ := minimux.GeoFromContext(ctx)
+			countries = append(countries, location.Country)
+		},
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/download").WithGeo(minimux.NotInCountries("KP")).IsHandledBy(minimux.NewStaticString("file", "text/plain")),
+			minimux.LiteralPath("/california").WithGeo(minimux.InCountries("us-ca")).IsHandledBy(minimux.NewStaticString("hi", "text/plain")),
+		},
+	}
+	DescribeTable("should only handle requests from accepted locations",
+		func(path, remoteAddr string, expectedStatus int, expectedCountry string) {
+			countries = nil
+			req := httptest.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+			req.RemoteAddr = remoteAddr
+			Expect(serve(mux, req).Code).To(Equal(expectedStatus))
+			Expect(countries).To(Equal([]string{expectedCountry}))
+		},
+		Entry("allowed country", "/download", "192.0.2.1:1234", http.StatusOK, "US"),
+		Entry("restricted country", "/download", "192.0.2.2:1234", http.StatusUnavailableForLegalReasons, "KP"),
+		Entry("unknown location", "/download", "192.0.2.9:1234", http.StatusUnavailableForLegalReasons, ""),
+		Entry("allowed region", "/california", "192.0.2.1:1234", http.StatusOK, "US"),
+		Entry("other country", "/california", "192.0.2.3:1234", http.StatusUnavailableForLegalReasons, "FR"),
+	)
+})
+
+var _ = Describe("Routes with a body constraint", func() {
+	echo := func(format string) minimux.Handler {
+		return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return err
+			}
+			w.Write([]byte(format + ":" + string(body)))
+			return nil
+		})
+	}
+	mux := &minimux.Mux{
+		MatchCacheSize: 10,
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/webhook").WithMethods(http.MethodPost).WithBody(minimux.LooksLikeXML).IsHandledBy(echo("xml")),
+			minimux.LiteralPath("/webhook").WithMethods(http.MethodPost).WithBody(minimux.LooksLikeJSON).IsHandledBy(echo("json")),
+			minimux.LiteralPath("/webhook").WithMethods(http.MethodPost).WithBody(minimux.BodyHasPrefix([]byte("%PDF"))).IsHandledBy(echo("pdf")),
+		},
+	}
+	DescribeTable("should route by the format of the body, and replay it to the handler",
+		func(body string, expectedStatus int, expectedBody string) {
+			resp := serve(mux, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("XML", `<?xml version="1.0"?><event/>`, http.StatusOK, `xml:<?xml version="1.0"?><event/>`),
+		Entry("JSON", "\xef\xbb\xbf\n {\"event\": 1}", http.StatusOK, "json:\xef\xbb\xbf\n {\"event\": 1}"),
+		Entry("JSON after XML was cached", `[1]`, http.StatusOK, "json:[1]"),
+		Entry("a long body", "{"+strings.Repeat(" ", 2*minimux.BodySniffBytes)+"}", http.StatusOK, "json:{"+strings.Repeat(" ", 2*minimux.BodySniffBytes)+"}"),
+		Entry("magic number", "%PDF-1.7", http.StatusOK, "pdf:%PDF-1.7"),
+		Entry("unknown format", "plain text", http.StatusOK, ""),
+	)
+})
+
+var _ = Describe("Routes with named capture groups", func() {
+	mux := &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.PathPattern("/users/(?P<name>[a-z]+)").IsHandledBy(respondWith("user-")),
+			minimux.LazyPathWithVars("/groups/(?P<name>[a-z]+)").IsHandledBy(respondWith("group-")),
+			minimux.PathWithVars("/(teams|orgs)/(?P<name>[a-z]+)").IsHandledBy(respondWith("team-")),
+			minimux.PathWithVars("/roles/(?P<id>[a-z]+)", "name").IsHandledBy(respondWith("role-")),
+		},
+	}
+
+	DescribeTable("should name the variables after the groups",
+		func(path, expectedBody string) {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "http://localhost"+path, nil))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("PathPattern", "/users/bob", "user-bob"),
+		Entry("LazyPathWithVars", "/groups/admins", "group-admins"),
+		Entry("with unnamed groups", "/orgs/acme", "team-acme"),
+		Entry("with explicit names", "/roles/reader", "role-reader"),
+	)
+})
@@ -0,0 +1,77 @@
+package minimux
+
+import (
+	"slices"
+	"time"
+)
+
+// A Schedule decides when a route is available
+type Schedule interface {
+	// Open returns true if the route is available at a time
+	Open(t time.Time) bool
+}
+
+// ScheduleFunc wraps a function into a Schedule
+type ScheduleFunc func(t time.Time) bool
+
+// Open implements Schedule
+func (f ScheduleFunc) Open(t time.Time) bool {
+	return f(t)
+}
+
+// A TimeWindow is a daily period of time in a time zone, such as business hours
+type TimeWindow struct {
+	// Days are the days the window opens on. If empty, it opens every day.
+	Days []time.Weekday
+	// Start is when the window opens, as the time since midnight, e.g. 9 * time.Hour
+	Start time.Duration
+	// End is when the window closes, as the time since midnight. If it is before Start, the window closes the next day.
+	End time.Duration
+	// Location is the time zone of the window. If nil, UTC is used.
+	Location *time.Location
+}
+
+// Open implements Schedule
+func (w TimeWindow) Open(t time.Time) bool {
+	location := w.Location
+	if location == nil {
+		location = time.UTC
+	}
+	t = t.In(location)
+	year, month, day := t.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, location)
+	sinceMidnight := t.Sub(midnight)
+	if w.Start <= w.End {
+		return w.opensOn(t.Weekday()) && sinceMidnight >= w.Start && sinceMidnight < w.End
+	}
+	// The window spans midnight, so it is either in the part which opened today, or yesterday
+	yesterday := midnight.AddDate(0, 0, -1).Weekday()
+	return (w.opensOn(t.Weekday()) && sinceMidnight >= w.Start) || (w.opensOn(yesterday) && sinceMidnight < w.End)
+}
+
+func (w TimeWindow) opensOn(day time.Weekday) bool {
+	return len(w.Days) == 0 || slices.Contains(w.Days, day)
+}
+
+// TimeWindows is a Schedule which is open during any of a set of windows
+type TimeWindows []TimeWindow
+
+// Open implements Schedule
+func (w TimeWindows) Open(t time.Time) bool {
+	for _, window := range w {
+		if window.Open(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// BusinessHours returns a TimeWindow from 9 AM to 5 PM, Monday to Friday, in a time zone
+func BusinessHours(location *time.Location) TimeWindow {
+	return TimeWindow{
+		Days:     []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start:    9 * time.Hour,
+		End:      17 * time.Hour,
+		Location: location,
+	}
+}
@@ -0,0 +1,58 @@
+package minimux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TimeWindows", func() {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		newYork = time.FixedZone("EST", -5*60*60)
+	}
+	schedule := minimux.TimeWindows{
+		minimux.BusinessHours(newYork),
+		// Saturday night batch window
+		{Days: []time.Weekday{time.Saturday}, Start: 22 * time.Hour, End: 2 * time.Hour},
+	}
+	DescribeTable("should be open during any window",
+		func(t time.Time, open bool) {
+			Expect(schedule.Open(t)).To(Equal(open))
+		},
+		// 2024-01-08 is a Monday
+		Entry("weekday morning in the time zone", time.Date(2024, 1, 8, 15, 0, 0, 0, time.UTC), true),
+		Entry("weekday morning in UTC only", time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC), false),
+		Entry("closing time", time.Date(2024, 1, 8, 17, 0, 0, 0, newYork), false),
+		Entry("weekend", time.Date(2024, 1, 13, 12, 0, 0, 0, newYork), false),
+		Entry("Saturday night", time.Date(2024, 1, 13, 23, 0, 0, 0, time.UTC), true),
+		Entry("early Sunday", time.Date(2024, 1, 14, 1, 0, 0, 0, time.UTC), true),
+		Entry("early Monday", time.Date(2024, 1, 15, 1, 0, 0, 0, time.UTC), false),
+	)
+})
+
+var _ = Describe("A route with a schedule", func() {
+	var open bool
+	schedule := minimux.ScheduleFunc(func(time.Time) bool { return open })
+	mux := &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/trade").
+				AvailableWhen(schedule, minimux.NewStaticString("closed", "text/plain")).
+				IsHandledBy(minimux.NewStaticString("open", "text/plain")),
+			minimux.LiteralPath("/batch").AvailableWhen(schedule, nil).IsHandledBy(minimux.NewStaticString("open", "text/plain")),
+		},
+	}
+	It("should use the fallback handler outside the schedule", func() {
+		open = true
+		Expect(serve(mux, httptest.NewRequest(http.MethodGet, "/trade", nil)).Body.String()).To(Equal("open"))
+		Expect(serve(mux, httptest.NewRequest(http.MethodGet, "/batch", nil)).Code).To(Equal(http.StatusOK))
+		open = false
+		Expect(serve(mux, httptest.NewRequest(http.MethodGet, "/trade", nil)).Body.String()).To(Equal("closed"))
+		Expect(serve(mux, httptest.NewRequest(http.MethodGet, "/batch", nil)).Code).To(Equal(http.StatusServiceUnavailable))
+	})
+})
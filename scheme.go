@@ -0,0 +1,64 @@
+package minimux
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// WithSchemes limits a handler to requests made with one of a set of schemes, such as "https" to require TLS.
+// Other matching requests are answered by the InsecureHandler of the Mux if they were made over plain HTTP
+// when HTTPS is allowed, or with 403 Forbidden otherwise.
+func (r *Route) WithSchemes(schemes ...string) *Route {
+	if r.Schemes == nil {
+		r.Schemes = StringSet{}
+	}
+	for _, scheme := range schemes {
+		r.Schemes[strings.ToLower(scheme)] = struct{}{}
+	}
+	return r
+}
+
+// RedirectToHTTPS is a handler, such as for InsecureHandler, which redirects requests to the same URL with the
+// https scheme, with 301 Moved Permanently for GET and HEAD requests, and 308 Permanent Redirect for others,
+// so that their method and body are kept
+var RedirectToHTTPS Handler = HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	code := http.StatusPermanentRedirect
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	http.Redirect(w, req, "https://"+req.Host+req.URL.RequestURI(), code)
+	return nil
+})
+
+// scheme returns the scheme a request was made with, "https" if it was made over TLS, or, if TrustForwardedProto
+// is set, the X-Forwarded-Proto header says it was, or "http" otherwise
+func (m innerMux) scheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https"
+	}
+	if m.TrustForwardedProto {
+		// Proxies append to the header, so the first value is from the proxy the client connected to
+		proto, _, _ := strings.Cut(req.Header.Get("X-Forwarded-Proto"), ",")
+		if proto = strings.ToLower(strings.TrimSpace(proto)); proto != "" {
+			return proto
+		}
+	}
+	return "http"
+}
+
+// checkScheme answers a request which was made with a scheme other than those allowed, such as plain HTTP
+// when RequireTLS is set, and returns true if it did
+func (m innerMux) checkScheme(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, schemes StringSet) (bool, error) {
+	scheme := m.scheme(req)
+	if schemes.Has(scheme) {
+		return false, nil
+	}
+	if scheme == "http" && schemes.Has("https") && m.InsecureHandler != nil {
+		return true, m.InsecureHandler.ServeHTTP(ctx, w, req, pathVars, nil)
+	}
+	return true, m.writeStatus(ctx, w, req, http.StatusForbidden)
+}
+
+// httpsOnly is the set of schemes allowed when RequireTLS is set
+var httpsOnly = StringSet{"https": {}}
@@ -0,0 +1,74 @@
+package minimux_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scheme requirements", func() {
+	request := func(method, url string, tlsConn bool, forwardedProto string) *http.Request {
+		req := httptest.NewRequest(method, url, nil)
+		if !tlsConn {
+			req.TLS = nil
+		} else if req.TLS == nil {
+			req.TLS = &tls.ConnectionState{}
+		}
+		if forwardedProto != "" {
+			req.Header.Set("X-Forwarded-Proto", forwardedProto)
+		}
+		return req
+	}
+
+	Context("on a route", func() {
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/login").WithSchemes("https").IsHandledBy(minimux.NewStaticString("login", "text/plain")),
+				minimux.LiteralPath("/legacy").WithSchemes("http").IsHandledBy(minimux.NewStaticString("legacy", "text/plain")),
+				minimux.LiteralPath("/").IsHandledBy(minimux.NewStaticString("home", "text/plain")),
+			},
+		}
+
+		DescribeTable("should only handle requests with its schemes",
+			func(path string, tlsConn bool, expectedStatus int) {
+				resp := serve(mux, request(http.MethodGet, "http://example.com"+path, tlsConn, "https"))
+				Expect(resp.Code).To(Equal(expectedStatus))
+			},
+			Entry("TLS", "/login", true, http.StatusOK),
+			Entry("plain HTTP, ignoring the untrusted header", "/login", false, http.StatusForbidden),
+			Entry("plain HTTP only", "/legacy", false, http.StatusOK),
+			Entry("TLS on a plain HTTP only route", "/legacy", true, http.StatusForbidden),
+			Entry("any scheme", "/", false, http.StatusOK),
+		)
+	})
+
+	Context("on a mux", func() {
+		mux := &minimux.Mux{
+			RequireTLS:          true,
+			TrustForwardedProto: true,
+			InsecureHandler:     minimux.RedirectToHTTPS,
+			Routes: []minimux.Route{
+				minimux.PathPattern("/.*").IsHandledBy(minimux.NewStaticString("ok", "text/plain")),
+			},
+		}
+
+		DescribeTable("should redirect plain HTTP requests",
+			func(method string, tlsConn bool, forwardedProto string, expectedStatus int, expectedLocation string) {
+				resp := serve(mux, request(method, "http://example.com/a?b=c", tlsConn, forwardedProto))
+				Expect(resp.Code).To(Equal(expectedStatus))
+				Expect(resp.Header().Get("Location")).To(Equal(expectedLocation))
+			},
+			Entry("TLS", http.MethodGet, true, "", http.StatusOK, ""),
+			Entry("TLS terminated by a proxy", http.MethodGet, false, "https", http.StatusOK, ""),
+			Entry("TLS terminated by the first of several proxies", http.MethodGet, false, "HTTPS, http", http.StatusOK, ""),
+			Entry("plain HTTP through a proxy", http.MethodGet, false, "http", http.StatusMovedPermanently, "https://example.com/a?b=c"),
+			Entry("plain HTTP GET", http.MethodGet, false, "", http.StatusMovedPermanently, "https://example.com/a?b=c"),
+			Entry("plain HTTP POST", http.MethodPost, false, "", http.StatusPermanentRedirect, "https://example.com/a?b=c"),
+		)
+	})
+})
@@ -0,0 +1,288 @@
+package minimux
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultSessionMaxAge is how long a session lasts if CookieSessions.MaxAge is not set
+const DefaultSessionMaxAge = 12 * time.Hour
+
+var (
+	// ErrNoSession is returned when loading a session from a request which does not have one
+	ErrNoSession = errors.New("no session")
+	// ErrInvalidSession is returned when loading a session from a cookie which was tampered with or has expired
+	ErrInvalidSession = errors.New("invalid session")
+)
+
+// CookieSessions stores session values in signed cookies, so that clients can read, but not modify, them,
+// or, if EncryptionKeys are set, in encrypted cookies, so that clients can do neither
+type CookieSessions struct {
+	// Name is the name of the cookie
+	Name string
+	// Key is the secret key used to sign the cookie. If EncryptionKeys are set, it is only used to accept
+	// signed cookies from before encryption was enabled.
+	Key []byte
+	// EncryptionKeys are optional AES keys, of 16, 24, or 32 bytes, which encrypt and authenticate the cookie with AES-GCM.
+	// The first key encrypts new cookies, and any key decrypts them, so keys can be rotated by adding a new key
+	// to the front, and removing the last once the sessions it encrypted have expired or been rewrapped by LoadAndRewrap.
+	EncryptionKeys [][]byte
+	// MaxAge is how long a session lasts. If zero, DefaultSessionMaxAge is used.
+	MaxAge time.Duration
+	// Path is the path of the cookie. If empty, "/" is used.
+	Path string
+	// Domain is the optional domain of the cookie
+	Domain string
+	// Insecure allows the cookie to be sent over plaintext connections
+	Insecure bool
+	// SameSite is the SameSite mode of the cookie. If zero, http.SameSiteLaxMode is used.
+	SameSite http.SameSite
+}
+
+// sessionEnvelope is the signed contents of a session cookie
+type sessionEnvelope struct {
+	Expires int64           `json:"exp"`
+	Value   json.RawMessage `json:"v"`
+}
+
+func (c *CookieSessions) maxAge() time.Duration {
+	if c.MaxAge == 0 {
+		return DefaultSessionMaxAge
+	}
+	return c.MaxAge
+}
+
+func (c *CookieSessions) cookie(value string, maxAge time.Duration) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   !c.Insecure,
+		HttpOnly: true,
+		SameSite: c.SameSite,
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	if cookie.SameSite == 0 {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// sign returns the signature of a payload. The cookie name is signed along with it, as it is authenticated when
+// encrypting, so that a cookie can't be replayed as another.
+func (c *CookieSessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.Key)
+	mac.Write([]byte(c.Name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// derived returns sessions stored in another cookie, whose keys are derived from these keys for a purpose,
+// so that neither cookie can be accepted in place of the other, even if their names were the same
+func (c *CookieSessions) derived(suffix string) *CookieSessions {
+	sessions := *c
+	sessions.Name += suffix
+	if len(c.Key) != 0 {
+		sessions.Key = deriveKey(c.Key, suffix)
+	}
+	sessions.EncryptionKeys = make([][]byte, len(c.EncryptionKeys))
+	for ix, key := range c.EncryptionKeys {
+		sessions.EncryptionKeys[ix] = deriveKey(key, suffix)[:min(len(key), sha256.Size)]
+	}
+	return &sessions
+}
+
+// deriveKey derives a key for a purpose from another key
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("minimux session key\x00" + purpose))
+	return mac.Sum(nil)
+}
+
+// keyID identifies an encryption key in a cookie, so that only that key needs to be tried to decrypt it
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return base64.RawURLEncoding.EncodeToString(sum[:4])
+}
+
+// encryptedPrefix starts the value of encrypted cookies, which signed cookies, being base64, can not contain
+const encryptedPrefix = "e."
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encode returns the signed or encrypted cookie value for a session value, which is encoded as JSON
+func (c *CookieSessions) Encode(value any) (string, error) {
+	encodedValue, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return c.encodeEnvelope(sessionEnvelope{
+		Expires: time.Now().Add(c.maxAge()).Unix(),
+		Value:   encodedValue,
+	})
+}
+
+func (c *CookieSessions) encodeEnvelope(envelope sessionEnvelope) (string, error) {
+	envelopeBytes, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+	if len(c.EncryptionKeys) == 0 {
+		payload := base64.RawURLEncoding.EncodeToString(envelopeBytes)
+		return payload + "." + c.sign(payload), nil
+	}
+	gcm, err := newGCM(c.EncryptionKeys[0])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(envelopeBytes)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	// The cookie name is authenticated so that a cookie can't be replayed as another
+	sealed := gcm.Seal(nonce, nonce, envelopeBytes, []byte(c.Name))
+	return encryptedPrefix + keyID(c.EncryptionKeys[0]) + "." + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decode verifies or decrypts a cookie value and decodes the session value from it
+func (c *CookieSessions) Decode(cookieValue string, value any) error {
+	envelope, _, err := c.decodeEnvelope(cookieValue)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(envelope.Value, value)
+}
+
+// decodeEnvelope verifies or decrypts a cookie value, and returns true if it should be rewrapped
+// because it was not encrypted with the current key
+func (c *CookieSessions) decodeEnvelope(cookieValue string) (envelope sessionEnvelope, stale bool, err error) {
+	var envelopeBytes []byte
+	if encrypted, ok := strings.CutPrefix(cookieValue, encryptedPrefix); ok {
+		envelopeBytes, stale, err = c.decrypt(encrypted)
+	} else {
+		envelopeBytes, err = c.verify(cookieValue)
+		stale = len(c.EncryptionKeys) != 0
+	}
+	if err != nil {
+		return envelope, false, err
+	}
+	if err := json.Unmarshal(envelopeBytes, &envelope); err != nil {
+		return envelope, false, ErrInvalidSession
+	}
+	if time.Now().Unix() >= envelope.Expires {
+		return envelope, false, ErrInvalidSession
+	}
+	return envelope, stale, nil
+}
+
+func (c *CookieSessions) verify(cookieValue string) ([]byte, error) {
+	payload, signature, ok := strings.Cut(cookieValue, ".")
+	if !ok || len(c.Key) == 0 || !hmac.Equal([]byte(signature), []byte(c.sign(payload))) {
+		return nil, ErrInvalidSession
+	}
+	envelopeBytes, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	return envelopeBytes, nil
+}
+
+func (c *CookieSessions) decrypt(encrypted string) (envelopeBytes []byte, stale bool, err error) {
+	id, data, ok := strings.Cut(encrypted, ".")
+	if !ok {
+		return nil, false, ErrInvalidSession
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, false, ErrInvalidSession
+	}
+	for ix, key := range c.EncryptionKeys {
+		if keyID(key) != id {
+			continue
+		}
+		gcm, err := newGCM(key)
+		if err != nil || len(sealed) < gcm.NonceSize() {
+			return nil, false, ErrInvalidSession
+		}
+		envelopeBytes, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(c.Name))
+		if err != nil {
+			return nil, false, ErrInvalidSession
+		}
+		return envelopeBytes, ix != 0, nil
+	}
+	return nil, false, ErrInvalidSession
+}
+
+// Save sets the session cookie of a response to a session value
+func (c *CookieSessions) Save(w http.ResponseWriter, value any) error {
+	cookieValue, err := c.Encode(value)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, c.cookie(cookieValue, c.maxAge()))
+	return nil
+}
+
+// Load decodes the session value from the session cookie of a request, returning ErrNoSession if there isn't one,
+// or ErrInvalidSession if it was tampered with or has expired
+func (c *CookieSessions) Load(req *http.Request, value any) error {
+	cookie, err := req.Cookie(c.Name)
+	if err != nil {
+		return ErrNoSession
+	}
+	return c.Decode(cookie.Value, value)
+}
+
+// LoadAndRewrap is like Load, but if the session cookie was not encrypted with the current key, because keys
+// have been rotated or encryption was enabled since it was saved, it is replaced by one which is, without
+// changing when it expires. Using this instead of Load moves active sessions onto new keys as they are used.
+func (c *CookieSessions) LoadAndRewrap(w http.ResponseWriter, req *http.Request, value any) error {
+	cookie, err := req.Cookie(c.Name)
+	if err != nil {
+		return ErrNoSession
+	}
+	envelope, stale, err := c.decodeEnvelope(cookie.Value)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(envelope.Value, value); err != nil {
+		return err
+	}
+	if !stale {
+		return nil
+	}
+	cookieValue, err := c.encodeEnvelope(envelope)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, c.cookie(cookieValue, time.Until(time.Unix(envelope.Expires, 0))))
+	return nil
+}
+
+// Clear removes the session cookie from the client
+func (c *CookieSessions) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, c.cookie("", -1))
+}
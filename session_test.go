@@ -0,0 +1,103 @@
+package minimux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CookieSessions", func() {
+	sessions := &minimux.CookieSessions{Name: "session", Key: []byte("key")}
+	oldKey := []byte("0123456789abcdef0123456789abcdef")
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+
+	// requestWith returns a request with the cookies set by a response
+	requestWith := func(resp *httptest.ResponseRecorder) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "https://localhost/", nil)
+		for _, cookie := range resp.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+		return req
+	}
+
+	It("should load saved values", func() {
+		resp := httptest.NewRecorder()
+		Expect(sessions.Save(resp, map[string]string{"user": "alice"})).To(Succeed())
+		var value map[string]string
+		Expect(sessions.Load(requestWith(resp), &value)).To(Succeed())
+		Expect(value).To(Equal(map[string]string{"user": "alice"}))
+	})
+	It("should reject values signed with another key", func() {
+		other := &minimux.CookieSessions{Name: "session", Key: []byte("other")}
+		cookieValue, err := other.Encode("alice")
+		Expect(err).ToNot(HaveOccurred())
+		var value string
+		Expect(sessions.Decode(cookieValue, &value)).To(MatchError(minimux.ErrInvalidSession))
+	})
+	It("should reject values signed for another cookie", func() {
+		other := &minimux.CookieSessions{Name: "session-login", Key: []byte("key")}
+		cookieValue, err := other.Encode("alice")
+		Expect(err).ToNot(HaveOccurred())
+		var value string
+		Expect(sessions.Decode(cookieValue, &value)).To(MatchError(minimux.ErrInvalidSession))
+	})
+	It("should encrypt values", func() {
+		encrypted := &minimux.CookieSessions{Name: "session", EncryptionKeys: [][]byte{newKey}}
+		cookieValue, err := encrypted.Encode("alice")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cookieValue).ToNot(ContainSubstring("YWxpY2"), "The value was not encrypted")
+		var value string
+		Expect(encrypted.Decode(cookieValue, &value)).To(Succeed())
+		Expect(value).To(Equal("alice"))
+
+		mid := len(cookieValue) / 2
+		replacement := "A"
+		if cookieValue[mid] == 'A' {
+			replacement = "B"
+		}
+		tampered := cookieValue[:mid] + replacement + cookieValue[mid+1:]
+		Expect(encrypted.Decode(tampered, &value)).To(MatchError(minimux.ErrInvalidSession))
+
+		renamed := &minimux.CookieSessions{Name: "other", EncryptionKeys: [][]byte{newKey}}
+		Expect(renamed.Decode(cookieValue, &value)).To(MatchError(minimux.ErrInvalidSession))
+	})
+	It("should rewrap sessions onto the newest key", func() {
+		before := &minimux.CookieSessions{Name: "session", EncryptionKeys: [][]byte{oldKey}}
+		after := &minimux.CookieSessions{Name: "session", EncryptionKeys: [][]byte{newKey, oldKey}}
+		retired := &minimux.CookieSessions{Name: "session", EncryptionKeys: [][]byte{newKey}}
+
+		resp := httptest.NewRecorder()
+		Expect(before.Save(resp, "alice")).To(Succeed())
+		req := requestWith(resp)
+		var value string
+		Expect(retired.Load(req, &value)).To(MatchError(minimux.ErrInvalidSession))
+
+		resp = httptest.NewRecorder()
+		Expect(after.LoadAndRewrap(resp, req, &value)).To(Succeed())
+		Expect(value).To(Equal("alice"))
+		Expect(resp.Result().Cookies()).To(HaveLen(1), "The session was not rewrapped")
+
+		value = ""
+		req = requestWith(resp)
+		Expect(retired.Load(req, &value)).To(Succeed())
+		Expect(value).To(Equal("alice"))
+
+		resp = httptest.NewRecorder()
+		Expect(retired.LoadAndRewrap(resp, req, &value)).To(Succeed())
+		Expect(resp.Result().Cookies()).To(BeEmpty(), "A current session was rewrapped")
+	})
+	It("should upgrade signed sessions once encryption is enabled", func() {
+		resp := httptest.NewRecorder()
+		Expect(sessions.Save(resp, "alice")).To(Succeed())
+		upgraded := &minimux.CookieSessions{Name: "session", Key: []byte("key"), EncryptionKeys: [][]byte{newKey}}
+		resp2 := httptest.NewRecorder()
+		var value string
+		Expect(upgraded.LoadAndRewrap(resp2, requestWith(resp), &value)).To(Succeed())
+		Expect(value).To(Equal("alice"))
+		Expect(resp2.Result().Cookies()[0].Value).To(HavePrefix("e."))
+	})
+})
@@ -0,0 +1,59 @@
+package minimux
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// BodySniffBytes is how many bytes of the body of a request are read ahead for routes which check its Body
+const BodySniffBytes = 512
+
+// peekedBody is the body of a request whose first bytes have been read ahead, and are read again first
+type peekedBody struct {
+	io.Reader
+	io.Closer
+	prefix []byte
+}
+
+// peekBody returns the first bytes of the body of a request, up to BodySniffBytes, replacing the body so that
+// they are read again. Reading them again for another route does not read any more of the body.
+func peekBody(req *http.Request) []byte {
+	if peeked, ok := req.Body.(*peekedBody); ok {
+		return peeked.prefix
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	prefix := make([]byte, BodySniffBytes)
+	n, _ := io.ReadFull(req.Body, prefix)
+	prefix = prefix[:n]
+	req.Body = &peekedBody{Reader: io.MultiReader(bytes.NewReader(prefix), req.Body), Closer: req.Body, prefix: prefix}
+	return prefix
+}
+
+// trimBOMAndSpace removes a UTF-8 byte order mark and whitespace from the start of a body
+func trimBOMAndSpace(prefix []byte) []byte {
+	return bytes.TrimLeft(bytes.TrimPrefix(prefix, []byte("\xef\xbb\xbf")), " \t\r\n")
+}
+
+// LooksLikeJSON is a function for Route.WithBody which accepts bodies which begin with a JSON object or array
+func LooksLikeJSON(prefix []byte) bool {
+	prefix = trimBOMAndSpace(prefix)
+	return len(prefix) != 0 && (prefix[0] == '{' || prefix[0] == '[')
+}
+
+// LooksLikeXML is a function for Route.WithBody which accepts bodies which begin with an XML declaration or element
+func LooksLikeXML(prefix []byte) bool {
+	prefix = trimBOMAndSpace(prefix)
+	return len(prefix) > 1 && prefix[0] == '<' && (prefix[1] == '?' || prefix[1] == '!' || prefix[1] == '_' ||
+		(prefix[1]|0x20 >= 'a' && prefix[1]|0x20 <= 'z') || prefix[1] >= 0x80)
+}
+
+// BodyHasPrefix returns a function for Route.WithBody which accepts bodies which begin with some bytes,
+// such as the magic number of a file format
+func BodyHasPrefix(magic []byte) func(prefix []byte) bool {
+	return func(prefix []byte) bool {
+		return bytes.HasPrefix(prefix, magic)
+	}
+}
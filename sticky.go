@@ -0,0 +1,126 @@
+package minimux
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+)
+
+// DefaultStickyCookie is the cookie StickyBackends pins clients with, if neither its Cookie nor PathVar is set
+const DefaultStickyCookie = "backend"
+
+// ErrNoHealthyBackend is returned when every backend is unhealthy
+var ErrNoHealthyBackend = errors.New("no healthy backend")
+
+// StickyBackends balances requests across stateful backends, sending each client, or each value of a path variable,
+// such as a tenant or document ID, to the same backend while it is healthy. Backends are ranked for each key by
+// rendezvous hashing, so that when a backend fails, or is added or removed, only the keys pinned to it move,
+// and they move to their next-ranked healthy backend.
+type StickyBackends struct {
+	// Backends are the base URLs of the backends
+	Backends []*url.URL
+	// Healthy is an optional function which returns false for backends which should not receive requests
+	Healthy func(backend *url.URL) bool
+	// PathVar, if set, is the path variable to pin requests by, instead of a cookie.
+	// Requests without the variable are pinned by cookie.
+	PathVar string
+	// Cookie is the name of the cookie which pins a client to a backend. If empty, DefaultStickyCookie is used.
+	Cookie string
+	// Insecure allows the cookie to be sent over plaintext connections
+	Insecure bool
+	// Transport sends requests to the backends. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	once    sync.Once
+	proxies map[string]*httputil.ReverseProxy
+}
+
+// backendID identifies a backend in a cookie without revealing its address
+func backendID(backend *url.URL) string {
+	sum := sha256.Sum256([]byte(backend.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *StickyBackends) healthy(backend *url.URL) bool {
+	return s.Healthy == nil || s.Healthy(backend)
+}
+
+// rank returns the healthy backend which ranks highest for a key
+func (s *StickyBackends) rank(key string) *url.URL {
+	var best *url.URL
+	var bestScore uint64
+	for _, backend := range s.Backends {
+		if !s.healthy(backend) {
+			continue
+		}
+		sum := sha256.Sum256([]byte(key + "\x00" + backend.String()))
+		if score := binary.BigEndian.Uint64(sum[:]); best == nil || score > bestScore {
+			best, bestScore = backend, score
+		}
+	}
+	return best
+}
+
+// Pick returns the backend for a request, setting the cookie which pins the client to it if needed,
+// or ErrNoHealthyBackend if none are healthy
+func (s *StickyBackends) Pick(w http.ResponseWriter, req *http.Request, pathVars map[string]string) (*url.URL, error) {
+	if value, ok := pathVars[s.PathVar]; s.PathVar != "" && ok {
+		if backend := s.rank(value); backend != nil {
+			return backend, nil
+		}
+		return nil, ErrNoHealthyBackend
+	}
+	name := s.Cookie
+	if name == "" {
+		name = DefaultStickyCookie
+	}
+	key := req.RemoteAddr
+	if cookie, err := req.Cookie(name); err == nil {
+		for _, backend := range s.Backends {
+			if backendID(backend) == cookie.Value && s.healthy(backend) {
+				return backend, nil
+			}
+		}
+		// The pinned backend is unhealthy or gone, so fail over consistently
+		key = cookie.Value
+	}
+	backend := s.rank(key)
+	if backend == nil {
+		return nil, ErrNoHealthyBackend
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    backendID(backend),
+		Path:     "/",
+		Secure:   !s.Insecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return backend, nil
+}
+
+// ServeHTTP implements Handler by proxying the request to the backend chosen by Pick,
+// or answering with 503 Service Unavailable if none are healthy
+func (s *StickyBackends) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	s.once.Do(func() {
+		s.proxies = make(map[string]*httputil.ReverseProxy, len(s.Backends))
+		for _, backend := range s.Backends {
+			proxy := httputil.NewSingleHostReverseProxy(backend)
+			proxy.Transport = s.Transport
+			s.proxies[backend.String()] = proxy
+		}
+	})
+	backend, err := s.Pick(w, req, pathVars)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return err
+	}
+	s.proxies[backend.String()].ServeHTTP(w, req.WithContext(ctx))
+	return nil
+}
@@ -0,0 +1,92 @@
+package minimux_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StickyBackends", func() {
+	var backends []*url.URL
+	var down map[string]bool
+	var sticky *minimux.StickyBackends
+	var mux *minimux.Mux
+	BeforeEach(func() {
+		backends = nil
+		down = map[string]bool{}
+		for ix := 0; ix < 3; ix++ {
+			name := fmt.Sprintf("backend-%d", ix)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte(name))
+			}))
+			DeferCleanup(srv.Close)
+			u, err := url.Parse(srv.URL)
+			Expect(err).ToNot(HaveOccurred())
+			backends = append(backends, u)
+		}
+		sticky = &minimux.StickyBackends{
+			Backends: backends,
+			Healthy:  func(backend *url.URL) bool { return !down[backend.String()] },
+			PathVar:  "doc",
+			Insecure: true,
+		}
+		mux = &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/docs/([^/]+)", "doc").IsHandledBy(sticky),
+				minimux.PathPattern("/.*").IsHandledBy(sticky),
+			},
+		}
+	})
+
+	get := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return serve(mux, req)
+	}
+
+	It("should pin clients to a backend by cookie, failing over when it is unhealthy", func() {
+		resp := get("/")
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		cookies := resp.Result().Cookies()
+		Expect(cookies).To(HaveLen(1))
+		pinned := resp.Body.String()
+		for ix := 0; ix < 5; ix++ {
+			Expect(get("/", cookies...).Body.String()).To(Equal(pinned))
+		}
+
+		var ix int
+		fmt.Sscanf(pinned, "backend-%d", &ix)
+		down[backends[ix].String()] = true
+		failover := get("/", cookies...)
+		Expect(failover.Body.String()).ToNot(Equal(pinned))
+		Expect(failover.Result().Cookies()).To(HaveLen(1))
+		Expect(get("/", failover.Result().Cookies()...).Body.String()).To(Equal(failover.Body.String()))
+	})
+
+	It("should pin path variables to a backend", func() {
+		first := get("/docs/42").Body.String()
+		for ix := 0; ix < 5; ix++ {
+			Expect(get("/docs/42").Body.String()).To(Equal(first))
+		}
+		spread := map[string]bool{}
+		for ix := 0; ix < 30; ix++ {
+			spread[get(fmt.Sprintf("/docs/%d", ix)).Body.String()] = true
+		}
+		Expect(spread).To(HaveLen(3))
+	})
+
+	It("should answer 503 when every backend is unhealthy", func() {
+		for _, backend := range backends {
+			down[backend.String()] = true
+		}
+		Expect(get("/docs/42").Code).To(Equal(http.StatusServiceUnavailable))
+	})
+})
@@ -0,0 +1,53 @@
+package minimux
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// A Switchable is a handler which calls another that can be replaced at any time, even while serving requests,
+// such as to swap an entire subtree between blue and green implementations without changing any routes.
+// Requests which are already being served continue with the handler they started with.
+// Until a handler is set, requests are answered with 503 Service Unavailable.
+type Switchable struct {
+	current atomic.Pointer[switchableHandler]
+}
+
+// switchableHandler holds a Handler, which may be of any type, so it can be stored atomically
+type switchableHandler struct {
+	handler Handler
+}
+
+// NewSwitchable returns a Switchable which starts by calling a handler
+func NewSwitchable(handler Handler) *Switchable {
+	s := &Switchable{}
+	s.Set(handler)
+	return s
+}
+
+// Set replaces the handler to call, returning the previous one
+func (s *Switchable) Set(handler Handler) (previous Handler) {
+	if old := s.current.Swap(&switchableHandler{handler: handler}); old != nil {
+		return old.handler
+	}
+	return nil
+}
+
+// Get returns the handler being called
+func (s *Switchable) Get() Handler {
+	if current := s.current.Load(); current != nil {
+		return current.handler
+	}
+	return nil
+}
+
+// ServeHTTP implements Handler
+func (s *Switchable) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	handler := s.Get()
+	if handler == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return nil
+	}
+	return handler.ServeHTTP(ctx, w, req, pathVars, formErr)
+}
@@ -0,0 +1,503 @@
+package minimux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A RouteTable is an immutable index over a set of Routes which avoids evaluating the pattern of every
+// route for every request, while still selecting the first matching route in declaration order.
+type RouteTable struct {
+	// source is the slice of routes this table was built from
+	source []Route
+	// pinned indicates that this table was built explicitly, and should not be rebuilt if Routes changes
+	pinned bool
+	// err is why the routes could not be built into a table, for a table built automatically from invalid routes,
+	// which has no routes
+	err error
+	// routes is a copy of the routes this table was built from
+	routes []Route
+	// literals maps exact paths to the indexes of the routes whose patterns match only that path,
+	// in declaration order
+	literals map[string][]int
+	// literalAllow maps exact paths to the methods allowed by the routes in literals without any hosts
+	literalAllow map[string]allowedMethods
+	// segments maps the first segment of a path to the routes whose patterns can only
+	// match paths which start with that segment
+	segments map[string]*routeList
+	// trie finds the routes whose patterns are segment templates, without evaluating them
+	trie segmentTrie
+	// templates are the segment templates of the routes in trie, by index
+	templates []segmentTemplate
+	// patterns are the remaining routes
+	patterns routeList
+	// hosts is the union of the Hosts of every route
+	hosts StringSet
+	// hostPatterns are the HostPatterns of every route which has one
+	hostPatterns []*regexp.Regexp
+	// names maps the names of routes to their indexes
+	names map[string]int
+	// methods are the methods allowed by any route
+	methods allowedMethods
+	// wrapped are the handlers of the routes, wrapped in the Middleware of the Mux using this table, and their own
+	wrapped     []Handler
+	wrappedOnce sync.Once
+
+	// notFound remembers requests which matched no route, and whether any route matched their path
+	notFound     *boundedCache[matchKey, bool]
+	notFoundOnce sync.Once
+	// matched remembers the routes which matched requests
+	matched     *boundedCache[matchKey, matchResult]
+	matchedOnce sync.Once
+}
+
+// matchResult is a remembered route which matched a request, along with the values of its route variables
+type matchResult struct {
+	route  *Route
+	values []string
+}
+
+// allowedMethods is a set of methods, or any method
+type allowedMethods struct {
+	any     bool
+	methods StringSet
+}
+
+func (a *allowedMethods) add(methods StringSet) {
+	if methods == nil {
+		a.any = true
+		return
+	}
+	if a.methods == nil {
+		a.methods = StringSet{}
+	}
+	for method := range methods {
+		a.methods[method] = struct{}{}
+	}
+}
+
+// routeList is a list of routes which must have their patterns evaluated
+type routeList struct {
+	// indexes are the indexes of the routes, in declaration order
+	indexes []int
+	// combined is a single pattern which matches any path matched by the routes, or nil if there are too few
+	// routes for this to be worthwhile, or if any of their patterns are not anchored to the start of the path
+	combined *regexp.Regexp
+	// groups are the capture groups of combined which correspond to each route
+	groups []int
+}
+
+// compile builds the combined pattern for the list
+func (l *routeList) compile(routes []Route, analyses []patternAnalysis) {
+	if len(l.indexes) < 2 {
+		return
+	}
+	var b strings.Builder
+	group := 1
+	l.groups = make([]int, 0, len(l.indexes))
+	for ix, routeIx := range l.indexes {
+		pattern := routes[routeIx].Pattern
+		// Leftmost-first matching only selects the first matching alternative if they all start at the same position
+		if routes[routeIx].Matcher != nil || !analyses[routeIx].anchored {
+			l.groups = nil
+			return
+		}
+		if ix != 0 {
+			b.WriteString("|")
+		}
+		b.WriteString("(")
+		b.WriteString(pattern.String())
+		b.WriteString(")")
+		l.groups = append(l.groups, group)
+		group += 1 + pattern.NumSubexp()
+	}
+	combined, err := regexp.Compile(b.String())
+	if err != nil {
+		l.groups = nil
+		return
+	}
+	l.combined = combined
+}
+
+// candidates returns the indexes of the routes in the list which must be evaluated for a path.
+// Any routes which come before the first route to match the path are skipped.
+func (l *routeList) candidates(path string) []int {
+	if l.combined == nil {
+		return l.indexes
+	}
+	loc := l.combined.FindStringSubmatchIndex(path)
+	if loc == nil {
+		return nil
+	}
+	for ix, group := range l.groups {
+		if loc[2*group] != -1 {
+			return l.indexes[ix:]
+		}
+	}
+	return nil
+}
+
+// patternAnalysis describes which paths a pattern can match
+type patternAnalysis struct {
+	// anchored is true if the pattern can only match at the start of the path
+	anchored bool
+	// prefix is the literal string that all paths matched by the pattern must start with
+	prefix string
+	// complete is true if prefix is the only path the pattern can match
+	complete bool
+}
+
+// analyzePattern determines which paths a pattern can match
+func analyzePattern(pattern *regexp.Regexp) patternAnalysis {
+	re, err := syntax.Parse(pattern.String(), syntax.Perl)
+	if err != nil {
+		return patternAnalysis{}
+	}
+	re = re.Simplify()
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+	if len(subs) == 0 || subs[0].Op != syntax.OpBeginText {
+		return patternAnalysis{}
+	}
+	subs = subs[1:]
+	var b strings.Builder
+	for len(subs) != 0 && subs[0].Op == syntax.OpLiteral && subs[0].Flags&syntax.FoldCase == 0 {
+		b.WriteString(string(subs[0].Rune))
+		subs = subs[1:]
+	}
+	return patternAnalysis{
+		anchored: true,
+		prefix:   b.String(),
+		complete: len(subs) == 1 && subs[0].Op == syntax.OpEndText,
+	}
+}
+
+// parallelize calls a function for each index up to n, concurrently if there are enough of them to be worthwhile
+func parallelize(n int, f func(ix int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if n < 64 || workers == 1 {
+		for ix := 0; ix < n; ix++ {
+			f(ix)
+		}
+		return
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ix := int(next.Add(1) - 1); ix < n; ix = int(next.Add(1) - 1) {
+				f(ix)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// firstSegment returns the first segment of a path, and false if the path has no leading slash
+func firstSegment(path string) (string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return "", false
+	}
+	path = path[1:]
+	if ix := strings.IndexByte(path, '/'); ix != -1 {
+		path = path[:ix]
+	}
+	return path, true
+}
+
+// NewRouteTable builds a RouteTable from a copy of a set of routes, compiling the PatternSource of any
+// routes without a Pattern. The patterns are compiled and analyzed concurrently, and an error is returned
+// for every route without a valid pattern or Matcher.
+func NewRouteTable(routes []Route) (*RouteTable, error) {
+	t := &RouteTable{
+		source:       routes,
+		routes:       append([]Route(nil), routes...),
+		literals:     map[string][]int{},
+		literalAllow: map[string]allowedMethods{},
+		segments:     map[string]*routeList{},
+		hosts:        StringSet{},
+		names:        map[string]int{},
+	}
+	analyses := make([]patternAnalysis, len(t.routes))
+	t.templates = make([]segmentTemplate, len(t.routes))
+	errs := make([]error, len(t.routes))
+	parallelize(len(t.routes), func(ix int) {
+		r := &t.routes[ix]
+		if err := r.compile(); err != nil {
+			errs[ix] = fmt.Errorf("route %d: %w", ix, err)
+			return
+		}
+		if r.Matcher == nil {
+			analyses[ix] = analyzePattern(r.Pattern)
+			if !analyses[ix].complete {
+				t.templates[ix], _ = analyzeSegments(r.Pattern)
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	for ix := range t.routes {
+		r := &t.routes[ix]
+		if r.Name != "" {
+			if other, ok := t.names[r.Name]; ok {
+				return nil, fmt.Errorf("routes %d and %d are both named %q", other, ix, r.Name)
+			}
+			t.names[r.Name] = ix
+		}
+	}
+	linkAcceptRivals(t.routes)
+	for ix := range t.routes {
+		r := &t.routes[ix]
+		r.index = ix
+		t.methods.add(r.Methods)
+		for host := range r.Hosts {
+			t.hosts[host] = struct{}{}
+		}
+		if r.HostPattern != nil {
+			t.hostPatterns = append(t.hostPatterns, r.HostPattern)
+		}
+		if r.Matcher != nil {
+			t.patterns.indexes = append(t.patterns.indexes, ix)
+			continue
+		}
+		prefix := analyses[ix].prefix
+		if analyses[ix].complete {
+			t.literals[prefix] = append(t.literals[prefix], ix)
+			if r.anyHost() {
+				allow := t.literalAllow[prefix]
+				allow.add(r.Methods)
+				t.literalAllow[prefix] = allow
+			}
+			continue
+		}
+		if t.templates[ix].vars != 0 {
+			t.trie.insert(t.templates[ix], ix)
+			continue
+		}
+		// Only a prefix which contains a complete segment followed by a slash
+		// restricts which first segments the pattern can match
+		segment, ok := firstSegment(prefix)
+		if ok && len(prefix) > len(segment)+1 {
+			list, ok := t.segments[segment]
+			if !ok {
+				list = &routeList{}
+				t.segments[segment] = list
+			}
+			list.indexes = append(list.indexes, ix)
+			continue
+		}
+		t.patterns.indexes = append(t.patterns.indexes, ix)
+	}
+	lists := []*routeList{&t.patterns}
+	for _, list := range t.segments {
+		lists = append(lists, list)
+	}
+	parallelize(len(lists), func(ix int) {
+		lists[ix].compile(t.routes, analyses)
+	})
+	return t, nil
+}
+
+// hasHost returns true if a host, without any port and in lower case, is one of the Hosts of any route,
+// or matches any of their HostPatterns
+func (t *RouteTable) hasHost(host string) bool {
+	if t.hosts.Has(host) {
+		return true
+	}
+	for _, pattern := range t.hostPatterns {
+		if pattern.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Routes returns the routes in this table, in the order they are checked.
+// The returned slice must not be modified.
+func (t *RouteTable) Routes() []Route {
+	return t.routes
+}
+
+// notFoundCache returns the cache of requests which matched no route, creating it with the given size if needed
+func (t *RouteTable) notFoundCache(size int) *boundedCache[matchKey, bool] {
+	t.notFoundOnce.Do(func() { t.notFound = newBoundedCache[matchKey, bool](size) })
+	return t.notFound
+}
+
+// matchCache returns the cache of routes which matched requests, creating it with the given size if needed
+func (t *RouteTable) matchCache(size int) *boundedCache[matchKey, matchResult] {
+	t.matchedOnce.Do(func() { t.matched = newBoundedCache[matchKey, matchResult](size) })
+	return t.matched
+}
+
+// builtFrom returns true if this table was built from the given slice of routes
+func (t *RouteTable) builtFrom(routes []Route) bool {
+	if len(t.source) != len(routes) {
+		return false
+	}
+	return len(routes) == 0 || &t.source[0] == &routes[0]
+}
+
+// patternCandidates returns the indexes of the routes which aren't literals that must be evaluated for a request
+func (t *RouteTable) patternCandidates(req *http.Request) (segments []int, patterns []int) {
+	if segment, ok := firstSegment(req.URL.Path); ok {
+		if list, ok := t.segments[segment]; ok {
+			segments = list.candidates(req.URL.Path)
+		}
+	}
+	return segments, t.patterns.candidates(req.URL.Path)
+}
+
+// Match finds the first route which matches a request, along with the values of its capture groups.
+// If no route matches, but at least one route matched the host and path, methodNotAllowed is true.
+// Routes which are not Enabled for the request, given its context, whose Conditions do not hold, which do not offer
+// a media type it Accepts, whose variables are not valid for their VarTypes, or whose Body does not accept it, are skipped.
+func (t *RouteTable) Match(req *http.Request) (route *Route, varValues []string, methodNotAllowed bool) {
+	route, varValues, methodNotAllowed, _ = t.match(req.Context(), req)
+	return route, varValues, methodNotAllowed
+}
+
+// match finds the first route which matches a request, as with Match, and also returns true if any
+// routes which would have matched were skipped because they were not Enabled, their Conditions did not hold,
+// they did not offer a media type it Accepts, their variables were not valid, or their Body did not accept it
+func (t *RouteTable) match(ctx context.Context, req *http.Request) (route *Route, varValues []string, methodNotAllowed bool, skipped bool) {
+	literals := t.literals[req.URL.Path]
+	var buf [8]int
+	templates := t.trie.candidates(req.URL.Path, buf[:0])
+	segments, patterns := t.patternCandidates(req)
+	for len(literals) != 0 || len(templates) != 0 || len(segments) != 0 || len(patterns) != 0 {
+		var matches, notAllowed bool
+		var values []string
+		// Literals and templates always match the path, so they only need to be checked for host and method,
+		// but the routes from the other lists must have their patterns evaluated
+		ix, isLiteral := -1, false
+		if len(literals) != 0 {
+			ix, isLiteral = literals[0], true
+		}
+		if len(templates) != 0 && (ix == -1 || templates[0] < ix) {
+			ix, isLiteral = templates[0], true
+		}
+		if len(segments) != 0 && (ix == -1 || segments[0] < ix) {
+			ix, isLiteral = segments[0], false
+		}
+		if len(patterns) != 0 && (ix == -1 || patterns[0] < ix) {
+			ix, isLiteral = patterns[0], false
+		}
+		switch {
+		case len(literals) != 0 && literals[0] == ix:
+			literals = literals[1:]
+		case len(templates) != 0 && templates[0] == ix:
+			templates = templates[1:]
+		case len(segments) != 0 && segments[0] == ix:
+			segments = segments[1:]
+		default:
+			patterns = patterns[1:]
+		}
+		if isLiteral {
+			matches, notAllowed = t.routes[ix].matchesHostAndMethod(req)
+			if matches && t.templates[ix].vars != 0 {
+				values = t.templates[ix].values(req.URL.Path)
+			}
+		} else {
+			values, matches, notAllowed = t.routes[ix].Matches(req)
+		}
+		if (matches || notAllowed) && t.routes[ix].Enabled != nil && !t.routes[ix].Enabled(ctx, req) {
+			skipped = true
+			continue
+		}
+		if (matches || notAllowed) && (!t.routes[ix].conditionsHold(req) || (len(t.routes[ix].Accept) != 0 && !t.routes[ix].accepts(req))) {
+			skipped = true
+			continue
+		}
+		if matches && t.routes[ix].VarTypes != nil && !t.routes[ix].varsValid(values) {
+			skipped = true
+			continue
+		}
+		if matches && t.routes[ix].Body != nil && !t.routes[ix].Body(peekBody(req)) {
+			skipped = true
+			continue
+		}
+		if matches {
+			return &t.routes[ix], values, false, skipped
+		}
+		methodNotAllowed = methodNotAllowed || notAllowed
+	}
+	return nil, nil, methodNotAllowed, skipped
+}
+
+// handler returns the handler of a route in this table, wrapped in the Middleware of a Mux, which must be the same
+// every time, and its own
+func (t *RouteTable) handler(r *Route, middleware []Middleware) Handler {
+	if len(middleware) == 0 && len(r.Middleware) == 0 {
+		return r.Handler
+	}
+	t.wrappedOnce.Do(func() {
+		t.wrapped = make([]Handler, len(t.routes))
+		for ix := range t.routes {
+			t.wrapped[ix] = Chain(append(append([]Middleware(nil), middleware...), t.routes[ix].Middleware...)...)(t.routes[ix].Handler)
+		}
+	})
+	return t.wrapped[r.index]
+}
+
+// ServerMethods returns the set of methods accepted by any route, or false if any method may be accepted,
+// such as for an OPTIONS request for the whole server
+func (t *RouteTable) ServerMethods() (methods StringSet, ok bool) {
+	if t.methods.any {
+		return nil, false
+	}
+	methods = StringSet{}
+	for method := range t.methods.methods {
+		methods[method] = struct{}{}
+	}
+	return methods, true
+}
+
+// AllowedMethods returns the set of methods accepted by the routes which match the host and path of a request.
+// If any of those routes accepts any method, ok is false. Routes with a custom Matcher are assumed to accept
+// their Methods, if any, or any method otherwise.
+func (t *RouteTable) AllowedMethods(req *http.Request) (methods StringSet, ok bool) {
+	precomputed := t.literalAllow[req.URL.Path]
+	allow := allowedMethods{any: precomputed.any, methods: StringSet{}}
+	for method := range precomputed.methods {
+		allow.methods[method] = struct{}{}
+	}
+	for _, ix := range t.literals[req.URL.Path] {
+		r := &t.routes[ix]
+		if !r.anyHost() && r.matchesHost(req) {
+			allow.add(r.Methods)
+		}
+	}
+	for _, ix := range t.trie.candidates(req.URL.Path, nil) {
+		r := &t.routes[ix]
+		if r.matchesHost(req) {
+			allow.add(r.Methods)
+		}
+	}
+	segments, patterns := t.patternCandidates(req)
+	for _, candidates := range [][]int{segments, patterns} {
+		for _, ix := range candidates {
+			r := &t.routes[ix]
+			if _, matches, notAllowed := r.Matches(req); matches || notAllowed {
+				allow.add(r.Methods)
+			}
+		}
+	}
+	if allow.any {
+		return nil, false
+	}
+	return allow.methods, true
+}
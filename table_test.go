@@ -0,0 +1,310 @@
+package minimux_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RouteTable", func() {
+	routes := []minimux.Route{
+		minimux.PathWithVars("/users/([0-9]+)", "id").WithMethods(http.MethodGet).IsHandledBy(respondWith("get-")),
+		minimux.PathWithVars("/users/([0-9]+)", "id").WithHosts("admin").IsHandledBy(respondWith("admin-")),
+		minimux.PathWithVars("/users/([a-z]+)", "name").WithMethods(http.MethodPut).IsHandledBy(respondWith("put-")),
+		minimux.PathWithVars("/users/([a-z]+)", "name").WithMethods(http.MethodDelete).IsHandledBy(respondWith("delete-")),
+		minimux.LiteralPath("/users").WithMethods(http.MethodGet, http.MethodPost).IsHandledBy(respondWith("list")),
+		minimux.LiteralPath("/users").WithMethods(http.MethodPatch).WithHosts("admin").IsHandledBy(respondWith("patch")),
+	}
+	table, err := minimux.NewRouteTable(routes)
+	if err != nil {
+		panic(err)
+	}
+
+	DescribeTable("should find the first matching route",
+		func(method, host, path string, expected int, expectedValues []string, expectedNotAllowed bool) {
+			req, err := http.NewRequest(method, "http://"+host+path, nil)
+			Expect(err).ToNot(HaveOccurred())
+			route, values, notAllowed := table.Match(req)
+			Expect(notAllowed).To(Equal(expectedNotAllowed))
+			if expected == -1 {
+				Expect(route).To(BeNil())
+				return
+			}
+			Expect(route).To(Equal(&table.Routes()[expected]))
+			Expect(values).To(Equal(expectedValues))
+		},
+		Entry("first route", http.MethodGet, "localhost", "/users/1", 0, []string{"1"}, false),
+		Entry("host after method mismatch", http.MethodPost, "admin", "/users/1", 1, []string{"1"}, false),
+		Entry("method mismatch", http.MethodPost, "localhost", "/users/1", -1, nil, true),
+		Entry("skipping non-matching patterns", http.MethodPut, "localhost", "/users/bob", 2, []string{"bob"}, false),
+		Entry("after method mismatch", http.MethodDelete, "localhost", "/users/bob", 3, []string{"bob"}, false),
+		Entry("literal", http.MethodPost, "localhost", "/users", 4, nil, false),
+		Entry("literal with host", http.MethodPatch, "admin", "/users", 5, nil, false),
+		Entry("no route", http.MethodGet, "localhost", "/groups", -1, nil, false),
+	)
+
+	DescribeTable("should find the allowed methods for a path",
+		func(host, path string, expected minimux.StringSet, expectedOK bool) {
+			req, err := http.NewRequest(http.MethodOptions, "http://"+host+path, nil)
+			Expect(err).ToNot(HaveOccurred())
+			methods, ok := table.AllowedMethods(req)
+			Expect(ok).To(Equal(expectedOK))
+			if ok {
+				Expect(methods).To(Equal(expected))
+			}
+		},
+		Entry("pattern", "localhost", "/users/bob", minimux.StringSetOf(http.MethodPut, http.MethodDelete), true),
+		Entry("pattern without methods", "admin", "/users/1", nil, false),
+		Entry("literal", "localhost", "/users", minimux.StringSetOf(http.MethodGet, http.MethodPost), true),
+		Entry("literal with host", "admin", "/users", minimux.StringSetOf(http.MethodGet, http.MethodPost, http.MethodPatch), true),
+		Entry("no route", "localhost", "/groups", minimux.StringSetOf(), true),
+	)
+})
+
+var _ = Describe("A RouteTable with segment templates", func() {
+	routes := []minimux.Route{
+		minimux.PathWithVars("/files/([^/]+)/([^/]+)", "dir", "name").WithMethods(http.MethodGet).IsHandledBy(respondWith("get-")),
+		minimux.PathWithVars("/files/(x.*)", "path").IsHandledBy(respondWith("x-")),
+		minimux.PathWithVars("/files/([^/]+)", "name").IsHandledBy(respondWith("file-")),
+		minimux.LiteralPath("/files/readme").IsHandledBy(respondWith("readme")),
+		minimux.PathWithVars("/files/([^/]+)/", "dir").IsHandledBy(respondWith("dir-")),
+	}
+	table, err := minimux.NewRouteTable(routes)
+	if err != nil {
+		panic(err)
+	}
+
+	DescribeTable("should find the first matching route, including patterns",
+		func(method, path string, expected int, expectedValues []string, expectedNotAllowed bool) {
+			req, err := http.NewRequest(method, "http://localhost"+path, nil)
+			Expect(err).ToNot(HaveOccurred())
+			route, values, notAllowed := table.Match(req)
+			Expect(notAllowed).To(Equal(expectedNotAllowed))
+			if expected == -1 {
+				Expect(route).To(BeNil())
+				return
+			}
+			Expect(route).To(Equal(&table.Routes()[expected]))
+			Expect(values).To(Equal(expectedValues))
+		},
+		Entry("several variables", http.MethodGet, "/files/a/b", 0, []string{"a", "b"}, false),
+		Entry("method mismatch", http.MethodPost, "/files/a/b", -1, nil, true),
+		Entry("pattern before template", http.MethodGet, "/files/xa", 1, []string{"xa"}, false),
+		Entry("template before literal", http.MethodGet, "/files/readme", 2, []string{"readme"}, false),
+		Entry("trailing slash", http.MethodGet, "/files/a/", 4, []string{"a"}, false),
+		Entry("empty segment", http.MethodGet, "/files//b", -1, nil, false),
+		Entry("too many segments", http.MethodGet, "/files/a/b/c", -1, nil, false),
+	)
+
+	It("should find the allowed methods for a template", func() {
+		req, err := http.NewRequest(http.MethodOptions, "http://localhost/files/a/b", nil)
+		Expect(err).ToNot(HaveOccurred())
+		methods, ok := table.AllowedMethods(req)
+		Expect(ok).To(BeTrue())
+		Expect(methods).To(Equal(minimux.StringSetOf(http.MethodGet)))
+	})
+})
+
+var _ = Describe("NewRouteTable", func() {
+	It("should compile the patterns of many routes", func() {
+		routes := make([]minimux.Route, 0, 1000)
+		for i := 0; i < 1000; i++ {
+			routes = append(routes, minimux.LazyPathWithVars(fmt.Sprintf("/api/v%d/([^/]+)", i), "name").IsHandledBy(respondWith(fmt.Sprintf("%d-", i))))
+		}
+		table, err := minimux.NewRouteTable(routes)
+		Expect(err).ToNot(HaveOccurred())
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/api/v999/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		route, values, _ := table.Match(req)
+		Expect(route).To(Equal(&table.Routes()[999]))
+		Expect(values).To(Equal([]string{"foo"}))
+		Expect(routes[999].Pattern).To(BeNil(), "The original routes were modified")
+	})
+	It("should report every invalid route", func() {
+		_, err := minimux.NewRouteTable([]minimux.Route{
+			minimux.LazyPathWithVars("/(", "name").IsHandledBy(minimux.NotFound),
+			minimux.LiteralPath("/foo").IsHandledBy(minimux.NotFound),
+			{Handler: minimux.NotFound},
+		})
+		Expect(err).To(MatchError(ContainSubstring("route 0")))
+		Expect(err).ToNot(MatchError(ContainSubstring("route 1")))
+		Expect(err).To(MatchError(ContainSubstring("route 2")))
+	})
+})
+
+var _ = Describe("A compiled mux", func() {
+	It("should ignore changes to Routes until it is compiled again", func() {
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/foo").IsHandledBy(respondWith("old")),
+			},
+		}
+		Expect(mux.Compile()).Error().ToNot(HaveOccurred())
+		mux.Routes[0] = minimux.LiteralPath("/foo").IsHandledBy(respondWith("new"))
+
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		expectResponse(mux, req, http.StatusOK, "old")
+
+		Expect(mux.Compile()).Error().ToNot(HaveOccurred())
+		req, err = http.NewRequest(http.MethodGet, "http://localhost/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		expectResponse(mux, req, http.StatusOK, "new")
+	})
+})
+
+var _ = Describe("A mux with invalid routes", func() {
+	It("should answer requests with an error instead of panicking", func() {
+		var postErr error
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LazyPathWithVars("/(", "name").IsHandledBy(respondWith("broken")),
+			},
+			PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {
+				postErr = err
+			},
+		}
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		expectResponse(mux, req, http.StatusInternalServerError, "")
+		Expect(postErr).To(MatchError(ContainSubstring("route 0")))
+		Expect(mux.URL("broken").Build()).Error().To(MatchError(ContainSubstring("route 0")))
+
+		mux.Routes = []minimux.Route{minimux.LiteralPath("/foo").IsHandledBy(respondWith("fixed"))}
+		req, err = http.NewRequest(http.MethodGet, "http://localhost/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		expectResponse(mux, req, http.StatusOK, "fixed")
+	})
+})
+
+var _ = Describe("A mux with a not found cache", func() {
+	It("should remember requests which matched no route until the routes are rebuilt", func() {
+		defaultCalls := 0
+		mux := &minimux.Mux{
+			NotFoundCacheSize: 1,
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/foo").WithMethods(http.MethodGet).IsHandledBy(respondWith("foo")),
+			},
+			DefaultHandler: minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				defaultCalls++
+				w.WriteHeader(http.StatusNotFound)
+				return nil
+			}),
+		}
+		for _, path := range []string{"/bar", "/bar", "/baz", "/bar"} {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusNotFound, "")
+		}
+		Expect(defaultCalls).To(Equal(4))
+		for i := 0; i < 2; i++ {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/foo", nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusMethodNotAllowed, "")
+		}
+
+		mux.Routes = append(mux.Routes, minimux.LiteralPath("/bar").IsHandledBy(respondWith("bar")))
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/bar", nil)
+		Expect(err).ToNot(HaveOccurred())
+		expectResponse(mux, req, http.StatusOK, "bar")
+	})
+})
+
+var _ = Describe("A mux with routes swapped while serving", func() {
+	It("should serve every request in flight against a consistent set of routes", func() {
+		slowly := func(body string) minimux.Handler {
+			return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				time.Sleep(time.Millisecond)
+				w.Write([]byte(body))
+				return nil
+			})
+		}
+		// The first set accepts POSTs, the second only GETs, so a request matched against a mix of the
+		// two could produce a 405 with a body, or a 200 with an unexpected body
+		routesA := []minimux.Route{
+			minimux.LiteralPath("/foo").WithMethods(http.MethodPost).IsHandledBy(slowly("a")),
+			minimux.PathPattern("/.*").IsHandledBy(slowly("a-default")),
+		}
+		routesB := []minimux.Route{
+			minimux.LiteralPath("/foo").WithMethods(http.MethodGet).IsHandledBy(slowly("b")),
+		}
+		mux := &minimux.Mux{}
+		Expect(mux.SetRoutes(routesA)).Error().ToNot(HaveOccurred())
+
+		stop := make(chan struct{})
+		swapperDone := make(chan struct{})
+		go func() {
+			defer close(swapperDone)
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if i%2 == 0 {
+					mux.SetRoutes(routesB)
+				} else {
+					Expect(mux.SetRoutes(routesA)).Error().ToNot(HaveOccurred())
+				}
+				time.Sleep(100 * time.Microsecond)
+			}
+		}()
+
+		var wg sync.WaitGroup
+		results := make(chan string, 1000)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					req := httptest.NewRequest(http.MethodPost, "http://localhost/foo", nil)
+					resp := httptest.NewRecorder()
+					mux.ServeHTTP(resp, req)
+					results <- fmt.Sprintf("%d %s", resp.Code, resp.Body.String())
+				}
+			}()
+		}
+		wg.Wait()
+		close(stop)
+		<-swapperDone
+		close(results)
+
+		for result := range results {
+			Expect(result).To(BeElementOf("200 a", "405 "))
+		}
+	})
+})
+
+var _ = Describe("A mux with a match cache", func() {
+	It("should remember the routes which matched requests until the routes are rebuilt", func() {
+		mux := &minimux.Mux{
+			MatchCacheSize: 2,
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/hooks/([^/]+)", "name").WithMethods(http.MethodPost).IsHandledBy(respondWith("hook-")),
+			},
+		}
+		for _, path := range []string{"/hooks/a", "/hooks/b", "/hooks/a", "/hooks/c", "/hooks/b"} {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost"+path, nil)
+			Expect(err).ToNot(HaveOccurred())
+			expectResponse(mux, req, http.StatusOK, "hook-"+path[len("/hooks/"):])
+		}
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/hooks/a", nil)
+		Expect(err).ToNot(HaveOccurred())
+		expectResponse(mux, req, http.StatusMethodNotAllowed, "")
+
+		mux.Routes = []minimux.Route{
+			minimux.PathWithVars("/hooks/([^/]+)", "name").WithMethods(http.MethodPost).IsHandledBy(respondWith("new-")),
+		}
+		req, err = http.NewRequest(http.MethodPost, "http://localhost/hooks/a", nil)
+		Expect(err).ToNot(HaveOccurred())
+		expectResponse(mux, req, http.StatusOK, "new-a")
+	})
+})
@@ -0,0 +1,91 @@
+package minimux
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTarpitInterval is how long a Tarpit waits between bytes if its Interval is not set
+	DefaultTarpitInterval = 10 * time.Second
+	// DefaultTarpitDuration is how long a Tarpit holds a request if its Duration is not set
+	DefaultTarpitDuration = 10 * time.Minute
+	// DefaultTarpitMaxConcurrent is how many requests a Tarpit holds at once if its MaxConcurrent is not set
+	DefaultTarpitMaxConcurrent = 100
+)
+
+// tarpitFiller is the data a Tarpit drips out, which looks like the start of a page that never finishes loading
+const tarpitFiller = "<!DOCTYPE html>\n<html><head><title>Login</title></head><body>\n"
+
+// Tarpit is a handler which responds extremely slowly, one byte at a time, to waste the time of scanners probing
+// for known vulnerable paths, such as /wp-login.php. It holds no resources but the connection and a timer,
+// and stops as soon as the client disconnects or the context is cancelled. So that a flood of requests can't
+// exhaust the connections or file descriptors of the server, requests beyond those it is already holding
+// are answered immediately with 404 Not Found.
+type Tarpit struct {
+	// Interval is how long to wait between bytes. If zero, DefaultTarpitInterval is used.
+	Interval time.Duration
+	// Duration is how long to hold a request before finishing the response. If zero, DefaultTarpitDuration is used.
+	Duration time.Duration
+	// MaxConcurrent is how many requests to hold at once. If zero, DefaultTarpitMaxConcurrent is used.
+	MaxConcurrent int
+
+	once  sync.Once
+	slots chan struct{}
+}
+
+func (t *Tarpit) init() {
+	t.once.Do(func() {
+		size := t.MaxConcurrent
+		if size == 0 {
+			size = DefaultTarpitMaxConcurrent
+		}
+		t.slots = make(chan struct{}, size)
+	})
+}
+
+// ServeHTTP implements Handler
+func (t *Tarpit) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	t.init()
+	select {
+	case t.slots <- struct{}{}:
+		defer func() { <-t.slots }()
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	interval := t.Interval
+	if interval == 0 {
+		interval = DefaultTarpitInterval
+	}
+	duration := t.Duration
+	if duration == 0 {
+		duration = DefaultTarpitDuration
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(duration)
+	defer deadline.Stop()
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	flusher := http.NewResponseController(w)
+	for ix := 0; ; ix++ {
+		if _, err := w.Write([]byte{tarpitFiller[ix%len(tarpitFiller)]}); err != nil {
+			return nil
+		}
+		// Writers which can't flush will still hold the client until the deadline
+		flusher.Flush()
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case <-req.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package minimux_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tarpit", func() {
+	It("should drip-feed a response until the duration is over", func() {
+		resp := httptest.NewRecorder()
+		start := time.Now()
+		Expect((&minimux.Tarpit{Interval: 20 * time.Millisecond, Duration: 110 * time.Millisecond}).
+			ServeHTTP(context.Background(), resp, httptest.NewRequest(http.MethodGet, "http://localhost/wp-login.php", nil), nil, nil)).
+			To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 110*time.Millisecond))
+		Expect(resp.Body.Len()).To(BeNumerically("~", 6, 1))
+		Expect(resp.Flushed).To(BeTrue())
+	})
+	It("should stop when the client goes away", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/wp-login.php", nil).WithContext(ctx)
+		time.AfterFunc(50*time.Millisecond, cancel)
+		start := time.Now()
+		Expect((&minimux.Tarpit{Interval: 10 * time.Millisecond}).ServeHTTP(context.Background(), httptest.NewRecorder(), req, nil, nil)).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+	It("should turn away requests beyond the limit", func() {
+		tarpit := &minimux.Tarpit{Interval: 10 * time.Millisecond, MaxConcurrent: 1}
+		ctx, cancel := context.WithCancel(context.Background())
+		started := &startedRecorder{ResponseRecorder: httptest.NewRecorder(), started: make(chan struct{})}
+		held := make(chan error)
+		go func() {
+			held <- tarpit.ServeHTTP(ctx, started, httptest.NewRequest(http.MethodGet, "http://localhost/wp-login.php", nil), nil, nil)
+		}()
+		<-started.started
+		resp := httptest.NewRecorder()
+		Expect(tarpit.ServeHTTP(context.Background(), resp, httptest.NewRequest(http.MethodGet, "http://localhost/wp-login.php", nil), nil, nil)).To(Succeed())
+		Expect(resp.Code).To(Equal(http.StatusNotFound))
+		cancel()
+		Expect(<-held).To(Succeed())
+	})
+})
+
+// startedRecorder is a ResponseRecorder which closes a channel once a response is started
+type startedRecorder struct {
+	*httptest.ResponseRecorder
+	started chan struct{}
+}
+
+func (r *startedRecorder) WriteHeader(statusCode int) {
+	r.ResponseRecorder.WriteHeader(statusCode)
+	close(r.started)
+}
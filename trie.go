@@ -0,0 +1,157 @@
+package minimux
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// templateSegment is one segment of a segmentTemplate
+type templateSegment struct {
+	// literal is the exact text of the segment, if it is not a variable
+	literal string
+	// variable is true if the segment matches any non-empty text without a slash, which is captured
+	variable bool
+}
+
+// segmentTemplate describes a pattern which matches a fixed number of path segments, each of which is
+// either literal text, or a variable, such as ^/users/([^/]+)/posts$
+type segmentTemplate struct {
+	segments []templateSegment
+	// vars is the number of variable segments
+	vars int
+}
+
+// segmentClass is the character class of a variable segment, [^/]
+var segmentClass = []rune{0, '/' - 1, '/' + 1, unicode.MaxRune}
+
+// analyzeSegments determines if a pattern only matches paths which fit a segment template with at least
+// one variable, and if so, returns it
+func analyzeSegments(pattern *regexp.Regexp) (segmentTemplate, bool) {
+	re, err := syntax.Parse(pattern.String(), syntax.Perl)
+	if err != nil {
+		return segmentTemplate{}, false
+	}
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) < 3 || re.Sub[0].Op != syntax.OpBeginText || re.Sub[len(re.Sub)-1].Op != syntax.OpEndText {
+		return segmentTemplate{}, false
+	}
+	// Variables are replaced by a NUL, so literals containing one are not templates
+	var b strings.Builder
+	for _, sub := range re.Sub[1 : len(re.Sub)-1] {
+		switch {
+		case sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0 && !slices.Contains(sub.Rune, 0):
+			b.WriteString(string(sub.Rune))
+		case isSegmentCapture(sub):
+			b.WriteByte(0)
+		default:
+			return segmentTemplate{}, false
+		}
+	}
+	path, ok := strings.CutPrefix(b.String(), "/")
+	if !ok {
+		return segmentTemplate{}, false
+	}
+	var template segmentTemplate
+	for _, segment := range strings.Split(path, "/") {
+		switch {
+		case segment == "\x00":
+			template.segments = append(template.segments, templateSegment{variable: true})
+			template.vars++
+		case strings.IndexByte(segment, 0) != -1:
+			// A variable which is only part of a segment
+			return segmentTemplate{}, false
+		default:
+			template.segments = append(template.segments, templateSegment{literal: segment})
+		}
+	}
+	return template, template.vars != 0
+}
+
+// isSegmentCapture returns true if a regular expression is ([^/]+)
+func isSegmentCapture(re *syntax.Regexp) bool {
+	if re.Op != syntax.OpCapture || re.Sub[0].Op != syntax.OpPlus {
+		return false
+	}
+	class := re.Sub[0].Sub[0]
+	return class.Op == syntax.OpCharClass && slices.Equal(class.Rune, segmentClass)
+}
+
+// values returns the values of the variables of a template from a path it is known to match
+func (s segmentTemplate) values(path string) []string {
+	values := make([]string, 0, s.vars)
+	path = path[1:]
+	for _, segment := range s.segments {
+		value, rest, _ := strings.Cut(path, "/")
+		if segment.variable {
+			values = append(values, value)
+		}
+		path = rest
+	}
+	return values
+}
+
+// segmentTrie is a tree of segment templates which finds the templates matching a path by looking at
+// each of its segments once, instead of evaluating every pattern
+type segmentTrie struct {
+	literals map[string]*segmentTrie
+	variable *segmentTrie
+	// routes are the indexes of the routes whose templates end at this node, in declaration order
+	routes []int
+}
+
+// insert adds the template of a route to the tree
+func (n *segmentTrie) insert(template segmentTemplate, ix int) {
+	for _, segment := range template.segments {
+		if segment.variable {
+			if n.variable == nil {
+				n.variable = &segmentTrie{}
+			}
+			n = n.variable
+			continue
+		}
+		if n.literals == nil {
+			n.literals = map[string]*segmentTrie{}
+		}
+		child, ok := n.literals[segment.literal]
+		if !ok {
+			child = &segmentTrie{}
+			n.literals[segment.literal] = child
+		}
+		n = child
+	}
+	n.routes = append(n.routes, ix)
+}
+
+// candidates appends the indexes of the routes whose templates match a path to a slice, in declaration order
+func (n *segmentTrie) candidates(path string, indexes []int) []int {
+	path, ok := strings.CutPrefix(path, "/")
+	if !ok {
+		return indexes
+	}
+	indexes = n.collect(path, indexes)
+	slices.Sort(indexes)
+	return indexes
+}
+
+// collect appends the indexes of the routes whose templates match the rest of a path, without its leading slash
+func (n *segmentTrie) collect(path string, indexes []int) []int {
+	segment, rest, more := strings.Cut(path, "/")
+	if child := n.literals[segment]; child != nil {
+		if more {
+			indexes = child.collect(rest, indexes)
+		} else {
+			indexes = append(indexes, child.routes...)
+		}
+	}
+	if child := n.variable; child != nil && segment != "" {
+		if more {
+			indexes = child.collect(rest, indexes)
+		} else {
+			indexes = append(indexes, child.routes...)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,82 @@
+package minimux
+
+import (
+	"context"
+	"net/http"
+)
+
+// ErrUnsupportedMediaType answers a request with 415 Unsupported Media Type, such as when its body is in a format
+// a TypedHandler cannot decode
+var ErrUnsupportedMediaType = NewHTTPError(http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType))
+
+// ErrNotAcceptable answers a request with 406 Not Acceptable, such as when it accepts none of the formats
+// a TypedHandler can encode
+var ErrNotAcceptable = NewHTTPError(http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable))
+
+// JSONHandler adapts a function which takes and returns values, rather than requests and responses, into a Handler.
+// The body of the request, if any, is decoded as JSON into the value the function is called with, and the value it
+// returns is encoded as JSON into the response. A body which cannot be decoded is returned as an error wrapping
+// ErrBadRequest, and a value which is invalid, as with Bind, is returned as an error wrapping ErrUnprocessableEntity.
+// Any error from the function is returned as-is, without writing a response, so that both are
+// answered by the ErrorHandler of the Mux, such as WriteError. If there is none, the former are answered with WriteError.
+func JSONHandler[Req, Resp any](handle func(ctx context.Context, req Req, vars map[string]string) (Resp, error)) Handler {
+	return typedHandler(handle, func(ctx context.Context, req *http.Request, value, result any) (Codec, Codec, error) {
+		return JSONCodec, JSONCodec, nil
+	})
+}
+
+// TypedHandler is JSONHandler, but the body of the request is decoded with the Codec for its Content-Type, such as
+// JSONCodec, XMLCodec, ProtobufCodec, or one of the Codecs of the Mux, and the response is encoded with whichever its
+// Accept header prefers, or otherwise as the request was, so that clients such as legacy XML integrations and binary
+// APIs can use the same handlers as JSON clients. Requests with a body in another format are answered with
+// 415 Unsupported Media Type, and those which accept none of them with 406 Not Acceptable.
+func TypedHandler[Req, Resp any](handle func(ctx context.Context, req Req, vars map[string]string) (Resp, error)) Handler {
+	return typedHandler(handle, negotiateCodecs)
+}
+
+// negotiateCodecs chooses the codecs for the body of a request and its response by its Content-Type and Accept headers
+// for the values pointed to by value and result
+func negotiateCodecs(ctx context.Context, req *http.Request, value, result any) (in, out Codec, err error) {
+	codecs := codecsFromContext(ctx)
+	in, ok := requestCodec(req, codecs)
+	if !ok || !codecSupports(in, value) {
+		return in, out, ErrUnsupportedMediaType
+	}
+	if out, ok = responseCodec(req, codecs, in, result); !ok {
+		return in, out, ErrNotAcceptable
+	}
+	return in, out, nil
+}
+
+// rejectInput returns an error for a request whose body can't be decoded or is invalid, answering it with WriteError
+// if there is no ErrorHandler to, so that it isn't answered with an empty 200 OK
+func rejectInput(ctx context.Context, w http.ResponseWriter, req *http.Request, err error) error {
+	if !errorHandled(ctx) {
+		WriteError(ctx, w, req, err)
+	}
+	return err
+}
+
+// typedHandler adapts a function which takes and returns values into a Handler, with the codecs chosen for each request
+func typedHandler[Req, Resp any](handle func(ctx context.Context, req Req, vars map[string]string) (Resp, error), choose func(ctx context.Context, req *http.Request, value, result any) (in, out Codec, err error)) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		var value Req
+		var result Resp
+		in, out, err := choose(ctx, req, &value, &result)
+		if err != nil {
+			return rejectInput(ctx, w, req, err)
+		}
+		if err := decodeBody(in, req, &value); err != nil {
+			return rejectInput(ctx, w, req, ErrBadRequest.WithInternal(err))
+		}
+		if err := validateInput(ctx, &value); err != nil {
+			return rejectInput(ctx, w, req, err)
+		}
+		result, err = handle(ctx, value, pathVars)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", out.ContentTypes()[0])
+		return out.Encode(w, &result)
+	})
+}
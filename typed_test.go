@@ -0,0 +1,292 @@
+package minimux_test
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type greetingRequest struct {
+	XMLName  xml.Name `json:"-" xml:"greetingRequest"`
+	Greeting string   `json:"greeting" xml:"greeting"`
+}
+
+type greetingResponse struct {
+	XMLName xml.Name `json:"-" xml:"greeting"`
+	Message string   `json:"message" xml:"message"`
+}
+
+var _ = Describe("JSONHandler", func() {
+	mux := &minimux.Mux{
+		ErrorHandler: minimux.WriteError,
+		Routes: []minimux.Route{
+			minimux.Pattern("/greet/{name}").IsHandledBy(minimux.JSONHandler(func(ctx context.Context, req greetingRequest, vars map[string]string) (greetingResponse, error) {
+				switch {
+				case vars["name"] == "nobody":
+					return greetingResponse{}, minimux.ErrNotFound
+				case vars["name"] == "broken":
+					return greetingResponse{}, errors.New("secret failure")
+				case req.Greeting == "":
+					req.Greeting = "Hello"
+				}
+				return greetingResponse{Message: req.Greeting + ", " + vars["name"]}, nil
+			})),
+		},
+	}
+
+	DescribeTable("should decode requests and encode responses",
+		func(method, path, body string, expectedStatus int, expectedContentType, expectedBody string) {
+			resp := serve(mux, httptest.NewRequest(method, path, strings.NewReader(body)))
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Header().Get("Content-Type")).To(Equal(expectedContentType))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("with a body", http.MethodPost, "/greet/bob", `{"greeting":"Hi"}`, http.StatusOK, "application/json", `{"message":"Hi, bob"}`+"\n"),
+		Entry("without a body", http.MethodGet, "/greet/bob", "", http.StatusOK, "application/json", `{"message":"Hello, bob"}`+"\n"),
+		Entry("invalid body", http.MethodPost, "/greet/bob", `{"greeting":`, http.StatusBadRequest, "text/plain; charset=utf-8", "Bad Request\n"),
+		Entry("HTTPError", http.MethodGet, "/greet/nobody", "", http.StatusNotFound, "text/plain; charset=utf-8", "Not Found\n"),
+		Entry("other error", http.MethodGet, "/greet/broken", "", http.StatusInternalServerError, "text/plain; charset=utf-8", "Internal Server Error\n"),
+	)
+
+	It("should answer invalid bodies itself without an ErrorHandler", func() {
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/greet").IsHandledBy(minimux.TypedHandler(func(ctx context.Context, req greetingRequest, vars map[string]string) (greetingResponse, error) {
+					return greetingResponse{Message: req.Greeting}, nil
+				})),
+			},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/greet", strings.NewReader(`{"greeting":`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := serve(mux, req)
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		Expect(resp.Body.String()).To(Equal("Bad Request\n"))
+
+		req = httptest.NewRequest(http.MethodPost, "/greet", strings.NewReader("greeting: hi"))
+		req.Header.Set("Content-Type", "application/yaml")
+		Expect(serve(mux, req).Code).To(Equal(http.StatusUnsupportedMediaType))
+	})
+})
+
+var _ = Describe("TypedHandler", func() {
+	mux := &minimux.Mux{
+		ErrorHandler: minimux.WriteError,
+		Routes: []minimux.Route{
+			minimux.Pattern("/greet/{name}").IsHandledBy(minimux.TypedHandler(func(ctx context.Context, req greetingRequest, vars map[string]string) (greetingResponse, error) {
+				if req.Greeting == "" {
+					req.Greeting = "Hello"
+				}
+				return greetingResponse{Message: req.Greeting + ", " + vars["name"]}, nil
+			})),
+		},
+	}
+
+	DescribeTable("should negotiate formats",
+		func(contentType, accept, body string, expectedStatus int, expectedContentType, expectedBody string) {
+			req := httptest.NewRequest(http.MethodPost, "/greet/bob", strings.NewReader(body))
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+			resp := serve(mux, req)
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Header().Get("Content-Type")).To(Equal(expectedContentType))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("JSON", "application/json", "", `{"greeting":"Hi"}`, http.StatusOK, "application/json", `{"message":"Hi, bob"}`+"\n"),
+		Entry("XML", "text/xml; charset=utf-8", "", `<greetingRequest><greeting>Hi</greeting></greetingRequest>`, http.StatusOK, "application/xml", xml.Header+`<greeting><message>Hi, bob</message></greeting>`),
+		Entry("JSON for XML", "application/json", "application/xml", `{"greeting":"Hi"}`, http.StatusOK, "application/xml", xml.Header+`<greeting><message>Hi, bob</message></greeting>`),
+		Entry("preferred XML", "", "application/json;q=0.5, application/xml", "", http.StatusOK, "application/xml", xml.Header+`<greeting><message>Hello, bob</message></greeting>`),
+		Entry("no body", "", "", "", http.StatusOK, "application/json", `{"message":"Hello, bob"}`+"\n"),
+		Entry("unsupported body", "text/csv", "", "greeting\nHi", http.StatusUnsupportedMediaType, "text/plain; charset=utf-8", "Unsupported Media Type\n"),
+		Entry("unacceptable response", "application/json", "text/csv", `{}`, http.StatusNotAcceptable, "text/plain; charset=utf-8", "Not Acceptable\n"),
+		Entry("invalid XML", "application/xml", "", `<greetingRequest>`, http.StatusBadRequest, "text/plain; charset=utf-8", "Bad Request\n"),
+	)
+})
+
+// protoGreeting is a message with a single string field, numbered 1, with Marshal and Unmarshal methods
+// as generated by gogo/protobuf
+type protoGreeting struct {
+	Message string `json:"message"`
+}
+
+func (m *protoGreeting) Marshal() ([]byte, error) {
+	return append([]byte{0x0a, byte(len(m.Message))}, m.Message...), nil
+}
+
+func (m *protoGreeting) Unmarshal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if len(data) < 2 || data[0] != 0x0a || int(data[1]) != len(data)-2 {
+		return errors.New("invalid message")
+	}
+	m.Message = string(data[2:])
+	return nil
+}
+
+var _ = Describe("TypedHandler with Protocol Buffers", func() {
+	mux := &minimux.Mux{
+		ErrorHandler: minimux.WriteError,
+		Routes: []minimux.Route{
+			minimux.Pattern("/greet/{name}").IsHandledBy(minimux.TypedHandler(func(ctx context.Context, req *protoGreeting, vars map[string]string) (*protoGreeting, error) {
+				return &protoGreeting{Message: req.Message + ", " + vars["name"]}, nil
+			})),
+			minimux.Pattern("/plain/{name}").IsHandledBy(minimux.TypedHandler(func(ctx context.Context, req greetingRequest, vars map[string]string) (greetingResponse, error) {
+				return greetingResponse{Message: req.Greeting}, nil
+			})),
+		},
+	}
+
+	DescribeTable("should encode and decode messages",
+		func(path, contentType, accept, body string, expectedStatus int, expectedContentType, expectedBody string) {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+			resp := serve(mux, req)
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Header().Get("Content-Type")).To(Equal(expectedContentType))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("protobuf", "/greet/bob", "application/x-protobuf", "", "\x0a\x02Hi", http.StatusOK, "application/x-protobuf", "\x0a\x07Hi, bob"),
+		Entry("protobuf without x-", "/greet/bob", "application/protobuf", "", "\x0a\x02Hi", http.StatusOK, "application/x-protobuf", "\x0a\x07Hi, bob"),
+		Entry("JSON for protobuf", "/greet/bob", "application/json", "application/protobuf", `{"message":"Hi"}`, http.StatusOK, "application/x-protobuf", "\x0a\x07Hi, bob"),
+		Entry("protobuf for JSON", "/greet/bob", "application/x-protobuf", "application/json", "\x0a\x02Hi", http.StatusOK, "application/json", `{"message":"Hi, bob"}`+"\n"),
+		Entry("invalid message", "/greet/bob", "application/x-protobuf", "", "\x0a\x09Hi", http.StatusBadRequest, "text/plain; charset=utf-8", "Bad Request\n"),
+		Entry("protobuf for other values", "/plain/bob", "application/x-protobuf", "", "\x0a\x02Hi", http.StatusUnsupportedMediaType, "text/plain; charset=utf-8", "Unsupported Media Type\n"),
+		Entry("protobuf response for other values", "/plain/bob", "application/json", "application/x-protobuf", "{}", http.StatusNotAcceptable, "text/plain; charset=utf-8", "Not Acceptable\n"),
+	)
+})
+
+// apiMessage stands in for proto.Message, whose messages are marshaled by functions rather than methods of their own
+type apiMessage interface {
+	ProtoMessage()
+}
+
+type apiGreeting struct {
+	Message string
+}
+
+func (*apiGreeting) ProtoMessage() {}
+
+var apiCodec = minimux.NewProtobufCodec(
+	func(m apiMessage) ([]byte, error) {
+		message := m.(*apiGreeting).Message
+		return append([]byte{0x0a, byte(len(message))}, message...), nil
+	},
+	func(data []byte, m apiMessage) error {
+		if len(data) < 2 || data[0] != 0x0a || int(data[1]) != len(data)-2 {
+			return errors.New("invalid message")
+		}
+		m.(*apiGreeting).Message = string(data[2:])
+		return nil
+	},
+)
+
+var _ = Describe("NewProtobufCodec", func() {
+	mux := &minimux.Mux{
+		ErrorHandler: minimux.WriteError,
+		Codecs:       []minimux.Codec{apiCodec},
+		Routes: []minimux.Route{
+			minimux.Pattern("/greet/{name}").IsHandledBy(minimux.TypedHandler(func(ctx context.Context, req *apiGreeting, vars map[string]string) (*apiGreeting, error) {
+				return &apiGreeting{Message: req.Message + ", " + vars["name"]}, nil
+			})),
+			minimux.Pattern("/plain/{name}").IsHandledBy(minimux.TypedHandler(func(ctx context.Context, req greetingRequest, vars map[string]string) (greetingResponse, error) {
+				return greetingResponse{Message: req.Greeting}, nil
+			})),
+		},
+	}
+
+	DescribeTable("should encode and decode messages with functions",
+		func(path, contentType, accept, body string, expectedStatus int, expectedContentType, expectedBody string) {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+			resp := serve(mux, req)
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Header().Get("Content-Type")).To(Equal(expectedContentType))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("protobuf", "/greet/bob", "application/x-protobuf", "", "\x0a\x02Hi", http.StatusOK, "application/x-protobuf", "\x0a\x07Hi, bob"),
+		Entry("JSON for protobuf", "/greet/bob", "application/json", "application/protobuf", `{"Message":"Hi"}`, http.StatusOK, "application/x-protobuf", "\x0a\x07Hi, bob"),
+		Entry("invalid message", "/greet/bob", "application/x-protobuf", "", "\x0a\x09Hi", http.StatusBadRequest, "text/plain; charset=utf-8", "Bad Request\n"),
+		Entry("protobuf for other values", "/plain/bob", "application/x-protobuf", "", "\x0a\x02Hi", http.StatusUnsupportedMediaType, "text/plain; charset=utf-8", "Unsupported Media Type\n"),
+	)
+})
+
+// textCodec encodes and decodes strings as plain text
+type textCodec struct{}
+
+func (textCodec) ContentTypes() []string { return []string{"text/plain"} }
+
+func (textCodec) Encode(w io.Writer, v any) error {
+	_, err := io.WriteString(w, *v.(*string))
+	return err
+}
+
+func (textCodec) Decode(r io.Reader, v any) error {
+	data, err := io.ReadAll(r)
+	*v.(*string) = string(data)
+	return err
+}
+
+func (textCodec) Supports(v any) bool {
+	_, ok := v.(*string)
+	return ok
+}
+
+var _ = Describe("TypedHandler with custom codecs", func() {
+	greet := minimux.TypedHandler(func(ctx context.Context, req string, vars map[string]string) (string, error) {
+		return req + ", " + vars["name"], nil
+	})
+	mux := &minimux.Mux{
+		ErrorHandler: minimux.WriteError,
+		Codecs:       []minimux.Codec{textCodec{}},
+		Routes: []minimux.Route{
+			minimux.Pattern("/greet/{name}").IsHandledBy(greet),
+			minimux.Pattern("/greeting/{greeting}").IsHandledBy(minimux.TypedHandler(func(ctx context.Context, req greetingRequest, vars map[string]string) (greetingResponse, error) {
+				return greetingResponse{Message: vars["greeting"]}, nil
+			})),
+		},
+	}
+
+	DescribeTable("should negotiate between the codecs of the mux and the built-in codecs",
+		func(path, contentType, accept, body string, expectedStatus int, expectedContentType, expectedBody string) {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+			resp := serve(mux, req)
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Header().Get("Content-Type")).To(Equal(expectedContentType))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("custom codec", "/greet/bob", "text/plain; charset=utf-8", "", "Hi", http.StatusOK, "text/plain", "Hi, bob"),
+		Entry("built-in codec for the same values", "/greet/bob", "application/json", "", `"Hi"`, http.StatusOK, "application/json", `"Hi, bob"`+"\n"),
+		Entry("custom codec for the response", "/greet/bob", "application/json", "text/*", `"Hi"`, http.StatusOK, "text/plain", "Hi, bob"),
+		Entry("structured syntax suffix", "/greet/bob", "application/vnd.greeting+json", "", `"Hi"`, http.StatusOK, "application/json", `"Hi, bob"`+"\n"),
+		Entry("custom codec for unsupported values", "/greeting/hi", "text/plain", "", "Hi", http.StatusUnsupportedMediaType, "text/plain; charset=utf-8", "Unsupported Media Type\n"),
+	)
+
+	It("should only use the built-in codecs outside of the mux", func() {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("Hi"))
+		req.Header.Set("Content-Type", "text/plain")
+		Expect(greet.ServeHTTP(req.Context(), httptest.NewRecorder(), req, nil, nil)).To(MatchError(minimux.ErrUnsupportedMediaType))
+	})
+})
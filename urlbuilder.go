@@ -0,0 +1,245 @@
+package minimux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp/syntax"
+	"strings"
+)
+
+// ErrUnknownRoute is returned when building a URL for a route name which does not exist
+var ErrUnknownRoute = errors.New("no route has that name")
+
+// A URLBuilder builds the URL of a named route from the values of its variables, and optional query parameters,
+// scheme, and host. Variables are substituted for the capture groups of the route's pattern, which must otherwise
+// only match a single path, except for optional parts, which are left out unless they contain a variable
+// which is given. The built path must be matched by the route.
+type URLBuilder struct {
+	route  *Route
+	vars   map[string]string
+	query  url.Values
+	scheme string
+	host   string
+	err    error
+}
+
+// URL starts building the URL of the route with a name
+func (t *RouteTable) URL(name string) *URLBuilder {
+	ix, ok := t.names[name]
+	if !ok {
+		return &URLBuilder{err: fmt.Errorf("%w: %q", ErrUnknownRoute, name)}
+	}
+	return &URLBuilder{route: &t.routes[ix], vars: map[string]string{}, query: url.Values{}}
+}
+
+// URL starts building the URL of the route with a name, using the current routes
+func (m *Mux) URL(name string) *URLBuilder {
+	t, err := m.currentTable()
+	if err != nil {
+		return &URLBuilder{err: err}
+	}
+	return t.URL(name)
+}
+
+// Var sets the value of a route variable, formatted as with fmt.Sprint
+func (b *URLBuilder) Var(name string, value any) *URLBuilder {
+	if b.err != nil {
+		return b
+	}
+	for _, varName := range b.route.VarNames {
+		if varName == name {
+			b.vars[name] = fmt.Sprint(value)
+			return b
+		}
+	}
+	b.err = fmt.Errorf("route %q has no variable %q", b.route.Name, name)
+	return b
+}
+
+// Query adds a value of a query parameter, formatted as with fmt.Sprint
+func (b *URLBuilder) Query(name string, value any) *URLBuilder {
+	if b.err == nil {
+		b.query.Add(name, fmt.Sprint(value))
+	}
+	return b
+}
+
+// Scheme makes the URL absolute, with a scheme, such as "https", and the host set with Host,
+// or, if none was, the route's host, if it has exactly one
+func (b *URLBuilder) Scheme(scheme string) *URLBuilder {
+	b.scheme = scheme
+	return b
+}
+
+// Host sets the host of the URL, which is absolute with the scheme set with Scheme, or "https" if none was
+func (b *URLBuilder) Host(host string) *URLBuilder {
+	b.host = host
+	return b
+}
+
+// Build returns the URL, or an error if it could not be built
+func (b *URLBuilder) Build() (*url.URL, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.route.Pattern == nil {
+		return nil, fmt.Errorf("route %q has no pattern to build a URL from", b.route.Name)
+	}
+	re, err := syntax.Parse(b.route.Pattern.String(), syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	path, err := buildPath(re.Simplify(), b.route.VarNames, b.vars)
+	if err != nil {
+		return nil, fmt.Errorf("building URL for route %q: %w", b.route.Name, err)
+	}
+	if !b.route.Pattern.MatchString(path) {
+		return nil, fmt.Errorf("building URL for route %q: %q does not match its pattern", b.route.Name, path)
+	}
+	u := &url.URL{Path: path, RawQuery: b.query.Encode()}
+	if b.scheme != "" || b.host != "" {
+		u.Scheme, u.Host = b.scheme, b.host
+		if u.Scheme == "" {
+			u.Scheme = "https"
+		}
+		if u.Host == "" && len(b.route.Hosts) == 1 {
+			for host := range b.route.Hosts {
+				u.Host = host
+			}
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("building URL for route %q: no host", b.route.Name)
+		}
+	}
+	return u, nil
+}
+
+// String returns the URL, or an empty string if it could not be built
+func (b *URLBuilder) String() string {
+	u, err := b.Build()
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// errMissingVar is returned when building a path for a pattern without the value of one of its variables
+type errMissingVar string
+
+func (e errMissingVar) Error() string {
+	return fmt.Sprintf("missing variable %q", string(e))
+}
+
+// buildPath returns the single path a parsed pattern matches with the values of its variables substituted
+func buildPath(re *syntax.Regexp, varNames []string, vars map[string]string) (string, error) {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary, syntax.OpStar:
+		return "", nil
+	case syntax.OpLiteral:
+		return string(re.Rune), nil
+	case syntax.OpCharClass:
+		if len(re.Rune) == 2 && re.Rune[0] == re.Rune[1] {
+			return string(re.Rune[0]), nil
+		}
+	case syntax.OpCapture:
+		if re.Cap > len(varNames) {
+			return "", fmt.Errorf("capture group %d has no variable", re.Cap)
+		}
+		value, ok := vars[varNames[re.Cap-1]]
+		if !ok {
+			return "", errMissingVar(varNames[re.Cap-1])
+		}
+		return value, nil
+	case syntax.OpConcat:
+		var path strings.Builder
+		for _, sub := range re.Sub {
+			part, err := buildPath(sub, varNames, vars)
+			if err != nil {
+				return "", err
+			}
+			path.WriteString(part)
+		}
+		return path.String(), nil
+	case syntax.OpQuest:
+		if re.Sub[0].MaxCap() == 0 {
+			return "", nil
+		}
+		path, err := buildPath(re.Sub[0], varNames, vars)
+		var missing errMissingVar
+		if errors.As(err, &missing) {
+			return "", nil
+		}
+		return path, err
+	case syntax.OpPlus, syntax.OpRepeat:
+		path, err := buildPath(re.Sub[0], varNames, vars)
+		if err != nil {
+			return "", err
+		}
+		return strings.Repeat(path, max(re.Min, 1)), nil
+	case syntax.OpAlternate:
+		var err error
+		for _, sub := range re.Sub {
+			var path string
+			if path, err = buildPath(sub, varNames, vars); err == nil {
+				return path, nil
+			}
+		}
+		return "", err
+	}
+	return "", fmt.Errorf("%q matches more than one path", re.String())
+}
+
+// URLFuncs returns the functions templates use to build URLs of the routes of a Mux: "url", which is called with
+// the name of a route, followed by pairs of variable names and values, and returns its path.
+// Variable names starting with "?" are added as query parameters instead.
+func (m *Mux) URLFuncs() template.FuncMap {
+	return template.FuncMap{
+		"url": func(name string, pairs ...any) (string, error) {
+			if len(pairs)%2 != 0 {
+				return "", fmt.Errorf("url %q: odd number of variable names and values", name)
+			}
+			b := m.URL(name)
+			for ix := 0; ix < len(pairs); ix += 2 {
+				varName := fmt.Sprint(pairs[ix])
+				if query, ok := strings.CutPrefix(varName, "?"); ok {
+					b.Query(query, pairs[ix+1])
+				} else {
+					b.Var(varName, pairs[ix+1])
+				}
+			}
+			u, err := b.Build()
+			if err != nil {
+				return "", err
+			}
+			return u.String(), nil
+		},
+	}
+}
+
+// RedirectingToRoute returns a handler which redirects to the URL of a named route of a Mux, with a specific status
+// code, passing on the values of the route variables of the request with the same names.
+// If the URL cannot be built, the request is answered with 500 Internal Server Error.
+func RedirectingToRoute(m *Mux, name string, statusCode int) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		b := m.URL(name)
+		if b.route != nil {
+			for _, varName := range b.route.VarNames {
+				if value, ok := pathVars[varName]; ok {
+					b.Var(varName, value)
+				}
+			}
+		}
+		u, err := b.Build()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return err
+		}
+		http.Redirect(w, req, u.String(), statusCode)
+		return nil
+	})
+}
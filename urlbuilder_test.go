@@ -0,0 +1,72 @@
+package minimux_test
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("URLBuilder", func() {
+	mux := &minimux.Mux{}
+	mux.Routes = []minimux.Route{
+		minimux.LiteralPath("/").Named("home").IsHandledBy(respondWith("home")),
+		minimux.PathWithVars("/users/([^/]+)", "id").Named("user-detail").IsHandledBy(respondWith("user")),
+		minimux.PathWithVars("/files(/.*)?", "path").Named("files").IsHandledBy(respondWith("files")),
+		minimux.PathPattern("/v[12]/things").Named("ambiguous").IsHandledBy(respondWith("things")),
+		minimux.LiteralPath("/admin").WithHosts("admin.example.com").Named("admin").IsHandledBy(respondWith("admin")),
+		minimux.PathWithVars("/profile/([^/]+)", "id").IsHandledBy(minimux.RedirectingToRoute(mux, "user-detail", http.StatusMovedPermanently)),
+	}
+
+	It("should build paths with escaped variables and queries", func() {
+		Expect(mux.URL("home").String()).To(Equal("/"))
+		Expect(mux.URL("user-detail").Var("id", 42).Query("tab", "posts").Query("q", "a&b").String()).To(Equal("/users/42?q=a%26b&tab=posts"))
+		Expect(mux.URL("user-detail").Var("id", "jane doe?").String()).To(Equal("/users/jane%20doe%3F"))
+		Expect(mux.URL("files").String()).To(Equal("/files"))
+		Expect(mux.URL("files").Var("path", "/a/b c").String()).To(Equal("/files/a/b%20c"))
+	})
+
+	It("should build absolute URLs", func() {
+		Expect(mux.URL("home").Scheme("http").Host("example.com:8080").String()).To(Equal("http://example.com:8080/"))
+		Expect(mux.URL("admin").Scheme("https").String()).To(Equal("https://admin.example.com/admin"))
+	})
+
+	DescribeTable("should fail to build invalid URLs",
+		func(build func() *minimux.URLBuilder) {
+			_, err := build().Build()
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("unknown route", func() *minimux.URLBuilder { return mux.URL("missing") }),
+		Entry("unknown variable", func() *minimux.URLBuilder { return mux.URL("user-detail").Var("name", "x") }),
+		Entry("missing variable", func() *minimux.URLBuilder { return mux.URL("user-detail") }),
+		Entry("value not matching the pattern", func() *minimux.URLBuilder { return mux.URL("user-detail").Var("id", "a/b") }),
+		Entry("pattern matching several paths", func() *minimux.URLBuilder { return mux.URL("ambiguous") }),
+		Entry("scheme without a host", func() *minimux.URLBuilder { return mux.URL("home").Scheme("https") }),
+	)
+
+	It("should build URLs in templates", func() {
+		tmpl := template.Must(template.New("links").Funcs(mux.URLFuncs()).Parse(`<a href="{{ url "user-detail" "id" 7 "?tab" "posts" }}">`))
+		var out strings.Builder
+		Expect(tmpl.Execute(&out, nil)).To(Succeed())
+		Expect(out.String()).To(Equal(`<a href="/users/7?tab=posts">`))
+	})
+
+	It("should redirect to routes", func() {
+		resp := serve(mux, httptest.NewRequest(http.MethodGet, "/profile/9", nil))
+		Expect(resp.Code).To(Equal(http.StatusMovedPermanently))
+		Expect(resp.Header().Get("Location")).To(Equal("/users/9"))
+	})
+
+	It("should reject duplicate names", func() {
+		_, err := minimux.NewRouteTable([]minimux.Route{
+			minimux.LiteralPath("/a").Named("x").IsHandledBy(respondWith("a")),
+			minimux.LiteralPath("/b").Named("x").IsHandledBy(respondWith("b")),
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
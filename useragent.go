@@ -0,0 +1,36 @@
+package minimux
+
+import "regexp"
+
+// KnownBots matches the User-Agents of common crawlers, scrapers, and HTTP client libraries
+var KnownBots = regexp.MustCompile(`(?i)bot\b|crawl|spider|slurp|scrap|fetcher|headless|curl/|wget/|python-requests|python-urllib|go-http-client|java/|okhttp|libwww-perl|httpclient`)
+
+// A UserAgentFilter decides which User-Agents may make requests, such as to keep bots off of expensive routes.
+// Use its Allows method with Route.WithUserAgent.
+type UserAgentFilter struct {
+	// Blocked are patterns of User-Agents which are not allowed, such as KnownBots
+	Blocked []*regexp.Regexp
+	// Allowed are patterns of User-Agents which are allowed even if they match Blocked,
+	// such as a monitoring service
+	Allowed []*regexp.Regexp
+	// BlockEmpty blocks requests without a User-Agent
+	BlockEmpty bool
+}
+
+// Allows returns true if a User-Agent may make requests
+func (f *UserAgentFilter) Allows(userAgent string) bool {
+	for _, pattern := range f.Allowed {
+		if pattern.MatchString(userAgent) {
+			return true
+		}
+	}
+	if userAgent == "" {
+		return !f.BlockEmpty
+	}
+	for _, pattern := range f.Blocked {
+		if pattern.MatchString(userAgent) {
+			return false
+		}
+	}
+	return true
+}
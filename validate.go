@@ -0,0 +1,95 @@
+package minimux
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Validate checks Routes for mistakes which would otherwise only show up while serving requests, returning
+// an error for every route which is invalid, as with Compile, has no Handler, has a different number of VarNames
+// than its pattern has capture groups, has VarTypes for variables it does not have, or can never be reached because an earlier route with the same pattern
+// always handles the same methods and hosts first.
+// Routes with a Matcher are not checked against their patterns, and routes which can be skipped,
+// such as with EnabledWhen, WithMatcher, WithAccept, WithVarTypes, or WithBody, do not hide the routes after them.
+func (m *Mux) Validate() error {
+	t, err := NewRouteTable(m.Routes)
+	if err != nil {
+		return err
+	}
+	return t.Validate()
+}
+
+// Validate checks the routes in this table, as with Mux.Validate
+func (t *RouteTable) Validate() error {
+	var errs []error
+	seen := map[routeCombination]int{}
+	for ix := range t.routes {
+		r := &t.routes[ix]
+		if r.Handler == nil {
+			errs = append(errs, fmt.Errorf("route %d: no Handler", ix))
+		}
+		for name := range r.VarTypes {
+			if !slices.Contains(r.VarNames, name) {
+				errs = append(errs, fmt.Errorf("route %d: VarTypes has type for unknown variable %q", ix, name))
+			}
+		}
+		if r.Matcher != nil {
+			continue
+		}
+		if groups := r.Pattern.NumSubexp(); len(r.VarNames) != groups {
+			errs = append(errs, fmt.Errorf("route %d: %d VarNames for %d capture groups in %q", ix, len(r.VarNames), groups, r.Pattern))
+		}
+		methods, hosts := setOrAny(r.Methods), setOrAny(r.Hosts)
+		if r.HostPattern != nil {
+			// Only routes with the same host pattern, or any host, handle the same hosts
+			hosts = []string{"~" + r.HostPattern.String()}
+		}
+		var shadowedBy []int
+		for _, method := range methods {
+			for _, host := range hosts {
+				if other, ok := shadowingRoute(seen, r.Pattern.String(), method, host); ok {
+					shadowedBy = append(shadowedBy, other)
+					continue
+				}
+				if !r.skippable() {
+					seen[routeCombination{pattern: r.Pattern.String(), method: method, host: host}] = ix
+				}
+			}
+		}
+		if len(shadowedBy) != 0 && len(shadowedBy) == len(methods)*len(hosts) {
+			errs = append(errs, fmt.Errorf("route %d: unreachable, as route %d has the same pattern, methods and hosts", ix, shadowedBy[0]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// routeCombination is a pattern, method and host handled by a route, where an empty method or host stands for any
+type routeCombination struct {
+	pattern, method, host string
+}
+
+// shadowingRoute returns the index of the first route which handles a routeCombination, including by handling any method or host
+func shadowingRoute(seen map[routeCombination]int, pattern, method, host string) (int, bool) {
+	first, found := 0, false
+	for _, m := range []string{method, ""} {
+		for _, h := range []string{host, ""} {
+			if ix, ok := seen[routeCombination{pattern: pattern, method: m, host: h}]; ok && (!found || ix < first) {
+				first, found = ix, true
+			}
+		}
+	}
+	return first, found
+}
+
+// setOrAny returns the elements of a set, or a single empty string to stand for any element if it is nil
+func setOrAny(s StringSet) []string {
+	if s == nil {
+		return []string{""}
+	}
+	elems := make([]string, 0, len(s))
+	for elem := range s {
+		elems = append(elems, elem)
+	}
+	return elems
+}
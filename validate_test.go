@@ -0,0 +1,54 @@
+package minimux_test
+
+import (
+	"net/http"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validating a mux", func() {
+	It("should accept valid routes", func() {
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/users/([0-9]+)", "id").WithMethods(http.MethodGet).IsHandledBy(minimux.NotFound),
+				minimux.PathWithVars("/users/([0-9]+)", "id").WithMethods(http.MethodPut).IsHandledBy(minimux.NotFound),
+				minimux.PathWithVars("/users/([0-9]+)", "id").WithHosts("admin").IsHandledBy(minimux.NotFound),
+				minimux.PathPattern("/users/(?P<id>[a-z]+)").IsHandledBy(minimux.NotFound),
+				minimux.LiteralPath("/beta").WithBody(minimux.LooksLikeJSON).IsHandledBy(minimux.NotFound),
+				minimux.LiteralPath("/beta").IsHandledBy(minimux.NotFound),
+				minimux.MatchedBy(minimux.RegexMatcher{}, "a", "b").IsHandledBy(minimux.NotFound),
+			},
+		}
+		Expect(mux.Validate()).To(Succeed())
+	})
+
+	It("should report every mistake", func() {
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/users/([0-9]+)/([a-z]+)", "id").IsHandledBy(minimux.NotFound),
+				*minimux.LiteralPath("/nil"),
+				minimux.LiteralPath("/users").IsHandledBy(minimux.NotFound),
+				minimux.LiteralPath("/users").WithMethods(http.MethodGet).WithHosts("admin").IsHandledBy(minimux.NotFound),
+				minimux.LiteralPath("/groups").WithMethods(http.MethodGet, http.MethodPost).IsHandledBy(minimux.NotFound),
+				minimux.LiteralPath("/groups").WithMethods(http.MethodPost, http.MethodPut).IsHandledBy(minimux.NotFound),
+			},
+		}
+		err := mux.Validate()
+		Expect(err).To(MatchError(ContainSubstring("route 0: 1 VarNames for 2 capture groups")))
+		Expect(err).To(MatchError(ContainSubstring("route 1: no Handler")))
+		Expect(err).To(MatchError(ContainSubstring("route 3: unreachable, as route 2")))
+		Expect(err).ToNot(MatchError(ContainSubstring("route 5")))
+	})
+
+	It("should report invalid routes", func() {
+		mux := &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.LazyPathWithVars("/(", "name").IsHandledBy(minimux.NotFound),
+			},
+		}
+		Expect(mux.Validate()).To(MatchError(ContainSubstring("route 0")))
+	})
+})
@@ -0,0 +1,75 @@
+package minimux
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// A Validator is a request value, such as one populated by Bind or JSONHandler, which can check itself
+type Validator interface {
+	// Validate returns an error if the value is invalid, which should wrap a FieldError for each invalid field
+	Validate() error
+}
+
+// FieldError is the reason one field of a request value is invalid
+type FieldError struct {
+	// Field is the name of the field, as the client knows it, such as its JSON name
+	Field string
+	// Message is why it is invalid, which is shown to the client
+	Message string
+}
+
+// Error implements error
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ErrUnprocessableEntity answers a request with 422 Unprocessable Entity, such as when its values are invalid
+var ErrUnprocessableEntity = NewHTTPError(http.StatusUnprocessableEntity, http.StatusText(http.StatusUnprocessableEntity))
+
+// FieldErrors returns every FieldError an error wraps, including through errors.Join, in order
+func FieldErrors(err error) []*FieldError {
+	var fields []*FieldError
+	var walk func(err error)
+	walk = func(err error) {
+		switch err := err.(type) {
+		case nil:
+		case *FieldError:
+			fields = append(fields, err)
+		case interface{ Unwrap() []error }:
+			for _, err := range err.Unwrap() {
+				walk(err)
+			}
+		default:
+			walk(errors.Unwrap(err))
+		}
+	}
+	walk(err)
+	return fields
+}
+
+type validateInputKey struct{}
+
+// validateInput checks a value decoded from a request, first by its own Validate method, if it is a Validator,
+// and then by the ValidateInput of the Mux serving the request, if any. Any errors are returned wrapped in
+// ErrUnprocessableEntity, with the FieldErrors they wrap added to its message.
+func validateInput(ctx context.Context, v any) error {
+	var errs []error
+	if validator, ok := v.(Validator); ok {
+		errs = append(errs, validator.Validate())
+	}
+	if validate, ok := ctx.Value(validateInputKey{}).(func(context.Context, any) error); ok {
+		errs = append(errs, validate(ctx, v))
+	}
+	err := errors.Join(errs...)
+	if err == nil {
+		return nil
+	}
+	message := []string{ErrUnprocessableEntity.Message}
+	for _, field := range FieldErrors(err) {
+		message = append(message, field.Error())
+	}
+	return NewHTTPError(http.StatusUnprocessableEntity, strings.Join(message, "\n")).WithInternal(err)
+}
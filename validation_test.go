@@ -0,0 +1,75 @@
+package minimux_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type signup struct {
+	Name  string `json:"name"`
+	Email string `json:"email" query:"email"`
+}
+
+func (s signup) Validate() error {
+	var errs []error
+	if s.Name == "" {
+		errs = append(errs, &minimux.FieldError{Field: "name", Message: "is required"})
+	}
+	if !strings.Contains(s.Email, "@") {
+		errs = append(errs, &minimux.FieldError{Field: "email", Message: "is not an email address"})
+	}
+	return errors.Join(errs...)
+}
+
+var _ = Describe("Validation", func() {
+	mux := &minimux.Mux{
+		ErrorHandler: minimux.WriteError,
+		ValidateInput: func(ctx context.Context, v any) error {
+			if s, ok := v.(*signup); ok && s.Name == "root" {
+				return &minimux.FieldError{Field: "name", Message: "is reserved"}
+			}
+			return nil
+		},
+		Routes: []minimux.Route{
+			minimux.LiteralPath("/json").IsHandledBy(minimux.JSONHandler(func(ctx context.Context, req signup, vars map[string]string) (signup, error) {
+				return req, nil
+			})),
+			minimux.LiteralPath("/bind").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				var s signup
+				if err := minimux.Bind(req.WithContext(ctx), pathVars, &s); err != nil {
+					return err
+				}
+				_, err := w.Write([]byte(s.Name))
+				return err
+			}),
+		},
+	}
+
+	DescribeTable("should answer invalid values with their field errors",
+		func(path, body string, expectedStatus int, expectedBody string) {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			resp := serve(mux, req)
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("valid JSON", "/json", `{"name":"bob","email":"bob@example.com"}`, http.StatusOK, `{"name":"bob","email":"bob@example.com"}`+"\n"),
+		Entry("invalid JSON", "/json", `{"email":"bob"}`, http.StatusUnprocessableEntity, "Unprocessable Entity\nname: is required\nemail: is not an email address\n"),
+		Entry("invalid for the mux", "/json", `{"name":"root","email":"root@example.com"}`, http.StatusUnprocessableEntity, "Unprocessable Entity\nname: is reserved\n"),
+		Entry("valid binding", "/bind?email=bob@example.com", `{"name":"bob"}`, http.StatusOK, "bob"),
+		Entry("invalid binding", "/bind?email=bob", `{"name":"root"}`, http.StatusUnprocessableEntity, "Unprocessable Entity\nemail: is not an email address\nname: is reserved\n"),
+	)
+
+	It("should find field errors which are wrapped", func() {
+		err := minimux.ErrBadRequest.WithInternal(errors.Join(errors.New("other"), &minimux.FieldError{Field: "a", Message: "b"}))
+		Expect(minimux.FieldErrors(err)).To(Equal([]*minimux.FieldError{{Field: "a", Message: "b"}}))
+	})
+})
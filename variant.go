@@ -0,0 +1,215 @@
+package minimux
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// CanaryExperiment is the experiment name Canary records its variant under
+	CanaryExperiment = "canary"
+	// CanaryPrimary is the variant recorded when Canary chooses the primary handler
+	CanaryPrimary = "primary"
+	// CanaryVariant is the variant recorded when Canary chooses the canary handler
+	CanaryVariant = "canary"
+)
+
+type variantsKey struct{}
+
+// variants are the variants chosen for a request, by experiment
+type variants struct {
+	lock   sync.Mutex
+	chosen map[string]string
+}
+
+// RecordVariants is a PreProcessor which records the variants chosen for a request by handlers such as Canary,
+// so that a PostProcessor, which otherwise cannot see the context of the handler, can find them with
+// VariantsFromContext
+var RecordVariants PreProcessor = func(ctx context.Context, req *http.Request) (context.Context, func()) {
+	return context.WithValue(ctx, variantsKey{}, &variants{}), nil
+}
+
+// RecordVariant records the variant of an experiment chosen for a request, returning a context to pass to
+// the handler for the variant. It is recorded where a PostProcessor can find it if RecordVariants was used.
+func RecordVariant(ctx context.Context, experiment, variant string) context.Context {
+	v, ok := ctx.Value(variantsKey{}).(*variants)
+	if !ok {
+		v = &variants{}
+		ctx = context.WithValue(ctx, variantsKey{}, v)
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.chosen == nil {
+		v.chosen = make(map[string]string, 1)
+	}
+	v.chosen[experiment] = variant
+	return ctx
+}
+
+// VariantsFromContext returns a copy of the variants chosen for a request, by experiment
+func VariantsFromContext(ctx context.Context) map[string]string {
+	v, ok := ctx.Value(variantsKey{}).(*variants)
+	if !ok {
+		return nil
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	chosen := make(map[string]string, len(v.chosen))
+	for experiment, variant := range v.chosen {
+		chosen[experiment] = variant
+	}
+	return chosen
+}
+
+// VariantFromContext returns the variant chosen for an experiment, or an empty string if none was
+func VariantFromContext(ctx context.Context, experiment string) string {
+	v, ok := ctx.Value(variantsKey{}).(*variants)
+	if !ok {
+		return ""
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.chosen[experiment]
+}
+
+// Canary returns a handler which sends a percentage, from 0 to 100, of requests to a canary handler,
+// and the rest to a primary handler, recording which was chosen as the variant of CanaryExperiment.
+// Requests are assigned by hashing the result of key, such as a user ID or client address, so that
+// the same key is sent to the same handler while the percentage does not change, and more keys are
+// moved to the canary as it increases. If key is nil or returns an empty string, requests are assigned
+// at random. The percentage is checked for every request, so it can be changed while serving.
+func Canary(primary, canary Handler, percent func() float64, key func(req *http.Request) string) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		var position float64
+		var k string
+		if key != nil {
+			k = key(req)
+		}
+		if k == "" {
+			position = rand.Float64()
+		} else {
+			position = keyPosition(k)
+		}
+		if position*100 < percent() {
+			return canary.ServeHTTP(RecordVariant(ctx, CanaryExperiment, CanaryVariant), w, req, pathVars, formErr)
+		}
+		return primary.ServeHTTP(RecordVariant(ctx, CanaryExperiment, CanaryPrimary), w, req, pathVars, formErr)
+	})
+}
+
+// keyPosition deterministically maps a key to a position in [0, 1)
+func keyPosition(key string) float64 {
+	sum := sha256.Sum256([]byte(key))
+	return float64(binary.BigEndian.Uint64(sum[:])>>11) / (1 << 53)
+}
+
+// DefaultSplitMaxAge is how long a Split remembers the variant assigned to a browser, if its MaxAge is not set
+const DefaultSplitMaxAge = 30 * 24 * time.Hour
+
+// SplitVariant is one of the variants of a Split
+type SplitVariant struct {
+	// Name identifies the variant in the cookie, header, and recorded variants
+	Name string
+	// Weight is the share of new requests assigned to this variant, relative to the others. If zero, 1 is used.
+	Weight float64
+	// Handler serves the requests assigned to this variant
+	Handler Handler
+}
+
+// A Split is a handler for A/B tests, which assigns each browser to one of several named variants at random,
+// according to their weights, remembers the assignment in a cookie, and sends its requests to that variant's handler.
+// The assigned variant is recorded in the context under the experiment's Name, as with RecordVariant,
+// so that it can be logged for analysis.
+type Split struct {
+	// Name is the name of the experiment
+	Name string
+	// Variants are the variants to assign requests to
+	Variants []SplitVariant
+	// Cookie is the name of the cookie which remembers the assigned variant. If empty, "split-" and the Name is used.
+	Cookie string
+	// Header is an optional request header which chooses a variant instead of the cookie, such as for clients
+	// without cookies, or for testing a variant. The choice is not remembered.
+	Header string
+	// MaxAge is how long the cookie lasts. If zero, DefaultSplitMaxAge is used.
+	MaxAge time.Duration
+	// Insecure allows the cookie to be sent over plaintext connections
+	Insecure bool
+	// SameSite is the SameSite mode of the cookie. If zero, http.SameSiteLaxMode is used.
+	SameSite http.SameSite
+}
+
+// variant returns the variant with a name, or nil if there is none
+func (s *Split) variant(name string) *SplitVariant {
+	for ix := range s.Variants {
+		if s.Variants[ix].Name == name {
+			return &s.Variants[ix]
+		}
+	}
+	return nil
+}
+
+// assign chooses a variant for a new request at random, by weight
+func (s *Split) assign() *SplitVariant {
+	var total float64
+	for _, v := range s.Variants {
+		total += splitWeight(v)
+	}
+	position := rand.Float64() * total
+	for ix := range s.Variants {
+		position -= splitWeight(s.Variants[ix])
+		if position < 0 {
+			return &s.Variants[ix]
+		}
+	}
+	return &s.Variants[len(s.Variants)-1]
+}
+
+func splitWeight(v SplitVariant) float64 {
+	if v.Weight == 0 {
+		return 1
+	}
+	return v.Weight
+}
+
+// ServeHTTP implements Handler
+func (s *Split) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	if s.Header != "" {
+		if v := s.variant(req.Header.Get(s.Header)); v != nil {
+			return v.Handler.ServeHTTP(RecordVariant(ctx, s.Name, v.Name), w, req, pathVars, formErr)
+		}
+	}
+	cookieName := s.Cookie
+	if cookieName == "" {
+		cookieName = "split-" + s.Name
+	}
+	var v *SplitVariant
+	if cookie, err := req.Cookie(cookieName); err == nil {
+		v = s.variant(cookie.Value)
+	}
+	if v == nil {
+		v = s.assign()
+		maxAge := s.MaxAge
+		if maxAge == 0 {
+			maxAge = DefaultSplitMaxAge
+		}
+		sameSite := s.SameSite
+		if sameSite == 0 {
+			sameSite = http.SameSiteLaxMode
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookieName,
+			Value:    v.Name,
+			Path:     "/",
+			MaxAge:   int(maxAge / time.Second),
+			Secure:   !s.Insecure,
+			HttpOnly: true,
+			SameSite: sameSite,
+		})
+	}
+	return v.Handler.ServeHTTP(RecordVariant(ctx, s.Name, v.Name), w, req, pathVars, formErr)
+}
@@ -0,0 +1,127 @@
+package minimux_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Canary", func() {
+	var percent float64
+	var served []string
+	var mux *minimux.Mux
+	BeforeEach(func() {
+		served = nil
+		mux = &minimux.Mux{
+			PreProcess: minimux.RecordVariants,
+			PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {
+				served = append(served, minimux.VariantsFromContext(ctx)[minimux.CanaryExperiment])
+			},
+			Routes: []minimux.Route{
+				minimux.LiteralPath("/").IsHandledBy(minimux.Canary(
+					respondWith("primary"),
+					respondWith("canary"),
+					func() float64 { return percent },
+					func(req *http.Request) string { return req.Header.Get("X-User") },
+				)),
+			},
+		}
+	})
+
+	get := func(user string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", user)
+		return serve(mux, req).Body.String()
+	}
+
+	It("should send a sticky fraction of users to the canary, and report it to the PostProcessor", func() {
+		percent = 30
+		canaries := map[string]bool{}
+		for ix := 0; ix < 1000; ix++ {
+			user := fmt.Sprintf("user-%d", ix)
+			canaries[user] = get(user) == "canary"
+		}
+		count := 0
+		for user, canary := range canaries {
+			if canary {
+				count++
+			}
+			Expect(get(user) == "canary").To(Equal(canary))
+		}
+		Expect(count).To(BeNumerically("~", 300, 50))
+		Expect(served).To(HaveLen(2000))
+		Expect(served).To(ContainElements(minimux.CanaryPrimary, minimux.CanaryVariant))
+
+		percent = 60
+		for user, canary := range canaries {
+			if canary {
+				Expect(get(user)).To(Equal("canary"))
+			}
+		}
+	})
+
+	It("should send everyone to the primary at 0%, and the canary at 100%", func() {
+		percent = 0
+		Expect(get("alice")).To(Equal("primary"))
+		Expect(get("")).To(Equal("primary"))
+		percent = 100
+		Expect(get("alice")).To(Equal("canary"))
+		Expect(get("")).To(Equal("canary"))
+	})
+})
+
+var _ = Describe("Split", func() {
+	var seen []string
+	split := &minimux.Split{
+		Name: "checkout",
+		Variants: []minimux.SplitVariant{
+			{Name: "a", Handler: respondWith("a")},
+			{Name: "b", Weight: 3, Handler: respondWith("b")},
+		},
+		Header: "X-Variant",
+	}
+	mux := &minimux.Mux{
+		PreProcess: minimux.RecordVariants,
+		PostProcess: func(ctx context.Context, req *http.Request, statusCode int, err error) {
+			seen = append(seen, minimux.VariantFromContext(ctx, "checkout"))
+		},
+		Routes: []minimux.Route{minimux.LiteralPath("/").IsHandledBy(split)},
+	}
+	BeforeEach(func() { seen = nil })
+
+	It("should assign new browsers to variants by weight, and keep them there", func() {
+		counts := map[string]int{}
+		for ix := 0; ix < 400; ix++ {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+			cookies := resp.Result().Cookies()
+			Expect(cookies).To(HaveLen(1))
+			Expect(cookies[0].Name).To(Equal("split-checkout"))
+			Expect(cookies[0].Value).To(Equal(resp.Body.String()))
+			counts[resp.Body.String()]++
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(cookies[0])
+			resp2 := serve(mux, req)
+			Expect(resp2.Body.String()).To(Equal(cookies[0].Value))
+			Expect(resp2.Result().Cookies()).To(BeEmpty())
+		}
+		Expect(counts["b"]).To(BeNumerically("~", 300, 50))
+		Expect(seen).To(HaveLen(800))
+		Expect(seen).To(ContainElements("a", "b"))
+	})
+
+	It("should let a header choose the variant", func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Variant", "a")
+		resp := serve(mux, req)
+		Expect(resp.Body.String()).To(Equal("a"))
+		Expect(resp.Result().Cookies()).To(BeEmpty())
+		Expect(seen).To(Equal([]string{"a"}))
+	})
+})
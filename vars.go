@@ -0,0 +1,39 @@
+package minimux
+
+import (
+	"context"
+	"maps"
+)
+
+type varsKey struct{}
+
+// withVars returns a context holding the path variables of a request, if it has any, or the context unchanged otherwise
+func withVars(ctx context.Context, pathVars map[string]string) context.Context {
+	if len(pathVars) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, varsKey{}, pathVars)
+}
+
+// detachVars returns a context for work which outlives a request, such as in another goroutine, which is not canceled
+// with it, and which holds a copy of its path variables, along with that copy, so that neither the work nor the
+// handlers still serving the request see the other's changes to them
+func detachVars(ctx context.Context, pathVars map[string]string) (context.Context, map[string]string) {
+	detached := make(map[string]string, len(pathVars))
+	maps.Copy(detached, pathVars)
+	return context.WithValue(context.WithoutCancel(ctx), varsKey{}, detached), detached
+}
+
+// VarsFromContext returns the path variables of the route which is handling a request, such as from within
+// a net/http.Handler wrapped with Simple, which cannot receive them otherwise.
+// As with the pathVars passed to a Handler, the map may be kept after the request is finished,
+// but must not be modified.
+func VarsFromContext(ctx context.Context) map[string]string {
+	vars, _ := ctx.Value(varsKey{}).(map[string]string)
+	return vars
+}
+
+// Var returns the value of a path variable of the route which is handling a request, or an empty string if it has none
+func Var(ctx context.Context, name string) string {
+	return VarsFromContext(ctx)[name]
+}
@@ -0,0 +1,50 @@
+package minimux_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Path variables in the context", func() {
+	mux := &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.PathWithVars("/users/([^/]+)", "id").IsHandledBy(minimux.SimpleFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte("simple-" + minimux.Var(req.Context(), "id")))
+			})),
+			minimux.PathWithVars("/groups/([^/]+)", "id").IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+				_, err := w.Write([]byte("group-" + minimux.VarsFromContext(ctx)["id"]))
+				return err
+			}),
+			minimux.LiteralPath("/").IsHandledBy(minimux.SimpleFunc(func(w http.ResponseWriter, req *http.Request) {
+				Expect(minimux.VarsFromContext(req.Context())).To(BeEmpty())
+			})),
+		},
+	}
+
+	It("should be available to wrapped net/http handlers", func() {
+		resp := serve(mux, httptest.NewRequest(http.MethodGet, "/users/bob", nil))
+		Expect(resp.Body.String()).To(Equal("simple-bob"))
+	})
+	It("should be available to handlers", func() {
+		resp := serve(mux, httptest.NewRequest(http.MethodGet, "/groups/admins", nil))
+		Expect(resp.Body.String()).To(Equal("group-admins"))
+	})
+	It("should be empty for routes without variables", func() {
+		serve(mux, httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	It("should be available to handlers called directly with variables", func() {
+		handler := minimux.SimpleFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(minimux.Var(req.Context(), "id")))
+		})
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		Expect(handler.ServeHTTP(req.Context(), resp, req, map[string]string{"id": "direct"}, nil)).To(Succeed())
+		Expect(resp.Body.String()).To(Equal("direct"))
+	})
+})
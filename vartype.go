@@ -0,0 +1,109 @@
+package minimux
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// A VarType decides whether the value of a route variable is valid, such as whether it is a number
+type VarType func(value string) bool
+
+var (
+	// VarInt accepts decimal integers which fit in an int, as read by IntVar
+	VarInt VarType = func(value string) bool {
+		_, err := strconv.Atoi(value)
+		return err == nil
+	}
+	// VarInt64 accepts decimal integers which fit in an int64, as read by Int64Var
+	VarInt64 VarType = func(value string) bool {
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	}
+	// VarBool accepts the values accepted by strconv.ParseBool, as read by BoolVar
+	VarBool VarType = func(value string) bool {
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	}
+	// VarDate accepts dates in the form 2006-01-02, as read by DateVar
+	VarDate VarType = func(value string) bool {
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	}
+	// VarUUID accepts UUIDs in their canonical form, such as 123e4567-e89b-12d3-a456-426614174000, in either case
+	VarUUID VarType = func(value string) bool {
+		if len(value) != 36 {
+			return false
+		}
+		for ix := 0; ix < len(value); ix++ {
+			c := value[ix]
+			switch ix {
+			case 8, 13, 18, 23:
+				if c != '-' {
+					return false
+				}
+			default:
+				if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+					return false
+				}
+			}
+		}
+		return true
+	}
+)
+
+// WithVarTypes limits a handler to requests whose route variables are valid for their types, such as VarInt
+// for numeric IDs, so that handlers can read them with accessors like IntVar without checking for errors.
+// Requests with an invalid variable continue on to the next matching route, and so are answered with
+// 404 Not Found if there is none, as the resource they name cannot exist.
+func (r *Route) WithVarTypes(types map[string]VarType) *Route {
+	r.VarTypes = types
+	return r
+}
+
+// varsValid returns true if every route variable with a type in VarTypes is valid, given their values
+// in the order of VarNames
+func (r *Route) varsValid(values []string) bool {
+	for ix, name := range r.VarNames {
+		if valid, ok := r.VarTypes[name]; ok && (ix >= len(values) || !valid(values[ix])) {
+			return false
+		}
+	}
+	return true
+}
+
+// IntVar returns the value of a route variable as an int
+func IntVar(pathVars map[string]string, name string) (int, error) {
+	value, err := strconv.Atoi(pathVars[name])
+	if err != nil {
+		return 0, fmt.Errorf("route variable %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// Int64Var returns the value of a route variable as an int64
+func Int64Var(pathVars map[string]string, name string) (int64, error) {
+	value, err := strconv.ParseInt(pathVars[name], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("route variable %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// BoolVar returns the value of a route variable as a bool
+func BoolVar(pathVars map[string]string, name string) (bool, error) {
+	value, err := strconv.ParseBool(pathVars[name])
+	if err != nil {
+		return false, fmt.Errorf("route variable %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// DateVar returns the value of a route variable in the form 2006-01-02 as midnight UTC on that date
+func DateVar(pathVars map[string]string, name string) (time.Time, error) {
+	value, err := time.Parse(time.DateOnly, pathVars[name])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("route variable %s: %w", name, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,71 @@
+package minimux_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Typed route variables", func() {
+	mux := &minimux.Mux{
+		DefaultHandler: minimux.NotFound,
+		Routes: []minimux.Route{
+			minimux.Pattern("GET /users/{id}").
+				WithVarTypes(map[string]minimux.VarType{"id": minimux.VarInt64}).
+				IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					id, err := minimux.Int64Var(pathVars, "id")
+					Expect(err).ToNot(HaveOccurred())
+					_, err = fmt.Fprintf(w, "user %d", id+1)
+					return err
+				}),
+			minimux.Pattern("GET /users/me").IsHandledBy(minimux.NewStaticString("me", "text/plain")),
+			minimux.Pattern("GET /reports/{date}/{final}").
+				WithVarTypes(map[string]minimux.VarType{"date": minimux.VarDate, "final": minimux.VarBool}).
+				IsHandledByFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+					date, err := minimux.DateVar(pathVars, "date")
+					Expect(err).ToNot(HaveOccurred())
+					final, err := minimux.BoolVar(pathVars, "final")
+					Expect(err).ToNot(HaveOccurred())
+					_, err = fmt.Fprintf(w, "%s %t", date.Weekday(), final)
+					return err
+				}),
+			minimux.Pattern("GET /orders/{id}").
+				WithVarTypes(map[string]minimux.VarType{"id": minimux.VarUUID}).
+				IsHandledBy(respondWith("order")),
+		},
+	}
+
+	DescribeTable("should only handle requests with valid variables",
+		func(path string, expectedStatus int, expectedBody string) {
+			resp := serve(mux, httptest.NewRequest(http.MethodGet, path, nil))
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("int64", "/users/41", http.StatusOK, "user 42"),
+		Entry("not an int64, handled by the next route", "/users/me", http.StatusOK, "me"),
+		Entry("not an int64, without a next route", "/users/bob", http.StatusNotFound, ""),
+		Entry("date and bool", "/reports/2024-01-01/true", http.StatusOK, "Monday true"),
+		Entry("invalid date", "/reports/2024-13-01/true", http.StatusNotFound, ""),
+		Entry("invalid bool", "/reports/2024-01-01/maybe", http.StatusNotFound, ""),
+		Entry("uuid", "/orders/123e4567-e89b-12d3-A456-426614174000", http.StatusOK, "order"),
+		Entry("invalid uuid", "/orders/123e4567e89b12d3a456426614174000", http.StatusNotFound, ""),
+	)
+
+	It("should reject types for unknown variables", func() {
+		invalid := &minimux.Mux{Routes: []minimux.Route{
+			minimux.Pattern("/users/{id}").WithVarTypes(map[string]minimux.VarType{"name": minimux.VarInt}).IsHandledBy(minimux.NotFound),
+		}}
+		Expect(invalid.Validate()).To(MatchError(ContainSubstring(`unknown variable "name"`)))
+	})
+
+	It("should report invalid values from accessors", func() {
+		_, err := minimux.IntVar(map[string]string{"id": "x"}, "id")
+		Expect(err).To(MatchError(ContainSubstring("route variable id")))
+	})
+})
@@ -0,0 +1,74 @@
+package minimux
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+type apiVersionKey struct{}
+
+// APIVersionFromContext returns the API version chosen for a request by a Versioned handler, or false if none was
+func APIVersionFromContext(ctx context.Context) (string, bool) {
+	version, ok := ctx.Value(apiVersionKey{}).(string)
+	return version, ok
+}
+
+// Versioned is a handler which calls one of several implementations of a route, one for each version of an API,
+// so that supporting several versions does not require a route for each. The version is taken from the first of
+// these the request has: a path variable, such as from a "/(v[0-9]+)/..." prefix, a custom header, such as
+// "API-Version", or a parameter of its Accept header, such as "application/json; version=2", or otherwise is
+// the Default. Versions are compared without any leading "v", so "v2" and "2" are the same version.
+// Requests for versions which are not supported are answered with 406 Not Acceptable.
+// The chosen version can be found by the handler with APIVersionFromContext.
+type Versioned struct {
+	// Versions are the implementations for each version, without any leading "v"
+	Versions map[string]Handler
+	// Default is the version for requests which do not specify one. If empty, they are not acceptable.
+	Default string
+	// PathVar, if non-empty, is the path variable which holds the version
+	PathVar string
+	// Header, if non-empty, is the name of a header which holds the version
+	Header string
+	// AcceptParam, if non-empty, is the parameter of the media types in the Accept header which holds the version
+	AcceptParam string
+}
+
+// version returns the version a request asks for, if any
+func (v Versioned) version(w http.ResponseWriter, req *http.Request, pathVars map[string]string) string {
+	if v.PathVar != "" {
+		if version := pathVars[v.PathVar]; version != "" {
+			return version
+		}
+	}
+	if v.Header != "" {
+		w.Header().Add("Vary", v.Header)
+		if version := req.Header.Get(v.Header); version != "" {
+			return version
+		}
+	}
+	if v.AcceptParam != "" {
+		w.Header().Add("Vary", "Accept")
+		for _, accept := range req.Header.Values("Accept") {
+			for _, mediaRange := range strings.Split(accept, ",") {
+				_, params, err := mime.ParseMediaType(mediaRange)
+				if err == nil && params[v.AcceptParam] != "" {
+					return params[v.AcceptParam]
+				}
+			}
+		}
+	}
+	return v.Default
+}
+
+// ServeHTTP implements Handler
+func (v Versioned) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	version := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(v.version(w, req, pathVars)), "v"), "V")
+	handler, ok := v.Versions[version]
+	if !ok {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return nil
+	}
+	return handler.ServeHTTP(context.WithValue(ctx, apiVersionKey{}, version), w, req, pathVars, formErr)
+}
@@ -0,0 +1,54 @@
+package minimux_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Versioned", func() {
+	implementation := func(name string) minimux.Handler {
+		return minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+			version, _ := minimux.APIVersionFromContext(ctx)
+			w.Write([]byte(name + " " + version + " " + pathVars["id"]))
+			return nil
+		})
+	}
+	versions := map[string]minimux.Handler{"1": implementation("old"), "2": implementation("new")}
+	mux := &minimux.Mux{
+		Routes: []minimux.Route{
+			minimux.PathWithVars("/(v[0-9]+)/users/([^/]+)", "version", "id").
+				IsHandledBy(minimux.Versioned{Versions: versions, PathVar: "version"}),
+			minimux.PathWithVars("/users/([^/]+)", "id").
+				IsHandledBy(minimux.Versioned{Versions: versions, Default: "1", Header: "API-Version", AcceptParam: "version"}),
+		},
+	}
+
+	DescribeTable("should call the implementation for the requested version",
+		func(path string, headers []string, expectedStatus int, expectedBody string) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			for ix := 0; ix < len(headers); ix += 2 {
+				req.Header.Set(headers[ix], headers[ix+1])
+			}
+			resp := serve(mux, req)
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("by path prefix", "/v2/users/alice", nil, http.StatusOK, "new 2 alice"),
+		Entry("by unsupported path prefix", "/v3/users/alice", nil, http.StatusNotAcceptable, ""),
+		Entry("by header", "/users/alice", []string{"API-Version", "2"}, http.StatusOK, "new 2 alice"),
+		Entry("by Accept parameter", "/users/alice", []string{"Accept", "text/html, application/json; version=v2"}, http.StatusOK, "new 2 alice"),
+		Entry("by default", "/users/alice", nil, http.StatusOK, "old 1 alice"),
+		Entry("by unsupported header", "/users/alice", []string{"API-Version", "9"}, http.StatusNotAcceptable, ""),
+	)
+
+	It("should vary responses by the headers it uses", func() {
+		resp := serve(mux, httptest.NewRequest(http.MethodGet, "/users/alice", nil))
+		Expect(resp.Header().Values("Vary")).To(ConsistOf("API-Version", "Accept"))
+	})
+})
@@ -0,0 +1,176 @@
+package minimux
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPollInterval is how often a PollingWatcher checks for changes, if its Interval is not set
+const DefaultPollInterval = 2 * time.Second
+
+// A Watcher reports when the files in a directory may have changed, such as by polling, or with fsnotify
+type Watcher interface {
+	// Watch calls changed whenever the files in a directory may have changed, until the context is done
+	Watch(ctx context.Context, dir string, changed func()) error
+}
+
+// A PollingWatcher is a Watcher which periodically checks the names, sizes, and modification times of the files
+// in a directory, which works on every filesystem, including network and container volumes, at the cost of latency
+type PollingWatcher struct {
+	// Interval is how often to check for changes. If zero, DefaultPollInterval is used.
+	Interval time.Duration
+}
+
+// Watch implements Watcher
+func (p PollingWatcher) Watch(ctx context.Context, dir string, changed func()) error {
+	interval := p.Interval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+	last, err := fingerprintDir(dir)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		current, err := fingerprintDir(dir)
+		if err != nil || current == last {
+			continue
+		}
+		last = current
+		changed()
+	}
+}
+
+// fingerprintDir returns a hash of the names, sizes, and modification times of the files in a directory tree
+func fingerprintDir(dir string) ([sha256.Size]byte, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		hash.Write([]byte(p))
+		hash.Write(binary.BigEndian.AppendUint64(nil, uint64(info.Size())))
+		hash.Write(binary.BigEndian.AppendUint64(nil, uint64(info.ModTime().UnixNano())))
+		return nil
+	})
+	var sum [sha256.Size]byte
+	hash.Sum(sum[:0])
+	return sum, err
+}
+
+// WatchedStatic is a handler which serves the files in a directory from memory, as with StaticData, keyed by their
+// slash-separated paths within the directory, starting with a "/", and reloads them when its Watcher reports changes,
+// so that content such as landing pages can be updated without restarting. Files named index.html are also served
+// at the path of their directory, with a trailing slash. Symbolic links are not followed.
+// The files are loaded on the first request if Load has not been called, and reloaded only while Watch is running.
+// If they cannot be loaded then, requests are answered with 503 Service Unavailable until a reload succeeds.
+type WatchedStatic struct {
+	// Dir is the directory to load files from
+	Dir string
+	// PathVar, if non-empty, is the path variable to use as the key instead of the entire URL path, as with StaticData
+	PathVar string
+	// DefaultHandler is called for paths which have no file, as with StaticData
+	DefaultHandler Handler
+	// Watcher reports when the files may have changed. If nil, a PollingWatcher is used.
+	Watcher Watcher
+	// OnReload, if set, is called after each attempt to reload the files, with the error, if it failed,
+	// in which case the previously loaded files continue to be served
+	OnReload func(err error)
+
+	once   sync.Once
+	loaded atomic.Pointer[StaticData]
+}
+
+// Load loads the files from the directory, replacing those previously loaded if it succeeds
+func (s *WatchedStatic) Load() error {
+	data := &StaticData{StaticBytes: make(map[string]StaticBytes), PathVar: s.PathVar, DefaultHandler: s.DefaultHandler}
+	err := filepath.WalkDir(s.Dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.Dir, p)
+		if err != nil {
+			return err
+		}
+		key := "/" + filepath.ToSlash(rel)
+		contentType := mime.TypeByExtension(path.Ext(key))
+		if contentType == "" {
+			contentType = http.DetectContentType(content)
+		}
+		static := NewHashedStaticBytes(content, contentType, info.ModTime())
+		data.StaticBytes[key] = static
+		if path.Base(key) == "index.html" {
+			data.StaticBytes[strings.TrimSuffix(key, "index.html")] = static
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.loaded.Store(data)
+	return nil
+}
+
+// reload loads the files again, reporting the result to OnReload
+func (s *WatchedStatic) reload() {
+	err := s.Load()
+	if s.OnReload != nil {
+		s.OnReload(err)
+	}
+}
+
+// Watch reloads the files whenever the Watcher reports they may have changed, until the context is done
+func (s *WatchedStatic) Watch(ctx context.Context) error {
+	watcher := s.Watcher
+	if watcher == nil {
+		watcher = PollingWatcher{}
+	}
+	return watcher.Watch(ctx, s.Dir, s.reload)
+}
+
+// ServeHTTP implements Handler
+func (s *WatchedStatic) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	data := s.loaded.Load()
+	if data == nil {
+		s.once.Do(func() {
+			if s.loaded.Load() == nil {
+				s.reload()
+			}
+		})
+		if data = s.loaded.Load(); data == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return nil
+		}
+	}
+	return data.ServeHTTP(ctx, w, req, pathVars, formErr)
+}
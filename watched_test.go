@@ -0,0 +1,77 @@
+package minimux_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WatchedStatic", func() {
+	var dir string
+	var static *minimux.WatchedStatic
+	var reloads chan error
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>v1</h1>"), 0o644)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(dir, "about"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "about", "index.html"), []byte("about"), 0o644)).To(Succeed())
+		reloads = make(chan error, 10)
+		static = &minimux.WatchedStatic{
+			Dir:            dir,
+			DefaultHandler: minimux.NotFound,
+			Watcher:        minimux.PollingWatcher{Interval: 10 * time.Millisecond},
+			OnReload:       func(err error) { reloads <- err },
+		}
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		return serve(&minimux.Mux{Routes: []minimux.Route{minimux.PathPattern("/.*").IsHandledBy(static)}}, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	It("should serve the files in the directory", func() {
+		resp := get("/")
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("Content-Type")).To(HavePrefix("text/html"))
+		Expect(resp.Header().Get("ETag")).ToNot(BeEmpty())
+		Expect(resp.Body.String()).To(Equal("<h1>v1</h1>"))
+		Expect(get("/index.html").Body.String()).To(Equal("<h1>v1</h1>"))
+		Expect(get("/about/").Body.String()).To(Equal("about"))
+		Expect(get("/missing").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should reload the files when they change", func() {
+		Expect(static.Load()).To(Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- static.Watch(ctx) }()
+		DeferCleanup(func() {
+			cancel()
+			Eventually(done).Should(Receive(MatchError(context.Canceled)))
+		})
+
+		Expect(os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>version 2</h1>"), 0o644)).To(Succeed())
+		// The watcher may not have started polling until after the first change, so keep changing files until it notices
+		added := ""
+		Eventually(func() chan error {
+			added += "new"
+			Expect(os.WriteFile(filepath.Join(dir, "new.txt"), []byte(added), 0o644)).To(Succeed())
+			return reloads
+		}).Should(Receive(BeNil()))
+		Eventually(func() string { return get("/").Body.String() }).Should(Equal("<h1>version 2</h1>"))
+		Eventually(func() string { return get("/new.txt").Body.String() }).Should(Equal(added))
+	})
+
+	It("should answer 503 if the files cannot be loaded", func() {
+		static.Dir = filepath.Join(dir, "missing")
+		Expect(get("/").Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(reloads).To(Receive(HaveOccurred()))
+	})
+})
@@ -0,0 +1,534 @@
+package minimux
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A WritableFS is a filesystem which can also be modified, such as by a WebDAV handler.
+// Names are as for fs.FS, i.e. slash-separated and unrooted, with "." for the root.
+type WritableFS interface {
+	fs.StatFS
+	// Create creates a file, or truncates an existing one, for writing
+	Create(name string) (io.WriteCloser, error)
+	// Mkdir creates a directory, whose parent must already exist
+	Mkdir(name string) error
+	// RemoveAll removes a file, or a directory and everything in it
+	RemoveAll(name string) error
+	// Rename moves a file or directory, replacing any file at the new name
+	Rename(oldName, newName string) error
+}
+
+// WritableDirFS returns a WritableFS for the directory tree rooted at a directory on disk.
+// As with ContainedPath, symbolic links which lead outside of the directory are refused with ErrUnsafePath,
+// and names which are symbolic links themselves, even to somewhere inside it, can't be created, removed, or renamed.
+func WritableDirFS(root string) WritableFS {
+	return writableDirFS{root: root}
+}
+
+type writableDirFS struct {
+	root string
+}
+
+// path returns the path on disk of a name, which need not exist, as long as its parent directory does
+func (d writableDirFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	resolved, err := ContainedPath(d.root, name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return resolved, err
+	}
+	parent, err := ContainedPath(d.root, path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, path.Base(name)), nil
+}
+
+// writablePath returns the path on disk of a name to change, which need not exist, as long as its parent directory
+// does. Names which are symbolic links are refused, including dangling ones, which would otherwise be followed
+// to wherever they lead, such as by creating a file outside of the root.
+func (d writableDirFS) writablePath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	parent, err := ContainedPath(d.root, path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(parent, path.Base(name))
+	info, err := os.Lstat(p)
+	if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		return "", &fs.PathError{Op: op, Path: name, Err: ErrUnsafePath}
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	return p, nil
+}
+
+// Open implements fs.FS
+func (d writableDirFS) Open(name string) (fs.File, error) {
+	p, err := d.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Stat implements fs.StatFS
+func (d writableDirFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := d.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+// Create implements WritableFS
+func (d writableDirFS) Create(name string) (io.WriteCloser, error) {
+	p, err := d.writablePath("create", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(p)
+}
+
+// Mkdir implements WritableFS
+func (d writableDirFS) Mkdir(name string) error {
+	p, err := d.writablePath("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.Mkdir(p, 0o755)
+}
+
+// RemoveAll implements WritableFS
+func (d writableDirFS) RemoveAll(name string) error {
+	p, err := d.writablePath("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+// Rename implements WritableFS
+func (d writableDirFS) Rename(oldName, newName string) error {
+	oldPath, err := d.writablePath("rename", oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := d.writablePath("rename", newName)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+// WebDAV is a handler which exposes a WritableFS to WebDAV clients, implementing the subset of RFC 4918 needed to
+// browse and edit it: OPTIONS, GET, HEAD, PROPFIND, MKCOL, PUT, DELETE, and MOVE. Locking is not supported,
+// so clients which require it, such as the macOS Finder, can only read.
+// If PathVar is non-empty, that path variable is used as the path within the filesystem instead of the entire
+// URL path, and the rest of the URL path is taken to be the prefix for every path. Requests for paths which fail
+// CheckPath are answered with 400 Bad Request. So that one request can't list an entire tree, PROPFIND requests
+// for a directory with a Depth of infinity, which is the default, are refused with 403 Forbidden, as RFC 4918 allows.
+type WebDAV struct {
+	FS      WritableFS
+	PathVar string
+}
+
+// webDAVMethods are the methods supported by a WebDAV handler
+const webDAVMethods = "OPTIONS, GET, HEAD, PROPFIND, MKCOL, PUT, DELETE, MOVE"
+
+// ServeHTTP implements Handler
+func (d WebDAV) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	p := req.URL.Path
+	if d.PathVar != "" {
+		p = pathVars[d.PathVar]
+	}
+	if CheckPath(p) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	prefix := strings.TrimSuffix(req.URL.Path, p)
+	name := webDAVName(p)
+	switch req.Method {
+	case http.MethodOptions:
+		w.Header().Set("DAV", "1")
+		w.Header().Set("Allow", webDAVMethods)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case http.MethodGet, http.MethodHead:
+		return d.get(w, req, name)
+	case "PROPFIND":
+		return d.propfind(w, req, prefix, name)
+	case "MKCOL":
+		if req.ContentLength > 0 {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return nil
+		}
+		if _, err := d.FS.Stat(name); err == nil {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return nil
+		}
+		if status, err := d.checkParent(name); status != 0 {
+			w.WriteHeader(status)
+			return err
+		}
+		if err := d.FS.Mkdir(name); err != nil {
+			return webDAVError(w, err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		return nil
+	case http.MethodPut:
+		return d.put(w, req, name)
+	case http.MethodDelete:
+		if name == "." {
+			w.WriteHeader(http.StatusForbidden)
+			return nil
+		}
+		if _, err := d.FS.Stat(name); err != nil {
+			return webDAVError(w, err)
+		}
+		if err := d.FS.RemoveAll(name); err != nil {
+			return webDAVError(w, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case "MOVE":
+		return d.move(w, req, prefix, name)
+	default:
+		w.Header().Set("Allow", webDAVMethods)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil
+	}
+}
+
+// webDAVName returns the name within the filesystem of a slash-separated path from a request
+func webDAVName(p string) string {
+	name := strings.Trim(path.Clean("/"+p), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// webDAVError answers a request with the status for an error from the filesystem,
+// returning the error if it is not the client's fault
+func webDAVError(w http.ResponseWriter, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, fs.ErrExist):
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	case errors.Is(err, fs.ErrPermission):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, fs.ErrInvalid), errors.Is(err, ErrUnsafePath):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	return nil
+}
+
+// checkParent returns 409 Conflict if the parent of a name is not an existing directory
+func (d WebDAV) checkParent(name string) (int, error) {
+	if name == "." {
+		return http.StatusMethodNotAllowed, nil
+	}
+	info, err := d.FS.Stat(path.Dir(name))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !info.IsDir()) {
+		return http.StatusConflict, nil
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+func (d WebDAV) get(w http.ResponseWriter, req *http.Request, name string) error {
+	f, err := d.FS.Open(name)
+	if err != nil {
+		return webDAVError(w, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return webDAVError(w, err)
+	}
+	if info.IsDir() {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, MKCOL, DELETE, MOVE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil
+	}
+	if content, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, req, info.Name(), info.ModTime(), content)
+		return nil
+	}
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodHead {
+		return nil
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (d WebDAV) put(w http.ResponseWriter, req *http.Request, name string) error {
+	info, err := d.FS.Stat(name)
+	existed := err == nil
+	if existed && info.IsDir() {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil
+	}
+	if !existed {
+		if status, err := d.checkParent(name); status != 0 {
+			w.WriteHeader(status)
+			return err
+		}
+	}
+	f, err := d.FS.Create(name)
+	if err != nil {
+		return webDAVError(w, err)
+	}
+	_, err = io.Copy(f, req.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	if existed {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	return nil
+}
+
+func (d WebDAV) move(w http.ResponseWriter, req *http.Request, prefix, name string) error {
+	destination, err := url.Parse(req.Header.Get("Destination"))
+	if err != nil || destination.Path == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	if destination.Host != "" && destination.Host != req.Host {
+		w.WriteHeader(http.StatusBadGateway)
+		return nil
+	}
+	p, ok := strings.CutPrefix(destination.Path, prefix)
+	if !ok || CheckPath(p) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	newName := webDAVName(p)
+	if name == "." || newName == "." || newName == name || strings.HasPrefix(newName, name+"/") {
+		w.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	if _, err := d.FS.Stat(name); err != nil {
+		return webDAVError(w, err)
+	}
+	if status, err := d.checkParent(newName); status != 0 {
+		w.WriteHeader(status)
+		return err
+	}
+	_, err = d.FS.Stat(newName)
+	existed := err == nil
+	if existed {
+		if req.Header.Get("Overwrite") == "F" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return nil
+		}
+		if err := d.FS.RemoveAll(newName); err != nil {
+			return webDAVError(w, err)
+		}
+	}
+	if err := d.FS.Rename(name, newName); err != nil {
+		return webDAVError(w, err)
+	}
+	if existed {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	return nil
+}
+
+// webDAVPropfind is the body of a PROPFIND request
+type webDAVPropfind struct {
+	XMLName  xml.Name  `xml:"DAV: propfind"`
+	PropName *struct{} `xml:"DAV: propname"`
+	Prop     *struct {
+		Names []struct {
+			XMLName xml.Name
+		} `xml:",any"`
+	} `xml:"DAV: prop"`
+}
+
+type webDAVMultistatus struct {
+	XMLName   xml.Name         `xml:"D:multistatus"`
+	Namespace string           `xml:"xmlns:D,attr"`
+	Responses []webDAVResponse `xml:"D:response"`
+}
+
+type webDAVResponse struct {
+	Href      string           `xml:"D:href"`
+	Propstats []webDAVPropstat `xml:"D:propstat"`
+}
+
+type webDAVPropstat struct {
+	Props  []webDAVProperty `xml:"D:prop>_"`
+	Status string           `xml:"D:status"`
+}
+
+type webDAVProperty struct {
+	XMLName xml.Name
+	Value   string `xml:",innerxml"`
+}
+
+// webDAVProperties are the names of the properties a WebDAV handler reports, in the DAV: namespace
+var webDAVProperties = []string{"displayname", "resourcetype", "getcontentlength", "getcontenttype", "getlastmodified"}
+
+// webDAVPropertyOf returns the value of a property of a file as XML, or false if it does not have that property
+func webDAVPropertyOf(info fs.FileInfo, name, property string) (string, bool) {
+	var value strings.Builder
+	switch property {
+	case "displayname":
+		xml.EscapeText(&value, []byte(path.Base(name)))
+	case "resourcetype":
+		if info.IsDir() {
+			value.WriteString("<D:collection/>")
+		}
+	case "getcontentlength":
+		if info.IsDir() {
+			return "", false
+		}
+		value.WriteString(strconv.FormatInt(info.Size(), 10))
+	case "getcontenttype":
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if info.IsDir() || contentType == "" {
+			return "", false
+		}
+		xml.EscapeText(&value, []byte(contentType))
+	case "getlastmodified":
+		value.WriteString(info.ModTime().UTC().Format(http.TimeFormat))
+	default:
+		return "", false
+	}
+	return value.String(), true
+}
+
+func (d WebDAV) propfind(w http.ResponseWriter, req *http.Request, prefix, name string) error {
+	var body webDAVPropfind
+	if err := xml.NewDecoder(req.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	var requested []xml.Name
+	if body.Prop != nil {
+		for _, prop := range body.Prop.Names {
+			requested = append(requested, prop.XMLName)
+		}
+	} else {
+		for _, property := range webDAVProperties {
+			requested = append(requested, xml.Name{Space: "DAV:", Local: property})
+		}
+	}
+
+	depth := req.Header.Get("Depth")
+	if depth != "" && depth != "0" && depth != "1" && depth != "infinity" {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	root, err := d.FS.Stat(name)
+	if err != nil {
+		return webDAVError(w, err)
+	}
+	if root.IsDir() && depth != "0" && depth != "1" {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		_, err := io.WriteString(w, xml.Header+`<D:error xmlns:D="DAV:"><D:propfind-finite-depth/></D:error>`)
+		return err
+	}
+	multistatus := webDAVMultistatus{Namespace: "DAV:"}
+	respond := func(name string, info fs.FileInfo) {
+		href := prefix + "/" + strings.TrimPrefix(name, ".")
+		href = strings.TrimSuffix(strings.ReplaceAll(href, "//", "/"), "/")
+		if info.IsDir() {
+			href += "/"
+		}
+		found := webDAVPropstat{Status: "HTTP/1.1 200 OK"}
+		missing := webDAVPropstat{Status: "HTTP/1.1 404 Not Found"}
+		for _, property := range requested {
+			value, ok := "", false
+			if property.Space == "DAV:" {
+				value, ok = webDAVPropertyOf(info, name, property.Local)
+			}
+			if !ok {
+				missing.Props = append(missing.Props, webDAVProperty{XMLName: property})
+				continue
+			}
+			if body.PropName != nil {
+				value = ""
+			}
+			found.Props = append(found.Props, webDAVProperty{XMLName: xml.Name{Local: "D:" + property.Local}, Value: value})
+		}
+		response := webDAVResponse{Href: (&url.URL{Path: href}).EscapedPath()}
+		for _, propstat := range []webDAVPropstat{found, missing} {
+			if len(propstat.Props) != 0 {
+				response.Propstats = append(response.Propstats, propstat)
+			}
+		}
+		multistatus.Responses = append(multistatus.Responses, response)
+	}
+
+	respond(name, root)
+	if root.IsDir() && depth == "1" {
+		err = fs.WalkDir(d.FS, name, func(p string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p == name {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			respond(p, info)
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return webDAVError(w, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(multistatus)
+}
@@ -0,0 +1,120 @@
+package minimux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebDAV", func() {
+	var root string
+	var mux *minimux.Mux
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(root, "hello.txt"), []byte("hello"), 0o644)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(root, "docs"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("a"), 0o644)).To(Succeed())
+		mux = &minimux.Mux{
+			Routes: []minimux.Route{
+				minimux.PathWithVars("/dav(/.*)?", "path").IsHandledBy(minimux.WebDAV{FS: minimux.WritableDirFS(root), PathVar: "path"}),
+			},
+		}
+	})
+
+	request := func(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for ix := 0; ix < len(headers); ix += 2 {
+			req.Header.Set(headers[ix], headers[ix+1])
+		}
+		return serve(mux, req)
+	}
+
+	It("should advertise WebDAV", func() {
+		resp := request(http.MethodOptions, "/dav/", "")
+		Expect(resp.Header().Get("DAV")).To(Equal("1"))
+		Expect(resp.Header().Get("Allow")).To(ContainSubstring("PROPFIND"))
+	})
+
+	It("should list a directory", func() {
+		resp := request("PROPFIND", "/dav/", "", "Depth", "1")
+		Expect(resp.Code).To(Equal(http.StatusMultiStatus))
+		body := resp.Body.String()
+		Expect(body).To(ContainSubstring("<D:href>/dav/</D:href>"))
+		Expect(body).To(ContainSubstring("<D:href>/dav/docs/</D:href>"))
+		Expect(body).To(ContainSubstring("<D:href>/dav/hello.txt</D:href>"))
+		Expect(body).To(ContainSubstring("<D:getcontentlength>5</D:getcontentlength>"))
+		Expect(body).To(ContainSubstring("<D:collection/>"))
+		Expect(body).ToNot(ContainSubstring("a.txt"))
+	})
+
+	It("should refuse to list a directory to an infinite depth", func() {
+		for _, depth := range []string{"infinity", ""} {
+			resp := request("PROPFIND", "/dav/", "", "Depth", depth)
+			Expect(resp.Code).To(Equal(http.StatusForbidden))
+			Expect(resp.Body.String()).To(ContainSubstring("<D:propfind-finite-depth/>"))
+			Expect(resp.Body.String()).ToNot(ContainSubstring("hello.txt"))
+		}
+		Expect(request("PROPFIND", "/dav/hello.txt", "", "Depth", "infinity").Code).To(Equal(http.StatusMultiStatus))
+		Expect(request("PROPFIND", "/dav/", "", "Depth", "2").Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should report requested properties, and which are missing", func() {
+		resp := request("PROPFIND", "/dav/hello.txt", `<?xml version="1.0"?>
+<propfind xmlns="DAV:" xmlns:x="urn:x"><prop><getcontentlength/><x:color/></prop></propfind>`, "Depth", "0")
+		Expect(resp.Code).To(Equal(http.StatusMultiStatus))
+		body := resp.Body.String()
+		Expect(body).To(ContainSubstring("<D:getcontentlength>5</D:getcontentlength>"))
+		Expect(body).To(ContainSubstring(`<color xmlns="urn:x"></color>`))
+		Expect(body).To(ContainSubstring("HTTP/1.1 404 Not Found"))
+		Expect(body).ToNot(ContainSubstring("getlastmodified"))
+	})
+
+	It("should create, read, move, and delete files", func() {
+		Expect(request("MKCOL", "/dav/new", "").Code).To(Equal(http.StatusCreated))
+		Expect(request("MKCOL", "/dav/new", "").Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(request(http.MethodPut, "/dav/new/file.txt", "content").Code).To(Equal(http.StatusCreated))
+		Expect(request(http.MethodPut, "/dav/new/file.txt", "changed").Code).To(Equal(http.StatusNoContent))
+		Expect(request(http.MethodGet, "/dav/new/file.txt", "").Body.String()).To(Equal("changed"))
+
+		Expect(request("MOVE", "/dav/new/file.txt", "", "Destination", "http://example.com/dav/hello.txt", "Overwrite", "F").Code).To(Equal(http.StatusPreconditionFailed))
+		Expect(request("MOVE", "/dav/new/file.txt", "", "Destination", "http://example.com/dav/moved.txt").Code).To(Equal(http.StatusCreated))
+		Expect(os.ReadFile(filepath.Join(root, "moved.txt"))).To(Equal([]byte("changed")))
+
+		Expect(request(http.MethodDelete, "/dav/new", "").Code).To(Equal(http.StatusNoContent))
+		Expect(filepath.Join(root, "new")).ToNot(BeADirectory())
+		Expect(request(http.MethodDelete, "/dav/new", "").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should not follow symbolic links when changing files", func() {
+		outside := GinkgoT().TempDir()
+		Expect(os.Symlink(filepath.Join(outside, "planted"), filepath.Join(root, "evil"))).To(Succeed())
+		Expect(os.Symlink(filepath.Join(root, "hello.txt"), filepath.Join(root, "link"))).To(Succeed())
+		Expect(request(http.MethodPut, "/dav/evil", "planted").Code).To(Equal(http.StatusBadRequest))
+		_, err := os.Stat(filepath.Join(outside, "planted"))
+		Expect(err).To(MatchError(os.ErrNotExist))
+		Expect(request("MKCOL", "/dav/evil", "").Code).To(Equal(http.StatusBadRequest))
+		Expect(request(http.MethodDelete, "/dav/link", "").Code).To(Equal(http.StatusBadRequest))
+		Expect(request("MOVE", "/dav/link", "", "Destination", "/dav/moved").Code).To(Equal(http.StatusBadRequest))
+		Expect(os.ReadFile(filepath.Join(root, "hello.txt"))).To(Equal([]byte("hello")))
+	})
+
+	DescribeTable("should refuse invalid changes",
+		func(method, path string, expectedStatus int, headers ...string) {
+			Expect(request(method, path, "", headers...).Code).To(Equal(expectedStatus))
+		},
+		Entry("a file in a missing directory", http.MethodPut, "/dav/missing/file.txt", http.StatusConflict),
+		Entry("a directory in a missing directory", "MKCOL", "/dav/missing/dir", http.StatusConflict),
+		Entry("deleting the root", http.MethodDelete, "/dav/", http.StatusForbidden),
+		Entry("moving outside of the prefix", "MOVE", "/dav/hello.txt", http.StatusBadRequest, "Destination", "/other/hello.txt"),
+		Entry("moving into itself", "MOVE", "/dav/docs", http.StatusForbidden, "Destination", "/dav/docs/inner"),
+		Entry("moving to another host", "MOVE", "/dav/hello.txt", http.StatusBadGateway, "Destination", "http://other.example/dav/x"),
+		Entry("an unsafe path", http.MethodGet, "/dav/docs/%2e%2e/%2e%2e/etc/passwd", http.StatusBadRequest),
+	)
+})
@@ -0,0 +1,194 @@
+package minimux
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultWebhookTolerance is how old a timestamped webhook signature may be if WebhookSignatures.Tolerance is not set
+	DefaultWebhookTolerance = 5 * time.Minute
+	// DefaultWebhookMaxBodyBytes is the largest webhook body that is verified if WebhookSignatures.MaxBodyBytes is not set
+	DefaultWebhookMaxBodyBytes = 10 << 20
+)
+
+// ErrMissingWebhookSignature is returned by a WebhookScheme when a request is not signed
+var ErrMissingWebhookSignature = errors.New("missing webhook signature")
+
+// A WebhookScheme describes how a webhook sender signs requests with HMAC-SHA256
+type WebhookScheme interface {
+	// Signatures returns the signatures claimed by a request, the time they were made, or the zero time
+	// if the scheme does not sign a timestamp, and any data which is signed along with the body, before it
+	Signatures(req *http.Request) (signatures [][]byte, timestamp time.Time, prefix []byte, err error)
+}
+
+// WebhookSchemeFunc wraps a function into a WebhookScheme
+type WebhookSchemeFunc func(req *http.Request) (signatures [][]byte, timestamp time.Time, prefix []byte, err error)
+
+// Signatures implements WebhookScheme
+func (f WebhookSchemeFunc) Signatures(req *http.Request) (signatures [][]byte, timestamp time.Time, prefix []byte, err error) {
+	return f(req)
+}
+
+func parseUnixTimestamp(s string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// GitHubWebhooks is the scheme used by GitHub, which signs the body alone in the X-Hub-Signature-256 header
+var GitHubWebhooks WebhookScheme = WebhookSchemeFunc(func(req *http.Request) ([][]byte, time.Time, []byte, error) {
+	signature, ok := strings.CutPrefix(req.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !ok {
+		return nil, time.Time{}, nil, ErrMissingWebhookSignature
+	}
+	decoded, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	return [][]byte{decoded}, time.Time{}, nil, nil
+})
+
+// StripeWebhooks is the scheme used by Stripe, which signs a timestamp and the body in the Stripe-Signature header
+var StripeWebhooks WebhookScheme = WebhookSchemeFunc(func(req *http.Request) ([][]byte, time.Time, []byte, error) {
+	var timestamp string
+	var signatures [][]byte
+	for _, field := range strings.Split(req.Header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			decoded, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, time.Time{}, nil, err
+			}
+			signatures = append(signatures, decoded)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return nil, time.Time{}, nil, ErrMissingWebhookSignature
+	}
+	t, err := parseUnixTimestamp(timestamp)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	return signatures, t, []byte(timestamp + "."), nil
+})
+
+// SlackWebhooks is the scheme used by Slack, which signs a timestamp from the X-Slack-Request-Timestamp header
+// and the body in the X-Slack-Signature header
+var SlackWebhooks WebhookScheme = WebhookSchemeFunc(func(req *http.Request) ([][]byte, time.Time, []byte, error) {
+	timestamp := req.Header.Get("X-Slack-Request-Timestamp")
+	signature, ok := strings.CutPrefix(req.Header.Get("X-Slack-Signature"), "v0=")
+	if timestamp == "" || !ok {
+		return nil, time.Time{}, nil, ErrMissingWebhookSignature
+	}
+	decoded, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	t, err := parseUnixTimestamp(timestamp)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	return [][]byte{decoded}, t, []byte("v0:" + timestamp + ":"), nil
+})
+
+// WebhookSignatures verifies that webhook requests were signed by a known sender
+type WebhookSignatures struct {
+	// Scheme is how senders sign requests
+	Scheme WebhookScheme
+	// Secrets are the shared secrets of each sender, by name
+	Secrets map[string][]byte
+	// Tolerance is how old, or how far in the future, a timestamped signature may be.
+	// If zero, DefaultWebhookTolerance is used.
+	Tolerance time.Duration
+	// MaxBodyBytes is the largest body which will be verified. If zero, DefaultWebhookMaxBodyBytes is used.
+	MaxBodyBytes int64
+	// BufferThreshold is the number of bytes of the body to hold in memory before moving it to a temporary file.
+	// If zero, DefaultSpillThreshold is used.
+	BufferThreshold int
+}
+
+// Require returns a handler which buffers the body of a request, and, if it was signed by one of the senders,
+// calls another handler with the buffered body and the identity of the sender recorded in the context.
+// Requests which are not signed, or are signed too long ago, are rejected with a 401 status, and requests
+// with bodies which are too large are rejected with a 413 status.
+func (s *WebhookSignatures) Require(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		signatures, timestamp, prefix, err := s.Scheme.Signatures(req)
+		if err != nil {
+			AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodWebhookSignature, Request: req, Reason: err.Error()})
+			w.WriteHeader(http.StatusUnauthorized)
+			return nil
+		}
+		if !timestamp.IsZero() {
+			tolerance := s.Tolerance
+			if tolerance == 0 {
+				tolerance = DefaultWebhookTolerance
+			}
+			if age := time.Since(timestamp); age > tolerance || age < -tolerance {
+				AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodWebhookSignature, Request: req, Reason: "timestamp outside of tolerance"})
+				w.WriteHeader(http.StatusUnauthorized)
+				return nil
+			}
+		}
+
+		maxBodyBytes := s.MaxBodyBytes
+		if maxBodyBytes == 0 {
+			maxBodyBytes = DefaultWebhookMaxBodyBytes
+		}
+		names := make([]string, 0, len(s.Secrets))
+		macs := make([]hash.Hash, 0, len(s.Secrets))
+		writers := make([]io.Writer, 0, len(s.Secrets)+1)
+		body := NewSpillBuffer(s.BufferThreshold)
+		defer body.Close()
+		writers = append(writers, body)
+		for name, secret := range s.Secrets {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(prefix)
+			names = append(names, name)
+			macs = append(macs, mac)
+			writers = append(writers, mac)
+		}
+		n, err := io.Copy(io.MultiWriter(writers...), io.LimitReader(req.Body, maxBodyBytes+1))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return err
+		}
+		if n > maxBodyBytes {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return nil
+		}
+
+		for ix, mac := range macs {
+			sum := mac.Sum(nil)
+			for _, signature := range signatures {
+				if !hmac.Equal(sum, signature) {
+					continue
+				}
+				id := &Identity{Name: names[ix], Method: IdentityMethodWebhookSignature, ID: names[ix]}
+				AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodWebhookSignature, Identity: id, Request: req, Allowed: true, Reason: "valid signature"})
+				ctx = WithIdentity(ctx, id)
+				verified := req.WithContext(ctx)
+				verified.Body = io.NopCloser(body.Reader())
+				return next.ServeHTTP(ctx, w, verified, pathVars, formErr)
+			}
+		}
+		AuditAuthDecision(ctx, AuthDecision{Authenticator: IdentityMethodWebhookSignature, Request: req, Reason: "no valid signature"})
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	})
+}
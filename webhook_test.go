@@ -0,0 +1,72 @@
+package minimux_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func hmacHex(secret, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var _ = Describe("WebhookSignatures", func() {
+	echoSender := minimux.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+		id, _ := minimux.IdentityFromContext(ctx)
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		w.Write([]byte(id.Name + ": " + string(body)))
+		return nil
+	})
+	secrets := map[string][]byte{"alice": []byte("alice-secret"), "bob": []byte("bob-secret")}
+	newRequest := func(body string, headers map[string]string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "https://localhost/hook", strings.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return req
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	DescribeTable("should identify the sender of signed requests",
+		func(scheme minimux.WebhookScheme, headers map[string]string, expectedStatus int, expectedBody string) {
+			mux := &minimux.Mux{
+				Routes: []minimux.Route{
+					minimux.LiteralPath("/hook").IsHandledBy((&minimux.WebhookSignatures{Scheme: scheme, Secrets: secrets, MaxBodyBytes: 16}).Require(echoSender)),
+				},
+			}
+			body := "payload"
+			if expectedStatus == http.StatusRequestEntityTooLarge {
+				body = strings.Repeat("payload", 3)
+			}
+			resp := serve(mux, newRequest(body, headers))
+			Expect(resp.Code).To(Equal(expectedStatus))
+			Expect(resp.Body.String()).To(Equal(expectedBody))
+		},
+		Entry("GitHub", minimux.GitHubWebhooks, map[string]string{"X-Hub-Signature-256": "sha256=" + hmacHex("bob-secret", "payload")}, http.StatusOK, "bob: payload"),
+		Entry("GitHub with an unknown secret", minimux.GitHubWebhooks, map[string]string{"X-Hub-Signature-256": "sha256=" + hmacHex("eve-secret", "payload")}, http.StatusUnauthorized, ""),
+		Entry("GitHub without a signature", minimux.GitHubWebhooks, map[string]string{}, http.StatusUnauthorized, ""),
+		Entry("GitHub with a large body", minimux.GitHubWebhooks, map[string]string{"X-Hub-Signature-256": "sha256=" + hmacHex("bob-secret", strings.Repeat("payload", 3))}, http.StatusRequestEntityTooLarge, ""),
+		Entry("Stripe", minimux.StripeWebhooks, map[string]string{"Stripe-Signature": "t=" + now + ",v1=" + hmacHex("eve-secret", now+".payload") + ",v1=" + hmacHex("alice-secret", now+".payload")}, http.StatusOK, "alice: payload"),
+		Entry("Stripe with an old timestamp", minimux.StripeWebhooks, map[string]string{"Stripe-Signature": "t=" + old + ",v1=" + hmacHex("alice-secret", old+".payload")}, http.StatusUnauthorized, ""),
+		Entry("Stripe with a replaced timestamp", minimux.StripeWebhooks, map[string]string{"Stripe-Signature": "t=" + now + ",v1=" + hmacHex("alice-secret", old+".payload")}, http.StatusUnauthorized, ""),
+		Entry("Slack", minimux.SlackWebhooks, map[string]string{"X-Slack-Request-Timestamp": now, "X-Slack-Signature": "v0=" + hmacHex("alice-secret", "v0:"+now+":payload")}, http.StatusOK, "alice: payload"),
+	)
+})
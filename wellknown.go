@@ -0,0 +1,158 @@
+package minimux
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SecurityTxtPath is the path security.txt is served at
+	SecurityTxtPath = "/.well-known/security.txt"
+	// RobotsTxtPath is the path robots.txt is served at
+	RobotsTxtPath = "/robots.txt"
+	// DefaultSecurityTxtLifetime is how long after a request the security.txt returned by a SecurityTxt expires,
+	// if its Expires is not set
+	DefaultSecurityTxtLifetime = 180 * 24 * time.Hour
+)
+
+// SecurityTxt is a handler which returns a security.txt file, as described in RFC 9116,
+// which tells security researchers how to report vulnerabilities
+type SecurityTxt struct {
+	// Contacts are the URIs to report vulnerabilities to, such as "mailto:security@example.com". At least one is required.
+	Contacts []string
+	// Expires is when the file should no longer be trusted. If zero, it expires DefaultSecurityTxtLifetime after
+	// each request, so that it never becomes stale while it is being served.
+	Expires time.Time
+	// Encryption are optional URIs of keys to encrypt reports with
+	Encryption []string
+	// Acknowledgments are optional URIs of pages thanking reporters
+	Acknowledgments []string
+	// PreferredLanguages are optional language tags reports may be written in
+	PreferredLanguages []string
+	// Canonical are optional URIs the file is served from
+	Canonical []string
+	// Policy are optional URIs of the vulnerability disclosure policy
+	Policy []string
+	// Hiring are optional URIs of security-related job openings
+	Hiring []string
+}
+
+// String returns the contents of the file, with any zero Expires counted from now
+func (s *SecurityTxt) String() string {
+	expires := s.Expires
+	if expires.IsZero() {
+		expires = time.Now().Add(DefaultSecurityTxtLifetime).Truncate(24 * time.Hour)
+	}
+	b := strings.Builder{}
+	writeFields := func(name string, values []string) {
+		for _, value := range values {
+			b.WriteString(name)
+			b.WriteString(": ")
+			b.WriteString(value)
+			b.WriteString("\n")
+		}
+	}
+	writeFields("Contact", s.Contacts)
+	writeFields("Expires", []string{expires.UTC().Format(time.RFC3339)})
+	writeFields("Encryption", s.Encryption)
+	writeFields("Acknowledgments", s.Acknowledgments)
+	if len(s.PreferredLanguages) != 0 {
+		writeFields("Preferred-Languages", []string{strings.Join(s.PreferredLanguages, ", ")})
+	}
+	writeFields("Canonical", s.Canonical)
+	writeFields("Policy", s.Policy)
+	writeFields("Hiring", s.Hiring)
+	return b.String()
+}
+
+// ServeHTTP implements Handler
+func (s *SecurityTxt) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	return serveText(w, s.String())
+}
+
+// RobotsGroup is a group of rules in a robots.txt file, as described in RFC 9309
+type RobotsGroup struct {
+	// UserAgents are the crawlers the rules apply to, or "*" for all crawlers. If empty, "*" is used.
+	UserAgents []string
+	// Allow are the path prefixes the crawlers may visit, overriding any shorter prefix in Disallow
+	Allow []string
+	// Disallow are the path prefixes the crawlers may not visit
+	Disallow []string
+	// CrawlDelay, if non-zero, asks the crawlers to wait between requests. It is not part of RFC 9309,
+	// and is ignored by some crawlers.
+	CrawlDelay time.Duration
+}
+
+// RobotsTxt is a handler which returns a robots.txt file, which tells crawlers which paths they may visit
+type RobotsTxt struct {
+	// Groups are the rules for each set of crawlers
+	Groups []RobotsGroup
+	// Sitemaps are optional absolute URLs of sitemaps
+	Sitemaps []string
+}
+
+// DisallowAllRobots is a RobotsTxt which asks all crawlers to visit nothing
+var DisallowAllRobots = &RobotsTxt{Groups: []RobotsGroup{{Disallow: []string{"/"}}}}
+
+// String returns the contents of the file
+func (r *RobotsTxt) String() string {
+	b := strings.Builder{}
+	for ix, group := range r.Groups {
+		if ix != 0 {
+			b.WriteString("\n")
+		}
+		userAgents := group.UserAgents
+		if len(userAgents) == 0 {
+			userAgents = []string{"*"}
+		}
+		for _, userAgent := range userAgents {
+			b.WriteString("User-agent: " + userAgent + "\n")
+		}
+		for _, path := range group.Allow {
+			b.WriteString("Allow: " + path + "\n")
+		}
+		for _, path := range group.Disallow {
+			b.WriteString("Disallow: " + path + "\n")
+		}
+		if group.CrawlDelay != 0 {
+			b.WriteString("Crawl-delay: " + strconv.Itoa(int(group.CrawlDelay.Seconds())) + "\n")
+		}
+	}
+	if len(r.Sitemaps) != 0 && len(r.Groups) != 0 {
+		b.WriteString("\n")
+	}
+	for _, sitemap := range r.Sitemaps {
+		b.WriteString("Sitemap: " + sitemap + "\n")
+	}
+	return b.String()
+}
+
+// ServeHTTP implements Handler
+func (r *RobotsTxt) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request, pathVars map[string]string, formErr error) error {
+	return serveText(w, r.String())
+}
+
+func serveText(w http.ResponseWriter, text string) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(text)))
+	w.WriteHeader(http.StatusOK)
+	_, err := io.WriteString(w, text)
+	return err
+}
+
+// WellKnownRoutes returns routes which serve a security.txt and robots.txt at their well-known paths,
+// for GET and HEAD requests. Either may be nil, in which case it is not routed.
+func WellKnownRoutes(securityTxt *SecurityTxt, robotsTxt *RobotsTxt) []Route {
+	routes := make([]Route, 0, 2)
+	if securityTxt != nil {
+		routes = append(routes, LiteralPath(SecurityTxtPath).WithMethods(http.MethodGet, http.MethodHead).IsHandledBy(securityTxt))
+	}
+	if robotsTxt != nil {
+		routes = append(routes, LiteralPath(RobotsTxtPath).WithMethods(http.MethodGet, http.MethodHead).IsHandledBy(robotsTxt))
+	}
+	return routes
+}
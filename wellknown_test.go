@@ -0,0 +1,48 @@
+package minimux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/meln5674/minimux"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WellKnownRoutes", func() {
+	mux := &minimux.Mux{
+		Routes: minimux.WellKnownRoutes(
+			&minimux.SecurityTxt{
+				Contacts:           []string{"mailto:security@example.com"},
+				Expires:            time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC),
+				PreferredLanguages: []string{"en", "fr"},
+			},
+			&minimux.RobotsTxt{
+				Groups: []minimux.RobotsGroup{
+					{Disallow: []string{"/admin/"}},
+					{UserAgents: []string{"BadBot"}, Disallow: []string{"/"}},
+				},
+				Sitemaps: []string{"https://example.com/sitemap.xml"},
+			},
+		),
+	}
+
+	It("should serve security.txt", func() {
+		resp := serve(mux, httptest.NewRequest(http.MethodGet, "/.well-known/security.txt", nil))
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+		Expect(resp.Body.String()).To(Equal("Contact: mailto:security@example.com\nExpires: 2030-01-02T00:00:00Z\nPreferred-Languages: en, fr\n"))
+	})
+
+	It("should serve robots.txt", func() {
+		resp := serve(mux, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(Equal("User-agent: *\nDisallow: /admin/\n\nUser-agent: BadBot\nDisallow: /\n\nSitemap: https://example.com/sitemap.xml\n"))
+	})
+
+	It("should expire security.txt in the future by default", func() {
+		Expect((&minimux.SecurityTxt{}).String()).To(ContainSubstring("Expires: " + time.Now().Add(minimux.DefaultSecurityTxtLifetime).UTC().Format("2006-01-02")))
+	})
+})